@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// adminOnly guards admin endpoints with a bearer token. Without a configured
+// token the admin API is disabled altogether.
+func adminOnly(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// maxPatternBytes bounds the size of an uploaded pattern.
+const maxPatternBytes = 1 << 20
+
+// readPattern reads the pattern of a request: the built-in one named by
+// ?pattern=, the picture at ?url=, or the body as a picture, JSON or text
+// depending on its content type. Pictures are scaled to fit a w by h board.
+// It also returns the rule an RLE header names, if any.
+func readPattern(r *http.Request, w, h int) (Pattern, *Rule, error) {
+	if name := r.URL.Query().Get("pattern"); name != "" {
+		lp, ok := library[name]
+		if !ok {
+			return Pattern{}, nil, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown pattern %q", name)}
+		}
+		return lp.Pattern, lp.rule, nil
+	}
+	if u := r.URL.Query().Get("url"); u != "" {
+		p, err := fetchPicture(r, u, w, h)
+		return p, nil, err
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "image/") {
+		p, err := readPicture(r, r.Body, w, h)
+		return p, nil, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPatternBytes+1))
+	if err != nil {
+		return Pattern{}, nil, err
+	}
+	if len(body) > maxPatternBytes {
+		return Pattern{}, nil, &requestError{status: http.StatusRequestEntityTooLarge, msg: "pattern too large"}
+	}
+	var p Pattern
+	var rule *Rule
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err = json.Unmarshal(body, &p)
+	} else {
+		p, rule, err = ParsePattern(string(body))
+	}
+	if err != nil {
+		return Pattern{}, nil, &requestError{status: http.StatusBadRequest, msg: err.Error()}
+	}
+	return p, rule, nil
+}
+
+type boardJSON struct {
+	Generation uint64 `json:"generation"`
+	Population int    `json:"population"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+}
+
+// readPlacement reads a request's pattern, the rule it names if any, and
+// where on the room's board it goes: centred unless ?x= and ?y= place its
+// top-left corner.
+func readPlacement(room *GameRender, r *http.Request) (p Pattern, rule *Rule, x, y int, err error) {
+	w, h := room.Size()
+	if p, rule, err = readPattern(r, w, h); err != nil {
+		return Pattern{}, nil, 0, 0, err
+	}
+	if p.W > w || p.H > h {
+		return Pattern{}, nil, 0, 0, &requestError{
+			status: http.StatusBadRequest,
+			msg:    fmt.Sprintf("pattern is %dx%d, board is %dx%d", p.W, p.H, w, h),
+		}
+	}
+	if x, err = intParam(r, "x", (w-p.W)/2); err != nil {
+		return Pattern{}, nil, 0, 0, err
+	}
+	if y, err = intParam(r, "y", (h-p.H)/2); err != nil {
+		return Pattern{}, nil, 0, 0, err
+	}
+	return p, rule, x, y, nil
+}
+
+func writeBoardJSON(w http.ResponseWriter, room *GameRender, gen uint64) {
+	w.Header().Set("Content-Type", "application/json")
+	b := room.history.Latest().Board
+	if err := json.NewEncoder(w).Encode(boardJSON{Generation: gen, Population: b.Population(), Width: len(b), Height: len(b[0])}); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// boardHandle replaces a room's board with a pattern.
+func boardHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, rule, x, y, err := readPlacement(room, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	gen, err := room.Replace(p, rule, x, y)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeBoardJSON(w, room, gen)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"image/color"
+	"math"
+)
+
+// maxAge is the age cells stop counting at.
+const maxAge = math.MaxUint16
+
+// ageSpan is the age, in generations, at which mode=age draws a cell fully in
+// the palette's Alt colour.
+const ageSpan = 256
+
+// AgeBoard holds, indexed like Board, how many generations each live cell has
+// been alive for: 1 for a cell born this generation, 0 for a dead one.
+type AgeBoard [][]uint16
+
+// next returns the ages of b's cells, given that a holds the ages of the
+// generation before. Cells of a board of another size start over at 1.
+func (a AgeBoard) next(b Board) AgeBoard {
+	same := len(a) == len(b) && (len(b) == 0 || len(a[0]) == len(b[0]))
+	ages := make(AgeBoard, len(b))
+	for i, col := range b {
+		ages[i] = make([]uint16, len(col))
+		for j, alive := range col {
+			switch {
+			case !alive:
+			case same && a[i][j] < maxAge:
+				ages[i][j] = a[i][j] + 1
+			case same:
+				ages[i][j] = maxAge
+			default:
+				ages[i][j] = 1
+			}
+		}
+	}
+	return ages
+}
+
+// ageColor is the fill of a cell age generations old: the palette's Born
+// colour when just born, then its Alive colour moving towards Alt on a
+// logarithmic scale up to ageSpan, so still lifes stand out from the churn
+// around them.
+func ageColor(pal *Palette, age uint16) color.RGBA {
+	if age <= 1 {
+		return pal.Born
+	}
+	k := math.Min(1, math.Log(float64(age))/math.Log(ageSpan))
+	return mixColor(pal.Alt, pal.Alive, k)
+}
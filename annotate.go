@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+const (
+	// maxAnnotations bounds how many annotations a room keeps.
+	maxAnnotations = 32
+	// maxAnnotationText bounds an annotation's text, in characters.
+	maxAnnotationText = 40
+)
+
+// labelInk is the colour labels are written and pointed in, the captions'.
+var labelInk = color.RGBA{R: 200, A: 255}
+
+// Annotation is text pinned to a cell of a room's board, drawn as a label
+// with a line to the cell by styles that show labels.
+type Annotation struct {
+	ID   int    `json:"id"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	Text string `json:"text"`
+}
+
+// Annotations are a room's annotations, kept by an AnnotationStore under the
+// room's name.
+type Annotations struct {
+	store *AnnotationStore
+
+	mu    sync.Mutex
+	next  int
+	notes []Annotation
+}
+
+// Add keeps n under a new ID, which it returns n with.
+func (a *Annotations) Add(n Annotation) (Annotation, error) {
+	a.mu.Lock()
+	if len(a.notes) >= maxAnnotations {
+		a.mu.Unlock()
+		return Annotation{}, &requestError{status: http.StatusConflict, msg: fmt.Sprintf("room already has %d annotations", maxAnnotations)}
+	}
+	a.next++
+	n.ID = a.next
+	a.notes = append(a.notes, n)
+	a.mu.Unlock()
+	a.store.changed()
+	return n, nil
+}
+
+// Remove drops the annotation with the given ID, reporting whether there was
+// one.
+func (a *Annotations) Remove(id int) bool {
+	a.mu.Lock()
+	for i, n := range a.notes {
+		if n.ID == id {
+			a.notes = append(a.notes[:i:i], a.notes[i+1:]...)
+			a.mu.Unlock()
+			a.store.changed()
+			return true
+		}
+	}
+	a.mu.Unlock()
+	return false
+}
+
+// List returns the annotations in the order they were added, nil if there
+// are none.
+func (a *Annotations) List() []Annotation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.notes) == 0 {
+		return nil
+	}
+	return append([]Annotation(nil), a.notes...)
+}
+
+// annotationsKey is the Storage key annotations are kept under.
+const annotationsKey = "annotations"
+
+// annotationsJSON is how a room's annotations are saved.
+type annotationsJSON struct {
+	Next  int          `json:"next"`
+	Notes []Annotation `json:"notes"`
+}
+
+// AnnotationStore keeps every room's annotations by room name, saving them to
+// its Storage, if it has one, after they change. A room that is reaped or
+// lost to a restart gets its annotations back when it starts again.
+type AnnotationStore struct {
+	task *Task
+
+	mu      sync.Mutex
+	storage Storage
+	rooms   map[string]*Annotations
+	dirty   bool
+}
+
+func NewAnnotationStore(st Storage) (*AnnotationStore, error) {
+	s := &AnnotationStore{storage: st, rooms: make(map[string]*Annotations)}
+	if st != nil {
+		data, err := st.Get(annotationsKey)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			var saved map[string]annotationsJSON
+			if err := json.Unmarshal(data, &saved); err != nil {
+				return nil, fmt.Errorf("%s: %w", annotationsKey, err)
+			}
+			for room, a := range saved {
+				s.rooms[room] = &Annotations{store: s, next: a.Next, notes: a.Notes}
+			}
+		}
+	}
+	s.task = scheduler.Every(time.Minute, func() {
+		if err := s.Save(); err != nil {
+			fmt.Println(err)
+		}
+	})
+	return s, nil
+}
+
+// For returns the named room's annotations. A nil store keeps them in memory
+// for as long as the room.
+func (s *AnnotationStore) For(room string) *Annotations {
+	if s == nil {
+		return &Annotations{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.rooms[room]
+	if !ok {
+		a = &Annotations{store: s}
+		s.rooms[room] = a
+	}
+	return a
+}
+
+func (s *AnnotationStore) changed() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+}
+
+// Save writes the annotations to the store's Storage if they changed since
+// it last did, leaving out rooms that have none.
+func (s *AnnotationStore) Save() error {
+	s.mu.Lock()
+	if s.storage == nil || !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	saved := make(map[string]annotationsJSON)
+	for room, a := range s.rooms {
+		a.mu.Lock()
+		if len(a.notes) > 0 {
+			saved[room] = annotationsJSON{Next: a.next, Notes: append([]Annotation(nil), a.notes...)}
+		}
+		a.mu.Unlock()
+	}
+	s.dirty = false
+	s.mu.Unlock()
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return s.storage.Put(annotationsKey, data)
+}
+
+func (s *AnnotationStore) Close() {
+	s.task.Stop()
+	if err := s.Save(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func clamp(v, lo, hi int) int {
+	if v > hi {
+		v = hi
+	}
+	if v < lo {
+		v = lo
+	}
+	return v
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// labelLayout places the w by h box of a label for n on a frame drawn k
+// pixels per cell: up and to the right of the cell, across whichever way
+// keeps it on the frame. It returns the middle of the cell, the point on the
+// box nearest it, and the box; the leader line runs between the two points.
+func (f Frame) labelLayout(n Annotation, k, w, h int) (from, to image.Point, box image.Rectangle) {
+	fw, fh := k*len(f.Board), k*len(f.Board[0])
+	from = image.Pt(n.X*k+k/2, n.Y*k+k/2)
+	gap := 2 * k
+	if gap < 8 {
+		gap = 8
+	}
+	x, y := from.X+gap, from.Y-gap-h
+	if x+w > fw {
+		x = from.X - gap - w
+	}
+	if y < 0 {
+		y = from.Y + gap
+	}
+	x, y = clamp(x, 0, fw-w), clamp(y, 0, fh-h)
+	box = image.Rect(x, y, x+w, y+h)
+	to = image.Pt(clamp(from.X, box.Min.X, box.Max.X-1), clamp(from.Y, box.Min.Y, box.Max.Y-1))
+	return from, to, box
+}
+
+// drawLine draws a one pixel line from a to b.
+func drawLine(img draw.Image, a, b image.Point, c color.RGBA) {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	n := abs(dx)
+	if abs(dy) > n {
+		n = abs(dy)
+	}
+	img.Set(a.X, a.Y, c)
+	for i := 1; i <= n; i++ {
+		img.Set(a.X+dx*i/n, a.Y+dy*i/n, c)
+	}
+}
+
+func (f Frame) drawLabels(img draw.Image, k int) {
+	px := k / 3
+	if px < 2 {
+		px = 2
+	}
+	back := &image.Uniform{C: color.RGBA{R: 255, G: 255, B: 255, A: 200}}
+	ink := &image.Uniform{C: labelInk}
+	for _, n := range f.Notes {
+		w, h := textWidth(n.Text)*px+2*px, glyphHeight*px+2*px
+		from, to, box := f.labelLayout(n, k, w, h)
+		outline(img, image.Rect(n.X*k, n.Y*k, (n.X+1)*k, (n.Y+1)*k), labelInk)
+		drawLine(img, from, to, labelInk)
+		draw.Draw(img, box, back, image.Point{}, draw.Over)
+		textPixels(n.Text, func(x, y int) {
+			x, y = box.Min.X+px+x*px, box.Min.Y+px+y*px
+			draw.Draw(img, image.Rect(x, y, x+px, y+px), ink, image.Point{}, draw.Src)
+		})
+	}
+}
+
+func (f Frame) svgLabels(canvas *svg.SVG, k int) {
+	ink := svgColor(labelInk)
+	for _, n := range f.Notes {
+		from, to, box := f.labelLayout(n, k, 7*len([]rune(n.Text))+8, 18)
+		canvas.Rect(n.X*k, n.Y*k, k, k, `fill="none"`, `stroke="`+ink+`"`)
+		canvas.Line(from.X, from.Y, to.X, to.Y, `stroke="`+ink+`"`)
+		canvas.Rect(box.Min.X, box.Min.Y, box.Dx(), box.Dy(), `fill="white"`, `fill-opacity="0.8"`, `stroke="`+ink+`"`)
+		canvas.Text(box.Min.X+4, box.Min.Y+9, n.Text,
+			`font-size="12"`, `font-family="monospace"`, `fill="`+ink+`"`,
+			`dominant-baseline="middle"`,
+		)
+	}
+}
+
+func labelsParam(r *http.Request, def bool) (bool, error) {
+	s := r.URL.Query().Get("labels")
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("labels must be true or false, not %q", s)}
+	}
+	return v, nil
+}
+
+func writeAnnotations(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// annotationsJSONHandle lists a room's annotations for /annotations.json.
+func annotationsJSONHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	notes := room.notes.List()
+	if notes == nil {
+		notes = []Annotation{}
+	}
+	writeAnnotations(w, http.StatusOK, notes)
+}
+
+// annotationsHandle manages a room's annotations for /admin/annotations:
+// GET lists them, POST adds the one in its JSON body and DELETE drops the
+// one with ?id=.
+func annotationsHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		annotationsJSONHandle(room, w, r)
+	case http.MethodPost:
+		var n Annotation
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&n); err != nil {
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: err.Error()})
+			return
+		}
+		n.Text = strings.TrimSpace(n.Text)
+		width, height := room.Size()
+		switch {
+		case n.Text == "":
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: "annotation has no text"})
+			return
+		case len([]rune(n.Text)) > maxAnnotationText:
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("annotation text is longer than %d characters", maxAnnotationText)})
+			return
+		case n.X < 0 || n.X >= width || n.Y < 0 || n.Y >= height:
+			writeError(w, r, &requestError{
+				status: http.StatusBadRequest,
+				msg:    fmt.Sprintf("cell %d,%d is off the %dx%d board", n.X, n.Y, width, height),
+			})
+			return
+		}
+		n, err := room.notes.Add(n)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeAnnotations(w, http.StatusCreated, n)
+	case http.MethodDelete:
+		id, err := intParam(r, "id", 0)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if !room.notes.Remove(id) {
+			writeError(w, r, &requestError{status: http.StatusNotFound, msg: fmt.Sprintf("no annotation %d", id)})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotationStoreRoundTrip(t *testing.T) {
+	st := &FileStorage{Dir: t.TempDir()}
+	s, err := NewAnnotationStore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := s.For("room")
+	for _, text := range []string{"one", "two", "three"} {
+		if _, err := a.Add(Annotation{X: 1, Y: 2, Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Remove(2)
+	s.For("empty")
+	want := a.List()
+	s.Close()
+
+	again, err := NewAnnotationStore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	b := again.For("room")
+	if got := b.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("annotations came back as %v, want %v", got, want)
+	}
+	if n, err := b.Add(Annotation{Text: "four"}); err != nil || n.ID != 4 {
+		t.Errorf("next annotation got ID %d, %v, want 4", n.ID, err)
+	}
+	if got := again.For("empty").List(); got != nil {
+		t.Errorf("room without annotations came back with %v", got)
+	}
+}
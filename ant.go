@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+const (
+	// maxAntWorlds bounds how many ant worlds run at once.
+	maxAntWorlds = 8
+	maxAnts      = 16
+	// maxAntTurns bounds the turn string, and so the number of cell colours.
+	maxAntTurns = 12
+	// antStepsPerTick is how many steps each ant takes between frames.
+	antStepsPerTick = 20
+)
+
+// antHeadings are the directions an ant faces, clockwise from north, as cell
+// offsets.
+var antHeadings = [4][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+
+// Ant is a Langton's ant: where it is and which of antHeadings it faces.
+type Ant struct {
+	X, Y    int
+	Heading int
+}
+
+// AntRule is a generalised Langton's ant rule: on a cell of colour i an ant
+// turns right for an R at position i of Turns and left for an L, recolours
+// the cell i+1 (wrapping round) and steps forward. "RL" is Langton's own.
+type AntRule struct {
+	Turns string
+	Ants  int
+}
+
+func ParseAntRule(turns string, ants int) (AntRule, error) {
+	turns = strings.ToUpper(strings.TrimSpace(turns))
+	if len(turns) < 2 || len(turns) > maxAntTurns || strings.Trim(turns, "LR") != "" {
+		return AntRule{}, fmt.Errorf("bad turns %q: want 2 to %d of L and R, like RLLR", turns, maxAntTurns)
+	}
+	if ants < 1 || ants > maxAnts {
+		return AntRule{}, fmt.Errorf("ants must be between 1 and %d", maxAnts)
+	}
+	return AntRule{Turns: turns, Ants: ants}, nil
+}
+
+func (a AntRule) String() string {
+	return fmt.Sprintf("%s/%d", a.Turns, a.Ants)
+}
+
+// AntWorld runs ants on a torus of coloured cells for /ant.svg, pausing while
+// nobody watches.
+type AntWorld struct {
+	rule AntRule
+	task *Task
+
+	mu          sync.Mutex
+	cells       [][]uint8
+	ants        []Ant
+	steps       uint64
+	subscribers map[chan<- ImageBundle]*Session
+}
+
+// NewAntWorld starts rule's ants on a blank board, spread evenly across its
+// middle row and facing north.
+func NewAntWorld(rule AntRule) *AntWorld {
+	aw := &AntWorld{
+		rule:        rule,
+		cells:       make([][]uint8, defaultWidth),
+		subscribers: make(map[chan<- ImageBundle]*Session),
+	}
+	for i := range aw.cells {
+		aw.cells[i] = make([]uint8, defaultHeight)
+	}
+	for i := 0; i < rule.Ants; i++ {
+		aw.ants = append(aw.ants, Ant{X: (2*i + 1) * defaultWidth / (2 * rule.Ants), Y: defaultHeight / 2})
+	}
+	aw.task = scheduler.NewTask(time.Second, aw.tick)
+	aw.Start()
+	return aw
+}
+
+func (aw *AntWorld) Start() {
+	aw.task.Start()
+}
+
+func (aw *AntWorld) Close() {
+	aw.task.Stop()
+}
+
+// Step moves every ant once, in order, so ants meeting on a cell each turn by
+// the colour the one before left.
+func (aw *AntWorld) Step() {
+	w, h := len(aw.cells), len(aw.cells[0])
+	n := uint8(len(aw.rule.Turns))
+	for i := range aw.ants {
+		a := &aw.ants[i]
+		c := aw.cells[a.X][a.Y]
+		if aw.rule.Turns[c] == 'R' {
+			a.Heading = (a.Heading + 1) % 4
+		} else {
+			a.Heading = (a.Heading + 3) % 4
+		}
+		aw.cells[a.X][a.Y] = (c + 1) % n
+		d := antHeadings[a.Heading]
+		a.X, a.Y = (a.X+d[0]+w)%w, (a.Y+d[1]+h)%h
+	}
+	aw.steps++
+}
+
+// antColor is the colour of cells of colour c of n: the palette's live colour
+// shading into its alternate one.
+func antColor(pal *Palette, c, n uint8) color.RGBA {
+	if n <= 2 {
+		return pal.Alive
+	}
+	return mixColor(pal.Alt, pal.Alive, float64(c-1)/float64(n-2))
+}
+
+// svg draws the cells, leaving colour 0 blank, and the ants over them. It
+// also returns how many cells are coloured.
+func (aw *AntWorld) svg(k int) ([]byte, int) {
+	pal := Style{}.palette()
+	n := uint8(len(aw.rule.Turns))
+	var buf bytes.Buffer
+	canvas := svg.New(&buf)
+	canvas.Start(k*len(aw.cells), k*len(aw.cells[0]))
+	if pal.Background.A > 0 {
+		canvas.Rect(0, 0, k*len(aw.cells), k*len(aw.cells[0]), `fill="`+svgColor(pal.Background)+`"`)
+	}
+	coloured := 0
+	for i, col := range aw.cells {
+		for j, c := range col {
+			if c != 0 {
+				coloured++
+				canvas.Rect(i*k, j*k, k, k, `fill="`+svgColor(antColor(pal, c, n))+`"`)
+			}
+		}
+	}
+	for _, a := range aw.ants {
+		canvas.Rect(a.X*k, a.Y*k, k, k, `fill="`+svgColor(pal.Dying)+`"`)
+	}
+	canvas.End()
+	return buf.Bytes(), coloured
+}
+
+func (aw *AntWorld) tick() {
+	if d := budget.Interval(time.Second); d != aw.task.Interval() {
+		aw.task.SetInterval(d)
+	}
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if len(aw.subscribers) == 0 {
+		aw.task.Pause()
+		return
+	}
+
+	defer budget.Track(time.Now())
+	for i := 0; i < antStepsPerTick; i++ {
+		aw.Step()
+	}
+	data, coloured := aw.svg(defaultScale)
+	bundle := ImageBundle{
+		Data:        data,
+		ContentType: "image/svg+xml",
+		Generation:  aw.steps,
+		Population:  coloured,
+		Time:        time.Now(),
+	}
+	for ch, s := range aw.subscribers {
+		offer(ch, s, bundle)
+	}
+}
+
+func (aw *AntWorld) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat("svg")
+	leave := viewerCounts.Join(s, "ant/"+aw.rule.String())
+	aw.mu.Lock()
+	aw.subscribers[c] = s
+	aw.task.Resume()
+	aw.mu.Unlock()
+	return func() {
+		aw.mu.Lock()
+		delete(aw.subscribers, c)
+		aw.mu.Unlock()
+		leave()
+	}
+}
+
+// AntWorlds starts an AntWorld per rule asked for.
+type AntWorlds struct {
+	mu     sync.Mutex
+	byRule map[AntRule]*AntWorld
+}
+
+func NewAntWorlds() *AntWorlds {
+	return &AntWorlds{byRule: make(map[AntRule]*AntWorld)}
+}
+
+func (aws *AntWorlds) get(rule AntRule) (*AntWorld, error) {
+	aws.mu.Lock()
+	defer aws.mu.Unlock()
+	if aw, ok := aws.byRule[rule]; ok {
+		return aw, nil
+	}
+	if len(aws.byRule) >= maxAntWorlds {
+		return nil, &requestError{status: http.StatusServiceUnavailable, msg: fmt.Sprintf("%d ant worlds are already running", maxAntWorlds)}
+	}
+	aw := NewAntWorld(rule)
+	aws.byRule[rule] = aw
+	return aw, nil
+}
+
+func (aws *AntWorlds) Close() {
+	aws.mu.Lock()
+	defer aws.mu.Unlock()
+	for _, aw := range aws.byRule {
+		aw.Close()
+	}
+}
+
+// Handle streams /ant.svg with ?ants= ants following ?turns=, one RL ant by
+// default.
+func (aws *AntWorlds) Handle(w http.ResponseWriter, r *http.Request) {
+	turns := r.URL.Query().Get("turns")
+	if turns == "" {
+		turns = "RL"
+	}
+	ants, err := intParam(r, "ants", 1)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rule, err := ParseAntRule(turns, ants)
+	if err != nil {
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: err.Error()})
+		return
+	}
+	aw, err := aws.get(rule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	streamHandleFunc(aw)(w, r)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// benchRun is how long each engine runs on each board size, at most.
+const benchRun = 200 * time.Millisecond
+
+// benchSizes are the square boards /admin/bench evolves, either side of where
+// Evolute switches passes.
+var benchSizes = []int{64, 128, 200, 300, 500}
+
+// benchEngines evolve a board once from a seeded soup, returning a function
+// advancing it a generation at a time.
+var benchEngines = []struct {
+	name  string
+	start func(b Board) func()
+}{
+	{"table", func(b Board) func() {
+		t := Conway.tables()
+		return func() { b = evoluteTable(b, t) }
+	}},
+	{"counts", func(b Board) func() {
+		t := Conway.tables()
+		return func() { b = evoluteCounts(b, t) }
+	}},
+	{"parallel", func(b Board) func() {
+		return func() { b = Conway.Evolute(b) }
+	}},
+	{"buffered", func(b Board) func() {
+		var spare Board
+		return func() { b, spare = Conway.EvoluteInto(spare, b), b }
+	}},
+	{"hashlife", func(b Board) func() {
+		h := NewHashLife(Conway, 0)
+		h.StampBoard(b, 0, 0)
+		return h.Step
+	}},
+}
+
+type benchResult struct {
+	Engine          string  `json:"engine"`
+	Width           int     `json:"width"`
+	Height          int     `json:"height"`
+	Generations     int     `json:"generations"`
+	NsPerGeneration float64 `json:"nsPerGeneration"`
+	CellsPerSecond  float64 `json:"cellsPerSecond"`
+}
+
+type benchJSON struct {
+	GOOS       string        `json:"goos"`
+	GOARCH     string        `json:"goarch"`
+	CPUs       int           `json:"cpus"`
+	GOMAXPROCS int           `json:"gomaxprocs"`
+	Results    []benchResult `json:"results"`
+	// Fastest names the fastest engine for each size, CountPassCells the
+	// board area from which rooms use the count pass, and ParallelCells the
+	// area from which they step it in bands on every CPU.
+	Fastest        map[string]string `json:"fastest"`
+	CountPassCells int               `json:"countPassCells"`
+	ParallelCells  int               `json:"parallelCells"`
+}
+
+// Bench evolves the same seeded soups with every engine for a short while
+// each. HashLife runs one generation per step on an unbounded plane, so its
+// soups can grow past the board, but it shows how it compares on this host.
+func Bench() benchJSON {
+	resp := benchJSON{
+		GOOS:           runtime.GOOS,
+		GOARCH:         runtime.GOARCH,
+		CPUs:           runtime.NumCPU(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		Fastest:        make(map[string]string),
+		CountPassCells: countPassCells,
+		ParallelCells:  parallelCells,
+	}
+	for _, size := range benchSizes {
+		best := 0.0
+		for _, engine := range benchEngines {
+			step := engine.start(NewSeededBoard(size, size, 1))
+			start := time.Now()
+			n := 0
+			for n == 0 || time.Since(start) < benchRun {
+				step()
+				n++
+			}
+			elapsed := time.Since(start)
+			res := benchResult{
+				Engine:          engine.name,
+				Width:           size,
+				Height:          size,
+				Generations:     n,
+				NsPerGeneration: float64(elapsed.Nanoseconds()) / float64(n),
+				CellsPerSecond:  float64(size*size*n) / elapsed.Seconds(),
+			}
+			resp.Results = append(resp.Results, res)
+			if res.CellsPerSecond > best {
+				best = res.CellsPerSecond
+				resp.Fastest[fmt.Sprintf("%dx%d", size, size)] = engine.name
+			}
+		}
+	}
+	return resp
+}
+
+// benchSlot lets one benchmark run at a time.
+var benchSlot = make(chan struct{}, 1)
+
+// benchHandle runs Bench for /admin/bench. It takes a few seconds of CPU.
+func benchHandle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	select {
+	case benchSlot <- struct{}{}:
+		defer func() { <-benchSlot }()
+	default:
+		writeError(w, r, &requestError{status: http.StatusServiceUnavailable, msg: "a benchmark is already running"})
+		return
+	}
+	resp := Bench()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Println(err)
+	}
+}
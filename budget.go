@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// budgetWindow is how often the CPU budget measures usage and adjusts.
+	budgetWindow = 5 * time.Second
+	// maxStretch is the most the budget slows ticks down by.
+	maxStretch = 8
+)
+
+// CPUBudget limits how much CPU time ticks and encoders use, as a number of
+// CPUs. When usage goes over the limit it stretches tick intervals and sheds
+// optional work, and recovers gradually once usage drops well below it.
+type CPUBudget struct {
+	limit float64
+	spent int64 // nanoseconds, updated atomically
+
+	mu      sync.Mutex
+	stretch float64
+	usage   float64
+}
+
+var budget = &CPUBudget{stretch: 1}
+
+// Start enforces a limit of cpus, or accounts without limiting when cpus is
+// zero.
+func (b *CPUBudget) Start(cpus float64) {
+	b.limit = cpus
+	last := time.Now()
+	scheduler.Every(budgetWindow, func() {
+		now := time.Now()
+		spent := time.Duration(atomic.SwapInt64(&b.spent, 0))
+		b.adjust(spent.Seconds() / now.Sub(last).Seconds())
+		last = now
+	})
+}
+
+func (b *CPUBudget) adjust(usage float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.usage = usage
+	from := b.stretch
+	switch {
+	case b.limit <= 0:
+	case usage > b.limit && b.stretch < maxStretch:
+		b.stretch *= 1.5
+		if b.stretch > maxStretch {
+			b.stretch = maxStretch
+		}
+	case usage < 0.7*b.limit && b.stretch > 1:
+		b.stretch /= 1.25
+		if b.stretch < 1.05 {
+			b.stretch = 1
+		}
+	}
+	if b.stretch != from {
+		log.Printf("cpu budget: using %.3g of %g cpus, ticks stretched %.2fx", usage, b.limit, b.stretch)
+	}
+	metrics.SetCPUBudget(usage, b.stretch)
+}
+
+// Track charges the time since start to the budget.
+func (b *CPUBudget) Track(start time.Time) {
+	atomic.AddInt64(&b.spent, int64(time.Since(start)))
+}
+
+// Interval stretches a tick interval to fit the budget.
+func (b *CPUBudget) Interval(d time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Duration(float64(d) * b.stretch)
+}
+
+// Throttled reports whether optional work should be skipped.
+func (b *CPUBudget) Throttled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stretch > 1
+}
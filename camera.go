@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"net/http"
+)
+
+const (
+	// heatDecay is how much of a cell's activity is left a frame later.
+	heatDecay = 0.8
+	// cameraDamping is how far the camera moves towards where the activity
+	// is each frame.
+	cameraDamping = 0.15
+	// maxZoom is how many times the camera magnifies the board, at most.
+	maxZoom = 4
+)
+
+// Heatmap is how active each cell of a board has been lately: every change
+// adds one, and every frame the activity decays by heatDecay.
+type Heatmap struct {
+	W, H int
+	Heat []float64
+}
+
+// Add decays the heatmap and adds the changes from f.Prev to f.Board.
+func (m *Heatmap) Add(f Frame) {
+	w, h := len(f.Board), len(f.Board[0])
+	if m.W != w || m.H != h {
+		*m = Heatmap{W: w, H: h, Heat: make([]float64, w*h)}
+	}
+	for i, col := range f.Board {
+		for j, alive := range col {
+			v := m.Heat[i*h+j] * heatDecay
+			if f.Prev != nil && f.Prev.Get(i, j) != alive {
+				v++
+			}
+			m.Heat[i*h+j] = v
+		}
+	}
+}
+
+// spread returns the centre of the activity and how far it spreads each way,
+// two standard deviations, in cells, and false if there is none.
+func (m *Heatmap) spread() (cx, cy, sx, sy float64, ok bool) {
+	var sum, x, y, xx, yy float64
+	for i := 0; i < m.W; i++ {
+		for j := 0; j < m.H; j++ {
+			v := m.Heat[i*m.H+j]
+			fi, fj := float64(i)+0.5, float64(j)+0.5
+			sum += v
+			x, y = x+v*fi, y+v*fj
+			xx, yy = xx+v*fi*fi, yy+v*fj*fj
+		}
+	}
+	if sum < 1 {
+		return 0, 0, 0, 0, false
+	}
+	cx, cy = x/sum, y/sum
+	sx = 2 * math.Sqrt(math.Max(0, xx/sum-cx*cx))
+	sy = 2 * math.Sqrt(math.Max(0, yy/sum-cy*cy))
+	return cx, cy, sx, sy, true
+}
+
+// camera follows a board's activity for zoom=auto streams, zooming in where
+// it is concentrated and out as it spreads, easing towards each new view so
+// the picture never jumps.
+type camera struct {
+	heat       Heatmap
+	cx, cy     float64
+	span       float64 // width of the view, in cells
+	positioned bool
+}
+
+// follow adds f to the heatmap and returns the view to draw f with, in
+// pixels of a frame drawn k pixels per cell.
+func (c *camera) follow(f Frame, k int) image.Rectangle {
+	c.heat.Add(f)
+	w, h := float64(len(f.Board)), float64(len(f.Board[0]))
+	tx, ty, tspan := w/2, h/2, w
+	if cx, cy, sx, sy, ok := c.heat.spread(); ok {
+		// The view keeps the board's aspect, wide enough for the activity
+		// both ways with a cell of margin all round.
+		tx, ty = cx, cy
+		tspan = math.Max(2*sx, 2*sy*w/h) + 2
+		tspan = math.Max(w/maxZoom, math.Min(w, tspan))
+	}
+	if !c.positioned {
+		c.cx, c.cy, c.span, c.positioned = w/2, h/2, w, true
+	}
+	c.cx += (tx - c.cx) * cameraDamping
+	c.cy += (ty - c.cy) * cameraDamping
+	c.span += (tspan - c.span) * cameraDamping
+
+	fw, fh := k*len(f.Board), k*len(f.Board[0])
+	pw := int(math.Round(c.span * float64(k)))
+	ph := pw * fh / fw
+	x := clamp(int((c.cx-c.span/2)*float64(k)), 0, fw-pw)
+	y := clamp(int((c.cy-c.span*h/w/2)*float64(k)), 0, fh-ph)
+	return image.Rect(x, y, x+pw, y+ph)
+}
+
+// zoomed scales the view of src up to src's size, nearest neighbour.
+func zoomed(src *image.RGBA, view image.Rectangle) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	for y := 0; y < b.Dy(); y++ {
+		sy := view.Min.Y + y*view.Dy()/b.Dy()
+		for x := 0; x < b.Dx(); x++ {
+			sx := view.Min.X + x*view.Dx()/b.Dx()
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+func zoomParam(r *http.Request, def bool) (bool, error) {
+	switch z := r.URL.Query().Get("zoom"); z {
+	case "":
+		return def, nil
+	case "auto":
+		return true, nil
+	default:
+		return false, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown zoom %q, want auto", z)}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseCells parses a pattern in the plaintext .cells format used by
+// LifeWiki: lines starting with ! are comments, and every other line is a
+// row of cells, O (or *) alive and . dead. Rows may be shorter than the
+// widest one.
+func ParseCells(s string) (Pattern, error) {
+	var p Pattern
+	y := 0
+	for n, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		for x, c := range line {
+			switch c {
+			case 'O', 'o', '*':
+				p.Cells = append(p.Cells, [2]int{x, y})
+			case '.':
+			default:
+				return Pattern{}, fmt.Errorf("cells: line %d: unexpected %q", n+1, c)
+			}
+			if x >= p.W {
+				p.W = x + 1
+			}
+		}
+		y++
+	}
+	// Trailing blank lines are the end of the file, not empty rows.
+	for _, c := range p.Cells {
+		if c[1] >= p.H {
+			p.H = c[1] + 1
+		}
+	}
+	return p, nil
+}
+
+// ParsePattern parses a pattern in whichever of RLE, Life 1.06 and plaintext
+// .cells s is written in, and returns the rule an RLE header names, if any.
+func ParsePattern(s string) (Pattern, *Rule, error) {
+	switch patternFormat(s) {
+	case "life106":
+		p, err := ParseLife106(s)
+		return p, nil, err
+	case "cells":
+		p, err := ParseCells(s)
+		return p, nil, err
+	}
+	return ParseRLEWithRule(s)
+}
+
+// patternFormat guesses the format of a pattern: "life106" for the #Life 1.06
+// header, "cells" for a .cells comment or a first row of only O, * and .,
+// and otherwise "rle".
+func patternFormat(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#Life 1.06"):
+			return "life106"
+		case strings.HasPrefix(line, "!"):
+			return "cells"
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.Trim(line, "O*.") == "":
+			return "cells"
+		}
+		return "rle"
+	}
+	return "rle"
+}
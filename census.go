@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/draw"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+// vectorGain is how many cells long a velocity vector is drawn per cell per
+// generation of speed.
+const vectorGain = 16
+
+// Ship is a moving object of a census: its bounding box, whose corner wraps
+// on a torus, and the DX, DY it moves by every Period generations.
+type Ship struct {
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	W          int    `json:"w"`
+	H          int    `json:"h"`
+	Population int    `json:"population"`
+	Period     int    `json:"period"`
+	DX         int    `json:"dx"`
+	DY         int    `json:"dy"`
+	Speed      string `json:"speed"`
+	Heading    string `json:"heading"`
+}
+
+// Census sorts a board's objects, groups of touching live cells, by how they
+// repeat: in place every generation, in place every few, or moved. The rest
+// have not repeated within maxCyclePeriod generations.
+type Census struct {
+	Generation  uint64 `json:"generation"`
+	Objects     int    `json:"objects"`
+	Still       int    `json:"still"`
+	Oscillators int    `json:"oscillators"`
+	Unsettled   int    `json:"unsettled"`
+	Spaceships  []Ship `json:"spaceships"`
+}
+
+// objectShape identifies an object's cells relative to its bounding box.
+type objectShape struct {
+	hash uint64
+	w, h int
+}
+
+type object struct {
+	shape      objectShape
+	origin     image.Point
+	population int
+}
+
+// objects finds the board's objects, joined across the edges when wrap is
+// set.
+func (b Board) objects(wrap bool) []object {
+	w, h := len(b), len(b[0])
+	seen := make([]bool, w*h)
+	var objs []object
+	var cells, stack []image.Point
+	for x, col := range b {
+		for y, alive := range col {
+			if !alive || seen[x*h+y] {
+				continue
+			}
+			seen[x*h+y] = true
+			cells, stack = cells[:0], append(stack[:0], image.Pt(x, y))
+			for len(stack) > 0 {
+				c := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				cells = append(cells, c)
+				for dx := -1; dx <= 1; dx++ {
+					for dy := -1; dy <= 1; dy++ {
+						nx, ny := c.X+dx, c.Y+dy
+						wx, wy := nx, ny
+						if wrap {
+							wx, wy = (nx+w)%w, (ny+h)%h
+						}
+						if !b.Get(wx, wy) || seen[wx*h+wy] {
+							continue
+						}
+						seen[wx*h+wy] = true
+						stack = append(stack, image.Pt(nx, ny))
+					}
+				}
+			}
+			objs = append(objs, newObject(cells, w, h))
+		}
+	}
+	return objs
+}
+
+// newObject fingerprints cells, which may run off a w by h board where it
+// wraps.
+func newObject(cells []image.Point, w, h int) object {
+	min, max := cells[0], cells[0]
+	for _, c := range cells {
+		if c.X < min.X {
+			min.X = c.X
+		}
+		if c.Y < min.Y {
+			min.Y = c.Y
+		}
+		if c.X > max.X {
+			max.X = c.X
+		}
+		if c.Y > max.Y {
+			max.Y = c.Y
+		}
+	}
+	s := objectShape{w: max.X - min.X + 1, h: max.Y - min.Y + 1}
+	bits := make([]byte, (s.w*s.h+7)/8)
+	for _, c := range cells {
+		n := (c.X-min.X)*s.h + c.Y - min.Y
+		bits[n/8] |= 1 << uint(n%8)
+	}
+	f := fnv.New64a()
+	f.Write(bits)
+	s.hash = f.Sum64()
+	return object{shape: s, origin: image.Pt((min.X+w)%w, (min.Y+h)%h), population: len(cells)}
+}
+
+// wrapDelta is the shortest way from 0 to d around a ring of n, or d itself
+// when there is no ring.
+func wrapDelta(d, n int, wrap bool) int {
+	if !wrap {
+		return d
+	}
+	d %= n
+	if d > n/2 {
+		d -= n
+	}
+	if d < -n/2 {
+		d += n
+	}
+	return d
+}
+
+// heading names the compass direction of dx, dy, with north up.
+func heading(dx, dy int) string {
+	ns, ew := "", ""
+	switch {
+	case dy < 0:
+		ns = "north"
+	case dy > 0:
+		ns = "south"
+	}
+	switch {
+	case dx < 0:
+		ew = "west"
+	case dx > 0:
+		ew = "east"
+	}
+	if ns != "" && ew != "" {
+		return ns + "-" + ew
+	}
+	return ns + ew
+}
+
+// censusDepth is how many generations an ObjectTracker remembers: enough to
+// see a spaceship of maxCyclePeriod move twice.
+const censusDepth = 2 * maxCyclePeriod
+
+// sighting is where an object was seen, and how it had moved since it was
+// last seen in that shape, if it had.
+type sighting struct {
+	origin image.Point
+	period int
+	moved  image.Point
+}
+
+type censusState struct {
+	gen    uint64
+	shapes map[objectShape][]sighting
+}
+
+// ObjectTracker takes a census of every generation it observes, matching
+// each object to the nearest one of the same shape in the last
+// maxCyclePeriod generations no further away than light could have gone. An
+// object only counts as a spaceship once the one it matched had moved the
+// same way, so debris that happens to look alike is not taken for one.
+type ObjectTracker struct {
+	mu     sync.Mutex
+	states [censusDepth]censusState
+	seen   int
+	census Census
+}
+
+func (t *ObjectTracker) Observe(gen uint64, b Board, topo Topology) {
+	wrap := topo == Torus
+	objs := b.objects(wrap)
+	w, h := len(b), len(b[0])
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := Census{Generation: gen, Objects: len(objs)}
+	shapes := make(map[objectShape][]sighting, len(objs))
+	for _, o := range objs {
+		seen := sighting{origin: o.origin}
+		var last sighting
+		for p := 1; p <= maxCyclePeriod && p <= t.seen && uint64(p) <= gen; p++ {
+			st := t.states[(gen-uint64(p))%censusDepth]
+			if st.gen != gen-uint64(p) {
+				break
+			}
+			best := -1
+			for _, at := range st.shapes[o.shape] {
+				d := image.Pt(wrapDelta(o.origin.X-at.origin.X, w, wrap), wrapDelta(o.origin.Y-at.origin.Y, h, wrap))
+				if abs(d.X) > p || abs(d.Y) > p {
+					continue
+				}
+				if dist := abs(d.X) + abs(d.Y); best < 0 || dist < best {
+					best, seen.moved, last = dist, d, at
+				}
+			}
+			if best >= 0 {
+				seen.period = p
+				break
+			}
+		}
+		shapes[o.shape] = append(shapes[o.shape], seen)
+		period, moved := seen.period, seen.moved
+		switch {
+		case period == 0, moved != image.Point{} && (last.period != period || last.moved != moved):
+			c.Unsettled++
+		case moved != image.Point{}:
+			c.Spaceships = append(c.Spaceships, Ship{
+				X:          o.origin.X,
+				Y:          o.origin.Y,
+				W:          o.shape.w,
+				H:          o.shape.h,
+				Population: o.population,
+				Period:     period,
+				DX:         moved.X,
+				DY:         moved.Y,
+				Speed:      Phase{Period: period, DX: moved.X, DY: moved.Y}.Speed(),
+				Heading:    heading(moved.X, moved.Y),
+			})
+		case period == 1:
+			c.Still++
+		default:
+			c.Oscillators++
+		}
+	}
+	t.states[gen%censusDepth] = censusState{gen: gen, shapes: shapes}
+	t.seen++
+	t.census = c
+}
+
+// Census returns the census of the latest generation observed.
+func (t *ObjectTracker) Census() Census {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.census
+	c.Spaceships = append([]Ship{}, c.Spaceships...)
+	return c
+}
+
+// Ships returns the spaceships of the latest generation observed, nil if
+// there are none.
+func (t *ObjectTracker) Ships() []Ship {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.census.Spaceships) == 0 {
+		return nil
+	}
+	return append([]Ship(nil), t.census.Spaceships...)
+}
+
+// vector returns where a ship's velocity vector starts and ends on a frame
+// drawn k pixels per cell: from the middle of its box, vectorGain times its
+// speed long.
+func (s Ship) vector(k int) (from, to image.Point) {
+	from = image.Pt((2*s.X+s.W)*k/2, (2*s.Y+s.H)*k/2)
+	g := float64(vectorGain*k) / float64(s.Period)
+	to = from.Add(image.Pt(int(math.Round(float64(s.DX)*g)), int(math.Round(float64(s.DY)*g))))
+	return from, to
+}
+
+// arrowHead returns the ends of the two strokes of an arrow's head at to,
+// pointing away from from.
+func arrowHead(from, to image.Point, size int) (image.Point, image.Point) {
+	a := math.Atan2(float64(to.Y-from.Y), float64(to.X-from.X))
+	end := func(turn float64) image.Point {
+		return to.Sub(image.Pt(int(math.Round(float64(size)*math.Cos(a+turn))), int(math.Round(float64(size)*math.Sin(a+turn)))))
+	}
+	return end(math.Pi / 6), end(-math.Pi / 6)
+}
+
+func arrowSize(k int) int {
+	if k < 6 {
+		return 6
+	}
+	return k
+}
+
+func (f Frame) drawVectors(img draw.Image, k int) {
+	for _, s := range f.Ships {
+		from, to := s.vector(k)
+		l, r := arrowHead(from, to, arrowSize(k))
+		drawLine(img, from, to, labelInk)
+		drawLine(img, to, l, labelInk)
+		drawLine(img, to, r, labelInk)
+	}
+}
+
+func (f Frame) svgVectors(canvas *svg.SVG, k int) {
+	stroke := `stroke="` + svgColor(labelInk) + `"`
+	for _, s := range f.Ships {
+		from, to := s.vector(k)
+		l, r := arrowHead(from, to, arrowSize(k))
+		canvas.Polyline([]int{l.X, to.X, r.X}, []int{l.Y, to.Y, r.Y}, `fill="none"`, stroke)
+		canvas.Line(from.X, from.Y, to.X, to.Y, stroke)
+	}
+}
+
+func vectorsParam(r *http.Request, def bool) (bool, error) {
+	s := r.URL.Query().Get("vectors")
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("vectors must be true or false, not %q", s)}
+	}
+	return v, nil
+}
+
+// censusHandle reports the room's latest census for /census.json.
+func censusHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if err := json.NewEncoder(w).Encode(room.census.Census()); err != nil {
+		fmt.Println(err)
+	}
+}
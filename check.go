@@ -0,0 +1,210 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// checkConfig validates the flags, returning every problem found rather than
+// just the first, each naming the flag to fix.
+func checkConfig() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, err := ParseDropPolicy(*encodeDrop); err != nil {
+		fail("-encode-drop: %v, want oldest or newest", err)
+	}
+	if *autoThemeZone != "" {
+		if _, err := time.LoadLocation(*autoThemeZone); err != nil {
+			fail("-auto-theme: %v, want a zone like Europe/London or Local", err)
+		}
+	}
+	for _, name := range []string{autoTheme.Day, autoTheme.Night} {
+		if _, ok := palettes[name]; !ok {
+			fail("theme auto: no palette %q", name)
+		}
+	}
+	for name, spec := range namedRules {
+		if _, err := ParseRule(spec); err != nil {
+			fail("rule %s: %v", name, err)
+		}
+	}
+	for name, spec := range namedGenerations {
+		if _, err := ParseGenerations(spec); err != nil {
+			fail("rule %s: %v", name, err)
+		}
+	}
+
+	positive := []struct {
+		flag  string
+		value int
+	}{
+		{"-max-width", *maxWidth},
+		{"-max-height", *maxHeight},
+		{"-max-scale", *maxScale},
+		{"-max-hashlife-size", *maxHashLifeSize},
+		{"-encode-workers", *encodeWorkers},
+		{"-history", *historySize},
+		{"-universe-capacity", *universeCapacity},
+		{"-share-capacity", *shareCapacity},
+		{"-export-max-generations", *exportMaxGens},
+		{"-export-max-pixels", *exportMaxPixels},
+	}
+	for _, p := range positive {
+		if p.value < 1 {
+			fail("%s is %d, want at least 1", p.flag, p.value)
+		}
+	}
+	if *soupSearch < 0 {
+		fail("-soup-search is %d, want 0 or more", *soupSearch)
+	}
+	if *tournamentSize < 0 {
+		fail("-tournament-size is %d, want 0 or more", *tournamentSize)
+	}
+	if *reseedFlat > populationWindow {
+		fail("-reseed-flat is %d, want at most %d", *reseedFlat, populationWindow)
+	}
+	if *reseedFlatBand < 0 || *reseedFlatBand >= 1 {
+		fail("-reseed-flat-band is %g, want 0 or more and less than 1", *reseedFlatBand)
+	}
+	if *roomIdleTTL < 0 {
+		fail("-room-idle-ttl is %v, want 0 or more", *roomIdleTTL)
+	}
+	if *cpuBudget < 0 {
+		fail("-cpu-budget is %g, want 0 or more", *cpuBudget)
+	}
+	for _, d := range []struct {
+		flag  string
+		value time.Duration
+	}{
+		{"-embed-interval", *embedInterval},
+		{"-universe-ttl", *universeTTL},
+		{"-share-ttl", *shareTTL},
+		{"-freeze-hold", *freezeHold},
+	} {
+		if d.value <= 0 {
+			fail("%s is %v, want more than 0", d.flag, d.value)
+		}
+	}
+
+	// The default room is started before anything else, so the limits must
+	// let it in.
+	def := RoomOptions{Width: defaultWidth, Height: defaultHeight, Scale: defaultScale}
+	if defaultWidth > *maxWidth || defaultHeight > *maxHeight {
+		fail("-max-width and -max-height allow %dx%d, too small for the %dx%d default room", *maxWidth, *maxHeight, defaultWidth, defaultHeight)
+	}
+	if defaultScale > *maxScale {
+		fail("-max-scale is %d, too small for the default room's scale of %d", *maxScale, defaultScale)
+	}
+	if cost := def.MemoryCost(); cost > *memoryBudget {
+		fail("-memory-budget is %d bytes, too small for the default room's %d", *memoryBudget, cost)
+	}
+	return errs
+}
+
+// checkFormats renders a frame in every format, and a page in each vector
+// one, so a broken encoder fails at startup rather than leaving its streams
+// without frames.
+func checkFormats() []error {
+	var errs []error
+	b := NewSeededBoard(defaultWidth, defaultHeight, 1)
+	f := Frame{Board: b, Prev: Conway.Evolute(b), Rule: Conway}
+	formats := make([]string, 0, len(encoders))
+	for format := range encoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	for _, format := range formats {
+		if data, err := encoders[format].Encode(f, Style{Scale: defaultScale}); err != nil {
+			errs = append(errs, fmt.Errorf("format %s: %v", format, err))
+		} else if len(data) == 0 {
+			errs = append(errs, fmt.Errorf("format %s: empty frame", format))
+		}
+	}
+	for name := range palettes {
+		if _, err := f.Png(Style{Scale: defaultScale, Theme: name}); err != nil {
+			errs = append(errs, fmt.Errorf("theme %s: %v", name, err))
+		}
+	}
+	l, err := layoutPage("", defaultWidth, defaultHeight, defaultScale)
+	if err == nil {
+		_, err = f.Pdf(Style{Scale: defaultScale}, l)
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("format pdf: %v", err))
+	}
+	if len(f.Eps(Style{Scale: defaultScale}, l)) == 0 {
+		errs = append(errs, errors.New("format eps: empty page"))
+	}
+	return errs
+}
+
+// checkResources opens what the flags point at, the storage, API keys,
+// showcase patterns, GeoIP database and WebAssembly build, and closes them
+// again.
+func checkResources() []error {
+	var errs []error
+	storage, err := openStorage()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("-storage: %v", err))
+	} else if storage != nil {
+		if _, err := storage.Get(viewersKey); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("-storage: %v", err))
+		}
+		storage.Close()
+	}
+	if *apiKeys != "" {
+		if _, err := LoadTenants(*apiKeys); err != nil {
+			errs = append(errs, fmt.Errorf("-api-keys: %v", err))
+		}
+	}
+	if *showcaseDir != "" {
+		showcases, err := LoadShowcases(*showcaseDir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("-showcase-dir: %v", err))
+		} else {
+			showcases.Close()
+		}
+	}
+	if *geoIPDB != "" {
+		if _, err := OpenGeoStats(*geoIPDB); err != nil {
+			errs = append(errs, fmt.Errorf("-geoip-db: %v", err))
+		}
+	}
+	if *wasmDir != "" {
+		if _, err := os.Stat(filepath.Join(*wasmDir, "gol.wasm")); err != nil {
+			errs = append(errs, fmt.Errorf("-wasm-dir: %v", err))
+		}
+	}
+	return errs
+}
+
+// selfCheck runs the startup checks, along with checkResources for -check,
+// and exits with status 1 after listing the problems if there are any.
+func selfCheck(resources bool) {
+	errs := append(checkConfig(), checkFormats()...)
+	if resources {
+		errs = append(errs, checkResources()...)
+	}
+	if len(errs) == 0 {
+		return
+	}
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) == 1 {
+		fmt.Fprintln(os.Stderr, "1 problem found")
+	} else {
+		fmt.Fprintf(os.Stderr, "%d problems found\n", len(errs))
+	}
+	os.Exit(1)
+}
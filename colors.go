@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ColorRule is a Life variant whose live cells come in Colors colours. Cells
+// are born and survive as in Conway's Life, a survivor keeps its colour, and
+// a newborn takes the colour most of its parents have or, if they all differ,
+// the one colour none of them has.
+type ColorRule struct {
+	Name   string
+	Colors uint8
+}
+
+var (
+	// Immigration is Conway's Life in two colours.
+	Immigration = ColorRule{Name: "immigration", Colors: 2}
+	// QuadLife is Conway's Life in four colours, where three parents of
+	// different colours bear a child of the fourth.
+	QuadLife = ColorRule{Name: "quadlife", Colors: 4}
+)
+
+// colorRules are the ColorRules by name.
+var colorRules = map[string]ColorRule{
+	Immigration.Name: Immigration,
+	QuadLife.Name:    QuadLife,
+}
+
+// ParseColorRule returns the ColorRule named s, in either case.
+func ParseColorRule(s string) (ColorRule, error) {
+	cr, ok := colorRules[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return ColorRule{}, fmt.Errorf("unknown coloured rule %q, want one of %s", s, strings.Join(colorRuleNames(), ", "))
+	}
+	return cr, nil
+}
+
+func colorRuleNames() []string {
+	names := make([]string, 0, len(colorRules))
+	for name := range colorRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (cr ColorRule) String() string {
+	return cr.Name
+}
+
+// ColorBoard is a board of coloured cells, indexed like Board: 0 is dead, and
+// 1 up to the rule's Colors a live cell of that colour.
+type ColorBoard [][]uint8
+
+// NewColorBoard gives b's live cells colours from 1 to colors, at random but
+// the same for the same seed.
+func NewColorBoard(b Board, colors uint8, seed int64) ColorBoard {
+	rng := rand.New(rand.NewSource(seed))
+	c := make(ColorBoard, len(b))
+	for i, col := range b {
+		c[i] = make([]uint8, len(col))
+		for j, alive := range col {
+			if alive {
+				c[i][j] = 1 + uint8(rng.Intn(int(colors)))
+			}
+		}
+	}
+	return c
+}
+
+// Alive returns the board of live cells, whatever their colour.
+func (c ColorBoard) Alive() Board {
+	b := make(Board, len(c))
+	for i, col := range c {
+		b[i] = make([]bool, len(col))
+		for j, colour := range col {
+			b[i][j] = colour != 0
+		}
+	}
+	return b
+}
+
+// Step advances c one generation. The live cells step like a Conway board.
+func (cr ColorRule) Step(c ColorBoard) ColorBoard {
+	next := Conway.Evolute(c.Alive())
+	out := make(ColorBoard, len(c))
+	for i, col := range c {
+		out[i] = make([]uint8, len(col))
+		for j, colour := range col {
+			switch {
+			case !next[i][j]:
+			case colour != 0:
+				out[i][j] = colour
+			default:
+				out[i][j] = cr.birth(c.parents(i, j))
+			}
+		}
+	}
+	return out
+}
+
+// parents counts the colours of the cell's live neighbours, by colour.
+func (c ColorBoard) parents(i, j int) [256]int {
+	var counts [256]int
+	for di := -1; di <= 1; di++ {
+		for dj := -1; dj <= 1; dj++ {
+			x, y := i+di, j+dj
+			if (di != 0 || dj != 0) && x >= 0 && y >= 0 && x < len(c) && y < len(c[x]) {
+				counts[c[x][y]]++
+			}
+		}
+	}
+	return counts
+}
+
+// birth returns the colour of a cell born to parents of the given colours:
+// the most common, the lowest of any tied, unless no two share one and a
+// single colour is missing, which it takes instead.
+func (cr ColorRule) birth(counts [256]int) uint8 {
+	best := uint8(1)
+	for colour := uint8(2); colour <= cr.Colors; colour++ {
+		if counts[colour] > counts[best] {
+			best = colour
+		}
+	}
+	if counts[best] > 1 {
+		return best
+	}
+	missing := uint8(0)
+	for colour := uint8(1); colour <= cr.Colors; colour++ {
+		if counts[colour] == 0 {
+			if missing != 0 {
+				return best
+			}
+			missing = colour
+		}
+	}
+	if missing == 0 {
+		return best
+	}
+	return missing
+}
+
+// Populations counts the live cells of each colour, the first colour first.
+func (c ColorBoard) Populations(colors uint8) []int {
+	counts := make([]int, colors)
+	for _, col := range c {
+		for _, colour := range col {
+			if colour != 0 {
+				counts[colour-1]++
+			}
+		}
+	}
+	return counts
+}
+
+// cellColor is the colour a live cell of colour c is drawn in: the palette's
+// Alive, Alt, Born and Dying colours in turn.
+func cellColor(pal *Palette, c uint8) color.RGBA {
+	switch c {
+	case 2:
+		return pal.Alt
+	case 3:
+		return pal.Born
+	case 4:
+		return pal.Dying
+	}
+	return pal.Alive
+}
+
+// maxColorWorlds bounds how many coloured rules run at once.
+const maxColorWorlds = 8
+
+// ColorWorld runs a soup under a ColorRule for /colors.svg, pausing while
+// nobody watches.
+type ColorWorld struct {
+	rule ColorRule
+	task *Task
+
+	mu          sync.Mutex
+	cells       ColorBoard
+	generation  uint64
+	subscribers map[chan<- ImageBundle]*Session
+}
+
+func NewColorWorld(rule ColorRule) *ColorWorld {
+	cw := &ColorWorld{
+		rule:        rule,
+		cells:       NewColorBoard(NewBoard(defaultWidth, defaultHeight), rule.Colors, rand.Int63()),
+		subscribers: make(map[chan<- ImageBundle]*Session),
+	}
+	cw.task = scheduler.NewTask(time.Second, cw.tick)
+	cw.Start()
+	return cw
+}
+
+func (cw *ColorWorld) Start() {
+	cw.task.Start()
+}
+
+func (cw *ColorWorld) Close() {
+	cw.task.Stop()
+}
+
+func (cw *ColorWorld) frame() Frame {
+	return Frame{Board: cw.cells.Alive(), Rule: Conway, Colors: cw.cells}
+}
+
+func (cw *ColorWorld) tick() {
+	if d := budget.Interval(time.Second); d != cw.task.Interval() {
+		cw.task.SetInterval(d)
+	}
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if len(cw.subscribers) == 0 {
+		cw.task.Pause()
+		return
+	}
+
+	defer budget.Track(time.Now())
+	cw.cells = cw.rule.Step(cw.cells)
+	cw.generation++
+	f := cw.frame()
+	data, err := f.Svg(Style{Scale: defaultScale})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	bundle := ImageBundle{
+		Data:        data,
+		ContentType: "image/svg+xml",
+		Generation:  cw.generation,
+		Population:  f.Board.Population(),
+		Time:        time.Now(),
+	}
+	for ch, s := range cw.subscribers {
+		offer(ch, s, bundle)
+	}
+}
+
+func (cw *ColorWorld) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat("svg")
+	leave := viewerCounts.Join(s, "colors/"+cw.rule.String())
+	cw.mu.Lock()
+	cw.subscribers[c] = s
+	cw.task.Resume()
+	cw.mu.Unlock()
+	return func() {
+		cw.mu.Lock()
+		delete(cw.subscribers, c)
+		cw.mu.Unlock()
+		leave()
+	}
+}
+
+// ColorWorlds starts a ColorWorld per rule asked for.
+type ColorWorlds struct {
+	mu     sync.Mutex
+	byRule map[ColorRule]*ColorWorld
+}
+
+func NewColorWorlds() *ColorWorlds {
+	return &ColorWorlds{byRule: make(map[ColorRule]*ColorWorld)}
+}
+
+func (cws *ColorWorlds) get(rule ColorRule) (*ColorWorld, error) {
+	cws.mu.Lock()
+	defer cws.mu.Unlock()
+	if cw, ok := cws.byRule[rule]; ok {
+		return cw, nil
+	}
+	if len(cws.byRule) >= maxColorWorlds {
+		return nil, &requestError{status: http.StatusServiceUnavailable, msg: fmt.Sprintf("%d coloured rules are already running", maxColorWorlds)}
+	}
+	cw := NewColorWorld(rule)
+	cws.byRule[rule] = cw
+	return cw, nil
+}
+
+func (cws *ColorWorlds) Close() {
+	cws.mu.Lock()
+	defer cws.mu.Unlock()
+	for _, cw := range cws.byRule {
+		cw.Close()
+	}
+}
+
+type colorsJSON struct {
+	Rule       string `json:"rule"`
+	Generation uint64 `json:"generation"`
+	// Populations counts the live cells of each colour, the first colour
+	// first.
+	Populations []int `json:"populations"`
+}
+
+// Handle streams /colors.svg, snapshots /colors.png and counts each colour's
+// cells for /colors.json under ?rule=, Immigration by default.
+func (cws *ColorWorlds) Handle(w http.ResponseWriter, r *http.Request) {
+	s := r.URL.Query().Get("rule")
+	if s == "" {
+		s = Immigration.Name
+	}
+	rule, err := ParseColorRule(s)
+	if err != nil {
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: err.Error()})
+		return
+	}
+	cw, err := cws.get(rule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	switch r.URL.Path {
+	case "/colors.svg":
+		streamHandleFunc(cw)(w, r)
+		return
+	case "/colors.json":
+		cw.mu.Lock()
+		resp := colorsJSON{Rule: rule.String(), Generation: cw.generation, Populations: cw.cells.Populations(rule.Colors)}
+		cw.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache, max-age=0")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	cw.mu.Lock()
+	f := cw.frame()
+	cw.mu.Unlock()
+	data, err := f.Png(Style{Scale: defaultScale})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if _, err := w.Write(data); err != nil {
+		fmt.Println(err)
+	}
+}
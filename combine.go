@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// BoardOp is a cell by cell boolean operation between two boards.
+type BoardOp string
+
+const (
+	OpUnion      BoardOp = "union"
+	OpIntersect  BoardOp = "intersect"
+	OpDifference BoardOp = "difference"
+	OpXor        BoardOp = "xor"
+)
+
+var boardOps = map[BoardOp]func(a, b bool) bool{
+	OpUnion:      func(a, b bool) bool { return a || b },
+	OpIntersect:  func(a, b bool) bool { return a && b },
+	OpDifference: func(a, b bool) bool { return a && !b },
+	OpXor:        func(a, b bool) bool { return a != b },
+}
+
+// Combine returns a new board the size of b with op applied to each of its
+// cells and the same cell of o, dead where o is smaller.
+func (b Board) Combine(op BoardOp, o Board) Board {
+	f := boardOps[op]
+	c := make(Board, len(b))
+	for i, col := range b {
+		c[i] = make([]bool, len(col))
+		for j, alive := range col {
+			c[i][j] = f(alive, o.Get(i, j))
+		}
+	}
+	return c
+}
+
+// Union is alive where either board is.
+func (b Board) Union(o Board) Board { return b.Combine(OpUnion, o) }
+
+// Intersect is alive where both boards are.
+func (b Board) Intersect(o Board) Board { return b.Combine(OpIntersect, o) }
+
+// Difference is alive where b is and o is not.
+func (b Board) Difference(o Board) Board { return b.Combine(OpDifference, o) }
+
+// Xor is alive where exactly one of the boards is.
+func (b Board) Xor(o Board) Board { return b.Combine(OpXor, o) }
+
+// empty returns a board of dead cells the size of b.
+func (b Board) empty() Board {
+	e := make(Board, len(b))
+	for i := range e {
+		e[i] = make([]bool, len(b[i]))
+	}
+	return e
+}
+
+// mask returns a board the size of b holding only p, placed at (x, y).
+func (b Board) mask(p Pattern, x, y int) Board {
+	m := b.empty()
+	m.Stamp(p, x, y)
+	return m
+}
+
+func boardOpParam(r *http.Request) (BoardOp, error) {
+	op := BoardOp(r.URL.Query().Get("op"))
+	if _, ok := boardOps[op]; !ok {
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown op %q, want union, intersect, difference or xor", op)}
+	}
+	return op, nil
+}
+
+// combineHandle applies ?op= between a room's board and a pattern, placed
+// like boardHandle places it, without clearing the rest of the board.
+func combineHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	op, err := boardOpParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	p, _, x, y, err := readPlacement(room, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	gen, err := room.Combine(op, p, x, y)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeBoardJSON(w, room, gen)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"compress/flate"
+	"math"
+	"sync"
+)
+
+// Complexity estimates how interesting a board is. Empty and frozen boards
+// compress well and have low entropy; random soups are the opposite, and the
+// most lively universes sit in between.
+type Complexity struct {
+	// CompressionRatio is the size of the board packed eight cells to the
+	// byte and deflated, over its packed size.
+	CompressionRatio float64 `json:"compressionRatio"`
+	// BlockEntropy is the Shannon entropy of the board's 2x2 blocks, from 0
+	// to 4 bits.
+	BlockEntropy float64 `json:"blockEntropy"`
+}
+
+var flateWriters = sync.Pool{New: func() interface{} {
+	w, err := flate.NewWriter(nil, flate.BestSpeed)
+	if err != nil {
+		panic(err)
+	}
+	return w
+}}
+
+// countingWriter counts the bytes written to it and drops them.
+type countingWriter int
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
+
+func (b Board) Complexity() Complexity {
+	if len(b) == 0 || len(b[0]) == 0 {
+		return Complexity{}
+	}
+	return Complexity{CompressionRatio: b.compressionRatio(), BlockEntropy: b.blockEntropy()}
+}
+
+func (b Board) compressionRatio() float64 {
+	packed := make([]byte, (len(b)*len(b[0])+7)/8)
+	n := 0
+	for _, col := range b {
+		for _, alive := range col {
+			if alive {
+				packed[n/8] |= 1 << uint(n%8)
+			}
+			n++
+		}
+	}
+	var size countingWriter
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&size)
+	if _, err := w.Write(packed); err != nil {
+		return 1
+	}
+	if err := w.Close(); err != nil {
+		return 1
+	}
+	return float64(size) / float64(len(packed))
+}
+
+func (b Board) blockEntropy() float64 {
+	var counts [16]int
+	total := 0
+	for i := 0; i+1 < len(b); i += 2 {
+		for j := 0; j+1 < len(b[i]); j += 2 {
+			counts[bit(b[i][j])|bit(b[i+1][j])<<1|bit(b[i][j+1])<<2|bit(b[i+1][j+1])<<3]++
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	h := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(total)
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+func bit(alive bool) int {
+	if alive {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"net/http"
+	"sync"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+// maxCyclePeriod is the longest period the cycle detector recognises.
+const maxCyclePeriod = 16
+
+// maxPeriodLog is how many detected cycles a detector remembers.
+const maxPeriodLog = 100
+
+type PhaseKind string
+
+const (
+	PhaseChaotic    PhaseKind = "chaotic"
+	PhaseStable     PhaseKind = "stable"
+	PhaseOscillator PhaseKind = "oscillator"
+	// PhaseSpaceship is a board whose live cells repeat shifted by DX, DY.
+	PhaseSpaceship PhaseKind = "spaceship"
+	PhaseExtinct   PhaseKind = "extinct"
+)
+
+// Phase describes the long-term behaviour of a board: still chaotic, or
+// repeating with Period since generation Since, moved by DX, DY each period.
+type Phase struct {
+	Kind   PhaseKind `json:"kind"`
+	Period int       `json:"period,omitempty"`
+	Since  uint64    `json:"since,omitempty"`
+	DX     int       `json:"dx,omitempty"`
+	DY     int       `json:"dy,omitempty"`
+}
+
+// Speed is the spaceship's speed in the usual c/period notation with its
+// direction, e.g. "c/4 diagonal".
+func (p Phase) Speed() string {
+	dx, dy := p.DX, p.DY
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	n := dx
+	if dy > n {
+		n = dy
+	}
+	if n == 0 {
+		return ""
+	}
+	dir := "oblique"
+	switch {
+	case dx == 0 || dy == 0:
+		dir = "orthogonal"
+	case dx == dy:
+		dir = "diagonal"
+	}
+	d := gcd(n, p.Period)
+	if n/d == 1 {
+		return fmt.Sprintf("c/%d %s", p.Period/d, dir)
+	}
+	return fmt.Sprintf("%dc/%d %s", n/d, p.Period/d, dir)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func (p Phase) String() string {
+	switch p.Kind {
+	case PhaseExtinct:
+		return "extinct"
+	case PhaseStable:
+		return fmt.Sprintf("stabilized at gen %d", p.Since)
+	case PhaseOscillator:
+		return fmt.Sprintf("period-%d oscillator", p.Period)
+	case PhaseSpaceship:
+		return fmt.Sprintf("%s spaceship", p.Speed())
+	}
+	return "chaotic"
+}
+
+// shape fingerprints the board's live cells relative to their bounding box,
+// so a pattern hashes the same wherever it is, and returns the box's corner.
+func (b Board) shape() (uint64, image.Point) {
+	min, max := image.Pt(len(b), len(b[0])), image.Pt(-1, -1)
+	for x, col := range b {
+		for y, alive := range col {
+			if alive {
+				if x < min.X {
+					min.X = x
+				}
+				if y < min.Y {
+					min.Y = y
+				}
+				if x > max.X {
+					max.X = x
+				}
+				if y > max.Y {
+					max.Y = y
+				}
+			}
+		}
+	}
+	h := fnv.New64a()
+	if max.X < 0 {
+		return h.Sum64(), image.Point{}
+	}
+	for x := min.X; x <= max.X; x++ {
+		h.Write(cellBytes(b[x][min.Y : max.Y+1]))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64(), min
+}
+
+type cycleState struct {
+	hash   uint64
+	shape  uint64
+	origin image.Point
+}
+
+// CycleDetector watches consecutive generations for a board returning to one
+// of its last maxCyclePeriod states, either in place or shifted, and logs
+// every cycle it finds.
+type CycleDetector struct {
+	mu     sync.Mutex
+	states [maxCyclePeriod]cycleState
+	seen   int
+	phase  Phase
+	log    []Phase
+}
+
+func (d *CycleDetector) Observe(gen uint64, b Board) {
+	hash, population := b.Hash(), b.Population()
+	shape, origin := b.shape()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	period, moved := 0, image.Point{}
+	for p := 1; p <= maxCyclePeriod && p <= d.seen; p++ {
+		if d.states[(gen-uint64(p))%maxCyclePeriod].hash == hash {
+			period = p
+			break
+		}
+	}
+	if period == 0 {
+		for p := 1; p <= maxCyclePeriod && p <= d.seen; p++ {
+			if st := d.states[(gen-uint64(p))%maxCyclePeriod]; st.shape == shape {
+				period, moved = p, origin.Sub(st.origin)
+				break
+			}
+		}
+	}
+	d.states[gen%maxCyclePeriod] = cycleState{hash: hash, shape: shape, origin: origin}
+	d.seen++
+
+	prev := d.phase
+	switch {
+	case population == 0:
+		if d.phase.Kind != PhaseExtinct {
+			d.phase = Phase{Kind: PhaseExtinct, Period: 1, Since: gen}
+		}
+	case period == 0:
+		d.phase = Phase{Kind: PhaseChaotic}
+	case d.phase.Period != period || d.phase.Kind == PhaseChaotic || d.phase.DX != moved.X || d.phase.DY != moved.Y:
+		kind := PhaseOscillator
+		switch {
+		case moved != image.Point{}:
+			kind = PhaseSpaceship
+		case period == 1:
+			kind = PhaseStable
+		}
+		d.phase = Phase{Kind: kind, Period: period, Since: gen - uint64(period), DX: moved.X, DY: moved.Y}
+	}
+	if d.phase != prev && d.phase.Kind != PhaseChaotic {
+		d.log = append(d.log, d.phase)
+		if len(d.log) > maxPeriodLog {
+			d.log = d.log[1:]
+		}
+	}
+}
+
+// Log returns the cycles found so far, oldest first.
+func (d *CycleDetector) Log() []Phase {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Phase{}, d.log...)
+}
+
+func (d *CycleDetector) Phase() Phase {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.phase
+}
+
+var phaseColors = map[PhaseKind]string{
+	PhaseChaotic:    "#4c1",
+	PhaseStable:     "#007ec6",
+	PhaseOscillator: "#dfb317",
+	PhaseSpaceship:  "#9f5fd0",
+	PhaseExtinct:    "#e05d44",
+}
+
+// badgeSvg draws a shields.io style badge.
+func badgeSvg(label, message, color string) []byte {
+	const charWidth, padding = 7, 10
+	lw := len(label)*charWidth + padding
+	mw := len(message)*charWidth + padding
+
+	var buf bytes.Buffer
+	canvas := svg.New(&buf)
+	canvas.Start(lw+mw, 20)
+	canvas.Roundrect(0, 0, lw+mw, 20, 3, 3, `fill="#555"`)
+	canvas.Roundrect(lw, 0, mw, 20, 3, 3, `fill="`+color+`"`)
+	canvas.Rect(lw, 0, 4, 20, `fill="`+color+`"`)
+	textStyle := []string{
+		`fill="#fff"`, `font-family="Verdana,DejaVu Sans,sans-serif"`, `font-size="11"`,
+		`dominant-baseline="middle"`, `text-anchor="middle"`,
+	}
+	canvas.Text(lw/2, 10, label, textStyle...)
+	canvas.Text(lw+mw/2, 10, message, textStyle...)
+	canvas.End()
+	return buf.Bytes()
+}
+
+func statusBadgeHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	phase := room.cycles.Phase()
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if _, err := w.Write(badgeSvg("life", phase.String(), phaseColors[phase.Kind])); err != nil {
+		fmt.Println(err)
+	}
+}
+
+type statsJSON struct {
+	Room       string     `json:"room"`
+	Generation uint64     `json:"generation"`
+	Population int        `json:"population"`
+	Rule       Rule       `json:"rule"`
+	Phase      Phase      `json:"phase"`
+	Speed      string     `json:"speed,omitempty"`
+	Cycles     []Phase    `json:"cycles"`
+	Complexity Complexity `json:"complexity"`
+	// Window is the population statistics of the last generations.
+	Window  []GenerationStats `json:"window"`
+	Reseeds []Reseed          `json:"reseeds"`
+}
+
+// statsHandle reports the room's generation, its current phase, the cycles
+// found in it so far, and the population statistics of the last ?window=
+// generations.
+func statsHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	n, err := statsWindowParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	latest := room.history.Latest()
+	phase := room.cycles.Phase()
+	stats := statsJSON{
+		Room:       room.name,
+		Generation: latest.Number,
+		Population: latest.Board.Population(),
+		Rule:       room.Rule(),
+		Phase:      phase,
+		Speed:      phase.Speed(),
+		Cycles:     room.cycles.Log(),
+		Complexity: room.Complexity(),
+		Window:     room.stats.Window(n),
+		Reseeds:    room.reseeds.List(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		fmt.Println(err)
+	}
+}
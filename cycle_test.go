@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCycleDetector(t *testing.T) {
+	cells := func(rows ...string) Pattern {
+		p, err := ParseCells(strings.Join(rows, "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	tests := []struct {
+		name    string
+		pattern Pattern
+		gens    int
+		want    Phase
+	}{
+		{"block", cells("OO", "OO"), 5, Phase{Kind: PhaseStable, Period: 1, Since: 0}},
+		{"blinker", cells("OOO"), 5, Phase{Kind: PhaseOscillator, Period: 2, Since: 0}},
+		{"pulsar", patterns["pulsar"], 10, Phase{Kind: PhaseOscillator, Period: 3, Since: 0}},
+		{"glider", patterns["glider"], 10, Phase{Kind: PhaseSpaceship, Period: 4, Since: 0, DX: 1, DY: 1}},
+		{"lwss", patterns["lwss"], 10, Phase{Kind: PhaseSpaceship, Period: 4, Since: 0, DX: -2}},
+		{"dying", cells("O"), 3, Phase{Kind: PhaseExtinct, Period: 1, Since: 1}},
+		{"r-pentomino", patterns["r-pentomino"], 30, Phase{Kind: PhaseChaotic}},
+	}
+	for _, tt := range tests {
+		b := NewBoard(40, 40).empty()
+		b.Stamp(tt.pattern, 15, 15)
+		var d CycleDetector
+		for gen := 0; gen <= tt.gens; gen++ {
+			d.Observe(uint64(gen), b)
+			b = Conway.Evolute(b)
+		}
+		if got := d.Phase(); got != tt.want {
+			t.Errorf("%s: phase %#v, want %#v", tt.name, got, tt.want)
+		}
+		if log := d.Log(); tt.want.Kind != PhaseChaotic && (len(log) != 1 || log[0] != tt.want) {
+			t.Errorf("%s: logged %#v, want only %#v", tt.name, log, tt.want)
+		}
+	}
+}
+
+func TestPhaseSpeed(t *testing.T) {
+	tests := []struct {
+		phase Phase
+		want  string
+	}{
+		{Phase{Period: 4, DX: 1, DY: 1}, "c/4 diagonal"},
+		{Phase{Period: 4, DX: -2}, "c/2 orthogonal"},
+		{Phase{Period: 5, DY: 2}, "2c/5 orthogonal"},
+		{Phase{Period: 6, DX: 2, DY: -1}, "c/3 oblique"},
+		{Phase{Period: 2}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.phase.Speed(); got != tt.want {
+			t.Errorf("%#v: speed %q, want %q", tt.phase, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"time"
+)
+
+// maxKeyframeInterval bounds ?keyframe=.
+const maxKeyframeInterval = 600
+
+// FrameDelta is a frame given as the region that changed since the frame of
+// generation Base: a PNG of that region, to be drawn with its top-left corner
+// at X, Y.
+type FrameDelta struct {
+	Data []byte
+	X, Y int
+	Base uint64
+}
+
+// EncodeDelta renders f in a raster format like Encode does, and, given the
+// image of the frame before, also as a delta against it. It returns the image
+// for the next call.
+func EncodeDelta(format string, f Frame, st Style, prev *image.RGBA, base uint64) (ImageBundle, *image.RGBA, error) {
+	start := time.Now()
+	defer budget.Track(start)
+
+	var img *image.RGBA
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		img = f.opaque(st)
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		img = f.image(st).(*image.RGBA)
+		err = png.Encode(&buf, img)
+	default:
+		return ImageBundle{}, nil, fmt.Errorf("format %q has no deltas", format)
+	}
+	if err != nil {
+		return ImageBundle{}, nil, err
+	}
+	bundle := ImageBundle{Data: buf.Bytes(), ContentType: encoders[format].ContentType}
+	metrics.ObserveEncode(format, sizeClass(f.Board), time.Since(start), len(bundle.Data))
+
+	if prev != nil && prev.Bounds() == img.Bounds() {
+		r := changedRect(prev, img)
+		if r.Empty() {
+			// Nothing changed; a single unchanged pixel keeps the delta a
+			// valid image.
+			r = image.Rect(0, 0, 1, 1)
+		}
+		var crop bytes.Buffer
+		if err := png.Encode(&crop, img.SubImage(r)); err != nil {
+			return ImageBundle{}, nil, err
+		}
+		bundle.Delta = &FrameDelta{Data: crop.Bytes(), X: r.Min.X, Y: r.Min.Y, Base: base}
+	}
+	return bundle, img, nil
+}
+
+// changedRect is the smallest rectangle holding every pixel that differs
+// between two images of the same bounds.
+func changedRect(a, b *image.RGBA) image.Rectangle {
+	var r image.Rectangle
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		ra := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		rb := b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]
+		if bytes.Equal(ra, rb) {
+			continue
+		}
+		x0, x1 := 0, len(ra)/4
+		for x0 < x1 && bytes.Equal(ra[4*x0:4*x0+4], rb[4*x0:4*x0+4]) {
+			x0++
+		}
+		for x1 > x0 && bytes.Equal(ra[4*x1-4:4*x1], rb[4*x1-4:4*x1]) {
+			x1--
+		}
+		r = r.Union(image.Rect(bounds.Min.X+x0, y, bounds.Min.X+x1, y+1))
+	}
+	return r
+}
+
+// keyframes decides which frames a subscriber gets whole. At most every
+// frames go by between whole ones, and since a delta only makes sense on top
+// of the frame it was taken against, a subscriber that missed that frame gets
+// the next one whole too. every 0 sends every frame whole.
+type keyframes struct {
+	every   int
+	since   int
+	last    uint64
+	started bool
+}
+
+// Delta returns the delta to send in place of b, or nil to send b whole.
+func (k *keyframes) Delta(b ImageBundle) *FrameDelta {
+	d := b.Delta
+	if k.every == 0 || d == nil || !k.started || d.Base != k.last || k.since+1 >= k.every {
+		k.since = 0
+		d = nil
+	} else {
+		k.since++
+	}
+	k.last, k.started = b.Generation, true
+	return d
+}
+
+// keyframeParam reads ?keyframe=, the most frames between whole ones of a
+// delta encoded stream, 0 if the stream sends only whole frames. Only raster
+// formats have deltas.
+func keyframeParam(r *http.Request, format string) (int, error) {
+	n, err := intParam(r, "keyframe", 0)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > maxKeyframeInterval {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("keyframe must be between 0 and %d", maxKeyframeInterval)}
+	}
+	if n > 0 && format != "png" && format != "jpeg" {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("format %q has no deltas", format)}
+	}
+	return n, nil
+}
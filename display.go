@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DisplayProfile sizes frames for a physical display: a board of
+// Width/Cell by Height/Cell cells drawn Cell pixels to a cell fills it.
+type DisplayProfile struct {
+	Width  int
+	Height int
+	Cell   int
+	// Format is the encoder the display is sent frames in unless a request
+	// picks another.
+	Format string
+}
+
+// displayProfiles are the displays /display has profiles for, by name.
+var displayProfiles = map[string]DisplayProfile{
+	"led-32x16":    {Width: 32, Height: 16, Cell: 1, Format: "bits"},
+	"led-32x32":    {Width: 32, Height: 32, Cell: 1, Format: "bits"},
+	"led-64x32":    {Width: 64, Height: 32, Cell: 1, Format: "bits"},
+	"led-64x64":    {Width: 64, Height: 64, Cell: 1, Format: "bits"},
+	"eink-250x122": {Width: 250, Height: 122, Cell: 2, Format: "bmp"},
+	"eink-296x128": {Width: 296, Height: 128, Cell: 4, Format: "bmp"},
+	"eink-400x300": {Width: 400, Height: 300, Cell: 5, Format: "bmp"},
+	"eink-800x480": {Width: 800, Height: 480, Cell: 10, Format: "bmp"},
+}
+
+// bitmap packs the board into rows of one bit per pixel, most significant bit
+// first and each row padded to a whole byte, with live cells set.
+func (f Frame) bitmap(st Style) (w, h int, rows []byte) {
+	k := st.Scale
+	w, h = k*len(f.Board), k*len(f.Board[0])
+	stride := (w + 7) / 8
+	rows = make([]byte, stride*h)
+	for y := 0; y < h; y++ {
+		row := rows[y*stride : (y+1)*stride]
+		for x := 0; x < w; x++ {
+			if f.Board[x/k][y/k] {
+				row[x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return w, h, rows
+}
+
+// Bits writes the board as bare packed bits, row by row from the top-left,
+// with live cells set and each row padded to a whole byte. It is what LED
+// matrix drivers shift out, so microcontrollers need no decoder.
+func (f Frame) Bits(st Style) ([]byte, error) {
+	_, _, rows := f.bitmap(st)
+	return rows, nil
+}
+
+// Bmp writes the board as a 1-bit BMP, live cells black on white or, with
+// Invert, white on black. Colours and captions are left out.
+func (f Frame) Bmp(st Style) ([]byte, error) {
+	w, h, rows := f.bitmap(st)
+	stride := (w + 7) / 8
+	padded := (stride + 3) &^ 3
+	const headers = 14 + 40 + 2*4
+	size := headers + padded*h
+
+	var buf bytes.Buffer
+	buf.WriteString("BM")
+	for _, v := range []interface{}{
+		uint32(size), uint32(0), uint32(headers),
+		// BITMAPINFOHEADER: size, width, height, planes, bits per pixel,
+		// no compression, image size, 72 dpi both ways, colours used and
+		// important.
+		uint32(40), int32(w), int32(h), uint16(1), uint16(1),
+		uint32(0), uint32(padded * h), int32(2835), int32(2835), uint32(2), uint32(2),
+	} {
+		_ = binary.Write(&buf, binary.LittleEndian, v)
+	}
+	// Palette entries are blue, green, red and a reserved byte; index 1 is
+	// a live cell.
+	if st.Invert {
+		buf.Write([]byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0})
+	} else {
+		buf.Write([]byte{0xff, 0xff, 0xff, 0, 0, 0, 0, 0})
+	}
+	pad := make([]byte, padded-stride)
+	for y := h - 1; y >= 0; y-- {
+		buf.Write(rows[y*stride : (y+1)*stride])
+		buf.Write(pad)
+	}
+	return buf.Bytes(), nil
+}
+
+func displayProfileParam(r *http.Request) (DisplayProfile, error) {
+	name := r.URL.Query().Get("profile")
+	p, ok := displayProfiles[name]
+	if !ok {
+		var names []string
+		for n := range displayProfiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return DisplayProfile{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown profile %q, want one of %s", name, strings.Join(names, ", "))}
+	}
+	return p, nil
+}
+
+// displayHandleFunc serves /display?profile=, the latest generation of a room
+// sized for the profile's display. Without w, h and scale the room is one
+// whose board fills the display. Responses carry an ETag of the board, so a
+// device polling with If-None-Match gets 304 Not Modified, and need not
+// refresh, until the board changes.
+func displayHandleFunc(rooms *Rooms) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := displayProfileParam(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		r = r.Clone(r.Context())
+		q := r.URL.Query()
+		for key, v := range map[string]int{"w": p.Width / p.Cell, "h": p.Height / p.Cell, "scale": p.Cell} {
+			if q.Get(key) == "" {
+				q.Set(key, strconv.Itoa(v))
+			}
+		}
+		r.URL.RawQuery = q.Encode()
+		withRoom(rooms, func(room *GameRender, w http.ResponseWriter, r *http.Request) {
+			displayHandle(room, p, w, r)
+		})(w, r)
+	}
+}
+
+func displayHandle(room *GameRender, p DisplayProfile, w http.ResponseWriter, r *http.Request) {
+	format, err := formatParam(r, p.Format)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	st, err := styleParam(r, room.DefaultStyle())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	room.Touch()
+
+	latest := room.history.Latest()
+	// The same board looks the same for the same query, which
+	// displayHandleFunc has put in a canonical order.
+	query := fnv.New64a()
+	query.Write([]byte(r.URL.RawQuery))
+	etag := fmt.Sprintf(`"%s-%x"`, formatHash(latest.Hash), query.Sum64())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Generation", strconv.FormatUint(latest.Number, 10))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	bundle, err := Encode(format, Frame{Board: latest.Board, Rule: room.Rule(), Grid: room.opts.Grid, Generation: latest.Number}, st)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", bundle.ContentType)
+	if _, err := w.Write(bundle.Data); err != nil {
+		fmt.Println(err)
+	}
+}
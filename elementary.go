@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxElementaryWorlds bounds how many elementary rules run at once.
+	maxElementaryWorlds = 8
+	// elementaryInterval is how often an elementary world adds a row.
+	elementaryInterval = time.Second / 4
+	// elementaryScale draws elementary worlds, twice the size of a room's
+	// board in cells, as large as one.
+	elementaryScale = defaultScale / 2
+)
+
+// ElementaryRule is one of Wolfram's 256 elementary cellular automata: bit n
+// is whether a cell lives when it and its left and right neighbours on the
+// row before, read as a three-bit number left first, make n.
+type ElementaryRule uint8
+
+func ParseElementaryRule(s string) (ElementaryRule, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 255 {
+		return 0, fmt.Errorf("bad rule %q: elementary rules go from 0 to 255", s)
+	}
+	return ElementaryRule(n), nil
+}
+
+// Next returns the row after row, which wraps round at its ends.
+func (e ElementaryRule) Next(row []bool) []bool {
+	w := len(row)
+	next := make([]bool, w)
+	for x := range row {
+		n := bit(row[(x+w-1)%w])<<2 | bit(row[x])<<1 | bit(row[(x+1)%w])
+		next[x] = e&(1<<uint(n)) != 0
+	}
+	return next
+}
+
+// ElementaryWorld grows an elementary automaton from a single live cell for
+// /elementary.svg, a row a tick, scrolling up once its rows fill the board.
+// It pauses while nobody watches.
+type ElementaryWorld struct {
+	rule ElementaryRule
+	task *Task
+
+	mu          sync.Mutex
+	rows        [][]bool
+	generation  uint64
+	subscribers map[chan<- ImageBundle]*Session
+}
+
+func NewElementaryWorld(rule ElementaryRule) *ElementaryWorld {
+	first := make([]bool, 2*defaultWidth)
+	first[defaultWidth] = true
+	ew := &ElementaryWorld{
+		rule:        rule,
+		rows:        [][]bool{first},
+		subscribers: make(map[chan<- ImageBundle]*Session),
+	}
+	ew.task = scheduler.NewTask(elementaryInterval, ew.tick)
+	ew.Start()
+	return ew
+}
+
+func (ew *ElementaryWorld) Start() {
+	ew.task.Start()
+}
+
+func (ew *ElementaryWorld) Close() {
+	ew.task.Stop()
+}
+
+// board lays the rows out top to bottom on a board, blank below the last.
+func (ew *ElementaryWorld) board() Board {
+	b := make(Board, 2*defaultWidth)
+	for x := range b {
+		b[x] = make([]bool, 2*defaultHeight)
+		for y, row := range ew.rows {
+			b[x][y] = row[x]
+		}
+	}
+	return b
+}
+
+func (ew *ElementaryWorld) tick() {
+	if d := budget.Interval(elementaryInterval); d != ew.task.Interval() {
+		ew.task.SetInterval(d)
+	}
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	if len(ew.subscribers) == 0 {
+		ew.task.Pause()
+		return
+	}
+
+	defer budget.Track(time.Now())
+	ew.rows = append(ew.rows, ew.rule.Next(ew.rows[len(ew.rows)-1]))
+	if len(ew.rows) > 2*defaultHeight {
+		ew.rows = ew.rows[1:]
+	}
+	ew.generation++
+	b := ew.board()
+	data, err := Frame{Board: b}.Svg(Style{Scale: elementaryScale})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	bundle := ImageBundle{
+		Data:        data,
+		ContentType: "image/svg+xml",
+		Generation:  ew.generation,
+		Population:  b.Population(),
+		Time:        time.Now(),
+	}
+	for ch, s := range ew.subscribers {
+		offer(ch, s, bundle)
+	}
+}
+
+func (ew *ElementaryWorld) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat("svg")
+	leave := viewerCounts.Join(s, fmt.Sprintf("elementary/%d", ew.rule))
+	ew.mu.Lock()
+	ew.subscribers[c] = s
+	ew.task.Resume()
+	ew.mu.Unlock()
+	return func() {
+		ew.mu.Lock()
+		delete(ew.subscribers, c)
+		ew.mu.Unlock()
+		leave()
+	}
+}
+
+// ElementaryWorlds starts an ElementaryWorld per rule asked for.
+type ElementaryWorlds struct {
+	mu     sync.Mutex
+	byRule map[ElementaryRule]*ElementaryWorld
+}
+
+func NewElementaryWorlds() *ElementaryWorlds {
+	return &ElementaryWorlds{byRule: make(map[ElementaryRule]*ElementaryWorld)}
+}
+
+func (ews *ElementaryWorlds) get(rule ElementaryRule) (*ElementaryWorld, error) {
+	ews.mu.Lock()
+	defer ews.mu.Unlock()
+	if ew, ok := ews.byRule[rule]; ok {
+		return ew, nil
+	}
+	if len(ews.byRule) >= maxElementaryWorlds {
+		return nil, &requestError{status: http.StatusServiceUnavailable, msg: fmt.Sprintf("%d elementary rules are already running", maxElementaryWorlds)}
+	}
+	ew := NewElementaryWorld(rule)
+	ews.byRule[rule] = ew
+	return ew, nil
+}
+
+func (ews *ElementaryWorlds) Close() {
+	ews.mu.Lock()
+	defer ews.mu.Unlock()
+	for _, ew := range ews.byRule {
+		ew.Close()
+	}
+}
+
+// Handle streams /elementary.svg under ?rule=, Rule 30 by default.
+func (ews *ElementaryWorlds) Handle(w http.ResponseWriter, r *http.Request) {
+	s := r.URL.Query().Get("rule")
+	if s == "" {
+		s = "30"
+	}
+	rule, err := ParseElementaryRule(s)
+	if err != nil {
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: err.Error()})
+		return
+	}
+	ew, err := ews.get(rule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	streamHandleFunc(ew)(w, r)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EmbedRender serves single cacheable frames of the default room for clients
+// that cannot consume streams, such as GitHub's camo image proxy. The frame is
+// the room's latest generation, taken again at most once per interval, and
+// every request keeps the room evolving, and reseeding, for a while.
+type EmbedRender struct {
+	mu       sync.Mutex
+	room     *GameRender
+	interval time.Duration
+	updated  time.Time
+	frame    ImageBundle
+}
+
+func NewEmbedRender(room *GameRender, interval time.Duration) *EmbedRender {
+	return &EmbedRender{
+		room:     room,
+		interval: interval,
+	}
+}
+
+// Frame returns the current PNG frame and the time it stops being current.
+func (r *EmbedRender) Frame() (ImageBundle, time.Time, error) {
+	r.room.Touch()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.frame.Data == nil || now.Sub(r.updated) >= r.interval {
+		latest := r.room.history.Latest()
+		f := Frame{Board: latest.Board, Rule: r.room.Rule(), Grid: r.room.opts.Grid, Generation: latest.Number}
+		frame, err := Encode("png", f, r.room.DefaultStyle())
+		if err != nil {
+			return ImageBundle{}, time.Time{}, err
+		}
+		r.frame = frame
+		r.updated = now.Truncate(time.Second)
+	}
+	return r.frame, r.updated.Add(r.interval), nil
+}
+
+func embedHandleFunc(render *EmbedRender) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		frame, expires, err := render.Frame()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		maxAge := int(time.Until(expires) / time.Second)
+		if maxAge < 0 {
+			maxAge = 0
+		}
+		w.Header().Set("Content-Type", frame.ContentType)
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+		w.Header().Set("Expires", expires.UTC().Format(http.TimeFormat))
+		w.Header().Set("Last-Modified", expires.Add(-render.interval).UTC().Format(http.TimeFormat))
+		if _, err := w.Write(frame.Data); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Encoder struct {
+	ContentType string
+	Encode      func(f Frame, st Style) ([]byte, error)
+}
+
+var encoders = map[string]Encoder{
+	"svg":  {ContentType: "image/svg+xml", Encode: Frame.Svg},
+	"png":  {ContentType: "image/png", Encode: Frame.Png},
+	"jpeg": {ContentType: "image/jpeg", Encode: Frame.Jpeg},
+
+	"pbm":       {ContentType: "image/x-portable-bitmap", Encode: Frame.Pbm},
+	"pbm-ascii": {ContentType: "image/x-portable-bitmap", Encode: Frame.PbmASCII},
+	"pgm":       {ContentType: "image/x-portable-graymap", Encode: Frame.Pgm},
+	"ppm":       {ContentType: "image/x-portable-pixmap", Encode: Frame.Ppm},
+	"xbm":       {ContentType: "image/x-xbitmap", Encode: Frame.Xbm},
+	"xpm":       {ContentType: "image/x-xpixmap", Encode: Frame.Xpm},
+	"bits":      {ContentType: "application/octet-stream", Encode: Frame.Bits},
+	"bmp":       {ContentType: "image/bmp", Encode: Frame.Bmp},
+}
+
+// Encode renders f in the named format, recording encode latency and output
+// size.
+func Encode(format string, f Frame, st Style) (ImageBundle, error) {
+	enc, ok := encoders[format]
+	if !ok {
+		return ImageBundle{}, fmt.Errorf("unknown format %q", format)
+	}
+
+	start := time.Now()
+	defer budget.Track(start)
+	data, err := enc.Encode(f, st)
+	if err != nil {
+		return ImageBundle{}, err
+	}
+	metrics.ObserveEncode(format, sizeClass(f.Board), time.Since(start), len(data))
+
+	return ImageBundle{Data: data, ContentType: enc.ContentType}, nil
+}
+
+// formatParam reads the ?format= parameter, falling back to def.
+func formatParam(r *http.Request, def string) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return def, nil
+	}
+	if _, ok := encoders[format]; !ok {
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown format %q", format)}
+	}
+	return format, nil
+}
+
+// styleParam reads the drawing style a request asks for on top of def.
+func styleParam(r *http.Request, def Style) (Style, error) {
+	st := def
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "":
+	case "delta":
+		st.Delta = true
+	case "pip":
+		st.Inset = true
+	case "age":
+		st.Age = true
+	default:
+		return Style{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown mode %q", mode)}
+	}
+	theme, err := themeParam(r, st.Theme)
+	if err != nil {
+		return Style{}, err
+	}
+	st.Theme = theme
+	if st.Modulate, err = modulateParam(r, st.Modulate); err != nil {
+		return Style{}, err
+	}
+	if st.Texture, err = textureParam(r, st.Texture); err != nil {
+		return Style{}, err
+	}
+	if st.Labels, err = labelsParam(r, st.Labels); err != nil {
+		return Style{}, err
+	}
+	if st.AutoZoom, err = zoomParam(r, st.AutoZoom); err != nil {
+		return Style{}, err
+	}
+	if st.Vectors, err = vectorsParam(r, st.Vectors); err != nil {
+		return Style{}, err
+	}
+	if st.Invert, err = invertParam(r, st.Invert); err != nil {
+		return Style{}, err
+	}
+	if st.Timeline, err = timelineParam(r, st.Timeline); err != nil {
+		return Style{}, err
+	}
+	if st.Counter, err = counterParam(r, st.Counter); err != nil {
+		return Style{}, err
+	}
+	return st, nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type EventKind string
+
+const (
+	// EventStamp sets the cells of a pattern alive.
+	EventStamp EventKind = "stamp"
+	// EventRule switches the rule used from this generation on.
+	EventRule EventKind = "rule"
+	// EventBoard replaces the whole board with a pattern.
+	EventBoard EventKind = "board"
+	// EventCombine applies Op between the board and a pattern.
+	EventCombine EventKind = "combine"
+	// EventResize grows or crops the board to Width by Height, keeping its
+	// cells centred.
+	EventResize EventKind = "resize"
+)
+
+// Event is a change made to a room's board or rule outside of evolution. An
+// event at generation g applies to the board of generation g, before the step
+// to g+1.
+type Event struct {
+	Generation uint64    `json:"generation"`
+	Time       time.Time `json:"time"`
+	Kind       EventKind `json:"kind"`
+	X          int       `json:"x,omitempty"`
+	Y          int       `json:"y,omitempty"`
+	Pattern    *Pattern  `json:"pattern,omitempty"`
+	Rule       *Rule     `json:"rule,omitempty"`
+	Op         BoardOp   `json:"op,omitempty"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+}
+
+func (e Event) Apply(b Board, rule Rule) (Board, Rule) {
+	switch e.Kind {
+	case EventStamp:
+		b = b.Clone()
+		b.Stamp(*e.Pattern, e.X, e.Y)
+	case EventRule:
+		rule = *e.Rule
+	case EventBoard:
+		b = b.mask(*e.Pattern, e.X, e.Y)
+		if e.Rule != nil {
+			rule = *e.Rule
+		}
+	case EventCombine:
+		b = b.Combine(e.Op, b.mask(*e.Pattern, e.X, e.Y))
+	case EventResize:
+		b = b.Resize(e.Width, e.Height)
+	}
+	return b, rule
+}
+
+// EventLog is an append-only record of a room's events.
+type EventLog struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (l *EventLog) Append(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *EventLog) Events() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Event(nil), l.events...)
+}
+
+func (r Rule) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rule) UnmarshalText(text []byte) error {
+	rule, err := ParseRule(string(text))
+	if err != nil {
+		return err
+	}
+	*r = rule
+	return nil
+}
+
+// replayCacheSize is how many replayed boards a room keeps.
+const replayCacheSize = 4
+
+// replayCache keeps a room's most recently replayed boards by generation.
+// Boards never change once replayed, since events only ever join the log at
+// the latest generation.
+type replayCache struct {
+	mu     sync.Mutex
+	boards []Generation
+}
+
+func (c *replayCache) get(gen uint64) (Board, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, g := range c.boards {
+		if g.Number == gen {
+			return g.Board, true
+		}
+	}
+	return nil, false
+}
+
+// nearest returns the latest board at or before gen.
+func (c *replayCache) nearest(gen uint64) (Generation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var best Generation
+	found := false
+	for _, g := range c.boards {
+		if g.Number <= gen && (!found || g.Number > best.Number) {
+			best, found = g, true
+		}
+	}
+	return best, found
+}
+
+func (c *replayCache) put(gen uint64, b Board) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, g := range c.boards {
+		if g.Number == gen {
+			return
+		}
+	}
+	c.boards = append(c.boards, Generation{Number: gen, Board: b})
+	if len(c.boards) > replayCacheSize {
+		c.boards = c.boards[len(c.boards)-replayCacheSize:]
+	}
+}
+
+// replayWindow returns the generations that can be replayed, from the
+// oldest checkpoint to the latest generation.
+func (r *GameRender) replayWindow() (oldest, latest uint64) {
+	return r.history.Oldest(), r.history.Latest().Number
+}
+
+// genParam parses the generation query parameter name, which must lie in
+// the room's replay window, defaulting to the latest generation.
+func genParam(r *http.Request, room *GameRender, name string) (uint64, error) {
+	oldest, latest := room.replayWindow()
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return latest, nil
+	}
+	gen, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || gen < oldest || gen > latest {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("%s must be between %d and %d", name, oldest, latest)}
+	}
+	return gen, nil
+}
+
+// Replay rebuilds the room's board at generation gen from the event log,
+// starting from the nearest checkpoint or board replayed before.
+func (r *GameRender) Replay(gen uint64) (Board, Rule, error) {
+	events := r.events.Events()
+	if b, ok := r.replays.get(gen); ok {
+		return b, r.ruleAt(events, gen), nil
+	}
+	b, rule, _, err := r.replayFrom(events, gen)
+	return b, rule, err
+}
+
+// replayFrom rebuilds the board at generation gen from the nearest
+// checkpoint at or before it, or from a board replayed before if that is
+// nearer, caching the board it ends on and the one before. For an unbounded
+// room it also returns the plane around the board, and nil otherwise. It
+// fails for generations older than the oldest checkpoint.
+func (r *GameRender) replayFrom(events []Event, gen uint64) (Board, Rule, *Viewport, error) {
+	c, ok := r.history.Checkpoint(gen)
+	if !ok {
+		oldest, latest := r.replayWindow()
+		return nil, Rule{}, nil, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("generation %d is not between %d and %d", gen, oldest, latest)}
+	}
+	b, plane, from := c.Board, c.Plane, c.Number
+	if plane != nil {
+		plane = plane.Clone()
+	} else if g, ok := r.replays.nearest(gen); ok && g.Number > from {
+		b, from = g.Board, g.Number
+	}
+	rule := r.ruleAt(events, from)
+	next := sort.Search(len(events), func(i int) bool { return events[i].Generation > from })
+	for g := from + 1; g <= gen; g++ {
+		if g == gen {
+			r.replays.put(g-1, b)
+		}
+		b = advance(r.opts, plane, rule, b)
+		for ; next < len(events) && events[next].Generation == g; next++ {
+			b, rule = apply(plane, events[next], b, rule)
+		}
+	}
+	r.replays.put(gen, b)
+	return b, rule, plane, nil
+}
+
+// replay rebuilds the board at generation gen of a room with opts started
+// from seed, applying events along the way. For an unbounded room it also
+// returns the viewport onto the plane around the board, and nil otherwise. A
+// resumed room has no generations before the one it resumed at.
+func replay(opts RoomOptions, seed int64, events []Event, gen uint64) (Board, Rule, *Viewport) {
+	b, rule := opts.board(seed), opts.rule()
+	v := opts.viewport(b)
+	if gen < opts.ResumeAt {
+		gen = opts.ResumeAt
+	}
+
+	next := 0
+	for g := opts.ResumeAt; ; g++ {
+		for ; next < len(events) && events[next].Generation == g; next++ {
+			b, rule = apply(v, events[next], b, rule)
+		}
+		if g == gen {
+			return b, rule, v
+		}
+		b = advance(opts, v, rule, b)
+	}
+}
+
+// ruleAt returns the rule the events leave in place for the step from gen.
+func (r *GameRender) ruleAt(events []Event, gen uint64) Rule {
+	rule := r.opts.rule()
+	for _, e := range events {
+		if (e.Kind == EventRule || e.Kind == EventBoard) && e.Rule != nil && e.Generation <= gen {
+			rule = *e.Rule
+		}
+	}
+	return rule
+}
+
+type replayJSON struct {
+	Seed   int64 `json:"seed"`
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	Scale  int   `json:"scale"`
+	// Rule is the rule the room started with; events may change it.
+	Rule     Rule     `json:"rule"`
+	States   uint8    `json:"states,omitempty"`
+	Topology Topology `json:"topology"`
+	Grid     Grid     `json:"grid"`
+	HashLife bool     `json:"hashlife,omitempty"`
+	Step     uint     `json:"step,omitempty"`
+	Start    Start    `json:"start"`
+	Density  float64  `json:"density"`
+	Symmetry Symmetry `json:"symmetry"`
+	Noise    float64  `json:"noise"`
+	Level    float64  `json:"level"`
+	// Resume is the board a resumed room carried on from at ResumeAt.
+	Resume     *Pattern `json:"resume,omitempty"`
+	ResumeAt   uint64   `json:"resumeAt,omitempty"`
+	Generation uint64   `json:"generation"`
+	Verified   bool     `json:"verified"`
+	Events     []Event  `json:"events"`
+}
+
+// options returns the options of the room the replay is of.
+func (rj replayJSON) options() RoomOptions {
+	o := RoomOptions{Width: rj.Width, Height: rj.Height, Scale: rj.Scale, Rule: rj.Rule, States: rj.States, Topology: rj.Topology, Grid: rj.Grid, Start: rj.Start, Density: rj.Density, Symmetry: rj.Symmetry, Noise: rj.Noise, Level: rj.Level, ResumeAt: rj.ResumeAt, HashLife: rj.HashLife, Step: rj.Step}
+	if rj.Resume != nil {
+		o.Resume = make(Board, rj.Width)
+		for i := range o.Resume {
+			o.Resume[i] = make([]bool, rj.Height)
+		}
+		o.Resume.Stamp(*rj.Resume, 0, 0)
+	}
+	return o
+}
+
+// replayJSONHandle returns everything needed to replay the room, and whether
+// replaying the events since the last checkpoint reproduces the live board.
+func replayJSONHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	latest := room.history.Latest()
+	b, _, err := room.Replay(latest.Number)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := replayJSON{
+		Seed:       room.seed,
+		Width:      room.opts.Width,
+		Height:     room.opts.Height,
+		Scale:      room.opts.Scale,
+		Rule:       room.opts.rule(),
+		States:     room.opts.States,
+		Topology:   room.opts.topology(),
+		Grid:       room.opts.grid(),
+		HashLife:   room.opts.HashLife,
+		Step:       room.opts.Step,
+		Start:      room.opts.start(),
+		Density:    room.opts.density(),
+		Symmetry:   room.opts.symmetry(),
+		Noise:      room.opts.Noise,
+		Level:      room.opts.level(),
+		ResumeAt:   room.opts.ResumeAt,
+		Generation: latest.Number,
+		Verified:   b.Hash() == latest.Hash,
+		Events:     room.events.Events(),
+	}
+	if room.opts.Resume != nil {
+		p := room.opts.Resume.Pattern()
+		resp.Resume = &p
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// replayHandle renders the room as it was at ?gen=, defaulting to the latest
+// generation.
+func replayHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	format, err := formatParam(r, "svg")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	st, err := styleParam(r, room.DefaultStyle())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	gen, err := genParam(r, room, "gen")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var b Board
+	var rule Rule
+	var plane *Viewport
+	if room.opts.States > 2 {
+		// Cached replays keep boards, not the states of their cells.
+		b, rule, plane, err = room.replayFrom(room.events.Events(), gen)
+	} else {
+		b, rule, err = room.Replay(gen)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	frame := Frame{Board: b, Rule: rule, Topology: room.opts.Topology, Grid: room.opts.Grid, Generation: gen}
+	if plane != nil && plane.Cells != nil {
+		frame.Cells, frame.States = plane.Cells, plane.States
+	}
+	if oldest, _ := room.replayWindow(); gen > oldest {
+		if frame.Prev, _, err = room.Replay(gen - 1); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	bundle, err := Encode(format, frame, st)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", bundle.ContentType)
+	if _, err := w.Write(bundle.Data); err != nil {
+		fmt.Println(err)
+	}
+}
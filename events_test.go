@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplayFromCheckpoints(t *testing.T) {
+	highLife, err := ParseRule("highlife")
+	if err != nil {
+		t.Fatal(err)
+	}
+	glider := patterns["glider"]
+	events := []Event{
+		{Generation: 1500, Kind: EventStamp, X: 4, Y: 4, Pattern: &glider},
+		{Generation: 2100, Kind: EventRule, Rule: &highLife},
+		{Generation: 3000, Kind: EventBoard, Pattern: &glider},
+		{Generation: 3000, Kind: EventCombine, X: 10, Y: 10, Pattern: &glider, Op: OpUnion},
+	}
+	const last = 4500
+	for _, topology := range []Topology{Torus, Unbounded} {
+		opts := RoomOptions{Width: 32, Height: 24, Scale: 1, Topology: topology}
+		r := &GameRender{opts: opts, seed: 7, history: NewHistory(8)}
+		for _, e := range events {
+			r.events.Append(e)
+		}
+
+		// Run the room as it runs live, keeping checkpoints as it goes.
+		b, rule := opts.board(r.seed), opts.rule()
+		plane := opts.viewport(b)
+		next := 0
+		for g := uint64(0); ; g++ {
+			for ; next < len(events) && events[next].Generation == g; next++ {
+				b, rule = apply(plane, events[next], b, rule)
+			}
+			r.history.Push(g, b)
+			if g%checkpointEvery == 0 {
+				c := Checkpoint{Number: g, Board: b}
+				if plane != nil {
+					c.Plane = plane.Clone()
+				}
+				r.history.Keep(c)
+			}
+			if g == last {
+				break
+			}
+			b = advance(opts, plane, rule, b)
+		}
+
+		if oldest, latest := r.replayWindow(); oldest != last-last%checkpointEvery-(maxCheckpoints-1)*checkpointEvery || latest != last {
+			t.Errorf("%s: replay window %d to %d", topology, oldest, latest)
+		}
+		for _, gen := range []uint64{1000, 1499, 1500, 2100, 2101, 2999, 3000, 3001, 3999, 4000, last, 2500, 2501} {
+			got, gotRule, err := r.Replay(gen)
+			if err != nil {
+				t.Errorf("%s: generation %d: %v", topology, gen, err)
+				continue
+			}
+			want, wantRule, _ := replay(opts, r.seed, events, gen)
+			if !reflect.DeepEqual(got, want) || gotRule != wantRule {
+				t.Errorf("%s: generation %d differs from replaying it from the seed", topology, gen)
+			}
+		}
+		if _, _, err := r.Replay(999); err == nil {
+			t.Errorf("%s: replayed a generation older than the oldest checkpoint", topology)
+		}
+	}
+}
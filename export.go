@@ -0,0 +1,167 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Frames calls f with n consecutive frames starting at generation from, which
+// may be archived or the latest. Frames past the latest generation are
+// simulated without changing the room.
+func (r *GameRender) Frames(from uint64, n int, f func(gen uint64, frame Frame) error) error {
+	events := r.events.Events()
+	var b Board
+	var rule Rule
+	var plane *Viewport
+	if g, ok := r.history.Find(func(g Generation) bool { return g.Number == from }); ok && r.opts.topology() != Unbounded && r.opts.States <= 2 {
+		b, rule = g.Board, r.ruleAt(events, from)
+	} else {
+		// Unbounded rooms need the plane around the board too, and
+		// multi-state rooms the states of its cells.
+		var err error
+		if b, rule, plane, err = r.replayFrom(events, from); err != nil {
+			return err
+		}
+	}
+
+	var prev Board
+	for gen := from; gen < from+uint64(n); gen++ {
+		if gen > from {
+			prev, b = b, advance(r.opts, plane, rule, b)
+			for _, e := range events {
+				if e.Generation == gen {
+					b, rule = apply(plane, e, b, rule)
+				}
+			}
+		}
+		frame := Frame{Board: b, Prev: prev, Rule: rule, Topology: r.opts.Topology, Grid: r.opts.Grid, Generation: gen}
+		if plane != nil && plane.Cells != nil {
+			frame.Cells, frame.States = plane.Cells, plane.States
+		}
+		if r.cfg.MutateEvery > 0 {
+			frame.Caption = rule.String()
+		}
+		if err := f(gen, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportLimits bounds the work a single frame export may ask for.
+type ExportLimits struct {
+	MaxGenerations int
+	MaxPixels      int
+}
+
+var zipExtensions = map[string]string{
+	"svg":       "svg",
+	"png":       "png",
+	"jpeg":      "jpg",
+	"pbm":       "pbm",
+	"pbm-ascii": "pbm",
+	"pgm":       "pgm",
+	"ppm":       "ppm",
+	"xbm":       "xbm",
+	"xpm":       "xpm",
+}
+
+// exportHandleFunc streams ?generations= frames from ?from= (the latest
+// generation by default) as a ZIP of numbered images.
+func exportHandleFunc(limits ExportLimits) func(*GameRender, http.ResponseWriter, *http.Request) {
+	return func(room *GameRender, w http.ResponseWriter, r *http.Request) {
+		format, err := formatParam(r, "png")
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		st, err := styleParam(r, room.DefaultStyle())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		n, err := intParam(r, "generations", 100)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if n < 1 || n > limits.MaxGenerations {
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("generations must be between 1 and %d", limits.MaxGenerations)})
+			return
+		}
+		width, height := room.Size()
+		if pixels := width * height * st.Scale * st.Scale; pixels > limits.MaxPixels {
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("frames of %d pixels exceed the export limit of %d", pixels, limits.MaxPixels)})
+			return
+		}
+		from, err := genParam(r, room, "from")
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="frames.zip"`)
+		zw := zip.NewWriter(w)
+		err = room.Frames(from, n, func(gen uint64, frame Frame) error {
+			if err := r.Context().Err(); err != nil {
+				return err
+			}
+			var bundle ImageBundle
+			var err error
+			room.cfg.Pool.Do(func() {
+				bundle, err = Encode(format, frame, st)
+			})
+			if err != nil {
+				return err
+			}
+			header := &zip.FileHeader{Name: fmt.Sprintf("%08d.%s", gen, zipExtensions[format]), Method: zip.Deflate, Modified: time.Now()}
+			if format == "png" || format == "jpeg" {
+				header.Method = zip.Store
+			}
+			f, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			_, err = f.Write(bundle.Data)
+			return err
+		})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := zw.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// patternHandleFunc serves the room's latest generation as a pattern file
+// Golly can open: "rle", with the rule and, on a torus, its bounded grid, or
+// "lif" for Life 1.06.
+func patternHandleFunc(kind string) func(*GameRender, http.ResponseWriter, *http.Request) {
+	return func(room *GameRender, w http.ResponseWriter, r *http.Request) {
+		latest := room.history.Latest()
+		p := latest.Board.Pattern()
+		var data string
+		switch kind {
+		case "rle":
+			rule := room.ruleAt(room.events.Events(), latest.Number).String()
+			if room.opts.Topology == Torus {
+				rule += fmt.Sprintf(":T%d,%d", p.W, p.H)
+			}
+			data = EncodeRLE(p, rule, fmt.Sprintf("Generation %d of room %s", latest.Number, room.name))
+		case "lif":
+			data = EncodeLife106(p)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="board-%d.%s"`, latest.Number, kind))
+		if _, err := io.WriteString(w, data); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
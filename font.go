@@ -0,0 +1,99 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// fontGlyphs is a 3x5 pixel font; each glyph is five rows of three pixels.
+var fontGlyphs = map[rune][5]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"##.", "..#", ".#.", "#..", "###"},
+	'3': {"##.", "..#", ".#.", "..#", "##."},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "##.", "..#", "##."},
+	'6': {".##", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "##."},
+	'A': {".#.", "#.#", "###", "#.#", "#.#"},
+	'B': {"##.", "#.#", "##.", "#.#", "##."},
+	'C': {".##", "#..", "#..", "#..", ".##"},
+	'D': {"##.", "#.#", "#.#", "#.#", "##."},
+	'E': {"###", "#..", "##.", "#..", "###"},
+	'F': {"###", "#..", "##.", "#..", "#.."},
+	'G': {".##", "#..", "#.#", "#.#", ".##"},
+	'H': {"#.#", "#.#", "###", "#.#", "#.#"},
+	'I': {"###", ".#.", ".#.", ".#.", "###"},
+	'J': {"..#", "..#", "..#", "#.#", ".#."},
+	'K': {"#.#", "#.#", "##.", "#.#", "#.#"},
+	'L': {"#..", "#..", "#..", "#..", "###"},
+	'M': {"#.#", "###", "###", "#.#", "#.#"},
+	'N': {"##.", "#.#", "#.#", "#.#", "#.#"},
+	'O': {".#.", "#.#", "#.#", "#.#", ".#."},
+	'P': {"##.", "#.#", "##.", "#..", "#.."},
+	'Q': {".#.", "#.#", "#.#", "##.", ".##"},
+	'R': {"##.", "#.#", "##.", "#.#", "#.#"},
+	'S': {".##", "#..", ".#.", "..#", "##."},
+	'T': {"###", ".#.", ".#.", ".#.", ".#."},
+	'U': {"#.#", "#.#", "#.#", "#.#", "###"},
+	'V': {"#.#", "#.#", "#.#", "#.#", ".#."},
+	'W': {"#.#", "#.#", "###", "###", "#.#"},
+	'X': {"#.#", "#.#", ".#.", "#.#", "#.#"},
+	'Y': {"#.#", "#.#", ".#.", ".#.", ".#."},
+	'Z': {"###", "..#", ".#.", "#..", "###"},
+	' ': {"...", "...", "...", "...", "..."},
+	'/': {"..#", "..#", ".#.", "#..", "#.."},
+	'-': {"...", "...", "###", "...", "..."},
+	'.': {"...", "...", "...", "...", ".#."},
+	':': {"...", ".#.", "...", ".#.", "..."},
+	'!': {".#.", ".#.", ".#.", "...", ".#."},
+	'?': {"##.", "..#", ".#.", "...", ".#."},
+}
+
+const (
+	glyphWidth   = 3
+	glyphHeight  = 5
+	glyphAdvance = glyphWidth + 1
+)
+
+// textPixels calls f for every lit pixel of s set in the 3x5 font, one unit
+// per pixel. Characters without a glyph are skipped as blanks.
+func textPixels(s string, f func(x, y int)) {
+	for n, ch := range strings.ToUpper(s) {
+		g, ok := fontGlyphs[ch]
+		if !ok {
+			continue
+		}
+		for y, row := range g {
+			for x, px := range row {
+				if px == '#' {
+					f(n*glyphAdvance+x, y)
+				}
+			}
+		}
+	}
+}
+
+func textWidth(s string) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return n*glyphAdvance - 1
+}
+
+// drawCaption writes s at the top-left corner of img, k pixels per font pixel,
+// on a translucent white backing so it stays legible over the board.
+func drawCaption(img draw.Image, s string, k int) {
+	pad := k
+	back := image.Rect(0, 0, textWidth(s)*k+2*pad, glyphHeight*k+2*pad)
+	draw.Draw(img, back, &image.Uniform{C: color.RGBA{R: 255, G: 255, B: 255, A: 200}}, image.Point{}, draw.Over)
+	ink := &image.Uniform{C: color.RGBA{R: 200, A: 255}}
+	textPixels(s, func(x, y int) {
+		draw.Draw(img, image.Rect(pad+x*k, pad+y*k, pad+(x+1)*k, pad+(y+1)*k), ink, image.Point{}, draw.Src)
+	})
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// freeze holds the room still once it has run cfg.FreezeAfter generations
+// since it was last seeded, for cfg.FreezeHold, and then reseeds it with a new
+// soup as generation gen+1. It reports whether the tick was spent frozen or
+// reseeding, instead of evolving. Mazes under Maze and Mazectric grow for a
+// while and then barely change, so holding the finished maze and starting
+// another shows them off better than letting it sit.
+func (r *GameRender) freeze(gen uint64, b Board) bool {
+	if r.cfg.FreezeAfter == 0 || gen-r.seeded < r.cfg.FreezeAfter {
+		return false
+	}
+	if r.frozen.IsZero() {
+		r.frozen = time.Now()
+		log.Printf("room %s: frozen at gen %d", r.name, gen)
+	}
+	if time.Since(r.frozen) < r.cfg.FreezeHold {
+		return true
+	}
+	r.reseed(gen, b, "frozen")
+	r.frozen = time.Time{}
+	return true
+}
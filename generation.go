@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net/http"
+	"strconv"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+// Generation returns the number of the room's latest generation, counted
+// from the board it started with.
+func (r *GameRender) Generation() uint64 {
+	return r.history.Latest().Number
+}
+
+// counterText is how a frame's generation is drawn over it.
+func (f Frame) counterText() string {
+	return "gen " + strconv.FormatUint(f.Generation, 10)
+}
+
+// drawCounter writes the frame's generation at the top-right corner of img,
+// k pixels per font pixel, backed like a caption.
+func (f Frame) drawCounter(img draw.Image, k int) {
+	s := f.counterText()
+	pad := k
+	w := textWidth(s)*k + 2*pad
+	x0 := img.Bounds().Max.X - w
+	back := image.Rect(x0, 0, x0+w, glyphHeight*k+2*pad)
+	draw.Draw(img, back, &image.Uniform{C: color.RGBA{R: 255, G: 255, B: 255, A: 200}}, image.Point{}, draw.Over)
+	ink := &image.Uniform{C: color.RGBA{A: 255}}
+	textPixels(s, func(x, y int) {
+		draw.Draw(img, image.Rect(x0+pad+x*k, pad+y*k, x0+pad+(x+1)*k, pad+(y+1)*k), ink, image.Point{}, draw.Src)
+	})
+}
+
+// svgCounter writes the frame's generation at the top-right corner of a
+// canvas w pixels wide.
+func (f Frame) svgCounter(canvas *svg.SVG, w int) {
+	s := f.counterText()
+	bw := 9*len(s) + 8
+	canvas.Rect(w-bw, 0, bw, 22, `fill="white"`, `fill-opacity="0.8"`)
+	canvas.Text(w-4, 11, s,
+		`font-size="14"`, `font-family="monospace"`, `fill="black"`,
+		`dominant-baseline="middle"`, `text-anchor="end"`,
+	)
+}
+
+// counterParam reads ?counter=, which draws each frame's generation.
+func counterParam(r *http.Request, def bool) (bool, error) {
+	s := r.URL.Query().Get("counter")
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("counter must be true or false, not %q", s)}
+	}
+	return v, nil
+}
+
+type generationJSON struct {
+	Room       string `json:"room"`
+	Generation uint64 `json:"generation"`
+}
+
+// generationHandle reports the room's latest generation for /generation, as
+// JSON or, with ?format=text, as just the number for overlays that show a
+// file's text. Polling it keeps the room evolving.
+func generationHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	room.Touch()
+	gen := room.Generation()
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(generationJSON{Room: room.name, Generation: gen}); err != nil {
+			fmt.Println(err)
+		}
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := fmt.Fprintln(w, gen); err != nil {
+			fmt.Println(err)
+		}
+	default:
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown format %q, want json or text", format)})
+	}
+}
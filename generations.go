@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Generations is a rule of the Generations family: Life-like births and
+// survivals, except that a live cell that fails to survive spends States-2
+// generations dying before it is dead, neither counting as a neighbour nor
+// able to be born again meanwhile.
+type Generations struct {
+	Rule   Rule
+	States uint8
+}
+
+// namedGenerations are well-known rules ParseGenerations accepts by name.
+var namedGenerations = map[string]string{
+	"brians-brain": "/2/3",
+	"brianbrain":   "/2/3",
+	"star-wars":    "345/2/4",
+	"frogs":        "12/34/3",
+	"spirals":      "2/234/5",
+}
+
+// ParseGenerations parses a Generations rule in B/S/C notation, like
+// B2/S345/C4, with the parts in any order and in either case, or in the S/B/C
+// notation without letters, like 345/2/4. It also accepts the names in
+// namedGenerations.
+func ParseGenerations(s string) (Generations, error) {
+	s = strings.TrimSpace(s)
+	if named, ok := namedGenerations[strings.ToLower(s)]; ok {
+		s = named
+	}
+	parts := strings.Split(strings.ToUpper(s), "/")
+	if len(parts) != 3 {
+		return Generations{}, fmt.Errorf("bad rule %q: want B2/S345/C4", s)
+	}
+	states := parts[2]
+	for i, part := range parts {
+		if strings.HasPrefix(part, "C") {
+			states = part[1:]
+			parts = append(parts[:i:i], parts[i+1:]...)
+			break
+		}
+	}
+	if len(parts) == 3 {
+		parts = parts[:2]
+	}
+	n, err := strconv.Atoi(states)
+	if err != nil || n < 2 || n > 255 {
+		return Generations{}, fmt.Errorf("bad rule %q: the number of states goes from 2 to 255", s)
+	}
+	rule, err := ParseRule(parts[0] + "/" + parts[1])
+	if err != nil {
+		return Generations{}, err
+	}
+	if rule.Birth&1 != 0 {
+		return Generations{}, fmt.Errorf("bad rule %q: B0 rules are not supported", s)
+	}
+	if !rule.moore() {
+		return Generations{}, fmt.Errorf("bad rule %q: von Neumann and Larger than Life rules are not supported", s)
+	}
+	return Generations{Rule: rule, States: uint8(n)}, nil
+}
+
+func (g Generations) String() string {
+	return g.Rule.String() + "/C" + strconv.Itoa(int(g.States))
+}
+
+// StateBoard is a board of multi-state cells, indexed like Board: 0 is dead,
+// 1 alive, and 2 up to the rule's States-1 dying, the higher the closer to
+// dead.
+type StateBoard [][]uint8
+
+// NewStateBoard returns b's cells as live and dead states.
+func NewStateBoard(b Board) StateBoard {
+	s := make(StateBoard, len(b))
+	for i, col := range b {
+		s[i] = make([]uint8, len(col))
+		for j, alive := range col {
+			if alive {
+				s[i][j] = 1
+			}
+		}
+	}
+	return s
+}
+
+// Alive returns the board of cells in the live state.
+func (s StateBoard) Alive() Board {
+	b := make(Board, len(s))
+	for i, col := range s {
+		b[i] = make([]bool, len(col))
+		for j, state := range col {
+			b[i][j] = state == 1
+		}
+	}
+	return b
+}
+
+// Step advances s one generation. Only live cells count as neighbours, so the
+// live cells step like a Life-like board, births aside on dying cells.
+func (g Generations) Step(s StateBoard) StateBoard {
+	return g.step(s, g.Rule.Evolute(s.Alive()))
+}
+
+// step is Step given next, s's live cells stepped under the rule.
+func (g Generations) step(s StateBoard, next Board) StateBoard {
+	out := make(StateBoard, len(s))
+	for i, col := range s {
+		out[i] = make([]uint8, len(col))
+		for j, state := range col {
+			switch {
+			case state == 0 && next[i][j], state == 1 && next[i][j]:
+				out[i][j] = 1
+			case state == 0:
+			case int(state)+1 < int(g.States):
+				out[i][j] = state + 1
+			}
+		}
+	}
+	return out
+}
+
+// decayColor is the colour of a cell in a dying state of n, the palette's
+// dying colour fading into the background as the cell nears death.
+func decayColor(pal *Palette, state, n uint8) color.RGBA {
+	k := float64(n-state) / float64(n-2)
+	bg := insetBackground(pal)
+	return mixColor(pal.Dying, color.RGBA{R: bg.R, G: bg.G, B: bg.B, A: pal.Dying.A}, k)
+}
+
+// maxGenerationsWorlds bounds how many Generations rules run at once.
+const maxGenerationsWorlds = 8
+
+// GenerationsWorld runs a soup under a Generations rule for
+// /generations.svg, pausing while nobody watches.
+type GenerationsWorld struct {
+	rule Generations
+	task *Task
+
+	mu          sync.Mutex
+	cells       StateBoard
+	generation  uint64
+	subscribers map[chan<- ImageBundle]*Session
+}
+
+func NewGenerationsWorld(rule Generations) *GenerationsWorld {
+	gw := &GenerationsWorld{
+		rule:        rule,
+		cells:       NewStateBoard(NewBoard(defaultWidth, defaultHeight)),
+		subscribers: make(map[chan<- ImageBundle]*Session),
+	}
+	gw.task = scheduler.NewTask(time.Second, gw.tick)
+	gw.Start()
+	return gw
+}
+
+func (gw *GenerationsWorld) Start() {
+	gw.task.Start()
+}
+
+func (gw *GenerationsWorld) Close() {
+	gw.task.Stop()
+}
+
+func (gw *GenerationsWorld) frame() Frame {
+	return Frame{Board: gw.cells.Alive(), Rule: gw.rule.Rule, Cells: gw.cells, States: gw.rule.States}
+}
+
+func (gw *GenerationsWorld) tick() {
+	if d := budget.Interval(time.Second); d != gw.task.Interval() {
+		gw.task.SetInterval(d)
+	}
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	if len(gw.subscribers) == 0 {
+		gw.task.Pause()
+		return
+	}
+
+	defer budget.Track(time.Now())
+	gw.cells = gw.rule.Step(gw.cells)
+	gw.generation++
+	f := gw.frame()
+	data, err := f.Svg(Style{Scale: defaultScale})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	bundle := ImageBundle{
+		Data:        data,
+		ContentType: "image/svg+xml",
+		Generation:  gw.generation,
+		Population:  f.Board.Population(),
+		Time:        time.Now(),
+	}
+	for ch, s := range gw.subscribers {
+		offer(ch, s, bundle)
+	}
+}
+
+func (gw *GenerationsWorld) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat("svg")
+	leave := viewerCounts.Join(s, "generations/"+gw.rule.String())
+	gw.mu.Lock()
+	gw.subscribers[c] = s
+	gw.task.Resume()
+	gw.mu.Unlock()
+	return func() {
+		gw.mu.Lock()
+		delete(gw.subscribers, c)
+		gw.mu.Unlock()
+		leave()
+	}
+}
+
+// GenerationsWorlds starts a GenerationsWorld per rule asked for.
+type GenerationsWorlds struct {
+	mu     sync.Mutex
+	byRule map[Generations]*GenerationsWorld
+}
+
+func NewGenerationsWorlds() *GenerationsWorlds {
+	return &GenerationsWorlds{byRule: make(map[Generations]*GenerationsWorld)}
+}
+
+func (gws *GenerationsWorlds) get(rule Generations) (*GenerationsWorld, error) {
+	gws.mu.Lock()
+	defer gws.mu.Unlock()
+	if gw, ok := gws.byRule[rule]; ok {
+		return gw, nil
+	}
+	if len(gws.byRule) >= maxGenerationsWorlds {
+		return nil, &requestError{status: http.StatusServiceUnavailable, msg: fmt.Sprintf("%d Generations rules are already running", maxGenerationsWorlds)}
+	}
+	gw := NewGenerationsWorld(rule)
+	gws.byRule[rule] = gw
+	return gw, nil
+}
+
+func (gws *GenerationsWorlds) Close() {
+	gws.mu.Lock()
+	defer gws.mu.Unlock()
+	for _, gw := range gws.byRule {
+		gw.Close()
+	}
+}
+
+// Handle streams /generations.svg and snapshots /generations.png under
+// ?rule=, Star Wars by default.
+func (gws *GenerationsWorlds) Handle(w http.ResponseWriter, r *http.Request) {
+	s := r.URL.Query().Get("rule")
+	if s == "" {
+		s = "star-wars"
+	}
+	rule, err := ParseGenerations(s)
+	if err != nil {
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: err.Error()})
+		return
+	}
+	gw, err := gws.get(rule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if r.URL.Path == "/generations.svg" {
+		streamHandleFunc(gw)(w, r)
+		return
+	}
+	gw.mu.Lock()
+	f := gw.frame()
+	gw.mu.Unlock()
+	data, err := f.Png(Style{Scale: defaultScale})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if _, err := w.Write(data); err != nil {
+		fmt.Println(err)
+	}
+}
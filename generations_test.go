@@ -0,0 +1,162 @@
+package main
+
+import (
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseGenerations(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"B2/S345/C4", "B2/S345/C4"},
+		{"b2/s345/c4", "B2/S345/C4"},
+		{"C4/S345/B2", "B2/S345/C4"},
+		{"345/2/4", "B2/S345/C4"},
+		{"/2/3", "B2/S/C3"},
+		{"B2/S/C255", "B2/S/C255"},
+		{"brians-brain", "B2/S/C3"},
+	}
+	for _, tt := range tests {
+		g, err := ParseGenerations(tt.in)
+		if err != nil {
+			t.Errorf("ParseGenerations(%q): %v", tt.in, err)
+			continue
+		}
+		if got := g.String(); got != tt.want {
+			t.Errorf("ParseGenerations(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+		again, err := ParseGenerations(g.String())
+		if err != nil || again != g {
+			t.Errorf("%s parses back as %v, %v", g, again, err)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"B3/S23",
+		"B2/S345/C1",
+		"B2/S345/C256",
+		"B2/S345/Cx",
+		"B2/S345/C4/C4",
+		"B02/S345/C4",
+		"B2/S345V/C4",
+		"B9/S345/C4",
+	} {
+		if g, err := ParseGenerations(in); err == nil {
+			t.Errorf("ParseGenerations(%q) = %s, want an error", in, g)
+		}
+	}
+}
+
+// stateRows returns s as rows of digits, one per cell state.
+func stateRows(s StateBoard) []string {
+	rows := make([]string, len(s[0]))
+	for j := range rows {
+		for i := range s {
+			rows[j] += string(rune('0' + s[i][j]))
+		}
+	}
+	return rows
+}
+
+func TestStatesViewport(t *testing.T) {
+	brain, err := ParseGenerations("brianbrain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RoomOptions{Rule: brain.Rule, States: brain.States}
+	v := opts.viewport(cellsBoard(t,
+		".....",
+		".....",
+		".OO..",
+		".....",
+		".....",
+	))
+	steps := [][]string{
+		{"00000", "01100", "02200", "01100", "00000"},
+		{"01100", "02200", "10010", "02200", "01100"},
+	}
+	for i, want := range steps {
+		b := advance(opts, v, opts.rule(), v.Board())
+		if got := stateRows(v.Cells); !reflect.DeepEqual(got, want) {
+			t.Errorf("generation %d = %q, want %q", i+1, got, want)
+		}
+		if !reflect.DeepEqual(b, v.Cells.Alive()) {
+			t.Errorf("generation %d: board is not the live cells", i+1)
+		}
+	}
+
+	// Stamping keeps the dying cells; replacing the board clears them.
+	glider := patterns["glider"]
+	c := v.Clone()
+	c.Apply(Event{Kind: EventStamp, Pattern: &Pattern{W: 1, H: 1, Cells: [][2]int{{0, 0}}}, X: 4, Y: 4}, brain.Rule)
+	if got := stateRows(c.Cells); got[1] != "02200" || got[4] != "01101" {
+		t.Errorf("after stamping = %q", got)
+	}
+	if stateRows(v.Cells)[4] != "01100" {
+		t.Error("stamping a clone changed the original")
+	}
+	c.Apply(Event{Kind: EventBoard, Pattern: &glider}, brain.Rule)
+	for _, col := range c.Cells {
+		for _, state := range col {
+			if state > 1 {
+				t.Fatalf("dying cells survive a new board: %q", stateRows(c.Cells))
+			}
+		}
+	}
+}
+
+func TestStatesFrame(t *testing.T) {
+	cells := StateBoard{{1, 2, 0}}
+	f := Frame{Board: cells.Alive(), Rule: Conway, Cells: cells, States: 3}
+	st := Style{Scale: 1}
+	pal := f.palette(st)
+	img := f.image(st)
+	for y, want := range []color.RGBA{pal.Alive, pal.Dying} {
+		if got := color.RGBAModel.Convert(img.At(0, y)); got != want {
+			t.Errorf("cell in state %d drawn %v, want %v", cells[0][y], got, want)
+		}
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 2)); got == pal.Alive || got == pal.Dying {
+		t.Errorf("dead cell drawn %v", got)
+	}
+}
+
+func TestLookupGenerations(t *testing.T) {
+	rs := NewRooms(Limits{MaxWidth: 100, MaxHeight: 100, MaxScale: 10, MemoryBudget: 1 << 30}, GameConfig{History: 8})
+	defer rs.Close()
+	tests := []struct {
+		query  string
+		name   string
+		states uint8
+		status int
+	}{
+		{"rule=brianbrain", "default-B2SC3", 3, 0},
+		{"rule=B2/S/C3&topology=torus", "default-B2SC3-torus", 3, 0},
+		{"rule=B3/S23/C2&w=20&h=20", "20x20x10", 2, 0},
+		{"rule=brianbrain&grid=hex", "", 0, http.StatusBadRequest},
+		{"rule=brianbrain&topology=unbounded", "", 0, http.StatusBadRequest},
+		{"rule=brianbrain&room=default", "", 0, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		room, err := rs.Lookup(httptest.NewRequest(http.MethodGet, "/game.svg?"+tt.query, nil))
+		if tt.status != 0 {
+			if re, ok := err.(*requestError); !ok || re.status != tt.status {
+				t.Errorf("%s: error %v, want status %d", tt.query, err, tt.status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if room.name != tt.name || room.opts.states() != tt.states {
+			t.Errorf("%s: room %s with %d states, want %s with %d", tt.query, room.name, room.opts.states(), tt.name, tt.states)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	svg "github.com/ajstarks/svgo"
+	"github.com/oschwald/geoip2-golang"
+)
+
+const unknownCountry = "??"
+
+// GeoStats counts current viewers per country. Only the counts are kept; the
+// addresses they were derived from are not stored.
+type GeoStats struct {
+	db *geoip2.Reader
+
+	mu        sync.Mutex
+	countries map[string]int
+	continent map[string]string
+}
+
+func OpenGeoStats(path string) (*GeoStats, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoStats{
+		db:        db,
+		countries: make(map[string]int),
+		continent: make(map[string]string),
+	}, nil
+}
+
+func (g *GeoStats) lookup(remoteAddr string) (country, continent string) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return unknownCountry, ""
+	}
+	rec, err := g.db.Country(ip)
+	if err != nil || rec.Country.IsoCode == "" {
+		return unknownCountry, ""
+	}
+	return rec.Country.IsoCode, rec.Continent.Code
+}
+
+// Join counts a viewer from remoteAddr and returns the country to pass to
+// Leave once they are gone.
+func (g *GeoStats) Join(remoteAddr string) string {
+	country, continent := g.lookup(remoteAddr)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.countries[country]++
+	if continent != "" {
+		g.continent[country] = continent
+	}
+	return country
+}
+
+func (g *GeoStats) Leave(country string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.countries[country]--
+	if g.countries[country] <= 0 {
+		delete(g.countries, country)
+	}
+}
+
+type geoCount struct {
+	Country   string `json:"country"`
+	Continent string `json:"continent,omitempty"`
+	Viewers   int    `json:"viewers"`
+}
+
+type geoSummary struct {
+	Total      int            `json:"total"`
+	Countries  []geoCount     `json:"countries"`
+	Continents map[string]int `json:"continents"`
+}
+
+func (g *GeoStats) Summary() geoSummary {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := geoSummary{Countries: []geoCount{}, Continents: make(map[string]int)}
+	for country, n := range g.countries {
+		c := geoCount{Country: country, Continent: g.continent[country], Viewers: n}
+		s.Countries = append(s.Countries, c)
+		s.Total += n
+		if c.Continent != "" {
+			s.Continents[c.Continent] += n
+		}
+	}
+	sort.Slice(s.Countries, func(i, j int) bool {
+		if s.Countries[i].Viewers != s.Countries[j].Viewers {
+			return s.Countries[i].Viewers > s.Countries[j].Viewers
+		}
+		return s.Countries[i].Country < s.Countries[j].Country
+	})
+	return s
+}
+
+// maxGeoLimit bounds the rows /viewers/geo.svg draws: about one per country.
+const maxGeoLimit = 250
+
+func geoSvg(s geoSummary, limit int) []byte {
+	rows := s.Countries
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	var buf bytes.Buffer
+	canvas := svg.New(&buf)
+	canvas.Start(120, 20*len(rows)+10)
+	for i, c := range rows {
+		y := 20*i + 15
+		canvas.Text(10, y, c.Country, `font-size="14"`, `font-family="monospace"`, `dominant-baseline="middle"`)
+		canvas.Text(110, y, strconv.Itoa(c.Viewers),
+			`font-size="14"`, `fill="red"`,
+			`dominant-baseline="middle"`, `text-anchor="end"`,
+		)
+	}
+	canvas.End()
+	return buf.Bytes()
+}
+
+func geoJSONHandleFunc(g *GeoStats) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := json.NewEncoder(w).Encode(g.Summary()); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+func geoSvgHandleFunc(g *GeoStats) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := intParam(r, "limit", 5)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if limit < 1 || limit > maxGeoLimit {
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("limit must be between 1 and %d", maxGeoLimit)})
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Cache-Control", "no-cache")
+		if _, err := w.Write(geoSvg(g.Summary(), limit)); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
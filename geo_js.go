@@ -0,0 +1,14 @@
+//go:build js
+// +build js
+
+package main
+
+// GeoStats stands in for the GeoIP lookups in the browser build, where the
+// MaxMind reader does not compile and there are no viewers to locate.
+type GeoStats struct{}
+
+func (g *GeoStats) Join(remoteAddr string) string {
+	return "??"
+}
+
+func (g *GeoStats) Leave(country string) {}
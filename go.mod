@@ -2,4 +2,8 @@ module github.com/sorcererxw/game-of-life-img
 
 go 1.16
 
-require github.com/ajstarks/svgo v0.0.0-20210406150507-75cfd577ce75
+require (
+	github.com/ajstarks/svgo v0.0.0-20210406150507-75cfd577ce75
+	github.com/mattn/go-sqlite3 v1.14.16
+	github.com/oschwald/geoip2-golang v1.5.0
+)
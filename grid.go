@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Grid is the shape of a board's cells and so which cells neighbour which.
+type Grid string
+
+const (
+	// Square cells have the eight Moore neighbours. It is the grid of the zero
+	// Grid.
+	Square Grid = "square"
+	// Hex cells have six neighbours. Boards keep their cells in columns as
+	// usual, with every odd row drawn half a cell to the right.
+	Hex Grid = "hex"
+	// Tri cells are triangles, pointing up where i+j is even and down
+	// elsewhere, with the twelve neighbours they share a corner with.
+	Tri Grid = "tri"
+)
+
+// hexNeighbours are the offsets of a hex cell's neighbours, for cells in even
+// and odd rows.
+var hexNeighbours = [2][][2]int{
+	{{-1, 0}, {1, 0}, {-1, -1}, {0, -1}, {-1, 1}, {0, 1}},
+	{{-1, 0}, {1, 0}, {0, -1}, {1, -1}, {0, 1}, {1, 1}},
+}
+
+// triNeighbours are the offsets of a triangle's neighbours, for triangles
+// pointing up and down: two either side in its row, three across its point
+// and five across its base.
+var triNeighbours = [2][][2]int{
+	{{-2, 0}, {-1, 0}, {1, 0}, {2, 0}, {-1, -1}, {0, -1}, {1, -1}, {-2, 1}, {-1, 1}, {0, 1}, {1, 1}, {2, 1}},
+	{{-2, 0}, {-1, 0}, {1, 0}, {2, 0}, {-1, 1}, {0, 1}, {1, 1}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}},
+}
+
+// neighbours returns the offsets of the neighbours of the cell at (i, j), for
+// grids other than Square.
+func (g Grid) neighbours(i, j int) [][2]int {
+	if g == Tri {
+		return triNeighbours[(i+j)%2]
+	}
+	return hexNeighbours[j%2]
+}
+
+// Evolute advances b one generation under r on this grid and topology t.
+// Birth and survival conditions count the grid's neighbours, so only 0 to 6
+// matter on a hex grid, and triangles can have up to 12. These grids have
+// neighbourhoods of their own, so they ignore the rule's.
+func (g Grid) Evolute(t Topology, r Rule, b Board) Board {
+	if (g != Hex && g != Tri) || len(b) == 0 {
+		return t.Evolute(r, b)
+	}
+	return evoluteOffsets(b, r, t, g.neighbours)
+}
+
+// evoluteOffsets advances b one generation under r on topology t, counting
+// the cells at the offsets neighbours returns for each cell.
+func evoluteOffsets(b Board, r Rule, t Topology, neighbours func(i, j int) [][2]int) Board {
+	w, h := len(b), len(b[0])
+	next := make(Board, w)
+	for i := range next {
+		next[i] = make([]bool, h)
+		for j := range next[i] {
+			n := 0
+			for _, o := range neighbours(i, j) {
+				x, y := i+o[0], j+o[1]
+				if t == Torus {
+					// Offsets reach two cells across, further than a
+					// board one cell wide.
+					x, y = (x%w+w)%w, (y%h+h)%h
+				}
+				if b.Get(x, y) {
+					n++
+				}
+			}
+			next[i][j] = r.Next(b[i][j], n)
+		}
+	}
+	return next
+}
+
+// Evolute advances b one generation under r on the room's grid and topology.
+func (o RoomOptions) Evolute(r Rule, b Board) Board {
+	return o.Grid.Evolute(o.Topology, r, b)
+}
+
+// EvoluteInto is Evolute reusing next like Rule.EvoluteInto does, on bounded
+// square grids; others always allocate.
+func (o RoomOptions) EvoluteInto(r Rule, next, b Board) Board {
+	if o.grid() != Square || o.topology() == Torus {
+		return o.Evolute(r, b)
+	}
+	return r.EvoluteInto(next, b)
+}
+
+func (o RoomOptions) grid() Grid {
+	if o.Grid == "" {
+		return Square
+	}
+	return o.Grid
+}
+
+// fitsTorus reports why a w by h board of this grid cannot wrap around, or
+// nil if it can: hex rows alternate their offset, and triangles their
+// direction along both axes, so wrapping an odd number of them would put two
+// alike side by side at the seam.
+func (g Grid) fitsTorus(w, h int) error {
+	switch {
+	case g == Hex && h%2 != 0:
+		return fmt.Errorf("a hex torus needs an even height, not %d", h)
+	case g == Tri && (w%2 != 0 || h%2 != 0):
+		return fmt.Errorf("a tri torus needs an even width and height, not %dx%d", w, h)
+	}
+	return nil
+}
+
+func gridParam(r *http.Request) (Grid, error) {
+	switch g := Grid(r.URL.Query().Get("grid")); g {
+	case "", Square, Hex, Tri:
+		return g, nil
+	default:
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown grid %q, want square, hex or tri", g)}
+	}
+}
+
+// span returns the left and right edges of the cell at (i, j) drawn k pixels
+// to a cell. Hex cells are narrowed so that the odd rows, offset by half a
+// cell, still fit the width of k pixels per column; triangles overlap their
+// neighbours in the row by half their base, which is widened to fill it.
+func (f Frame) span(i, j, k int) (x0, x1 float64) {
+	w := float64(len(f.Board))
+	if f.Grid == Tri {
+		base := 2 * float64(k) * w / (w + 1)
+		x0 = float64(i) * base / 2
+		return x0, x0 + base
+	}
+	pitch := float64(k) * w / (w + 0.5)
+	x0 = float64(i) * pitch
+	if j%2 == 1 {
+		x0 += pitch / 2
+	}
+	return x0, x0 + pitch
+}
+
+// cellRect is where the cell at (i, j) is drawn k pixels to a cell on a
+// raster. Hex cells are drawn as bricks, which neighbour each other the same
+// way hexagons do.
+func (f Frame) cellRect(i, j, k int) image.Rectangle {
+	if f.Grid != Hex {
+		return image.Rect(k*i, k*j, k*(i+1), k*(j+1))
+	}
+	x0, x1 := f.span(i, j, k)
+	return image.Rect(int(x0), k*j, int(x1), k*(j+1))
+}
+
+// fillTriangle draws the triangle at (i, j) k pixels to a cell, a row of
+// pixels at a time.
+func (f Frame) fillTriangle(img draw.Image, i, j, k int, c color.RGBA) {
+	x0, x1 := f.span(i, j, k)
+	cx, half := (x0+x1)/2, (x1-x0)/2
+	u := &image.Uniform{C: c}
+	for y := 0; y < k; y++ {
+		t := (float64(y) + 0.5) / float64(k)
+		if (i+j)%2 == 1 {
+			t = 1 - t
+		}
+		r := image.Rect(int(cx-t*half+0.5), k*j+y, int(cx+t*half+0.5), k*j+y+1)
+		draw.Draw(img, r, u, image.Point{}, draw.Src)
+	}
+}
+
+// cellPoints returns the SVG points of the polygon for the cell at (i, j)
+// drawn k pixels to a cell, or "" on a square grid. A hexagon's top and
+// bottom points reach a sixth of a cell into the rows above and below,
+// between the hexagons there.
+func (f Frame) cellPoints(i, j, k int) string {
+	if f.Grid != Hex && f.Grid != Tri {
+		return ""
+	}
+	x0, x1 := f.span(i, j, k)
+	cx, y := (x0+x1)/2, float64(k*j)
+	var corners [][2]float64
+	switch {
+	case f.Grid == Hex:
+		d := float64(k) / 6
+		corners = [][2]float64{{cx, y - d}, {x1, y + d}, {x1, y + 5*d}, {cx, y + 7*d}, {x0, y + 5*d}, {x0, y + d}}
+	case (i+j)%2 == 0:
+		corners = [][2]float64{{cx, y}, {x1, y + float64(k)}, {x0, y + float64(k)}}
+	default:
+		corners = [][2]float64{{x0, y}, {x1, y}, {cx, y + float64(k)}}
+	}
+	var pts []string
+	for _, p := range corners {
+		pts = append(pts, strconv.FormatFloat(p[0], 'f', -1, 32)+","+strconv.FormatFloat(p[1], 'f', -1, 32))
+	}
+	return strings.Join(pts, " ")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// shifted returns b moved dx cells right and dy down, wrapping around.
+func shifted(b Board, dx, dy int) Board {
+	w, h := len(b), len(b[0])
+	s := b.empty()
+	for i := range b {
+		for j := range b[i] {
+			s[(i+dx)%w][(j+dy)%h] = b[i][j]
+		}
+	}
+	return s
+}
+
+func TestGridTorusHasNoSeam(t *testing.T) {
+	// A torus has no edges, so moving a board by a whole period of the grid,
+	// an even number of rows and, for triangles, of columns, before a step
+	// must give the same as moving it after.
+	tests := []struct {
+		grid   Grid
+		rule   string
+		w, h   int
+		dx, dy int
+	}{
+		{Hex, "B2/S34", 12, 10, 5, 2},
+		{Hex, "B2/S34", 7, 6, 3, 4},
+		{Tri, "B45/S34", 12, 10, 4, 2},
+		{Tri, "B45/S34", 10, 8, 6, 4},
+	}
+	for _, tt := range tests {
+		rule, err := ParseRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := NewSoup(tt.w, tt.h, 1, 0.4)
+		for gen := 0; gen < 4; gen++ {
+			moved := tt.grid.Evolute(Torus, rule, shifted(b, tt.dx, tt.dy))
+			b = tt.grid.Evolute(Torus, rule, b)
+			if !reflect.DeepEqual(moved, shifted(b, tt.dx, tt.dy)) {
+				t.Errorf("%s %dx%d: generation %d depends on where the seam is", tt.grid, tt.w, tt.h, gen+1)
+				break
+			}
+		}
+	}
+}
+
+func TestGridNarrowTorus(t *testing.T) {
+	// Triangles reach two cells along their row, further than a board one
+	// or two cells wide.
+	for _, w := range []int{1, 2} {
+		b := NewSoup(w, 4, 1, 1)
+		for _, g := range []Grid{Hex, Tri} {
+			if next := g.Evolute(Torus, Conway, b); len(next) != w {
+				t.Errorf("%s: %d columns became %d", g, w, len(next))
+			}
+		}
+	}
+}
+
+func TestGridTorusLimits(t *testing.T) {
+	l := Limits{MaxWidth: 100, MaxHeight: 100, MaxScale: 10}
+	tests := []struct {
+		grid Grid
+		w, h int
+		ok   bool
+	}{
+		{Hex, 10, 10, true},
+		{Hex, 9, 10, true},
+		{Hex, 10, 9, false},
+		{Tri, 10, 10, true},
+		{Tri, 9, 10, false},
+		{Tri, 10, 9, false},
+		{Square, 9, 9, true},
+	}
+	for _, tt := range tests {
+		err := l.Validate(RoomOptions{Width: tt.w, Height: tt.h, Scale: 1, Grid: tt.grid, Topology: Torus})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s torus %dx%d: %v", tt.grid, tt.w, tt.h, err)
+		}
+		if err := l.Validate(RoomOptions{Width: tt.w, Height: tt.h, Scale: 1, Grid: tt.grid}); err != nil {
+			t.Errorf("bounded %s %dx%d: %v", tt.grid, tt.w, tt.h, err)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// node is a square of 2^level cells in a HashLife quadtree. Nodes are
+// canonical: equal squares share one node, so the step of each one is only
+// ever computed once.
+type node struct {
+	nw, ne, sw, se *node
+	level          uint
+	pop            int
+
+	next  *node // the centre after 2^nextJ generations, if computed
+	nextJ uint
+}
+
+type quad struct {
+	nw, ne, sw, se *node
+}
+
+// hashLifeMaxNodes is how many nodes a HashLife keeps before it drops the ones
+// the current pattern no longer uses, along with every memoised step.
+const hashLifeMaxNodes = 1 << 20
+
+const (
+	// roomHashLifeNodes is hashLifeMaxNodes for a room's HashLife, which
+	// shares the memory budget with every other room.
+	roomHashLifeNodes = 1 << 18
+	// hashLifeNodeBytes is about what a node and its cache entry take.
+	hashLifeNodeBytes = 128
+	// maxHashLifeStep bounds step=, so a frame jumps at most 2^20
+	// generations.
+	maxHashLifeStep = 20
+)
+
+// HashLife evolves an unbounded plane with Gosper's HashLife, stepping 2^j
+// generations at a time. Patterns with a lot of repetition in space or time,
+// like guns, puffers and breeders, run many orders of magnitude faster than
+// cell by cell.
+type HashLife struct {
+	rule       Rule
+	j          uint
+	maxNodes   int
+	cache      map[quad]*node
+	dead, live *node
+	empties    []*node
+
+	root       *node
+	x, y       int64 // top-left corner of root
+	generation uint64
+}
+
+func NewHashLife(rule Rule, j uint) *HashLife {
+	h := &HashLife{
+		rule:     rule,
+		j:        j,
+		maxNodes: hashLifeMaxNodes,
+		dead:     &node{},
+		live:     &node{pop: 1},
+	}
+	h.cache = make(map[quad]*node)
+	h.root = h.empty(3)
+	h.x, h.y = -4, -4
+	return h
+}
+
+func (h *HashLife) join(nw, ne, sw, se *node) *node {
+	k := quad{nw, ne, sw, se}
+	if n, ok := h.cache[k]; ok {
+		return n
+	}
+	n := &node{nw: nw, ne: ne, sw: sw, se: se, level: nw.level + 1, pop: nw.pop + ne.pop + sw.pop + se.pop}
+	h.cache[k] = n
+	return n
+}
+
+func (h *HashLife) empty(level uint) *node {
+	for uint(len(h.empties)) <= level {
+		if len(h.empties) == 0 {
+			h.empties = append(h.empties, h.dead)
+			continue
+		}
+		e := h.empties[len(h.empties)-1]
+		h.empties = append(h.empties, h.join(e, e, e, e))
+	}
+	return h.empties[level]
+}
+
+// expand doubles the root, keeping it centred.
+func (h *HashLife) expand() {
+	r := h.root
+	e := h.empty(r.level - 1)
+	h.root = h.join(
+		h.join(e, e, e, r.nw),
+		h.join(e, e, r.ne, e),
+		h.join(e, r.sw, e, e),
+		h.join(r.se, e, e, e),
+	)
+	d := int64(1) << (r.level - 1)
+	h.x -= d
+	h.y -= d
+}
+
+// Set makes the cell at (x, y) alive or dead.
+func (h *HashLife) Set(x, y int64, alive bool) {
+	for x < h.x || y < h.y || x >= h.x+h.size() || y >= h.y+h.size() {
+		h.expand()
+	}
+	h.root = h.set(h.root, x-h.x, y-h.y, alive)
+}
+
+func (h *HashLife) size() int64 {
+	return int64(1) << h.root.level
+}
+
+func (h *HashLife) set(n *node, x, y int64, alive bool) *node {
+	if n.level == 0 {
+		if alive {
+			return h.live
+		}
+		return h.dead
+	}
+	half := int64(1) << (n.level - 1)
+	nw, ne, sw, se := n.nw, n.ne, n.sw, n.se
+	switch {
+	case x < half && y < half:
+		nw = h.set(nw, x, y, alive)
+	case y < half:
+		ne = h.set(ne, x-half, y, alive)
+	case x < half:
+		sw = h.set(sw, x, y-half, alive)
+	default:
+		se = h.set(se, x-half, y-half, alive)
+	}
+	return h.join(nw, ne, sw, se)
+}
+
+// Stamp sets the live cells of p with its top-left corner at (x, y).
+func (h *HashLife) Stamp(p Pattern, x, y int64) {
+	for _, c := range p.Cells {
+		h.Set(x+int64(c[0]), y+int64(c[1]), true)
+	}
+}
+
+// StampBoard sets the live cells of b with its top-left corner at (x, y), the
+// reverse of Board at zoom 0, so bounded boards can be carried onto the plane.
+func (h *HashLife) StampBoard(b Board, x, y int64) {
+	for i, col := range b {
+		for j, alive := range col {
+			if alive {
+				h.Set(x+int64(i), y+int64(j), true)
+			}
+		}
+	}
+}
+
+func (h *HashLife) Population() int {
+	return h.root.pop
+}
+
+func (h *HashLife) Generation() uint64 {
+	return h.generation
+}
+
+// StepSize is how many generations Step advances.
+func (h *HashLife) StepSize() uint64 {
+	return 1 << h.j
+}
+
+// centred reports whether the live cells all lie within the middle quarter of
+// the root, so that nothing can escape the centre during a step.
+func (h *HashLife) centred() bool {
+	r := h.root
+	return r.nw.pop == r.nw.se.se.pop && r.ne.pop == r.ne.sw.sw.pop &&
+		r.sw.pop == r.sw.ne.ne.pop && r.se.pop == r.se.nw.nw.pop
+}
+
+// Step advances the pattern StepSize generations.
+func (h *HashLife) Step() {
+	for h.root.level < h.j+2 || h.root.level < 3 || !h.centred() {
+		h.expand()
+	}
+	h.expand()
+	d := int64(1) << (h.root.level - 2)
+	h.root = h.successor(h.root, h.j)
+	h.x += d
+	h.y += d
+	h.generation += h.StepSize()
+	if len(h.cache) > h.maxNodes {
+		h.gc()
+	}
+}
+
+// SetRule changes the rule the pattern steps under, forgetting the steps
+// memoised under the old one.
+func (h *HashLife) SetRule(r Rule) {
+	if r == h.rule {
+		return
+	}
+	h.rule = r
+	h.gc()
+}
+
+// Clone returns a copy of h to step without changing h.
+func (h *HashLife) Clone() *HashLife {
+	c := NewHashLife(h.rule, h.j)
+	c.maxNodes = h.maxNodes
+	c.root, c.x, c.y, c.generation = c.adopt(h.root), h.x, h.y, h.generation
+	return c
+}
+
+// successor returns the centre of n, half its size, 2^j generations on.
+func (h *HashLife) successor(n *node, j uint) *node {
+	if n.level-2 < j {
+		j = n.level - 2
+	}
+	if n.next != nil && n.nextJ == j {
+		return n.next
+	}
+	var s *node
+	switch {
+	case n.pop == 0:
+		s = n.nw
+	case n.level == 2:
+		s = h.life4x4(n)
+	default:
+		c1 := h.successor(h.join(n.nw.nw, n.nw.ne, n.nw.sw, n.nw.se), j)
+		c2 := h.successor(h.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), j)
+		c3 := h.successor(h.join(n.ne.nw, n.ne.ne, n.ne.sw, n.ne.se), j)
+		c4 := h.successor(h.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne), j)
+		c5 := h.successor(h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw), j)
+		c6 := h.successor(h.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne), j)
+		c7 := h.successor(h.join(n.sw.nw, n.sw.ne, n.sw.sw, n.sw.se), j)
+		c8 := h.successor(h.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), j)
+		c9 := h.successor(h.join(n.se.nw, n.se.ne, n.se.sw, n.se.se), j)
+		if j < n.level-2 {
+			s = h.join(
+				h.join(c1.se, c2.sw, c4.ne, c5.nw),
+				h.join(c2.se, c3.sw, c5.ne, c6.nw),
+				h.join(c4.se, c5.sw, c7.ne, c8.nw),
+				h.join(c5.se, c6.sw, c8.ne, c9.nw),
+			)
+		} else {
+			s = h.join(
+				h.successor(h.join(c1, c2, c4, c5), j),
+				h.successor(h.join(c2, c3, c5, c6), j),
+				h.successor(h.join(c4, c5, c7, c8), j),
+				h.successor(h.join(c5, c6, c8, c9), j),
+			)
+		}
+	}
+	n.next, n.nextJ = s, j
+	return s
+}
+
+// life4x4 steps the middle 2x2 of a 4x4 node one generation.
+func (h *HashLife) life4x4(n *node) *node {
+	var cells [4][4]bool
+	for i, q := range []*node{n.nw, n.ne, n.sw, n.se} {
+		ox, oy := i%2*2, i/2*2
+		cells[ox][oy] = q.nw.pop > 0
+		cells[ox+1][oy] = q.ne.pop > 0
+		cells[ox][oy+1] = q.sw.pop > 0
+		cells[ox+1][oy+1] = q.se.pop > 0
+	}
+	next := func(x, y int) *node {
+		neighbours := 0
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				if (dx != 0 || dy != 0) && cells[x+dx][y+dy] {
+					neighbours++
+				}
+			}
+		}
+		if h.rule.Next(cells[x][y], neighbours) {
+			return h.live
+		}
+		return h.dead
+	}
+	return h.join(next(1, 1), next(2, 1), next(1, 2), next(2, 2))
+}
+
+// gc rebuilds the cache from the nodes the root still uses.
+func (h *HashLife) gc() {
+	h.cache = make(map[quad]*node, len(h.cache)/4)
+	h.empties = nil
+	h.root = h.adopt(h.root)
+}
+
+// adopt returns n rebuilt from nodes in h's cache, with no memoised steps.
+func (h *HashLife) adopt(n *node) *node {
+	seen := make(map[*node]*node)
+	var keep func(n *node) *node
+	keep = func(n *node) *node {
+		if n.level == 0 {
+			if n.pop > 0 {
+				return h.live
+			}
+			return h.dead
+		}
+		if k, ok := seen[n]; ok {
+			return k
+		}
+		k := h.join(keep(n.nw), keep(n.ne), keep(n.sw), keep(n.se))
+		seen[n] = k
+		return k
+	}
+	return keep(n)
+}
+
+// Bounds returns the smallest rectangle holding every live cell, to the
+// nearest 2^level cells, and false if there are none.
+func (h *HashLife) Bounds(level uint) (x0, y0, x1, y1 int64, ok bool) {
+	var walk func(n *node, x, y int64)
+	walk = func(n *node, x, y int64) {
+		if n.pop == 0 {
+			return
+		}
+		size := int64(1) << n.level
+		if ok && x >= x0 && y >= y0 && x+size <= x1 && y+size <= y1 {
+			return
+		}
+		if n.level <= level {
+			if !ok || x < x0 {
+				x0 = x
+			}
+			if !ok || y < y0 {
+				y0 = y
+			}
+			if !ok || x+size > x1 {
+				x1 = x + size
+			}
+			if !ok || y+size > y1 {
+				y1 = y + size
+			}
+			ok = true
+			return
+		}
+		half := size / 2
+		walk(n.nw, x, y)
+		walk(n.ne, x+half, y)
+		walk(n.sw, x, y+half)
+		walk(n.se, x+half, y+half)
+	}
+	walk(h.root, h.x, h.y)
+	return
+}
+
+// Board renders the w by h window at (x, y) with each cell standing for a
+// 2^zoom square of the plane, alive if any cell in the square is.
+func (h *HashLife) Board(x, y int64, w, ht int, zoom uint) Board {
+	b := make(Board, w)
+	for i := range b {
+		b[i] = make([]bool, ht)
+	}
+	var walk func(n *node, nx, ny int64)
+	walk = func(n *node, nx, ny int64) {
+		if n.pop == 0 {
+			return
+		}
+		size := int64(1) << n.level
+		if nx+size <= x || ny+size <= y || nx >= x+int64(w)<<zoom || ny >= y+int64(ht)<<zoom {
+			return
+		}
+		if n.level <= zoom {
+			i, j := (nx-x)>>zoom, (ny-y)>>zoom
+			if i >= 0 && j >= 0 && i < int64(w) && j < int64(ht) {
+				b[i][j] = true
+			}
+			return
+		}
+		half := size / 2
+		walk(n.nw, nx, ny)
+		walk(n.ne, nx+half, ny)
+		walk(n.sw, nx, ny+half)
+		walk(n.se, nx+half, ny+half)
+	}
+	walk(h.root, h.x, h.y)
+	return b
+}
+
+// hashLifeRule reports whether HashLife can run r: its stepping only counts
+// the Moore neighbourhood and takes empty space to stay empty.
+func hashLifeRule(r Rule) error {
+	if r.LtL.Radius > 0 || r.Neighbourhood != Moore || r.Birth&1 != 0 {
+		return fmt.Errorf("HashLife runs only Moore-neighbourhood rules without B0, not %s", r)
+	}
+	return nil
+}
+
+// engineParam reads ?engine=, cells or hashlife, and reports whether the room
+// runs on HashLife.
+func engineParam(r *http.Request) (bool, error) {
+	switch e := r.URL.Query().Get("engine"); e {
+	case "", "cells":
+		return false, nil
+	case "hashlife":
+		return true, nil
+	default:
+		return false, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown engine %q, want cells or hashlife", e)}
+	}
+}
+
+// stepParam reads ?step=, the power of two of generations a HashLife room
+// jumps each frame.
+func stepParam(r *http.Request) (uint, error) {
+	s := r.URL.Query().Get("step")
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || n > maxHashLifeStep {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid step %q, want 0 to %d", s, maxHashLifeStep)}
+	}
+	return uint(n), nil
+}
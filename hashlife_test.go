@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+// naiveEvolute steps b one generation under r by counting each cell's
+// neighbours one by one, as the reference the faster engines must match.
+func naiveEvolute(r Rule, b Board) Board {
+	next := make(Board, len(b))
+	for x := range b {
+		next[x] = make([]bool, len(b[x]))
+		for y := range b[x] {
+			n := 0
+			for dx := -1; dx <= 1; dx++ {
+				for dy := -1; dy <= 1; dy++ {
+					i, j := x+dx, y+dy
+					if (dx != 0 || dy != 0) && i >= 0 && j >= 0 && i < len(b) && j < len(b[i]) && b[i][j] {
+						n++
+					}
+				}
+			}
+			next[x][y] = r.Next(b[x][y], n)
+		}
+	}
+	return next
+}
+
+// engineRules are the rules the engines are checked under: no B0, which
+// HashLife does not run.
+var engineRules = []string{"B3/S23", "B36/S23", "B2/S", "B3678/S34678", "B35678/S5678"}
+
+// centredSoup returns a size by size board with a soup for seed in the middle
+// margin cells from every edge, so it can run margin generations before
+// anything reaches an edge and bounded and unbounded stepping part ways.
+func centredSoup(size, margin int, seed int64) Board {
+	b := make(Board, size)
+	for i := range b {
+		b[i] = make([]bool, size)
+	}
+	b.Stamp(NewSeededBoard(size-2*margin, size-2*margin, seed).Pattern(), margin, margin)
+	return b
+}
+
+func TestHashLifeMatchesEvolute(t *testing.T) {
+	const size, margin = 96, 40
+	for _, s := range engineRules {
+		rule, err := ParseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seed := int64(1); seed <= 3; seed++ {
+			for _, j := range []uint{0, 2, 4} {
+				start := centredSoup(size, margin, seed)
+				h := NewHashLife(rule, j)
+				h.StampBoard(start, 0, 0)
+				want := start
+				for gen := uint64(0); gen+h.StepSize() <= margin; gen += h.StepSize() {
+					h.Step()
+					for i := uint64(0); i < h.StepSize(); i++ {
+						want = naiveEvolute(rule, want)
+					}
+					if got := h.Board(0, 0, size, size, 0); got.Hash() != want.Hash() {
+						t.Fatalf("%s, seed %d, 2^%d a step: HashLife differs at generation %d", rule, seed, j, h.Generation())
+					}
+					if h.Population() != want.Population() {
+						t.Fatalf("%s, seed %d, 2^%d a step: population %d, want %d", rule, seed, j, h.Population(), want.Population())
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Hash fingerprints the board's live cells.
+func (b Board) Hash() uint64 {
+	h := fnv.New64a()
+	for _, col := range b {
+		h.Write(cellBytes(col))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64()
+}
+
+type Generation struct {
+	Number uint64
+	Hash   uint64
+	Board  Board
+}
+
+const (
+	// checkpointEvery is how many generations apart a room keeps checkpoints
+	// to replay later generations from.
+	checkpointEvery = 1000
+	// maxCheckpoints is how many checkpoints a room keeps. Replays reach back
+	// no further than the oldest.
+	maxCheckpoints = 4
+)
+
+// Checkpoint is a generation kept to replay later ones from: its board and,
+// for an unbounded room, a copy of the plane around it.
+type Checkpoint struct {
+	Number uint64
+	Board  Board
+	Plane  *Viewport
+}
+
+// History keeps the most recent generations of a room, and a few
+// checkpoints reaching further back.
+type History struct {
+	mu          sync.Mutex
+	size        int
+	entries     []Generation
+	checkpoints []Checkpoint
+}
+
+func NewHistory(size int) *History {
+	if size < 1 {
+		size = 1
+	}
+	return &History{size: size}
+}
+
+func (h *History) Push(n uint64, b Board) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, Generation{Number: n, Hash: b.Hash(), Board: b})
+	if len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+}
+
+// Keep adds c to the checkpoints, dropping the oldest once there are
+// maxCheckpoints.
+func (h *History) Keep(c Checkpoint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checkpoints = append(h.checkpoints, c)
+	if len(h.checkpoints) > maxCheckpoints {
+		h.checkpoints = h.checkpoints[len(h.checkpoints)-maxCheckpoints:]
+	}
+}
+
+// Checkpoint returns the latest checkpoint at or before generation gen.
+func (h *History) Checkpoint(gen uint64) (Checkpoint, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := len(h.checkpoints) - 1; i >= 0; i-- {
+		if h.checkpoints[i].Number <= gen {
+			return h.checkpoints[i], true
+		}
+	}
+	return Checkpoint{}, false
+}
+
+// Oldest returns the number of the oldest checkpoint, the earliest
+// generation that can be replayed.
+func (h *History) Oldest() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.checkpoints) == 0 {
+		return h.entries[len(h.entries)-1].Number
+	}
+	return h.checkpoints[0].Number
+}
+
+func (h *History) Latest() Generation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.entries[len(h.entries)-1]
+}
+
+func (h *History) Find(match func(Generation) bool) (Generation, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if match(h.entries[i]) {
+			return h.entries[i], true
+		}
+	}
+	return Generation{}, false
+}
+
+func formatHash(h uint64) string {
+	return fmt.Sprintf("%016x", h)
+}
+
+type diffResponse struct {
+	From       *uint64  `json:"from,omitempty"`
+	Generation uint64   `json:"generation"`
+	Hash       string   `json:"hash"`
+	Width      int      `json:"width"`
+	Height     int      `json:"height"`
+	Full       bool     `json:"full"`
+	Alive      [][2]int `json:"alive,omitempty"`
+	Born       [][2]int `json:"born,omitempty"`
+	Died       [][2]int `json:"died,omitempty"`
+}
+
+// lookupFrom resolves ?from=, which is either a generation number or a
+// 16-digit board hash as returned in an earlier response.
+func lookupFrom(h *History, from string) (Generation, bool) {
+	if len(from) == 16 {
+		hash, err := strconv.ParseUint(from, 16, 64)
+		if err == nil {
+			return h.Find(func(g Generation) bool { return g.Hash == hash })
+		}
+	}
+	n, err := strconv.ParseUint(from, 10, 64)
+	if err != nil {
+		return Generation{}, false
+	}
+	return h.Find(func(g Generation) bool { return g.Number == n })
+}
+
+// diffHandle reports the cells that changed between the client's generation
+// and the latest one. When the client's generation has fallen out of the
+// history, or none was given, it reports the whole board instead.
+func diffHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	room.Touch()
+
+	latest := room.history.Latest()
+	resp := diffResponse{
+		Generation: latest.Number,
+		Hash:       formatHash(latest.Hash),
+		Width:      len(latest.Board),
+		Height:     len(latest.Board[0]),
+	}
+
+	base, ok := lookupFrom(room.history, r.URL.Query().Get("from"))
+	if ok {
+		resp.From = &base.Number
+		for i, col := range latest.Board {
+			for j, alive := range col {
+				if alive == base.Board.Get(i, j) {
+					continue
+				}
+				if alive {
+					resp.Born = append(resp.Born, [2]int{i, j})
+				} else {
+					resp.Died = append(resp.Died, [2]int{i, j})
+				}
+			}
+		}
+	} else {
+		resp.Full = true
+		for i, col := range latest.Board {
+			for j, alive := range col {
+				if alive {
+					resp.Alive = append(resp.Alive, [2]int{i, j})
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sync"
+	"time"
+)
+
+// WorkerPool bounds how many frames are encoded concurrently across all rooms.
+type WorkerPool struct {
+	slots chan struct{}
+}
+
+func NewWorkerPool(n int) *WorkerPool {
+	if n < 1 {
+		n = 1
+	}
+	return &WorkerPool{slots: make(chan struct{}, n)}
+}
+
+func (p *WorkerPool) Do(f func()) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+	f()
+}
+
+type DropPolicy int
+
+const (
+	// DropOldest replaces a frame still waiting to be encoded with the newer one.
+	DropOldest DropPolicy = iota
+	// DropNewest discards the newer frame while one is still waiting.
+	DropNewest
+)
+
+func ParseDropPolicy(s string) (DropPolicy, error) {
+	switch s {
+	case "oldest":
+		return DropOldest, nil
+	case "newest":
+		return DropNewest, nil
+	}
+	return 0, fmt.Errorf("unknown drop policy %q", s)
+}
+
+type frameJob struct {
+	Generation uint64
+	Frame      Frame
+	Population int
+	Time       time.Time
+	Complexity *Complexity
+}
+
+// encodeQueue encodes frames in one format and style for one room and fans
+// them out to its subscribers. At most one frame waits at a time; when the
+// encoder falls behind, the policy decides which frame is dropped.
+type encodeQueue struct {
+	key    streamKey
+	policy DropPolicy
+	pool   *WorkerPool
+	jobs   chan frameJob
+
+	// prev is the last frame encoded, for streams with deltas; only touched
+	// by the encoder.
+	prev    *image.RGBA
+	prevGen uint64
+	// camera follows the board for zoom=auto streams; only touched by the
+	// encoder.
+	camera camera
+
+	mu          sync.Mutex
+	subscribers map[chan<- ImageBundle]*Session
+	idleSince   time.Time
+}
+
+func newEncodeQueue(key streamKey, policy DropPolicy, pool *WorkerPool) *encodeQueue {
+	q := &encodeQueue{
+		key:         key,
+		policy:      policy,
+		pool:        pool,
+		jobs:        make(chan frameJob, 1),
+		subscribers: make(map[chan<- ImageBundle]*Session),
+		idleSince:   time.Now(),
+	}
+	q.Start()
+	return q
+}
+
+func (q *encodeQueue) Start() {
+	go func() {
+		for job := range q.jobs {
+			if q.key.Style.AutoZoom {
+				job.Frame.View = q.camera.follow(job.Frame, q.key.Style.Scale)
+			}
+			var bundle ImageBundle
+			var err error
+			q.pool.Do(func() {
+				if !q.key.Deltas {
+					bundle, err = Encode(q.key.Format, job.Frame, q.key.Style)
+					return
+				}
+				var img *image.RGBA
+				if bundle, img, err = EncodeDelta(q.key.Format, job.Frame, q.key.Style, q.prev, q.prevGen); err == nil {
+					q.prev, q.prevGen = img, job.Generation
+				}
+			})
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			bundle.Generation = job.Generation
+			bundle.Population, bundle.Time, bundle.Complexity = job.Population, job.Time, job.Complexity
+
+			q.mu.Lock()
+			for ch, s := range q.subscribers {
+				offer(ch, s, bundle)
+			}
+			q.mu.Unlock()
+		}
+	}()
+}
+
+func (q *encodeQueue) Push(job frameJob) {
+	select {
+	case q.jobs <- job:
+		return
+	default:
+	}
+
+	metrics.ObserveEncodeDrop(q.key.Format)
+	if q.policy == DropNewest {
+		return
+	}
+	select {
+	case <-q.jobs:
+	default:
+	}
+	select {
+	case q.jobs <- job:
+	default:
+	}
+}
+
+func (q *encodeQueue) Subscribe(c chan<- ImageBundle, s *Session) func() {
+	q.mu.Lock()
+	q.subscribers[c] = s
+	q.mu.Unlock()
+	return func() {
+		q.mu.Lock()
+		delete(q.subscribers, c)
+		if len(q.subscribers) == 0 {
+			q.idleSince = time.Now()
+		}
+		q.mu.Unlock()
+	}
+}
+
+func (q *encodeQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.subscribers)
+}
+
+// Idle reports whether the queue has had no subscribers for at least d.
+func (q *encodeQueue) Idle(d time.Duration) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.subscribers) == 0 && time.Since(q.idleSince) >= d
+}
+
+// Close stops the queue's encoder. It must not be pushed to afterwards.
+func (q *encodeQueue) Close() {
+	close(q.jobs)
+}
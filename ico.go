@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+)
+
+// iconSizes are the square sizes bundled into /board.ico.
+var iconSizes = []int{16, 32, 48}
+
+// icon shrinks the board into a size by size square, centred, each pixel as
+// opaque as the share of live cells it covers.
+func (f Frame) icon(st Style, size int) *image.NRGBA {
+	pal := f.palette(st)
+	w, h := len(f.Board), len(f.Board[0])
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	if pal.Background.A > 0 {
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = pal.Background.R, pal.Background.G, pal.Background.B, pal.Background.A
+		}
+	}
+
+	long := w
+	if h > long {
+		long = h
+	}
+	// Pixel (px, py) covers cells [px*long/size, (px+1)*long/size), offset so
+	// the board sits in the middle.
+	ox, oy := (long-w)/2, (long-h)/2
+	for py := 0; py < size; py++ {
+		y0, y1 := py*long/size-oy, (py+1)*long/size-oy
+		for px := 0; px < size; px++ {
+			x0, x1 := px*long/size-ox, (px+1)*long/size-ox
+			cells, alive := 0, 0
+			for x := x0; x < x1 || x == x0; x++ {
+				for y := y0; y < y1 || y == y0; y++ {
+					cells++
+					if f.Board.Get(x, y) {
+						alive++
+					}
+				}
+			}
+			if alive == 0 {
+				continue
+			}
+			a := float64(alive) / float64(cells)
+			c := pal.Alive
+			if pal.Background.A > 0 {
+				img.Set(px, py, blend(pal.Background, c, a))
+			} else {
+				img.SetNRGBA(px, py, color.NRGBA{R: c.R, G: c.G, B: c.B, A: uint8(a*255 + 0.5)})
+			}
+		}
+	}
+	return img
+}
+
+func blend(bg, fg color.RGBA, a float64) color.RGBA {
+	mix := func(b, f uint8) uint8 { return uint8(float64(b)*(1-a) + float64(f)*a + 0.5) }
+	return color.RGBA{R: mix(bg.R, fg.R), G: mix(bg.G, fg.G), B: mix(bg.B, fg.B), A: 255}
+}
+
+// Ico bundles PNG renderings of the board at each of iconSizes into an ICO
+// file.
+func (f Frame) Ico(st Style) ([]byte, error) {
+	var images [][]byte
+	for _, size := range iconSizes {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, f.icon(st, size)); err != nil {
+			return nil, err
+		}
+		images = append(images, buf.Bytes())
+	}
+
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	binary.Write(&buf, le, [3]uint16{0, 1, uint16(len(images))})
+	offset := 6 + 16*len(images)
+	for i, data := range images {
+		size := uint8(iconSizes[i])
+		binary.Write(&buf, le, struct {
+			Width, Height, Colors, Reserved uint8
+			Planes, Bits                    uint16
+			Size, Offset                    uint32
+		}{size, size, 0, 0, 1, 32, uint32(len(data)), uint32(offset)})
+		offset += len(data)
+	}
+	for _, data := range images {
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// icoHandle serves the room's latest generation as a favicon.
+func icoHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	st, err := styleParam(r, room.DefaultStyle())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	data, err := Frame{Board: room.history.Latest().Board}.Ico(st)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/x-icon")
+	if _, err := w.Write(data); err != nil {
+		fmt.Println(err)
+	}
+}
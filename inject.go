@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// spaceshipEvent places a glider or lightweight spaceship on a random edge of
+// b, heading into the board, making its choices with rng. It reports false if
+// b is too small for one.
+func spaceshipEvent(b Board, gen uint64, rng *rand.Rand) (Event, bool) {
+	w, h := len(b), len(b[0])
+	if w < lwss.W+lwss.H || h < lwss.W+lwss.H {
+		return Event{}, false
+	}
+
+	// dx, dy is the direction of travel, pointing away from the chosen edge.
+	var dx, dy int
+	switch rng.Intn(4) {
+	case 0:
+		dx = 1
+	case 1:
+		dx = -1
+	case 2:
+		dy = 1
+	default:
+		dy = -1
+	}
+
+	var ship Pattern
+	if rng.Intn(2) == 0 {
+		// Gliders travel diagonally, so pick the sideways component at random.
+		if dx == 0 {
+			dx = 1 - 2*rng.Intn(2)
+		} else {
+			dy = 1 - 2*rng.Intn(2)
+		}
+		ship = glider
+		if dx < 0 {
+			ship = ship.FlipX()
+		}
+		if dy < 0 {
+			ship = ship.FlipY()
+		}
+	} else {
+		ship = lwss
+		switch {
+		case dx > 0:
+			ship = ship.FlipX()
+		case dy < 0:
+			ship = ship.Transpose()
+		case dy > 0:
+			ship = ship.Transpose().FlipY()
+		}
+	}
+
+	// Start against the edge the ship leaves from. Along that edge, leave room
+	// for any sideways drift so diagonal ships don't run into a corner.
+	var x, y int
+	if dx != 0 && (dy == 0 || rng.Intn(2) == 0) {
+		x = againstEdge(w, ship.W, dx)
+		y = alongEdge(h, ship.H, dy, rng)
+	} else {
+		x = alongEdge(w, ship.W, dx, rng)
+		y = againstEdge(h, ship.H, dy)
+	}
+
+	return Event{Generation: gen, Time: time.Now(), Kind: EventStamp, X: x, Y: y, Pattern: &ship}, true
+}
+
+func againstEdge(n, size, dir int) int {
+	if dir > 0 {
+		return 0
+	}
+	return n - size
+}
+
+func alongEdge(n, size, dir int, rng *rand.Rand) int {
+	span := n - size + 1
+	switch {
+	case dir > 0:
+		return rng.Intn(span/2 + 1)
+	case dir < 0:
+		return span - 1 - rng.Intn(span/2+1)
+	}
+	return rng.Intn(span)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type jsonFrame struct {
+	Generation  uint64 `json:"gen"`
+	ContentType string `json:"contentType"`
+	DataURI     string `json:"dataUri"`
+	// Population and Timestamp are only set for frames showing a board, and
+	// Complexity for those of rooms.
+	Population *int        `json:"population,omitempty"`
+	Timestamp  *time.Time  `json:"timestamp,omitempty"`
+	Complexity *Complexity `json:"complexity,omitempty"`
+	// Type, Offset and Base are only set for streams with deltas.
+	Type   string  `json:"type,omitempty"`
+	Offset *[2]int `json:"offset,omitempty"`
+	Base   *uint64 `json:"base,omitempty"`
+}
+
+func dataURI(contentType string, data []byte) string {
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func newJSONFrame(b ImageBundle) jsonFrame {
+	f := jsonFrame{
+		Generation:  b.Generation,
+		ContentType: b.ContentType,
+		DataURI:     dataURI(b.ContentType, b.Data),
+	}
+	f.describe(b)
+	return f
+}
+
+func (f *jsonFrame) describe(b ImageBundle) {
+	if !b.Time.IsZero() {
+		pop, t := b.Population, b.Time.UTC()
+		f.Population, f.Timestamp = &pop, &t
+	}
+	f.Complexity = b.Complexity
+}
+
+// newJSONDeltaFrame is newJSONFrame for streams with deltas, sending b's
+// delta instead of b if keys allows.
+func newJSONDeltaFrame(b ImageBundle, keys *keyframes) jsonFrame {
+	d := keys.Delta(b)
+	if d == nil {
+		f := newJSONFrame(b)
+		f.Type = "key"
+		return f
+	}
+	base := d.Base
+	f := jsonFrame{
+		Generation:  b.Generation,
+		ContentType: "image/png",
+		DataURI:     dataURI("image/png", d.Data),
+		Type:        "delta",
+		Offset:      &[2]int{d.X, d.Y},
+		Base:        &base,
+	}
+	f.describe(b)
+	return f
+}
+
+// jsonStreamHandle streams frames as JSON objects carrying a data: URI, so web
+// clients can assign img.src directly. EventSource clients get server-sent
+// events; everyone else gets newline-delimited JSON.
+func jsonStreamHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	format, err := formatParam(r, "svg")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	st, err := styleParam(r, room.DefaultStyle())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	clamp, err := motionParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	every, err := keyframeParam(r, format)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	keys := &keyframes{every: every}
+	render := room.Stream(format, st)
+	if every > 0 {
+		render = room.DeltaStream(format, st)
+	}
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+	ch := make(chan ImageBundle)
+	session, closeSession := sessions.Open(r)
+	defer closeSession()
+	unregister := render.Register(ch, session)
+	defer unregister()
+
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case bundle := <-ch:
+			if !clamp.Allow() {
+				continue
+			}
+			frame := newJSONFrame(bundle)
+			if every > 0 {
+				frame = newJSONDeltaFrame(bundle, keys)
+			}
+			data, err := json.Marshal(frame)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if sse {
+				_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", bundle.Generation, data)
+			} else {
+				_, err = fmt.Fprintf(w, "%s\n", data)
+			}
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
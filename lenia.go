@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+const (
+	// maxLeniaWorlds bounds how many Lenia worlds run at once.
+	maxLeniaWorlds = 4
+	maxLeniaRadius = 20
+	leniaWidth     = 128
+	leniaHeight    = 96
+	leniaScale     = 5
+	// leniaStepsPerTick is how many steps the field takes between frames.
+	leniaStepsPerTick = 4
+	// leniaVisible is the least value drawn; anything fainter is background.
+	leniaVisible = 0.02
+)
+
+// LeniaRule is a Lenia rule: each step every cell takes the average of the
+// field over a ring of Radius cells, weighted by a smooth bump, and grows by
+// 1/T times a Gaussian of that average centred on Mu with width Sigma, which
+// shrinks the cell where the average is far from Mu.
+type LeniaRule struct {
+	Radius int
+	Mu     float64
+	Sigma  float64
+	T      int
+}
+
+// namedLenia are well-known Lenia rules /lenia.svg accepts by name.
+var namedLenia = map[string]LeniaRule{
+	"orbium":        {Radius: 13, Mu: 0.15, Sigma: 0.015, T: 10},
+	"geminium":      {Radius: 18, Mu: 0.26, Sigma: 0.036, T: 10},
+	"scutium":       {Radius: 13, Mu: 0.29, Sigma: 0.045, T: 10},
+	"hydrogeminium": {Radius: 18, Mu: 0.26, Sigma: 0.036, T: 5},
+}
+
+func (l LeniaRule) String() string {
+	return fmt.Sprintf("R%d,mu%s,sigma%s,T%d", l.Radius, formatFloat(l.Mu), formatFloat(l.Sigma), l.T)
+}
+
+// leniaRuleParam reads ?rule=, a name in namedLenia and orbium by default,
+// with ?r=, ?mu=, ?sigma= and ?t= overriding its parameters.
+func leniaRuleParam(r *http.Request) (LeniaRule, error) {
+	q := r.URL.Query()
+	name := q.Get("rule")
+	if name == "" {
+		name = "orbium"
+	}
+	l, ok := namedLenia[strings.ToLower(name)]
+	if !ok {
+		var names []string
+		for n := range namedLenia {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return LeniaRule{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown Lenia rule %q, want one of %s", name, strings.Join(names, ", "))}
+	}
+	var err error
+	if l.Radius, err = intParam(r, "r", l.Radius); err != nil {
+		return LeniaRule{}, err
+	}
+	if l.T, err = intParam(r, "t", l.T); err != nil {
+		return LeniaRule{}, err
+	}
+	for _, p := range []struct {
+		name string
+		v    *float64
+	}{{"mu", &l.Mu}, {"sigma", &l.Sigma}} {
+		s := q.Get(p.name)
+		if s == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f <= 0 || f >= 1 {
+			return LeniaRule{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("%s must be a number between 0 and 1", p.name)}
+		}
+		*p.v = f
+	}
+	if l.Radius < 2 || l.Radius > maxLeniaRadius {
+		return LeniaRule{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("r must be between 2 and %d", maxLeniaRadius)}
+	}
+	if l.T < 1 || l.T > 100 {
+		return LeniaRule{}, &requestError{status: http.StatusBadRequest, msg: "t must be between 1 and 100"}
+	}
+	return l, nil
+}
+
+// leniaTap is one cell of a kernel: its offset and weight.
+type leniaTap struct {
+	dx, dy int
+	w      float64
+}
+
+// kernel returns the rule's kernel, a ring peaking halfway out to Radius,
+// normalised to sum to 1.
+func (l LeniaRule) kernel() []leniaTap {
+	var taps []leniaTap
+	var sum float64
+	for dx := -l.Radius; dx <= l.Radius; dx++ {
+		for dy := -l.Radius; dy <= l.Radius; dy++ {
+			r := math.Hypot(float64(dx), float64(dy)) / float64(l.Radius)
+			if r <= 0 || r >= 1 {
+				continue
+			}
+			w := math.Exp(4 - 1/(r*(1-r)))
+			taps = append(taps, leniaTap{dx: dx, dy: dy, w: w})
+			sum += w
+		}
+	}
+	for i := range taps {
+		taps[i].w /= sum
+	}
+	return taps
+}
+
+func (l LeniaRule) growth(u float64) float64 {
+	d := (u - l.Mu) / l.Sigma
+	return 2*math.Exp(-d*d/2) - 1
+}
+
+// Field is a grid of continuous cells from 0 to 1, indexed like Board.
+type Field [][]float64
+
+// NewLeniaField returns a field of w by h with a few square patches of random
+// values, each about three kernel radii across, which is how Lenia creatures
+// are usually found.
+func NewLeniaField(w, h, radius int) Field {
+	f := make(Field, w)
+	for i := range f {
+		f[i] = make([]float64, h)
+	}
+	size := 3 * radius
+	if size > w {
+		size = w
+	}
+	if size > h {
+		size = h
+	}
+	for n := 0; n < 3; n++ {
+		x0, y0 := rand.Intn(w-size+1), rand.Intn(h-size+1)
+		for i := x0; i < x0+size; i++ {
+			for j := y0; j < y0+size; j++ {
+				f[i][j] = rand.Float64()
+			}
+		}
+	}
+	return f
+}
+
+// Step advances the field one step of 1/T under l on a torus, using taps, the
+// rule's kernel. It copies the field into one flat slice, framed by Radius
+// cells wrapped round from the opposite edges, so each tap is a fixed offset
+// into it.
+func (l LeniaRule) Step(f Field, taps []leniaTap) Field {
+	w, h := len(f), len(f[0])
+	n := l.Radius
+	stride := h + 2*n
+	padded := make([]float64, (w+2*n)*stride)
+	for i := 0; i < w+2*n; i++ {
+		col := f[((i-n)%w+w)%w]
+		for j := 0; j < stride; j++ {
+			padded[i*stride+j] = col[((j-n)%h+h)%h]
+		}
+	}
+	offsets := make([]int, len(taps))
+	for k, t := range taps {
+		offsets[k] = t.dx*stride + t.dy
+	}
+
+	dt := 1 / float64(l.T)
+	next := make(Field, w)
+	inBands(w, w*h*len(taps)/8, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			col := make([]float64, h)
+			for j := range col {
+				centre := (i+n)*stride + j + n
+				var u float64
+				for k, off := range offsets {
+					u += taps[k].w * padded[centre+off]
+				}
+				col[j] = math.Max(0, math.Min(1, f[i][j]+dt*l.growth(u)))
+			}
+			next[i] = col
+		}
+	})
+	return next
+}
+
+// Mass is the sum of the field's cells.
+func (f Field) Mass() float64 {
+	var m float64
+	for _, col := range f {
+		for _, v := range col {
+			m += v
+		}
+	}
+	return m
+}
+
+// Colormap maps a cell's value from 0 to 1 to a colour.
+type Colormap []color.RGBA
+
+// colormaps are the colormaps /lenia.svg draws with, as evenly spaced stops.
+var colormaps = map[string]Colormap{
+	"gray":    {{0, 0, 0, 255}, {255, 255, 255, 255}},
+	"viridis": {{68, 1, 84, 255}, {59, 82, 139, 255}, {33, 145, 140, 255}, {94, 201, 98, 255}, {253, 231, 37, 255}},
+	"inferno": {{0, 0, 4, 255}, {87, 16, 110, 255}, {188, 55, 84, 255}, {249, 142, 9, 255}, {252, 255, 164, 255}},
+}
+
+func (c Colormap) At(v float64) color.RGBA {
+	x := math.Max(0, math.Min(1, v)) * float64(len(c)-1)
+	i := int(x)
+	if i >= len(c)-1 {
+		return c[len(c)-1]
+	}
+	return mixColor(c[i+1], c[i], x-float64(i))
+}
+
+func colormapParam(r *http.Request) (string, error) {
+	name := r.URL.Query().Get("colormap")
+	if name == "" {
+		return "viridis", nil
+	}
+	if _, ok := colormaps[name]; !ok {
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown colormap %q, want gray, viridis or inferno", name)}
+	}
+	return name, nil
+}
+
+// leniaSvg draws the field k pixels to a cell on the colormap's colour for 0,
+// leaving out cells too faint to see.
+func leniaSvg(f Field, cm Colormap, k int) []byte {
+	var buf bytes.Buffer
+	canvas := svg.New(&buf)
+	canvas.Start(k*len(f), k*len(f[0]))
+	canvas.Rect(0, 0, k*len(f), k*len(f[0]), `fill="`+svgColor(cm.At(0))+`"`)
+	for i, col := range f {
+		for j, v := range col {
+			if v >= leniaVisible {
+				canvas.Rect(i*k, j*k, k, k, `fill="`+svgColor(cm.At(v))+`"`)
+			}
+		}
+	}
+	canvas.End()
+	return buf.Bytes()
+}
+
+func leniaPng(f Field, cm Colormap, k int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, k*len(f), k*len(f[0])))
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			img.SetRGBA(x, y, cm.At(f[x/k][y/k]))
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type leniaSubscriber struct {
+	session  *Session
+	colormap string
+}
+
+// LeniaWorld runs a Lenia field on a torus for /lenia.svg, pausing while
+// nobody watches and starting over once it dies out.
+type LeniaWorld struct {
+	rule LeniaRule
+	taps []leniaTap
+	task *Task
+
+	mu          sync.Mutex
+	field       Field
+	steps       uint64
+	subscribers map[chan<- ImageBundle]leniaSubscriber
+}
+
+func NewLeniaWorld(rule LeniaRule) *LeniaWorld {
+	lw := &LeniaWorld{
+		rule:        rule,
+		taps:        rule.kernel(),
+		field:       NewLeniaField(leniaWidth, leniaHeight, rule.Radius),
+		subscribers: make(map[chan<- ImageBundle]leniaSubscriber),
+	}
+	lw.task = scheduler.NewTask(time.Second, lw.tick)
+	lw.Start()
+	return lw
+}
+
+func (lw *LeniaWorld) Start() {
+	lw.task.Start()
+}
+
+func (lw *LeniaWorld) Close() {
+	lw.task.Stop()
+}
+
+func (lw *LeniaWorld) tick() {
+	if d := budget.Interval(time.Second); d != lw.task.Interval() {
+		lw.task.SetInterval(d)
+	}
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if len(lw.subscribers) == 0 {
+		lw.task.Pause()
+		return
+	}
+
+	defer budget.Track(time.Now())
+	for i := 0; i < leniaStepsPerTick; i++ {
+		lw.field = lw.rule.Step(lw.field, lw.taps)
+		lw.steps++
+	}
+	mass := lw.field.Mass()
+	if mass < leniaVisible {
+		lw.field = NewLeniaField(leniaWidth, leniaHeight, lw.rule.Radius)
+	}
+	bundles := make(map[string]ImageBundle)
+	for ch, sub := range lw.subscribers {
+		bundle, ok := bundles[sub.colormap]
+		if !ok {
+			bundle = ImageBundle{
+				Data:        leniaSvg(lw.field, colormaps[sub.colormap], leniaScale),
+				ContentType: "image/svg+xml",
+				Generation:  lw.steps,
+				Population:  int(math.Round(mass)),
+				Time:        time.Now(),
+			}
+			bundles[sub.colormap] = bundle
+		}
+		offer(ch, sub.session, bundle)
+	}
+}
+
+func (lw *LeniaWorld) Register(c chan<- ImageBundle, s *Session) func() {
+	return lw.Colormap("viridis").Register(c, s)
+}
+
+// Colormap returns a Render streaming the world drawn with the named
+// colormap.
+func (lw *LeniaWorld) Colormap(name string) Render {
+	return leniaRender{world: lw, colormap: name}
+}
+
+type leniaRender struct {
+	world    *LeniaWorld
+	colormap string
+}
+
+func (r leniaRender) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat("svg")
+	leave := viewerCounts.Join(s, "lenia/"+r.world.rule.String())
+	r.world.mu.Lock()
+	r.world.subscribers[c] = leniaSubscriber{session: s, colormap: r.colormap}
+	r.world.task.Resume()
+	r.world.mu.Unlock()
+	return func() {
+		r.world.mu.Lock()
+		delete(r.world.subscribers, c)
+		r.world.mu.Unlock()
+		leave()
+	}
+}
+
+// LeniaWorlds starts a LeniaWorld per rule asked for.
+type LeniaWorlds struct {
+	mu     sync.Mutex
+	byRule map[LeniaRule]*LeniaWorld
+}
+
+func NewLeniaWorlds() *LeniaWorlds {
+	return &LeniaWorlds{byRule: make(map[LeniaRule]*LeniaWorld)}
+}
+
+func (lws *LeniaWorlds) get(rule LeniaRule) (*LeniaWorld, error) {
+	lws.mu.Lock()
+	defer lws.mu.Unlock()
+	if lw, ok := lws.byRule[rule]; ok {
+		return lw, nil
+	}
+	if len(lws.byRule) >= maxLeniaWorlds {
+		return nil, &requestError{status: http.StatusServiceUnavailable, msg: fmt.Sprintf("%d Lenia worlds are already running", maxLeniaWorlds)}
+	}
+	lw := NewLeniaWorld(rule)
+	lws.byRule[rule] = lw
+	return lw, nil
+}
+
+func (lws *LeniaWorlds) Close() {
+	lws.mu.Lock()
+	defer lws.mu.Unlock()
+	for _, lw := range lws.byRule {
+		lw.Close()
+	}
+}
+
+// Handle streams /lenia.svg and snapshots /lenia.png under ?rule=, drawn with
+// ?colormap=.
+func (lws *LeniaWorlds) Handle(w http.ResponseWriter, r *http.Request) {
+	rule, err := leniaRuleParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	cm, err := colormapParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	lw, err := lws.get(rule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if r.URL.Path == "/lenia.svg" {
+		streamHandleFunc(lw.Colormap(cm))(w, r)
+		return
+	}
+	lw.mu.Lock()
+	data, err := leniaPng(lw.field, colormaps[cm], leniaScale)
+	lw.mu.Unlock()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if _, err := w.Write(data); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// patternFiles are the built-in patterns, one RLE file each, named by their
+// file name without the extension.
+//
+//go:embed patterns/*.rle
+var patternFiles embed.FS
+
+// LibraryPattern is a built-in pattern with what its file says about it.
+type LibraryPattern struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Rule is the rule the pattern is meant for.
+	Rule    string  `json:"rule"`
+	Pattern Pattern `json:"pattern"`
+
+	rule *Rule
+}
+
+// library holds the built-in patterns by name, and patterns just their
+// cells.
+var library, patterns = loadLibrary()
+
+func loadLibrary() (map[string]LibraryPattern, map[string]Pattern) {
+	files, err := patternFiles.ReadDir("patterns")
+	if err != nil {
+		panic(err)
+	}
+	lib := make(map[string]LibraryPattern, len(files))
+	cells := make(map[string]Pattern, len(files))
+	for _, f := range files {
+		data, err := patternFiles.ReadFile(path.Join("patterns", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		p, rule, err := ParseRLEWithRule(string(data))
+		if err != nil {
+			panic(fmt.Sprintf("%s: %v", f.Name(), err))
+		}
+		lp := LibraryPattern{Name: strings.TrimSuffix(f.Name(), ".rle"), Pattern: p}
+		if rule != nil {
+			lp.Rule, lp.rule = rule.String(), rule
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "#N"):
+				lp.Title = strings.TrimSpace(line[2:])
+			case strings.HasPrefix(line, "#C"):
+				lp.Description = strings.TrimSpace(lp.Description + " " + strings.TrimSpace(line[2:]))
+			}
+		}
+		lib[lp.Name] = lp
+		cells[lp.Name] = p
+	}
+	return lib, cells
+}
+
+// patternNames returns the names of the built-in patterns in order.
+func patternNames() []string {
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// patternsHandle lists the built-in patterns for /patterns.json.
+func patternsHandle(w http.ResponseWriter, r *http.Request) {
+	resp := []LibraryPattern{}
+	for _, name := range patternNames() {
+		resp = append(resp, library[name])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Println(err)
+	}
+}
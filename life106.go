@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// maxLife106Span bounds how far apart the cells of a Life 1.06 pattern may
+// be, so a stray coordinate can't ask for an enormous bounding box.
+const maxLife106Span = 1 << 14
+
+// ParseLife106 parses a pattern in the Life 1.06 format: a "#Life 1.06"
+// header and then one live cell a line, as x and y separated by spaces.
+// Coordinates may be negative; the pattern is moved so its bounding box
+// starts at 0, 0.
+func ParseLife106(s string) (Pattern, error) {
+	var cells []image.Point
+	for n, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return Pattern{}, fmt.Errorf("life 1.06: line %d: want x and y, got %q", n+1, line)
+		}
+		x, errX := strconv.Atoi(fields[0])
+		y, errY := strconv.Atoi(fields[1])
+		if errX != nil || errY != nil {
+			return Pattern{}, fmt.Errorf("life 1.06: line %d: bad coordinates %q", n+1, line)
+		}
+		cells = append(cells, image.Pt(x, y))
+	}
+	if len(cells) == 0 {
+		return Pattern{}, nil
+	}
+
+	min, max := cells[0], cells[0]
+	for _, c := range cells {
+		if c.X < min.X {
+			min.X = c.X
+		}
+		if c.Y < min.Y {
+			min.Y = c.Y
+		}
+		if c.X > max.X {
+			max.X = c.X
+		}
+		if c.Y > max.Y {
+			max.Y = c.Y
+		}
+	}
+	if max.X-min.X >= maxLife106Span || max.Y-min.Y >= maxLife106Span {
+		return Pattern{}, fmt.Errorf("life 1.06: cells span more than %d cells", maxLife106Span)
+	}
+	p := Pattern{W: max.X - min.X + 1, H: max.Y - min.Y + 1}
+	seen := make(map[image.Point]bool, len(cells))
+	for _, c := range cells {
+		if !seen[c] {
+			seen[c] = true
+			p.Cells = append(p.Cells, [2]int{c.X - min.X, c.Y - min.Y})
+		}
+	}
+	return p, nil
+}
+
+// EncodeLife106 writes p in the Life 1.06 format, one live cell a line.
+func EncodeLife106(p Pattern) string {
+	var sb strings.Builder
+	sb.WriteString("#Life 1.06\n")
+	for _, c := range p.Cells {
+		fmt.Fprintf(&sb, "%d %d\n", c[0], c[1])
+	}
+	return sb.String()
+}
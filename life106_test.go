@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLife106(t *testing.T) {
+	glider := [][2]int{{1, 0}, {2, 1}, {0, 2}, {1, 2}, {2, 2}}
+	tests := []struct {
+		name  string
+		in    string
+		w, h  int
+		cells [][2]int
+	}{
+		{"glider", "#Life 1.06\n1 0\n2 1\n0 2\n1 2\n2 2\n", 3, 3, glider},
+		{"negative", "#Life 1.06\n0 -1\n1 0\n-1 1\n0 1\n1 1\n", 3, 3, glider},
+		{"offset", "#Life 1.06\n101 50\n102 51\n100 52\n101 52\n102 52\n", 3, 3, glider},
+		{"comments", "#Life 1.06\n#D a glider\n#N glider\n1 0\n2 1\n\n0 2\n1 2\n2 2", 3, 3, glider},
+		{"spacing", "#Life 1.06\r\n  1   0 \r\n2\t1\r\n0 2\r\n1 2\r\n2 2\r\n", 3, 3, glider},
+		{"duplicates", "#Life 1.06\n1 0\n1 0\n2 1\n0 2\n1 2\n2 2\n2 1\n", 3, 3, glider},
+		{"one cell", "#Life 1.06\n-7 -9\n", 1, 1, [][2]int{{0, 0}}},
+		{"no header", "0 0\n3 0\n", 4, 1, [][2]int{{0, 0}, {3, 0}}},
+		{"empty", "#Life 1.06\n", 0, 0, nil},
+	}
+	for _, tt := range tests {
+		p, err := ParseLife106(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if p.W != tt.w || p.H != tt.h {
+			t.Errorf("%s: size %dx%d, want %dx%d", tt.name, p.W, p.H, tt.w, tt.h)
+		}
+		if got, want := sortedCells(p), sortedCells(Pattern{Cells: tt.cells}); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: cells %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestParseLife106Malformed(t *testing.T) {
+	for _, in := range []string{
+		"#Life 1.06\n1\n",
+		"#Life 1.06\n1 2 3\n",
+		"#Life 1.06\n1 a\n",
+		"#Life 1.06\n1.5 2\n",
+		"#Life 1.06\n0 0\nx y\n",
+		"#Life 1.06\n0 0\n16384 0\n",
+		"#Life 1.06\n0 -10000\n0 10000\n",
+	} {
+		if p, err := ParseLife106(in); err == nil {
+			t.Errorf("ParseLife106(%q) = %v, want an error", in, p)
+		}
+	}
+}
+
+func TestLife106RoundTrip(t *testing.T) {
+	for name, lp := range library {
+		in := lp.Pattern
+		s := EncodeLife106(in)
+		if !strings.HasPrefix(s, "#Life 1.06\n") {
+			t.Errorf("%s: no #Life 1.06 header", name)
+		}
+		out, err := ParseLife106(s)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// Life 1.06 keeps no bounding box, so the pattern comes back cropped
+		// to its cells, which the library's patterns fill.
+		if !reflect.DeepEqual(sortedCells(out), sortedCells(in)) {
+			t.Errorf("%s: %v came back as %v", name, in, out)
+		}
+
+		p, rule, err := ParsePattern(s)
+		if err != nil || rule != nil || !reflect.DeepEqual(sortedCells(p), sortedCells(in)) {
+			t.Errorf("%s: ParsePattern did not read it as Life 1.06: %v, %v, %v", name, p, rule, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// maxLtLRadius is the largest neighbourhood radius a Larger than Life rule
+// may have.
+const maxLtLRadius = 10
+
+// LargerThanLife is the part of a Rule that makes it a Larger than Life rule,
+// counting the live cells in the square of cells within Radius of a cell,
+// the cell itself too if Middle is set. A dead cell comes alive with a count
+// from Birth[0] to Birth[1] and a live cell survives with one from Survive[0]
+// to Survive[1]. The zero LargerThanLife, of Radius 0, is not one.
+type LargerThanLife struct {
+	Radius  uint8
+	Middle  bool
+	Birth   [2]uint16
+	Survive [2]uint16
+}
+
+// ltlRule reports whether s looks like a Larger than Life rule in Golly's
+// notation rather than B/S notation.
+func ltlRule(s string) bool {
+	return strings.HasPrefix(strings.ToUpper(s), "R") && strings.Contains(s, ",")
+}
+
+// parseLtL parses a Larger than Life rule in Golly's notation, like Bugs,
+// R5,C0,M1,S34..58,B34..45,NM. Only two states and the Moore neighbourhood,
+// NM, are supported.
+func parseLtL(s string) (Rule, error) {
+	bad := func(why string) (Rule, error) {
+		return Rule{}, fmt.Errorf("bad rule %q: %s", s, why)
+	}
+	var l LargerThanLife
+	var seen [6]bool
+	for _, part := range strings.Split(strings.ToUpper(s), ",") {
+		if part == "" {
+			return bad("want R5,C0,M1,S34..58,B34..45,NM")
+		}
+		key := strings.IndexByte("RCMSBN", part[0])
+		if key < 0 || seen[key] {
+			return bad("want R5,C0,M1,S34..58,B34..45,NM")
+		}
+		seen[key] = true
+		v := part[1:]
+		switch part[0] {
+		case 'R':
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 2 || n > maxLtLRadius {
+				return bad(fmt.Sprintf("the radius goes from 2 to %d", maxLtLRadius))
+			}
+			l.Radius = uint8(n)
+		case 'C':
+			if v != "0" && v != "2" {
+				return bad("only two states are supported")
+			}
+		case 'M':
+			if v != "0" && v != "1" {
+				return bad("M is 0 or 1")
+			}
+			l.Middle = v == "1"
+		case 'S', 'B':
+			ends := strings.Split(v, "..")
+			lo, err1 := strconv.Atoi(ends[0])
+			hi, err2 := strconv.Atoi(ends[len(ends)-1])
+			if len(ends) != 2 || err1 != nil || err2 != nil || lo < 0 || lo > hi {
+				return bad("counts are ranges like 34..58")
+			}
+			if part[0] == 'S' {
+				l.Survive = [2]uint16{uint16(lo), uint16(hi)}
+			} else {
+				l.Birth = [2]uint16{uint16(lo), uint16(hi)}
+			}
+		case 'N':
+			if v != "M" {
+				return bad("only the Moore neighbourhood, NM, is supported")
+			}
+		}
+	}
+	if !seen[0] || !seen[3] || !seen[4] {
+		return bad("want R5,C0,M1,S34..58,B34..45,NM")
+	}
+	return Rule{LtL: l}, nil
+}
+
+func (l LargerThanLife) String() string {
+	m := 0
+	if l.Middle {
+		m = 1
+	}
+	return fmt.Sprintf("R%d,C0,M%d,S%d..%d,B%d..%d,NM", l.Radius, m, l.Survive[0], l.Survive[1], l.Birth[0], l.Birth[1])
+}
+
+func (l LargerThanLife) next(alive bool, count int) bool {
+	lo, hi := l.Birth[0], l.Birth[1]
+	if alive {
+		lo, hi = l.Survive[0], l.Survive[1]
+	}
+	return int(lo) <= count && count <= int(hi)
+}
+
+// mutate returns l with one end of its birth or survival range moved by one,
+// keeping the range from turning inside out.
+func (l LargerThanLife) mutate(rng *rand.Rand) LargerThanLife {
+	for {
+		m := l
+		bounds := &m.Birth
+		if rng.Intn(2) == 0 {
+			bounds = &m.Survive
+		}
+		end := rng.Intn(2)
+		if rng.Intn(2) == 0 {
+			bounds[end]++
+		} else if bounds[end] > 0 {
+			bounds[end]--
+		}
+		if bounds[0] <= bounds[1] && m != l {
+			return m
+		}
+	}
+}
+
+// evoluteLtL advances board one generation under a Larger than Life rule.
+// It sums the board once into a table of the live cells above and to the
+// left of each corner, from which any square's count takes four lookups
+// whatever the radius.
+func (r Rule) evoluteLtL(board Board) Board {
+	w, h := len(board), len(board[0])
+	stride := h + 1
+	sums := make([]int32, (w+1)*stride)
+	for i := 0; i < w; i++ {
+		cells := cellBytes(board[i])
+		var col int32
+		for j := 0; j < h; j++ {
+			col += int32(cells[j])
+			sums[(i+1)*stride+j+1] = sums[i*stride+j+1] + col
+		}
+	}
+
+	rad := int(r.LtL.Radius)
+	clamp := func(v, n int) int {
+		if v < 0 {
+			return 0
+		}
+		if v > n {
+			return n
+		}
+		return v
+	}
+	next := make(Board, w)
+	inBands(w, w*h, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			x0, x1 := clamp(i-rad, w), clamp(i+rad+1, w)
+			col := make([]bool, h)
+			for j := range col {
+				y0, y1 := clamp(j-rad, h), clamp(j+rad+1, h)
+				n := sums[x1*stride+y1] - sums[x0*stride+y1] - sums[x1*stride+y0] + sums[x0*stride+y0]
+				alive := board[i][j]
+				if alive && !r.LtL.Middle {
+					n--
+				}
+				col[j] = r.LtL.next(alive, int(n))
+			}
+			next[i] = col
+		}
+	})
+	return next
+}
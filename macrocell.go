@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseMacrocell loads a pattern in Golly's macrocell format into a new
+// HashLife stepping 2^j generations at a time. Nodes are listed bottom up,
+// each line either an 8x8 leaf drawn with '.', '*' and '$' or a level and the
+// line numbers of its four quadrants, 0 meaning empty; the last is the root,
+// placed with its centre at the origin. A #R line sets the rule.
+func ParseMacrocell(s string, j uint) (*HashLife, error) {
+	lines := strings.Split(s, "\n")
+	if len(lines) == 0 || !strings.HasPrefix(strings.TrimSpace(lines[0]), "[M2]") {
+		return nil, fmt.Errorf("macrocell: missing [M2] header")
+	}
+	rule := Conway
+	var specs []string
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#R"):
+			r, err := ParseRule(strings.TrimSpace(line[2:]))
+			if err != nil {
+				return nil, fmt.Errorf("macrocell: %v", err)
+			}
+			if r.Birth&1 != 0 {
+				return nil, fmt.Errorf("macrocell: rules with B0 are not supported")
+			}
+			if !r.moore() {
+				return nil, fmt.Errorf("macrocell: von Neumann and Larger than Life rules are not supported")
+			}
+			rule = r
+		case strings.HasPrefix(line, "#"):
+		default:
+			specs = append(specs, line)
+		}
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("macrocell: no nodes")
+	}
+
+	h := NewHashLife(rule, j)
+	nodes := make([]*node, 1, len(specs)+1)
+	for n, spec := range specs {
+		var nd *node
+		var err error
+		if c := spec[0]; c == '.' || c == '*' || c == '$' {
+			nd, err = h.leaf(spec)
+		} else {
+			nd, err = h.branch(spec, nodes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("macrocell: node %d: %v", n+1, err)
+		}
+		nodes = append(nodes, nd)
+	}
+
+	root := nodes[len(nodes)-1]
+	h.root = root
+	h.x = -(int64(1) << (root.level - 1))
+	h.y = h.x
+	return h, nil
+}
+
+// leaf builds an 8x8 node from rows of '.' and '*' ended by '$'.
+func (h *HashLife) leaf(spec string) (*node, error) {
+	var cells [8][8]bool
+	x, y := 0, 0
+	for _, c := range spec {
+		switch c {
+		case '$':
+			x, y = 0, y+1
+		case '.', '*':
+			if x >= 8 || y >= 8 {
+				return nil, fmt.Errorf("leaf larger than 8x8")
+			}
+			cells[x][y] = c == '*'
+			x++
+		default:
+			return nil, fmt.Errorf("unexpected %q in leaf", c)
+		}
+	}
+	var build func(x, y int, level uint) *node
+	build = func(x, y int, level uint) *node {
+		if level == 0 {
+			if cells[x][y] {
+				return h.live
+			}
+			return h.dead
+		}
+		half := 1 << (level - 1)
+		return h.join(
+			build(x, y, level-1), build(x+half, y, level-1),
+			build(x, y+half, level-1), build(x+half, y+half, level-1),
+		)
+	}
+	return build(0, 0, 3), nil
+}
+
+// branch builds a node from "level nw ne sw se", the quadrants referring to
+// earlier nodes by line number.
+func (h *HashLife) branch(spec string, nodes []*node) (*node, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("want level and four quadrants, got %q", spec)
+	}
+	level, err := strconv.Atoi(fields[0])
+	if err != nil || level < 4 || level > 62 {
+		return nil, fmt.Errorf("bad level %q", fields[0])
+	}
+	var q [4]*node
+	for i, f := range fields[1:] {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 || n >= len(nodes) {
+			return nil, fmt.Errorf("bad quadrant %q", f)
+		}
+		if n == 0 {
+			q[i] = h.empty(uint(level - 1))
+			continue
+		}
+		if nodes[n].level != uint(level-1) {
+			return nil, fmt.Errorf("quadrant %d is level %d, want %d", n, nodes[n].level, level-1)
+		}
+		q[i] = nodes[n]
+	}
+	return h.join(q[0], q[1], q[2], q[3]), nil
+}
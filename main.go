@@ -13,7 +13,10 @@ import (
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unsafe"
 
 	svg "github.com/ajstarks/svgo"
 )
@@ -25,6 +28,16 @@ func init() {
 type ImageBundle struct {
 	Data        []byte
 	ContentType string
+	Generation  uint64
+	// Delta is the frame as a change to the one before, for streams that
+	// encode deltas.
+	Delta *FrameDelta
+	// Population and Time describe the board shown, if there is one; Time is
+	// zero otherwise.
+	Population int
+	Time       time.Time
+	// Complexity describes the board shown, for rooms that measure it.
+	Complexity *Complexity
 }
 
 type Board [][]bool
@@ -39,6 +52,18 @@ func (b Board) Get(i, j int) bool {
 	return b[i][j]
 }
 
+func (b Board) Population() int {
+	var n int
+	for _, col := range b {
+		for _, alive := range col {
+			if alive {
+				n++
+			}
+		}
+	}
+	return n
+}
+
 func (b Board) String() string {
 	s := ""
 	for i := 0; i < len(b); i++ {
@@ -54,53 +79,299 @@ func (b Board) String() string {
 	return s
 }
 
-func (b Board) image(scale int) image.Image {
-	k := scale
-	img := image.NewRGBA(image.Rect(0, 0, k*len(b), k*len(b[0])))
-	for i := 0; i < len(b); i++ {
-		for j := 0; j < len(b[i]); j++ {
-			if !b[i][j] {
+// Style selects how frames are drawn. It is comparable, so streams that share
+// a style share an encoder.
+type Style struct {
+	Scale int
+	// Delta draws cells born this generation in the palette's Born colour and
+	// outlines cells that die in the next one in its Dying colour.
+	Delta bool
+	// Theme names the palette, the default one if empty.
+	Theme string
+	// Modulate names the modulator that fades the palette with some signal,
+	// none if empty.
+	Modulate string
+	// Inset draws the frame's Inset, the board insetSpeed times further on,
+	// in the bottom-right corner.
+	Inset bool
+	// Texture names the texture dead cells are drawn with, none if empty.
+	Texture string
+	// Labels draws the frame's Notes.
+	Labels bool
+	// AutoZoom follows the board's activity with a camera, drawing the
+	// frame's View.
+	AutoZoom bool
+	// Vectors draws the velocity of each of the frame's Ships.
+	Vectors bool
+	// Invert swaps the palette's live and background colours.
+	Invert bool
+	// Timeline draws a strip of the frame's Milestones under the board.
+	Timeline bool
+	// Age colours live cells by how long they have lived, from the frame's
+	// Ages.
+	Age bool
+	// Counter draws the frame's Generation in the top-right corner.
+	Counter bool
+}
+
+func (st Style) palette() *Palette {
+	p := palettes["default"]
+	if named, ok := palettes[st.Theme]; ok {
+		p = named
+	} else if tp, ok := themeProviders[st.Theme]; ok {
+		p = tp.Palette(time.Now())
+	}
+	if st.Invert {
+		return p.inverted()
+	}
+	return p
+}
+
+// Frame is a board about to be rendered, along with the generation before it
+// for styles that show change.
+type Frame struct {
+	Board Board
+	Prev  Board
+	Rule  Rule
+	// Topology and Grid are the board's, for styles that show the next
+	// generation. Grid also sets the shape cells are drawn in.
+	Topology Topology
+	Grid     Grid
+	// Caption, if set, is drawn over the top-left corner of the board.
+	Caption string
+	// Inset is the board's future, for styles that show it.
+	Inset Board
+	// Notes are the room's annotations, for styles that show labels.
+	Notes []Annotation
+	// Ships are the board's spaceships, for styles that show vectors.
+	Ships []Ship
+	// Milestones are the room's up to Generation, the board's, for styles
+	// that show a timeline.
+	Milestones []Milestone
+	Generation uint64
+	// Ages, if set, are how many generations each live cell has lived, for
+	// styles that show age.
+	Ages AgeBoard
+	// Cells, if set, are the board's cells under a multi-state rule of States
+	// states, and its dying cells are drawn too.
+	Cells  StateBoard
+	States uint8
+	// Colors, if set, are the colours of the board's live cells under a
+	// ColorRule.
+	Colors ColorBoard
+	// View, if not empty, is the part of the board drawn, in pixels at the
+	// style's scale, magnified to fill the frame. Overlays stay put.
+	View image.Rectangle
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// paint calls draw for every live cell with its fill and whether to outline it
+// as dying.
+func (f Frame) paint(st Style, draw func(i, j int, fill color.RGBA, dying bool)) {
+	pal := f.palette(st)
+	var next Board
+	if st.Delta {
+		next = f.Grid.Evolute(f.Topology, f.Rule, f.Board)
+	}
+	for i, col := range f.Board {
+		for j, alive := range col {
+			if !alive {
+				if f.Cells != nil && f.Cells[i][j] > 1 {
+					draw(i, j, decayColor(pal, f.Cells[i][j], f.States), false)
+				}
 				continue
 			}
-			draw.Draw(img, image.Rect(k*i, k*j, k*(i+1), k*(j+1)), &image.Uniform{C: color.RGBA{A: 255}}, image.Point{}, draw.Src)
+			fill, dying := pal.Alive, false
+			if st.Age && f.Ages != nil {
+				fill = ageColor(pal, f.Ages[i][j])
+			}
+			if f.Colors != nil {
+				fill = cellColor(pal, f.Colors[i][j])
+			}
+			if st.Delta {
+				if f.Prev != nil && !f.Prev.Get(i, j) {
+					fill = pal.Born
+				}
+				dying = !next.Get(i, j)
+			}
+			draw(i, j, fill, dying)
 		}
 	}
+}
+
+func outline(img draw.Image, r image.Rectangle, c color.RGBA) {
+	u := &image.Uniform{C: c}
+	if r.Dx() < 3 || r.Dy() < 3 {
+		draw.Draw(img, r, u, image.Point{}, draw.Src)
+		return
+	}
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1),
+		image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y),
+		image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(img, edge, u, image.Point{}, draw.Src)
+	}
+}
+
+func (f Frame) image(st Style) image.Image {
+	k := st.Scale
+	b := f.Board
+	pal := f.palette(st)
+	img := image.NewRGBA(image.Rect(0, 0, k*len(b), k*len(b[0])))
+	if pal.Background.A > 0 {
+		draw.Draw(img, img.Bounds(), &image.Uniform{C: pal.Background}, image.Point{}, draw.Src)
+	}
+	drawTexture(img, st, pal)
+	f.paint(st, func(i, j int, fill color.RGBA, dying bool) {
+		if f.Grid == Tri {
+			f.fillTriangle(img, i, j, k, fill)
+			return
+		}
+		r := f.cellRect(i, j, k)
+		draw.Draw(img, r, &image.Uniform{C: fill}, image.Point{}, draw.Src)
+		if dying {
+			outline(img, r, pal.Dying)
+		}
+	})
+	if st.Vectors {
+		f.drawVectors(img, k)
+	}
+	if st.Labels {
+		f.drawLabels(img, k)
+	}
+	if !f.View.Empty() {
+		img = zoomed(img, f.View)
+	}
+	if st.Inset && f.Inset != nil {
+		f.drawInset(img, st, pal)
+	}
+	if f.Caption != "" {
+		px := k / 3
+		if px < 2 {
+			px = 2
+		}
+		drawCaption(img, f.Caption, px)
+	}
+	if st.Counter {
+		px := k / 3
+		if px < 2 {
+			px = 2
+		}
+		f.drawCounter(img, px)
+	}
+	if st.Timeline {
+		img = f.withTimeline(img, pal)
+	}
 	return img
 }
 
-func (b Board) Jpeg(scale int) ([]byte, error) {
+// opaque renders the frame flattened onto white, for formats without an alpha
+// channel.
+func (f Frame) opaque(st Style) *image.RGBA {
+	src := f.image(st)
+	img := image.NewRGBA(src.Bounds())
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, img.Bounds(), src, image.Point{}, draw.Over)
+	return img
+}
+
+func (f Frame) Jpeg(st Style) ([]byte, error) {
+	img := f.opaque(st)
 	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, b.image(scale), nil); err != nil {
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-func (b Board) Png(scale int) ([]byte, error) {
+func (f Frame) Png(st Style) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := png.Encode(&buf, b.image(scale)); err != nil {
+	if err := png.Encode(&buf, f.image(st)); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-func (b Board) Svg(scale int) ([]byte, error) {
-	k := scale
+func (f Frame) Svg(st Style) ([]byte, error) {
+	k := st.Scale
+	b := f.Board
 	var buf bytes.Buffer
 	canvas := svg.New(&buf)
-	canvas.Start(k*len(b), k*len(b[0]))
-	for i := 0; i < len(b); i++ {
-		for j := 0; j < len(b[i]); j++ {
-			if !b[i][j] {
-				continue
+	pal := f.palette(st)
+	if st.Timeline {
+		canvas.Start(k*len(b), k*len(b[0])+timelineHeight)
+	} else {
+		canvas.Start(k*len(b), k*len(b[0]))
+	}
+	if pal.Background.A > 0 {
+		canvas.Rect(0, 0, k*len(b), k*len(b[0]), `fill="`+svgColor(pal.Background)+`"`)
+	}
+	if !f.View.Empty() {
+		canvas.Gtransform(fmt.Sprintf("scale(%g) translate(%d %d)", float64(k*len(b))/float64(f.View.Dx()), -f.View.Min.X, -f.View.Min.Y))
+	}
+	svgTexture(canvas, st, pal, k*len(b), k*len(b[0]))
+	f.paint(st, func(i, j int, fill color.RGBA, dying bool) {
+		if pts := f.cellPoints(i, j, k); pts != "" {
+			attrs := `fill="` + svgColor(fill) + `"`
+			if dying {
+				attrs += ` stroke="` + svgColor(pal.Dying) + `"`
 			}
-			canvas.Rect(i*k, j*k, k, k, `fill="black"`)
+			fmt.Fprintf(canvas.Writer, "<polygon points=\"%s\" %s />\n", pts, attrs)
+			return
 		}
+		if dying {
+			canvas.Rect(i*k, j*k, k, k, `fill="`+svgColor(fill)+`"`, `stroke="`+svgColor(pal.Dying)+`"`)
+		} else {
+			canvas.Rect(i*k, j*k, k, k, `fill="`+svgColor(fill)+`"`)
+		}
+	})
+	if st.Vectors {
+		f.svgVectors(canvas, k)
+	}
+	if st.Labels {
+		f.svgLabels(canvas, k)
+	}
+	if !f.View.Empty() {
+		canvas.Gend()
+	}
+	if st.Inset && f.Inset != nil {
+		f.svgInset(canvas, st, pal)
+	}
+	if f.Caption != "" {
+		canvas.Rect(0, 0, 9*len(f.Caption)+8, 22, `fill="white"`, `fill-opacity="0.8"`)
+		canvas.Text(4, 11, f.Caption,
+			`font-size="14"`, `font-family="monospace"`, `fill="#c80000"`,
+			`dominant-baseline="middle"`,
+		)
+	}
+	if st.Counter {
+		f.svgCounter(canvas, k*len(b))
+	}
+	if st.Timeline {
+		f.svgTimeline(canvas, pal, k*len(b[0]), k*len(b))
 	}
 	canvas.End()
 	return buf.Bytes(), nil
 }
 
+func errorSvg(msg string) []byte {
+	var buf bytes.Buffer
+	canvas := svg.New(&buf)
+	canvas.Start(len(msg)*8+20, 30)
+	canvas.Rect(0, 0, len(msg)*8+20, 30, `fill="white"`, `stroke="red"`)
+	canvas.Text(10, 15, msg,
+		`font-size="14"`, `font-family="monospace"`, `fill="red"`,
+		`dominant-baseline="middle"`,
+	)
+	canvas.End()
+	return buf.Bytes()
+}
+
 func numberSvg(v int) []byte {
 	s := strconv.Itoa(v)
 	var buf bytes.Buffer
@@ -115,11 +386,33 @@ func numberSvg(v int) []byte {
 }
 
 func NewBoard(w, h int) Board {
+	return NewSeededBoard(w, h, rand.Int63())
+}
+
+// defaultDensity is the share of a soup's cells that start alive unless a
+// room asks for another.
+const defaultDensity = 0.2
+
+// NewSeededBoard returns a random soup that is the same for the same seed.
+func NewSeededBoard(w, h int, seed int64) Board {
+	return NewSoup(w, h, seed, defaultDensity)
+}
+
+// NewSoup returns a random soup with about density of its cells alive that is
+// the same for the same seed and density. At the default density it draws
+// cells the way soups always have, so seeds recorded before density could be
+// picked lay out the same.
+func NewSoup(w, h int, seed int64, density float64) Board {
+	rng := rand.New(rand.NewSource(seed))
+	alive := func() bool { return rng.Float64() < density }
+	if density == defaultDensity {
+		alive = func() bool { return rng.Int()%5 == 0 }
+	}
 	b := make(Board, w)
 	for i := 0; i < w; i++ {
 		b[i] = make([]bool, h)
 		for j := 0; j < h; j++ {
-			if rand.Int()%5 == 0 {
+			if alive() {
 				b[i][j] = true
 			}
 		}
@@ -127,188 +420,706 @@ func NewBoard(w, h int) Board {
 	return b
 }
 
-func Evolute(board Board) Board {
-	newBoard := make(Board, len(board))
-	for i := 0; i < len(board); i++ {
-		newBoard[i] = make([]bool, len(board[i]))
-		for j := 0; j < len(board[i]); j++ {
-			var cnt int
-
-			directions := [8][2]int{
-				{1, 1},
-				{1, 0},
-				{1, -1},
-				{0, 1},
-				{0, -1},
-				{-1, 1},
-				{-1, 0},
-				{-1, -1},
+func cell(col []bool, j int) int {
+	if j < len(col) && col[j] {
+		return 1
+	}
+	return 0
+}
+
+// countPassCells is the board area from which Evolute switches from the lookup
+// table to the neighbour-count pass, roughly where the latter starts winning.
+const countPassCells = 200 * 200
+
+// Evolute advances board one generation under r.
+func (r Rule) Evolute(board Board) Board {
+	return r.EvoluteInto(nil, board)
+}
+
+// EvoluteInto is Evolute writing the next generation into next, whose columns
+// it reuses if it is the size of board, and returning it. Stepping a board
+// over and over, swapping it with next each time, then allocates nothing once
+// both exist. next must not be board, and nothing else may still be reading
+// it. Larger than Life and von Neumann rules always allocate.
+func (r Rule) EvoluteInto(next, board Board) Board {
+	if len(board) == 0 {
+		return Board{}
+	}
+	if r.LtL.Radius > 0 {
+		return r.evoluteLtL(board)
+	}
+	if r.Neighbourhood == VonNeumann {
+		return evoluteOffsets(board, r, Bounded, func(int, int) [][2]int { return vonNeumannNeighbours })
+	}
+	pass := tableBand
+	if len(board)*len(board[0]) >= countPassCells {
+		pass = countsBand
+	}
+	t := r.tables()
+	if len(next) != len(board) {
+		next = make(Board, len(board))
+	}
+	inBands(len(board), len(board)*len(board[0]), func(lo, hi int) {
+		pass(board, t, next, lo, hi)
+	})
+	return next
+}
+
+func evoluteTable(board Board, t *ruleTables) Board {
+	next := make(Board, len(board))
+	tableBand(board, t, next, 0, len(board))
+	return next
+}
+
+// tableBand fills columns lo to hi of next with the step of board, looking up
+// each cell's 3x3 window in the rule's table. Columns of next that are already
+// the right length are overwritten in place.
+func tableBand(board Board, t *ruleTables, next Board, lo, hi int) {
+	for i := lo; i < hi; i++ {
+		var left, right []bool
+		if i > 0 {
+			left = board[i-1]
+		}
+		if i+1 < len(board) {
+			right = board[i+1]
+		}
+		mid := board[i]
+
+		col := next[i]
+		if len(col) != len(mid) {
+			col = make([]bool, len(mid))
+			next[i] = col
+		}
+		idx := cell(left, 0)<<2 | cell(mid, 0)<<1 | cell(right, 0)
+		for j := range mid {
+			idx = (idx<<3 | cell(left, j+1)<<2 | cell(mid, j+1)<<1 | cell(right, j+1)) & 0x1ff
+			col[j] = t.window[idx]
+		}
+	}
+}
+
+// cellBytes views a column as bytes; a Go bool is stored as a 0 or 1 byte, so
+// cells can be summed without branching.
+func cellBytes(col []bool) []uint8 {
+	return *(*[]uint8)(unsafe.Pointer(&col))
+}
+
+func evoluteCounts(board Board, t *ruleTables) Board {
+	next := make(Board, len(board))
+	if len(board) > 0 {
+		countsBand(board, t, next, 0, len(board))
+	}
+	return next
+}
+
+// countScratch holds the sums countsBand works in between calls, so bands
+// stepped over and over reuse them.
+var countScratch = sync.Pool{New: func() interface{} { return new([]uint8) }}
+
+// countsBand fills columns lo to hi of next with the step of board, reusing
+// its columns like tableBand. It sums every 3x3 block into a flat grid of
+// counts, first down each column and then across neighbouring columns, and
+// applies the rule to the sums. It does one predictable pass per step instead
+// of eight scattered lookups per cell.
+func countsBand(board Board, t *ruleTables, next Board, lo, hi int) {
+	w, h := len(board), len(board[0])
+	// Column sums for lo-1 to hi, where they exist.
+	from, to := lo-1, hi+1
+	if from < 0 {
+		from = 0
+	}
+	if to > w {
+		to = w
+	}
+	scratch := countScratch.Get().(*[]uint8)
+	defer countScratch.Put(scratch)
+	if n := (to - from + 1) * h; cap(*scratch) < n {
+		*scratch = make([]uint8, n)
+	}
+	vertical := (*scratch)[:(to-from)*h]
+	for i := from; i < to; i++ {
+		row := vertical[(i-from)*h : (i-from+1)*h]
+		cells := cellBytes(board[i])
+		for j := range row {
+			sum := cells[j]
+			if j > 0 {
+				sum += cells[j-1]
+			}
+			if j+1 < h {
+				sum += cells[j+1]
 			}
+			row[j] = sum
+		}
+	}
 
-			for _, dir := range directions {
-				if board.Get(i+dir[0], j+dir[1]) {
-					cnt++
-				}
+	counts := (*scratch)[(to-from)*h : (to-from+1)*h]
+	for i := lo; i < hi; i++ {
+		for j := range counts {
+			counts[j] = 0
+		}
+		for k := i - 1; k <= i+1; k++ {
+			if k < from || k >= to {
+				continue
 			}
-			if cnt == 2 {
-				newBoard[i][j] = board.Get(i, j)
-			} else if cnt == 3 {
-				newBoard[i][j] = true
-			} else {
-				newBoard[i][j] = false
+			src := vertical[(k-from)*h : (k-from+1)*h]
+			for j := range counts {
+				counts[j] += src[j]
 			}
 		}
+		cells := cellBytes(board[i])
+		col := next[i]
+		if len(col) != h {
+			col = make([]bool, h)
+			next[i] = col
+		}
+		for j := range col {
+			col[j] = t.sums[counts[j]+10*cells[j]]
+		}
 	}
-	return newBoard
 }
 
 type Render interface {
-	Register(c chan<- ImageBundle) func()
+	Register(c chan<- ImageBundle, s *Session) func()
 }
 
+// GameConfig holds the settings shared by every room.
+type GameConfig struct {
+	Drop    DropPolicy
+	Pool    *WorkerPool
+	History int
+	// InjectEvery fires a spaceship in from an edge every so many
+	// generations, so boards that have settled get stirred up again.
+	InjectEvery uint64
+	// MutateEvery toggles one condition of each room's rule this often,
+	// showing the current rule over the board.
+	MutateEvery time.Duration
+	// Theme is the theme streams use unless a request picks one.
+	Theme string
+	// FreezeAfter holds each room still once it has run this many
+	// generations since it was seeded, for FreezeHold, and then reseeds it.
+	// Zero disables it.
+	FreezeAfter uint64
+	FreezeHold  time.Duration
+	// Soups, if set, finds the soups rooms reseed with.
+	Soups *SoupSearch
+	// Seed, if not zero, seeds rooms that are not given a seed of their
+	// own, each mixed with its name, so they start over the same.
+	Seed int64
+	// ReseedAfterCycle reseeds each room once its board has repeated a
+	// cycle of period up to maxCyclePeriod for this many generations,
+	// ReseedExtinct once it has been empty for this many, and ReseedFlat
+	// once its population has stayed within ReseedFlatBand of itself for
+	// this many. Zero disables each.
+	ReseedAfterCycle uint64
+	ReseedExtinct    uint64
+	ReseedFlat       uint64
+	ReseedFlatBand   float64
+	// Notes keeps the rooms' annotations; if nil they last only as long as
+	// each room.
+	Notes *AnnotationStore
+}
+
+// pollKeepAlive is how long a room keeps evolving after a polling request
+// without any stream subscribers.
+const pollKeepAlive = 10 * time.Second
+
+// queueKeepAlive is how long an encode queue outlives its last subscriber, so
+// that a viewer reconnecting right away reuses it.
+const queueKeepAlive = 30 * time.Second
+
 type GameRender struct {
-	gameChs map[chan<- ImageBundle]struct{}
+	name     string
+	opts     RoomOptions
+	cfg      GameConfig
+	seed     int64
+	history  *History
+	replays  replayCache
+	cycles   CycleDetector
+	stats    PopulationStats
+	reseeds  ReseedLog
+	census   ObjectTracker
+	events   EventLog
+	timeline Timeline
+	notes    *Annotations
+	task     *Task
+	mutated  time.Time    // only touched by task
+	ahead    *speculation // only touched by task
+	seeded   uint64       // only touched by task
+	frozen   time.Time    // only touched by task
+	caption  string       // only touched by task
+	rng      *rand.Rand   // only touched by task
+	ages     AgeBoard     // only touched by task
+	plane    *Viewport    // only touched by task, nil unless unbounded or multi-state
+	control  chan func()
+
+	mu         sync.Mutex
+	rule       Rule
+	complexity Complexity
+	queues     map[streamKey]*encodeQueue
+	pollUntil  time.Time
+	seen       time.Time // last watched, polled or changed
 }
 
-func NewGameRender() Render {
+func NewGameRender(name string, opts RoomOptions, cfg GameConfig) *GameRender {
 	r := &GameRender{
-		gameChs: make(map[chan<- ImageBundle]struct{}),
+		name:    name,
+		opts:    opts,
+		cfg:     cfg,
+		seed:    opts.seed(name, cfg.Seed),
+		history: NewHistory(cfg.History),
+		notes:   cfg.Notes.For(name),
+		rule:    opts.rule(),
+		queues:  make(map[streamKey]*encodeQueue),
+		control: make(chan func(), 16),
+		seen:    time.Now(),
 	}
+	r.rng = rand.New(rand.NewSource(r.seed))
+	r.task = scheduler.NewTask(time.Second, r.tick)
+	b := opts.board(r.seed)
+	r.plane = opts.viewport(b)
+	r.ages = r.ages.next(b)
+	r.push(opts.ResumeAt, b)
 	r.Start()
 	return r
 }
 
 func (r *GameRender) Start() {
-	go func() {
-		b := NewBoard(80, 60)
+	r.mutated = time.Now()
+	r.task.Start()
+}
 
-		for {
-			if len(r.gameChs) == 0 {
-				time.Sleep(time.Millisecond * 100)
-				continue
-			}
-			b = Evolute(b)
+// tick advances the room one generation while anyone is watching, and pauses
+// the room once nobody is and its encode queues are gone. Requests queued on
+// the control channel take the place of evolving.
+func (r *GameRender) tick() {
+	if d := budget.Interval(time.Second); d != r.task.Interval() {
+		r.task.SetInterval(d)
+	}
+	r.reapQueues()
+	if r.runControl() || !r.active() {
+		r.pauseIfIdle()
+		return
+	}
 
-			img, err := b.Svg(10)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			bundle := ImageBundle{
-				Data:        img,
-				ContentType: "image/svg+xml",
-			}
+	defer budget.Track(time.Now())
+	latest := r.history.Latest()
+	b, gen := latest.Board, latest.Number
+	if r.freeze(gen, b) || r.restart(gen, b) {
+		return
+	}
+	if r.cfg.MutateEvery > 0 && time.Since(r.mutated) >= r.cfg.MutateEvery {
+		r.mutateRule(gen, b)
+		r.mutated = time.Now()
+	}
+	rule := r.Rule()
 
-			for ch := range r.gameChs {
-				select {
-				case ch <- bundle:
-				default:
-				}
-			}
-			time.Sleep(time.Second)
+	prev := b
+	b = advance(r.opts, r.plane, rule, b)
+	gen++
+	if r.cfg.InjectEvery > 0 && gen%r.cfg.InjectEvery == 0 {
+		if e, ok := spaceshipEvent(b, gen, r.rng); ok {
+			b, _ = r.record(e, b)
+		}
+	}
+	r.publish(gen, prev, b, rule)
+}
+
+// runControl runs the queued control requests and reports whether there were
+// any.
+func (r *GameRender) runControl() bool {
+	ran := false
+	for {
+		select {
+		case f := <-r.control:
+			f()
+			ran = true
+		default:
+			return ran
+		}
+	}
+}
+
+// publish makes b generation gen and sends it to the streams. Over the CPU
+// budget, captions are left out and formats other than SVG only get every
+// other generation.
+func (r *GameRender) publish(gen uint64, prev, b Board, rule Rule) {
+	r.push(gen, b)
+	r.ages = r.ages.next(b)
+
+	throttled := budget.Throttled()
+	frame := Frame{Board: b, Prev: prev, Rule: rule, Topology: r.opts.Topology, Grid: r.opts.Grid, Notes: r.notes.List(), Ships: r.census.Ships(), Milestones: r.timeline.List(), Generation: gen, Ages: r.ages}
+	if r.plane != nil && r.plane.Cells != nil {
+		frame.Cells, frame.States = r.plane.Cells, r.plane.States
+	}
+	if r.cfg.MutateEvery > 0 && !throttled {
+		frame.Caption = rule.String()
+	}
+	if r.caption != "" {
+		frame.Caption = r.caption
+	}
+	if r.wantsInset() {
+		frame.Inset = r.speculate(gen, b, rule)
+	} else {
+		r.ahead = nil
+	}
+	c := r.Complexity()
+	job := frameJob{Generation: gen, Frame: frame, Population: b.Population(), Time: time.Now(), Complexity: &c}
+	for _, q := range r.activeQueues() {
+		if throttled && q.key.Format != "svg" && gen%2 == 1 {
+			continue
+		}
+		q.Push(job)
+	}
+}
+
+var errControlBusy = &requestError{status: http.StatusServiceUnavailable, msg: "room is busy, try again"}
+
+// Replace replaces the board with p placed at (x, y) as the next generation,
+// which it returns, switching to rule too if it is set. Streams carry on with
+// the new board.
+func (r *GameRender) Replace(p Pattern, rule *Rule, x, y int) (uint64, error) {
+	return r.change(Event{Kind: EventBoard, X: x, Y: y, Pattern: &p, Rule: rule})
+}
+
+// Combine applies op between the board and p placed at (x, y) as the next
+// generation, which it returns.
+func (r *GameRender) Combine(op BoardOp, p Pattern, x, y int) (uint64, error) {
+	return r.change(Event{Kind: EventCombine, X: x, Y: y, Pattern: &p, Op: op})
+}
+
+// change steps the board and applies e to it as the next generation, which
+// it publishes, the way Replay will.
+func (r *GameRender) change(e Event) (uint64, error) {
+	done := make(chan uint64, 1)
+	f := func() {
+		latest := r.history.Latest()
+		gen := latest.Number + 1
+		e.Generation, e.Time = gen, time.Now()
+		b, rule := r.record(e, advance(r.opts, r.plane, r.Rule(), latest.Board))
+		r.publish(gen, latest.Board, b, rule)
+		done <- gen
+	}
+
+	r.mu.Lock()
+	select {
+	case r.control <- f:
+	default:
+		r.mu.Unlock()
+		return 0, errControlBusy
+	}
+	r.seen = time.Now()
+	r.task.Resume()
+	r.mu.Unlock()
+	return <-done, nil
+}
+
+func (r *GameRender) Rule() Rule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rule
+}
+
+// Complexity is the complexity of the latest board.
+func (r *GameRender) Complexity() Complexity {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.complexity
+}
+
+// record logs e and applies it to b and the room's rule, rolling back any
+// speculation.
+func (r *GameRender) record(e Event, b Board) (Board, Rule) {
+	r.events.Append(e)
+	r.timeline.Record(e)
+	r.ahead = nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, r.rule = apply(r.plane, e, b, r.rule)
+	return b, r.rule
+}
+
+func (r *GameRender) mutateRule(gen uint64, b Board) {
+	from := r.Rule()
+	to := from.Mutate(r.rng)
+	r.record(Event{Generation: gen, Time: time.Now(), Kind: EventRule, Rule: &to}, b)
+	log.Printf("room %s: rule mutated from %s to %s at gen %d", r.name, from, to, gen)
+}
+
+func (r *GameRender) push(gen uint64, b Board) {
+	r.history.Push(gen, b)
+	if gen%checkpointEvery == 0 || gen == r.opts.ResumeAt {
+		c := Checkpoint{Number: gen, Board: b}
+		if r.plane != nil {
+			c.Plane = r.plane.Clone()
+		}
+		r.history.Keep(c)
+	}
+	r.cycles.Observe(gen, b)
+	r.stats.Observe(gen, b)
+	r.census.Observe(gen, b, r.opts.Topology)
+	r.timeline.Observe(gen, b.Population(), r.cycles.Phase(), r.census.Ships())
+	c := b.Complexity()
+	r.mu.Lock()
+	r.complexity = c
+	r.mu.Unlock()
+	metrics.SetComplexity(r.name, c)
+}
+
+// Touch keeps the room evolving for a while for clients that poll instead of
+// subscribing to a stream.
+func (r *GameRender) Touch() {
+	r.mu.Lock()
+	r.pollUntil = time.Now().Add(pollKeepAlive)
+	r.seen = time.Now()
+	r.task.Resume()
+	r.mu.Unlock()
+}
+
+func (r *GameRender) active() bool {
+	r.mu.Lock()
+	polled := time.Now().Before(r.pollUntil)
+	r.mu.Unlock()
+	return polled || len(r.activeQueues()) > 0
+}
+
+// pauseIfIdle pauses the room when it has no polling clients, encode queues
+// or control requests. Touch, Register and Replace resume it under the same
+// lock.
+func (r *GameRender) pauseIfIdle() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.queues) == 0 && len(r.control) == 0 && !time.Now().Before(r.pollUntil) {
+		r.task.Pause()
+	}
+}
+
+func (r *GameRender) activeQueues() []*encodeQueue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var queues []*encodeQueue
+	for _, q := range r.queues {
+		if q.Len() > 0 {
+			queues = append(queues, q)
 		}
-	}()
+	}
+	return queues
+}
+
+// Close stops the room and its encoders.
+func (r *GameRender) Close() {
+	r.task.Stop()
+	metrics.DropComplexity(r.name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, q := range r.queues {
+		q.Close()
+		delete(r.queues, key)
+	}
 }
 
-func (r *GameRender) Register(c chan<- ImageBundle) func() {
-	r.gameChs[c] = struct{}{}
+// reapQueues stops encode queues nobody has subscribed to for queueKeepAlive.
+func (r *GameRender) reapQueues() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, q := range r.queues {
+		if q.Idle(queueKeepAlive) {
+			q.Close()
+			delete(r.queues, key)
+			r.seen = time.Now()
+		}
+	}
+}
+
+// Idle reports whether the room has had no viewers, polling clients or
+// changes for d.
+func (r *GameRender) Idle(d time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.queues) == 0 && len(r.control) == 0 && time.Since(r.seen) > d && !time.Now().Before(r.pollUntil)
+}
+
+// streamKey identifies one way of encoding a room's frames.
+type streamKey struct {
+	Format string
+	Style  Style
+	// Deltas also encodes each frame as the change from the one before.
+	Deltas bool
+}
+
+// Stream returns a Render streaming this room in the given format and style.
+func (r *GameRender) Stream(format string, st Style) Render {
+	return gameStreamRender{game: r, key: streamKey{Format: format, Style: st}}
+}
+
+// DeltaStream is Stream with deltas alongside each frame.
+func (r *GameRender) DeltaStream(format string, st Style) Render {
+	return gameStreamRender{game: r, key: streamKey{Format: format, Style: st, Deltas: true}}
+}
+
+// DefaultStyle is the style streams use unless a request asks otherwise.
+func (r *GameRender) DefaultStyle() Style {
+	return Style{Scale: r.opts.Scale, Theme: r.cfg.Theme}
+}
+
+func (r *GameRender) Register(c chan<- ImageBundle, s *Session) func() {
+	return r.Stream("svg", r.DefaultStyle()).Register(c, s)
+}
+
+type gameStreamRender struct {
+	game *GameRender
+	key  streamKey
+}
+
+func (r gameStreamRender) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat(r.key.Format)
+	r.game.mu.Lock()
+	q, ok := r.game.queues[r.key]
+	if !ok {
+		q = newEncodeQueue(r.key, r.game.cfg.Drop, r.game.cfg.Pool)
+		r.game.queues[r.key] = q
+	}
+	unsubscribe := q.Subscribe(c, s)
+	r.game.seen = time.Now()
+	r.game.task.Resume()
+	r.game.mu.Unlock()
+
+	leave := viewerCounts.Join(s, r.game.name)
 	return func() {
-		delete(r.gameChs, c)
+		unsubscribe()
+		leave()
 	}
 }
 
+type subscriber struct {
+	session *Session
+	filter  ViewerFilter
+}
+
+// ViewersRender streams viewer counts, each subscriber seeing the count its
+// filter selects.
 type ViewersRender struct {
-	viewerJoin  chan chan<- ImageBundle
-	viewerLeave chan chan<- ImageBundle
+	task *Task
+
+	mu          sync.Mutex
+	subscribers map[chan<- ImageBundle]subscriber
 }
 
-func NewViewerRender() Render {
+func NewViewerRender() *ViewersRender {
 	r := &ViewersRender{
-		viewerJoin:  make(chan chan<- ImageBundle),
-		viewerLeave: make(chan chan<- ImageBundle),
+		subscribers: make(map[chan<- ImageBundle]subscriber),
 	}
 	r.Start()
 	return r
 }
 
 func (r *ViewersRender) Start() {
-	go func() {
-		viewers := make(map[chan<- ImageBundle]struct{})
-
-		for {
-			select {
-			case c := <-r.viewerJoin:
-				viewers[c] = struct{}{}
-			case c := <-r.viewerLeave:
-				delete(viewers, c)
-			case <-time.Tick(time.Second):
-			}
-
-			bundle := ImageBundle{
-				Data:        numberSvg(len(viewers)),
-				ContentType: "image/svg+xml",
-			}
-			for ch := range viewers {
-				select {
-				case ch <- bundle:
-				default:
+	r.task = scheduler.Every(time.Second, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		bundles := make(map[ViewerFilter]ImageBundle)
+		for ch, sub := range r.subscribers {
+			bundle, ok := bundles[sub.filter]
+			if !ok {
+				bundle = ImageBundle{
+					Data:        numberSvg(viewerCounts.Count(sub.filter)),
+					ContentType: "image/svg+xml",
 				}
+				bundles[sub.filter] = bundle
 			}
+			offer(ch, sub.session, bundle)
 		}
-	}()
+	})
+}
+
+func (r *ViewersRender) Close() {
+	r.task.Stop()
 }
 
-func (r *ViewersRender) Register(c chan<- ImageBundle) func() {
-	r.viewerJoin <- c
+// For returns a Render streaming the count of viewers matching f.
+func (r *ViewersRender) For(f ViewerFilter) Render {
+	return filteredViewersRender{viewers: r, filter: f}
+}
+
+func (r *ViewersRender) Register(c chan<- ImageBundle, s *Session) func() {
+	return r.For(ViewerFilter{}).Register(c, s)
+}
+
+type filteredViewersRender struct {
+	viewers *ViewersRender
+	filter  ViewerFilter
+}
+
+func (r filteredViewersRender) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat("svg")
+	r.viewers.mu.Lock()
+	r.viewers.subscribers[c] = subscriber{session: s, filter: r.filter}
+	r.viewers.mu.Unlock()
 	return func() {
-		r.viewerLeave <- c
+		r.viewers.mu.Lock()
+		delete(r.viewers.subscribers, c)
+		r.viewers.mu.Unlock()
+	}
+}
+
+func viewersHandleFunc(render *ViewersRender) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f := ViewerFilter{
+			Path: r.URL.Query().Get("endpoint"),
+			Room: r.URL.Query().Get("room"),
+			Stat: r.URL.Query().Get("count"),
+		}
+		streamHandleFunc(render.For(f))(w, r)
 	}
 }
 
 //go:embed index.html
 var static embed.FS
 
+// streamFormat is the format the stream at the request's path sends: JPEG
+// for .mjpeg, and SVG for every other stream.
+func streamFormat(r *http.Request) string {
+	if strings.HasSuffix(r.URL.Path, ".mjpeg") {
+		return "jpeg"
+	}
+	return "svg"
+}
+
 func streamHandleFunc(render Render) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		clamp, err := motionParam(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		every, err := keyframeParam(r, streamFormat(r))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		keys := &keyframes{every: every}
 		ch := make(chan ImageBundle)
 
-		unregister := render.Register(ch)
+		session, closeSession := sessions.Open(r)
+		defer closeSession()
+		unregister := render.Register(ch, session)
 		defer unregister()
 
-		const boundary = "BOUNDARY"
-		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
-		defer func() {
-			w.Header().Set("Connection", "close")
-		}()
+		stream := NewStreamWriter(w)
+		defer stream.Close()
 
 		for {
 			select {
 			case <-r.Context().Done():
 				return
 			case data := <-ch:
-				var err error
-				_, err = w.Write([]byte("\r\n--" + boundary + "\r\n"))
-				_, err = w.Write([]byte("Content-Type: " + data.ContentType + "\r\n"))
-				_, err = w.Write([]byte("Content-Length: " + strconv.Itoa(len(data.Data)) + "\r\n\r\n"))
-				_, err = w.Write(data.Data)
-				if err != nil {
-					fmt.Println(err)
+				if !clamp.Allow() {
+					continue
 				}
-				if f, ok := w.(http.Flusher); ok {
-					f.Flush()
+				if err := stream.WriteFrame(data, keys); err != nil {
+					fmt.Println(err)
+					return
 				}
 			}
 		}
 	}
 }
-
-func main() {
-	gameRender := NewGameRender()
-	viewerRender := NewViewerRender()
-
-	mux := http.NewServeMux()
-	mux.Handle("/", http.FileServer(http.FS(static)))
-	mux.HandleFunc("/game.svg", streamHandleFunc(gameRender))
-	mux.HandleFunc("/viewers.svg", streamHandleFunc(viewerRender))
-	log.Fatal(http.ListenAndServe(":3000", mux))
-}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestEnginesAgree(t *testing.T) {
+	const gens = 30
+	for _, s := range engineRules {
+		rule, err := ParseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables := rule.tables()
+		for _, size := range []struct{ w, h, margin int }{{40, 30, 0}, {96, 96, gens}, {256, 220, 0}} {
+			for seed := int64(1); seed <= 2; seed++ {
+				b := NewSeededBoard(size.w, size.h, seed)
+				if size.margin > 0 {
+					b = centredSoup(size.w, size.margin, seed)
+				}
+				table, counts, evolute, into, spare := b, b, b, b, Board(nil)
+				h := NewHashLife(rule, 0)
+				h.StampBoard(b, 0, 0)
+				for gen := 1; gen <= gens; gen++ {
+					b = naiveEvolute(rule, b)
+					table = evoluteTable(table, tables)
+					counts = evoluteCounts(counts, tables)
+					evolute = rule.Evolute(evolute)
+					// Swap the two buffers each step, as rooms do.
+					spare, into = into, rule.EvoluteInto(spare, into)
+					for name, got := range map[string]Board{"table": table, "counts": counts, "Evolute": evolute, "EvoluteInto": into} {
+						if got.Hash() != b.Hash() {
+							t.Fatalf("%s, %dx%d seed %d: %s differs at generation %d", rule, size.w, size.h, seed, name, gen)
+						}
+					}
+					if size.margin > 0 {
+						h.Step()
+						if h.Board(0, 0, size.w, size.h, 0).Hash() != b.Hash() {
+							t.Fatalf("%s, %dx%d seed %d: HashLife differs at generation %d", rule, size.w, size.h, seed, gen)
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var metrics = NewMetrics()
+
+var encodeSecondsBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) Observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+type summary struct {
+	sum   float64
+	count uint64
+}
+
+func (s *summary) Observe(v float64) {
+	s.sum += v
+	s.count++
+}
+
+type encodeKey struct {
+	format string
+	size   string
+}
+
+// sizeClass buckets a board into one of a few sizes for the size label,
+// since visitors choose board dimensions freely: small up to 64x64 cells,
+// medium up to 256x256 and large beyond.
+func sizeClass(b Board) string {
+	cells := 0
+	if len(b) > 0 {
+		cells = len(b) * len(b[0])
+	}
+	switch {
+	case cells <= 64*64:
+		return "small"
+	case cells <= 256*256:
+		return "medium"
+	}
+	return "large"
+}
+
+func (k encodeKey) labels() string {
+	return fmt.Sprintf(`format=%q,size=%q`, k.format, k.size)
+}
+
+// Metrics collects process metrics and exposes them in the Prometheus text
+// format.
+type Metrics struct {
+	mu            sync.Mutex
+	encodeSeconds map[encodeKey]*histogram
+	encodeBytes   map[encodeKey]*summary
+	encodeDrops   map[string]uint64
+	cpuUsage      float64
+	tickStretch   float64
+	complexity    map[string]Complexity
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		encodeSeconds: make(map[encodeKey]*histogram),
+		encodeBytes:   make(map[encodeKey]*summary),
+		encodeDrops:   make(map[string]uint64),
+		complexity:    make(map[string]Complexity),
+		tickStretch:   1,
+	}
+}
+
+func (m *Metrics) ObserveEncode(format, size string, d time.Duration, n int) {
+	k := encodeKey{format: format, size: size}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.encodeSeconds[k]
+	if !ok {
+		h = newHistogram(encodeSecondsBuckets)
+		m.encodeSeconds[k] = h
+		m.encodeBytes[k] = &summary{}
+	}
+	h.Observe(d.Seconds())
+	m.encodeBytes[k].Observe(float64(n))
+}
+
+func (m *Metrics) ObserveEncodeDrop(format string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encodeDrops[format]++
+}
+
+func (m *Metrics) SetCPUBudget(usage, stretch float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cpuUsage, m.tickStretch = usage, stretch
+}
+
+// SetComplexity records the complexity of a room's latest board.
+func (m *Metrics) SetComplexity(room string, c Complexity) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.complexity[room] = c
+}
+
+// DropComplexity forgets a closed room's complexity.
+func (m *Metrics) DropComplexity(room string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.complexity, room)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedEncodeKeys(m map[encodeKey]*histogram) []encodeKey {
+	keys := make([]encodeKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].format != keys[j].format {
+			return keys[i].format < keys[j].format
+		}
+		return keys[i].size < keys[j].size
+	})
+	return keys
+}
+
+func (m *Metrics) Write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := sortedEncodeKeys(m.encodeSeconds)
+
+	fmt.Fprintln(w, "# HELP gol_encode_duration_seconds Time spent encoding a frame.")
+	fmt.Fprintln(w, "# TYPE gol_encode_duration_seconds histogram")
+	for _, k := range keys {
+		h := m.encodeSeconds[k]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "gol_encode_duration_seconds_bucket{%s,le=\"%g\"} %d\n", k.labels(), b, h.counts[i])
+		}
+		fmt.Fprintf(w, "gol_encode_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", k.labels(), h.count)
+		fmt.Fprintf(w, "gol_encode_duration_seconds_sum{%s} %g\n", k.labels(), h.sum)
+		fmt.Fprintf(w, "gol_encode_duration_seconds_count{%s} %d\n", k.labels(), h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP gol_encode_size_bytes Size of encoded frames.")
+	fmt.Fprintln(w, "# TYPE gol_encode_size_bytes summary")
+	for _, k := range keys {
+		s := m.encodeBytes[k]
+		fmt.Fprintf(w, "gol_encode_size_bytes_sum{%s} %g\n", k.labels(), s.sum)
+		fmt.Fprintf(w, "gol_encode_size_bytes_count{%s} %d\n", k.labels(), s.count)
+	}
+
+	fmt.Fprintln(w, "# HELP gol_encode_dropped_total Frames dropped because the encoder fell behind.")
+	fmt.Fprintln(w, "# TYPE gol_encode_dropped_total counter")
+	for _, format := range sortedKeys(m.encodeDrops) {
+		fmt.Fprintf(w, "gol_encode_dropped_total{format=%q} %d\n", format, m.encodeDrops[format])
+	}
+
+	fmt.Fprintln(w, "# HELP gol_cpu_usage CPUs used by ticks and encoders over the last budget window.")
+	fmt.Fprintln(w, "# TYPE gol_cpu_usage gauge")
+	fmt.Fprintf(w, "gol_cpu_usage %g\n", m.cpuUsage)
+	fmt.Fprintln(w, "# HELP gol_tick_stretch Factor the CPU budget currently slows ticks down by.")
+	fmt.Fprintln(w, "# TYPE gol_tick_stretch gauge")
+	fmt.Fprintf(w, "gol_tick_stretch %g\n", m.tickStretch)
+
+	labels, series := m.complexitySeries()
+	fmt.Fprintln(w, "# HELP gol_board_compression_ratio Deflated size of a room's packed board over its packed size.")
+	fmt.Fprintln(w, "# TYPE gol_board_compression_ratio gauge")
+	for _, label := range labels {
+		fmt.Fprintf(w, "gol_board_compression_ratio{room=%q} %g\n", label, series[label].CompressionRatio)
+	}
+	fmt.Fprintln(w, "# HELP gol_board_block_entropy_bits Shannon entropy of a room's 2x2 blocks.")
+	fmt.Fprintln(w, "# TYPE gol_board_block_entropy_bits gauge")
+	for _, label := range labels {
+		fmt.Fprintf(w, "gol_board_block_entropy_bits{room=%q} %g\n", label, series[label].BlockEntropy)
+	}
+}
+
+// complexitySeries folds the rooms' complexity into a fixed set of labels, so
+// visitors naming rooms cannot grow the series without bound: the default
+// room under its own name, and the mean of every other room under "other".
+func (m *Metrics) complexitySeries() ([]string, map[string]Complexity) {
+	series := make(map[string]Complexity, 2)
+	var labels []string
+	if c, ok := m.complexity[defaultRoom]; ok {
+		labels = append(labels, defaultRoom)
+		series[defaultRoom] = c
+	}
+	var sum Complexity
+	n := 0
+	for room, c := range m.complexity {
+		if room != defaultRoom {
+			sum.CompressionRatio += c.CompressionRatio
+			sum.BlockEntropy += c.BlockEntropy
+			n++
+		}
+	}
+	if n > 0 {
+		labels = append(labels, "other")
+		series["other"] = Complexity{CompressionRatio: sum.CompressionRatio / float64(n), BlockEntropy: sum.BlockEntropy / float64(n)}
+	}
+	return labels, series
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.Write(w)
+}
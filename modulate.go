@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"net/http"
+	"time"
+)
+
+// A Modulator turns a signal into a level between 0 and 1 that sets how
+// vividly a frame's cells are drawn: at 1 in the palette's own colours,
+// fading towards the background as the level falls. The frame carries the
+// simulation's state; modulators are free to read other signals.
+type Modulator interface {
+	Level(f Frame) float64
+}
+
+// ModulatorFunc adapts a function to a Modulator.
+type ModulatorFunc func(f Frame) float64
+
+func (m ModulatorFunc) Level(f Frame) float64 {
+	return m(f)
+}
+
+// modulators are the modulators styles can name with ?modulate=.
+var modulators = map[string]Modulator{
+	"births":      ModulatorFunc(birthsLevel),
+	"population":  ModulatorFunc(populationLevel),
+	"viewers":     ModulatorFunc(viewersLevel),
+	"time-of-day": ModulatorFunc(timeOfDayLevel),
+}
+
+// minModulation is how much of a cell's colour is left at level 0.
+const minModulation = 0.25
+
+func saturate(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// birthsLevel rises with the share of live cells born this generation, a
+// quarter of them being enough for full colour.
+func birthsLevel(f Frame) float64 {
+	if f.Prev == nil {
+		return 1
+	}
+	alive, born := 0, 0
+	for i, col := range f.Board {
+		for j, a := range col {
+			if a {
+				alive++
+				if !f.Prev.Get(i, j) {
+					born++
+				}
+			}
+		}
+	}
+	if alive == 0 {
+		return 0
+	}
+	return saturate(4 * float64(born) / float64(alive))
+}
+
+// populationLevel rises with how much the population changed since the last
+// generation, a tenth being enough for full colour.
+func populationLevel(f Frame) float64 {
+	if f.Prev == nil {
+		return 1
+	}
+	prev := f.Prev.Population()
+	if prev == 0 {
+		return saturate(float64(f.Board.Population()))
+	}
+	delta := math.Abs(float64(f.Board.Population() - prev))
+	return saturate(10 * delta / float64(prev))
+}
+
+// viewersLevel rises with the number of viewers across the server, full at
+// 50.
+func viewersLevel(Frame) float64 {
+	return saturate(float64(viewerCounts.Count(ViewerFilter{})) / 50)
+}
+
+// timeOfDayLevel follows the sun in the server's time zone, full at 2pm and
+// lowest at 2am.
+func timeOfDayLevel(Frame) float64 {
+	now := time.Now()
+	h := float64(now.Hour()) + float64(now.Minute())/60
+	return (1 + math.Cos(2*math.Pi*(h-14)/24)) / 2
+}
+
+// palette is the style's palette, modulated for this frame if the style asks
+// for it.
+func (f Frame) palette(st Style) *Palette {
+	pal := st.palette()
+	m, ok := modulators[st.Modulate]
+	if !ok {
+		return pal
+	}
+	return pal.modulated(minModulation + (1-minModulation)*saturate(m.Level(f)))
+}
+
+// modulated returns a copy of p with its cell colours blended towards the
+// background, white if it is transparent, leaving k of each.
+func (p *Palette) modulated(k float64) *Palette {
+	bg := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	if p.Background.A > 0 {
+		bg = p.Background
+	}
+	mix := func(c color.RGBA) color.RGBA {
+		return mixColor(c, color.RGBA{R: bg.R, G: bg.G, B: bg.B, A: c.A}, k)
+	}
+	m := *p
+	m.Alive, m.Alt, m.Born, m.Dying = mix(p.Alive), mix(p.Alt), mix(p.Born), mix(p.Dying)
+	return &m
+}
+
+func modulateParam(r *http.Request, def string) (string, error) {
+	name := r.URL.Query().Get("modulate")
+	if name == "" {
+		return def, nil
+	}
+	if _, ok := modulators[name]; !ok {
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown modulator %q", name)}
+	}
+	return name, nil
+}
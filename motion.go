@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// reducedMotionInterval is the slowest a reduced motion stream updates.
+const reducedMotionInterval = 10 * time.Second
+
+// frameClamp lets a subscriber through at most one frame per interval. The
+// zero value lets every frame through.
+type frameClamp struct {
+	interval time.Duration
+	last     time.Time
+}
+
+func (c *frameClamp) Allow() bool {
+	now := time.Now()
+	if c.interval > 0 && !c.last.IsZero() && now.Sub(c.last) < c.interval {
+		return false
+	}
+	c.last = now
+	return true
+}
+
+// motionParam reads ?motion=, which is either empty or "reduced".
+func motionParam(r *http.Request) (*frameClamp, error) {
+	switch v := r.URL.Query().Get("motion"); v {
+	case "":
+		return &frameClamp{}, nil
+	case "reduced":
+		return &frameClamp{interval: reducedMotionInterval}, nil
+	default:
+		return nil, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown motion %q", v)}
+	}
+}
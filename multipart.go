@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// StreamWriter writes a multipart/x-mixed-replace response, one part per
+// frame, flushing each part as soon as it is written. Every stream gets its
+// own random boundary.
+type StreamWriter struct {
+	w  http.ResponseWriter
+	mw *multipart.Writer
+}
+
+// NewStreamWriter sends the response headers immediately, before any frame is
+// ready, so clients know what kind of stream to expect.
+func NewStreamWriter(w http.ResponseWriter) *StreamWriter {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	s := &StreamWriter{w: w, mw: mw}
+	s.flush()
+	return s
+}
+
+func (s *StreamWriter) flush() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *StreamWriter) WritePart(contentType string, data []byte) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", contentType)
+	return s.writePart(header, data)
+}
+
+// WriteFrame writes b as a part, or its delta if keys allows. Every part
+// carries the frame's generation, and its population and when it was made
+// if it shows a board. Parts of a stream with deltas say which kind they are;
+// delta parts also carry where to draw them and the generation they apply to.
+func (s *StreamWriter) WriteFrame(b ImageBundle, keys *keyframes) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("X-Generation", strconv.FormatUint(b.Generation, 10))
+	if !b.Time.IsZero() {
+		header.Set("X-Population", strconv.Itoa(b.Population))
+		header.Set("X-Frame-Timestamp", b.Time.UTC().Format(time.RFC3339Nano))
+	}
+	if keys.every == 0 {
+		header.Set("Content-Type", b.ContentType)
+		return s.writePart(header, b.Data)
+	}
+	d := keys.Delta(b)
+	if d == nil {
+		header.Set("Content-Type", b.ContentType)
+		header.Set("X-Frame-Type", "key")
+		return s.writePart(header, b.Data)
+	}
+	header.Set("Content-Type", "image/png")
+	header.Set("X-Frame-Type", "delta")
+	header.Set("X-Frame-Offset", fmt.Sprintf("%d,%d", d.X, d.Y))
+	header.Set("X-Frame-Base", strconv.FormatUint(d.Base, 10))
+	return s.writePart(header, d.Data)
+}
+
+func (s *StreamWriter) writePart(header textproto.MIMEHeader, data []byte) error {
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+
+	part, err := s.mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+// Close writes the closing boundary that terminates the stream.
+func (s *StreamWriter) Close() error {
+	if err := s.mw.Close(); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
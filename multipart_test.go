@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	s := NewStreamWriter(w)
+	delta := &FrameDelta{Data: []byte("delta"), X: 3, Y: 4, Base: 1}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	frames := []ImageBundle{
+		{Data: []byte("one"), ContentType: "image/png", Generation: 1, Population: 10, Time: now},
+		{Data: []byte("two"), ContentType: "image/png", Generation: 2, Population: 11, Time: now, Delta: delta},
+		{Data: []byte("three"), ContentType: "image/png", Generation: 3, Population: 12, Time: now, Delta: &FrameDelta{Data: []byte("stale"), Base: 1}},
+	}
+	keys := &keyframes{every: 10}
+	for _, f := range frames {
+		if err := s.WriteFrame(f, keys); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.WritePart("text/plain", []byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" || params["boundary"] == "" {
+		t.Fatalf("Content-Type %q: %v", w.Header().Get("Content-Type"), err)
+	}
+	want := []struct {
+		data, contentType, frameType, generation, offset string
+	}{
+		{"one", "image/png", "key", "1", ""},
+		{"delta", "image/png", "delta", "2", "3,4"},
+		{"three", "image/png", "key", "3", ""},
+		{"bye", "text/plain", "", "", ""},
+	}
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for i, tt := range want {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := part.Header
+		if string(data) != tt.data || h.Get("Content-Type") != tt.contentType || h.Get("X-Frame-Type") != tt.frameType || h.Get("X-Generation") != tt.generation || h.Get("X-Frame-Offset") != tt.offset {
+			t.Errorf("part %d = %q with %v", i, data, h)
+		}
+		if h.Get("Content-Length") == "" {
+			t.Errorf("part %d has no Content-Length", i)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("after the last part: %v, want the closing boundary", err)
+	}
+
+	other := httptest.NewRecorder()
+	NewStreamWriter(other)
+	if other.Header().Get("Content-Type") == w.Header().Get("Content-Type") {
+		t.Error("two streams share a boundary")
+	}
+}
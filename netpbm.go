@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+)
+
+// Pbm writes the board as a binary (P4) bitmap, one bit per pixel with live
+// cells black. Colours and captions are left out.
+func (f Frame) Pbm(st Style) ([]byte, error) {
+	w, h, rows := f.bitmap(st)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "P4\n%d %d\n", w, h)
+	buf.Write(rows)
+	return buf.Bytes(), nil
+}
+
+// PbmASCII writes the board as a plain (P1) bitmap.
+func (f Frame) PbmASCII(st Style) ([]byte, error) {
+	k := st.Scale
+	w, h := k*len(f.Board), k*len(f.Board[0])
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "P1\n%d %d\n", w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Keep lines within the 70 characters netpbm asks for.
+			if x > 0 && x%35 == 0 {
+				buf.WriteByte('\n')
+			} else if x > 0 {
+				buf.WriteByte(' ')
+			}
+			if f.Board[x/k][y/k] {
+				buf.WriteByte('1')
+			} else {
+				buf.WriteByte('0')
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// Pgm writes the rendered frame as a binary (P5) greymap.
+func (f Frame) Pgm(st Style) ([]byte, error) {
+	img := f.opaque(st)
+	b := img.Bounds()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "P5\n%d %d\n255\n", b.Dx(), b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			buf.WriteByte(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Ppm writes the rendered frame as a binary (P6) pixmap.
+func (f Frame) Ppm(st Style) ([]byte, error) {
+	img := f.opaque(st)
+	b := img.Bounds()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "P6\n%d %d\n255\n", b.Dx(), b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			off := img.PixOffset(x, y)
+			buf.Write(img.Pix[off : off+3])
+		}
+	}
+	return buf.Bytes(), nil
+}
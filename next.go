@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const maxNextTimeout = time.Minute
+
+// nextHandle blocks until the room broadcasts its next frame and returns that
+// frame alone, or 204 No Content once the timeout passes.
+func nextHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	format, err := formatParam(r, "svg")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	st, err := styleParam(r, room.DefaultStyle())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	timeout := 30 * time.Second
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid timeout %q", v)})
+			return
+		}
+		if d < maxNextTimeout {
+			timeout = d
+		} else {
+			timeout = maxNextTimeout
+		}
+	}
+
+	ch := make(chan ImageBundle, 1)
+	unregister := room.Stream(format, st).Register(ch, nil)
+	defer unregister()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-r.Context().Done():
+	case <-timer.C:
+		w.WriteHeader(http.StatusNoContent)
+	case frame := <-ch:
+		w.Header().Set("Content-Type", frame.ContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		if _, err := w.Write(frame.Data); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNextHandle(t *testing.T) {
+	rs := NewRooms(Limits{MaxWidth: 100, MaxHeight: 100, MaxScale: 10, MemoryBudget: 1 << 30}, GameConfig{History: 8, Pool: NewWorkerPool(1)})
+	defer rs.Close()
+	room, _ := rs.Get(defaultRoom, RoomOptions{})
+
+	// A room that has stopped never sends another frame.
+	stopped, _ := rs.Get("stopped", RoomOptions{Width: 10, Height: 10, Scale: 1})
+	stopped.Close()
+	w := httptest.NewRecorder()
+	nextHandle(stopped, w, httptest.NewRequest(http.MethodGet, "/next?timeout=10ms", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("stopped room: %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	tests := []struct {
+		query       string
+		status      int
+		contentType string
+	}{
+		{"timeout=0s", http.StatusBadRequest, ""},
+		{"timeout=soon", http.StatusBadRequest, ""},
+		{"format=gif", http.StatusBadRequest, ""},
+		{"timeout=5s", http.StatusOK, "image/svg+xml"},
+		{"timeout=5s&format=png", http.StatusOK, "image/png"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		nextHandle(room, w, httptest.NewRequest(http.MethodGet, "/next?"+tt.query, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: %d, want %d", tt.query, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: Content-Type %s, want %s", tt.query, got, tt.contentType)
+		}
+		if w.Header().Get("Cache-Control") != "no-store" || w.Body.Len() == 0 {
+			t.Errorf("%s: %d bytes with Cache-Control %q", tt.query, w.Body.Len(), w.Header().Get("Cache-Control"))
+		}
+	}
+}
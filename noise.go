@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// defaultNoiseLevel is the noise level above which a noise soup is laid
+	// down unless a room asks for another: about half the board.
+	defaultNoiseLevel = 0.5
+	// noiseOctaves is how many layers of ever finer noise are summed, which
+	// roughens the clusters' edges.
+	noiseOctaves = 3
+	// maxNoiseScale bounds the size of a noise soup's clusters.
+	maxNoiseScale = 1000
+)
+
+// Perlin is Ken Perlin's improved gradient noise in two dimensions: a smooth
+// random field that is the same for the same seed.
+type Perlin [512]uint8
+
+// NewPerlin returns the noise field for seed.
+func NewPerlin(seed int64) *Perlin {
+	var p Perlin
+	for i, v := range rand.New(rand.NewSource(seed)).Perm(256) {
+		p[i], p[i+256] = uint8(v), uint8(v)
+	}
+	return &p
+}
+
+// At returns the noise at x, y, between about -1 and 1. It is 0 wherever x
+// and y are both whole.
+func (p *Perlin) At(x, y float64) float64 {
+	xf, yf := math.Floor(x), math.Floor(y)
+	xi, yi := int(xf)&255, int(yf)&255
+	x, y = x-xf, y-yf
+	u, v := noiseFade(x), noiseFade(y)
+	a, b := int(p[xi]), int(p[xi+1])
+	return noiseLerp(v,
+		noiseLerp(u, noiseGrad(p[a+yi], x, y), noiseGrad(p[b+yi], x-1, y)),
+		noiseLerp(u, noiseGrad(p[a+yi+1], x, y-1), noiseGrad(p[b+yi+1], x-1, y-1)),
+	)
+}
+
+// Fractal sums noiseOctaves layers of noise, each twice as fine and half as
+// strong as the last, with clusters about scale apart, and returns it scaled
+// to between 0 and 1.
+func (p *Perlin) Fractal(x, y, scale float64) float64 {
+	var sum, total float64
+	amp, freq := 1.0, 1/scale
+	for i := 0; i < noiseOctaves; i++ {
+		sum += amp * p.At(x*freq, y*freq)
+		total += amp
+		amp, freq = amp/2, freq*2
+	}
+	return math.Max(0, math.Min(1, 0.5+0.5*sum/total))
+}
+
+func noiseFade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func noiseLerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// noiseGrad returns the dot product of x, y with one of eight gradients,
+// picked by h.
+func noiseGrad(h uint8, x, y float64) float64 {
+	switch h & 7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x
+	case 5:
+		return -x
+	case 6:
+		return y
+	default:
+		return -y
+	}
+}
+
+// NoiseMask clears the cells of b where noise for seed, with clusters about
+// scale cells apart, is at or below level, leaving soup only in the organic
+// clusters where it rises above.
+func NoiseMask(b Board, seed int64, scale, level float64) Board {
+	p := NewPerlin(seed)
+	for x := range b {
+		for y := range b[x] {
+			if b[x][y] && p.Fractal(float64(x), float64(y), scale) <= level {
+				b[x][y] = false
+			}
+		}
+	}
+	return b
+}
+
+// level is the room's noise Level: the one it was given, else
+// defaultNoiseLevel.
+func (o RoomOptions) level() float64 {
+	if o.Level == 0 {
+		return defaultNoiseLevel
+	}
+	return o.Level
+}
+
+// noiseParam reads ?noise=, the size in cells of a noise soup's clusters.
+func noiseParam(r *http.Request) (float64, error) {
+	s := r.URL.Query().Get("noise")
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 1 || n > maxNoiseScale {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid noise %q, want 1 to %d cells", s, maxNoiseScale)}
+	}
+	return n, nil
+}
+
+// levelParam reads ?level=, the noise level above which a noise soup is laid
+// down.
+func levelParam(r *http.Request) (float64, error) {
+	s := r.URL.Query().Get("level")
+	if s == "" {
+		return 0, nil
+	}
+	l, err := strconv.ParseFloat(s, 64)
+	if err != nil || l <= 0 || l >= 1 {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid level %q, want between 0 and 1", s)}
+	}
+	return l, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Palette colours a rendered board. A transparent background is drawn as
+// white wherever the format can't be transparent.
+type Palette struct {
+	Name       string
+	Background color.RGBA
+	Alive      color.RGBA
+	// Alt is a second live colour for modes with more than one cell state.
+	Alt   color.RGBA
+	Born  color.RGBA
+	Dying color.RGBA
+
+	// Contrast is the WCAG contrast ratio of each cell colour against the
+	// background.
+	Contrast map[string]float64
+	// Separation is the smallest CIE76 difference between any two cell
+	// colours as seen with each kind of colour vision.
+	Separation map[string]float64
+}
+
+// minSeparation is the smallest Separation for a palette to count as safe
+// for a kind of colour vision.
+const minSeparation = 20
+
+// visions are Machado et al. (2009) simulations of full dichromacy, applied
+// to linear RGB.
+var visions = map[string][3][3]float64{
+	"normal":       {{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+	"protanopia":   {{0.152286, 1.052583, -0.204868}, {0.114503, 0.786281, 0.099216}, {-0.003882, -0.048116, 1.051998}},
+	"deuteranopia": {{0.367322, 0.860646, -0.227968}, {0.280085, 0.672501, 0.047413}, {-0.011820, 0.042940, 0.968881}},
+	"tritanopia":   {{1.255528, -0.076749, -0.178779}, {-0.078411, 0.930809, 0.147602}, {0.004733, 0.691367, 0.303900}},
+}
+
+var palettes = map[string]*Palette{}
+
+func init() {
+	for _, p := range []Palette{
+		{
+			Name:  "default",
+			Alive: color.RGBA{A: 255},
+			Alt:   color.RGBA{B: 200, A: 255},
+			Born:  color.RGBA{G: 160, A: 255},
+			Dying: color.RGBA{R: 220, A: 255},
+		},
+		{
+			Name:       "dark",
+			Background: color.RGBA{R: 0x12, G: 0x12, B: 0x12, A: 255},
+			Alive:      color.RGBA{R: 0xf0, G: 0xf0, B: 0xf0, A: 255},
+			Alt:        color.RGBA{R: 0x64, G: 0x9c, B: 0xff, A: 255},
+			Born:       color.RGBA{R: 0x4c, G: 0xd0, B: 0x6c, A: 255},
+			Dying:      color.RGBA{R: 0xff, G: 0x5a, B: 0x5a, A: 255},
+		},
+		// The colour-blind safe palettes are drawn from Okabe and Ito's
+		// palette: every cell colour keeps at least 3:1 contrast against
+		// white, and they stay apart with normal vision and the named
+		// dichromacy.
+		{
+			Name:  "cb-safe-deuteranopia",
+			Alive: color.RGBA{A: 255},
+			Alt:   color.RGBA{R: 0x00, G: 0x9e, B: 0x73, A: 255},
+			Born:  color.RGBA{R: 0x00, G: 0x72, B: 0xb2, A: 255},
+			Dying: color.RGBA{R: 0xd5, G: 0x5e, B: 0x00, A: 255},
+		},
+		{
+			Name:  "cb-safe-protanopia",
+			Alive: color.RGBA{A: 255},
+			Alt:   color.RGBA{R: 0x00, G: 0x72, B: 0xb2, A: 255},
+			Born:  color.RGBA{R: 0x00, G: 0x9e, B: 0x73, A: 255},
+			Dying: color.RGBA{R: 0xd5, G: 0x5e, B: 0x00, A: 255},
+		},
+		{
+			Name:  "cb-safe-tritanopia",
+			Alive: color.RGBA{A: 255},
+			Alt:   color.RGBA{R: 0xcc, G: 0x79, B: 0xa7, A: 255},
+			Born:  color.RGBA{R: 0x00, G: 0x9e, B: 0x73, A: 255},
+			Dying: color.RGBA{R: 0xd5, G: 0x5e, B: 0x00, A: 255},
+		},
+	} {
+		p := p
+		p.measure()
+		palettes[p.Name] = &p
+	}
+}
+
+func (p *Palette) cells() map[string]color.RGBA {
+	return map[string]color.RGBA{"alive": p.Alive, "alt": p.Alt, "born": p.Born, "dying": p.Dying}
+}
+
+func (p *Palette) measure() {
+	bg := p.Background
+	if bg.A == 0 {
+		bg = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	}
+	p.Contrast = make(map[string]float64)
+	for name, c := range p.cells() {
+		p.Contrast[name] = round2(contrast(c, bg))
+	}
+
+	cells := []color.RGBA{p.Alive, p.Alt, p.Born, p.Dying}
+	p.Separation = make(map[string]float64)
+	for vision, m := range visions {
+		min := math.Inf(1)
+		for i := range cells {
+			for j := i + 1; j < len(cells); j++ {
+				if d := deltaE(simulate(m, cells[i]), simulate(m, cells[j])); d < min {
+					min = d
+				}
+			}
+		}
+		p.Separation[vision] = round2(min)
+	}
+}
+
+// SafeFor lists the kinds of colour vision the cell colours stay apart for.
+func (p *Palette) SafeFor() []string {
+	var safe []string
+	for vision, d := range p.Separation {
+		if d >= minSeparation {
+			safe = append(safe, vision)
+		}
+	}
+	sort.Strings(safe)
+	return safe
+}
+
+// mixColor blends a towards b, keeping k of a.
+func mixColor(a, b color.RGBA, k float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x)*k + float64(y)*(1-k)))
+	}
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: mix(a.A, b.A)}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func linear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func luminance(c color.RGBA) float64 {
+	return 0.2126*linear(c.R) + 0.7152*linear(c.G) + 0.0722*linear(c.B)
+}
+
+func contrast(a, b color.RGBA) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// simulate returns c as seen through m, in linear RGB.
+func simulate(m [3][3]float64, c color.RGBA) [3]float64 {
+	in := [3]float64{linear(c.R), linear(c.G), linear(c.B)}
+	var out [3]float64
+	for i := range out {
+		v := m[i][0]*in[0] + m[i][1]*in[1] + m[i][2]*in[2]
+		out[i] = math.Max(0, math.Min(1, v))
+	}
+	return out
+}
+
+// deltaE is the CIE76 difference between two linear RGB colours.
+func deltaE(a, b [3]float64) float64 {
+	la, lb := lab(a), lab(b)
+	return math.Sqrt((la[0]-lb[0])*(la[0]-lb[0]) + (la[1]-lb[1])*(la[1]-lb[1]) + (la[2]-lb[2])*(la[2]-lb[2]))
+}
+
+func lab(c [3]float64) [3]float64 {
+	x := (0.4124*c[0] + 0.3576*c[1] + 0.1805*c[2]) / 0.95047
+	y := 0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]
+	z := (0.0193*c[0] + 0.1192*c[1] + 0.9505*c[2]) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// themeParam reads ?theme=, naming one of the palettes or theme providers.
+func themeParam(r *http.Request, def string) (string, error) {
+	theme := r.URL.Query().Get("theme")
+	if theme == "" {
+		return def, nil
+	}
+	_, ok := palettes[theme]
+	if _, provided := themeProviders[theme]; !ok && !provided {
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown theme %q", theme)}
+	}
+	return theme, nil
+}
+
+// invertParam reads ?invert=, which swaps live and background colours.
+func invertParam(r *http.Request, def bool) (bool, error) {
+	s := r.URL.Query().Get("invert")
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invert must be true or false, not %q", s)}
+	}
+	return v, nil
+}
+
+// inverted returns a copy of p drawing live cells in its background colour,
+// white if it is transparent, on its live colour.
+func (p *Palette) inverted() *Palette {
+	q := *p
+	q.Name = p.Name + "-inverted"
+	q.Background, q.Alive = p.Alive, insetBackground(p)
+	q.Contrast, q.Separation = nil, nil
+	return &q
+}
+
+type paletteJSON struct {
+	Name       string             `json:"name"`
+	Background string             `json:"background,omitempty"`
+	Colors     map[string]string  `json:"colors"`
+	Contrast   map[string]float64 `json:"contrast"`
+	Separation map[string]float64 `json:"separation"`
+	SafeFor    []string           `json:"safeFor"`
+}
+
+func palettesHandle(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := make([]paletteJSON, 0, len(names))
+	for _, name := range names {
+		p := palettes[name]
+		pj := paletteJSON{
+			Name:       p.Name,
+			Colors:     make(map[string]string),
+			Contrast:   p.Contrast,
+			Separation: p.Separation,
+			SafeFor:    p.SafeFor(),
+		}
+		if p.Background.A > 0 {
+			pj.Background = svgColor(p.Background)
+		}
+		for cell, c := range p.cells() {
+			pj.Colors[cell] = svgColor(c)
+		}
+		resp = append(resp, pj)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Println(err)
+	}
+}
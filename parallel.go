@@ -0,0 +1,45 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+const (
+	// parallelCells is the board area from which Evolute splits the board
+	// into bands stepped concurrently; below it the goroutines cost more
+	// than they save.
+	parallelCells = 128 * 128
+	// minBandColumns keeps bands from getting so narrow that their edges,
+	// which both neighbouring bands read, dominate.
+	minBandColumns = 16
+)
+
+// evolvePool bounds how many bands step at once across all rooms, so large
+// boards share the CPUs rather than each claiming all of them.
+var evolvePool = NewWorkerPool(runtime.GOMAXPROCS(0))
+
+// inBands calls f for bands of columns covering 0 to w, a board of cells
+// cells, concurrently on evolvePool when the board is large enough, and
+// returns once they are all done. Bands never overlap, so the result is the
+// same however they are scheduled.
+func inBands(w, cells int, f func(lo, hi int)) {
+	n := runtime.GOMAXPROCS(0)
+	if max := w / minBandColumns; n > max {
+		n = max
+	}
+	if cells < parallelCells || n < 2 {
+		f(0, w)
+		return
+	}
+	var wg sync.WaitGroup
+	for b := 0; b < n; b++ {
+		lo, hi := b*w/n, (b+1)*w/n
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			evolvePool.Do(func() { f(lo, hi) })
+		}()
+	}
+	wg.Wait()
+}
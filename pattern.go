@@ -0,0 +1,68 @@
+package main
+
+// Pattern is a small arrangement of live cells in a W by H bounding box.
+type Pattern struct {
+	W     int      `json:"width"`
+	H     int      `json:"height"`
+	Cells [][2]int `json:"cells"`
+}
+
+func (p Pattern) transform(w, h int, f func(x, y int) (int, int)) Pattern {
+	q := Pattern{W: w, H: h, Cells: make([][2]int, len(p.Cells))}
+	for i, c := range p.Cells {
+		x, y := f(c[0], c[1])
+		q.Cells[i] = [2]int{x, y}
+	}
+	return q
+}
+
+func (p Pattern) FlipX() Pattern {
+	return p.transform(p.W, p.H, func(x, y int) (int, int) { return p.W - 1 - x, y })
+}
+
+func (p Pattern) FlipY() Pattern {
+	return p.transform(p.W, p.H, func(x, y int) (int, int) { return x, p.H - 1 - y })
+}
+
+func (p Pattern) Transpose() Pattern {
+	return p.transform(p.H, p.W, func(x, y int) (int, int) { return y, x })
+}
+
+// Pattern returns the board's live cells as a pattern the size of the board.
+func (b Board) Pattern() Pattern {
+	p := Pattern{W: len(b), H: len(b[0])}
+	for x, col := range b {
+		for y, alive := range col {
+			if alive {
+				p.Cells = append(p.Cells, [2]int{x, y})
+			}
+		}
+	}
+	return p
+}
+
+func (b Board) Clone() Board {
+	c := make(Board, len(b))
+	for i, col := range b {
+		c[i] = append([]bool(nil), col...)
+	}
+	return c
+}
+
+// Stamp sets the pattern's cells alive with its top-left corner at (x, y),
+// clipping anything outside the board.
+func (b Board) Stamp(p Pattern, x, y int) {
+	for _, c := range p.Cells {
+		i, j := x+c[0], y+c[1]
+		if i >= 0 && i < len(b) && j >= 0 && j < len(b[i]) {
+			b[i][j] = true
+		}
+	}
+}
+
+var (
+	// glider travels towards +x, +y.
+	glider = patterns["glider"]
+	// lwss is a lightweight spaceship travelling towards -x.
+	lwss = patterns["lwss"]
+)
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	// Registered for image.Decode, which encoder.go's imports do not cover.
+	_ "image/gif"
+)
+
+const (
+	// maxImageBytes bounds the size of an uploaded or fetched picture.
+	maxImageBytes = 8 << 20
+	// maxImagePixels bounds how large a picture may decode to, so a small
+	// file can't ask for an enormous canvas.
+	maxImagePixels = 40 << 20
+	// imageFetchTimeout bounds how long fetching a picture from ?url= takes.
+	imageFetchTimeout = 10 * time.Second
+)
+
+// imageClient fetches pictures for ?url=. It only connects to public
+// addresses, so a URL can't be used to reach the server's own network.
+var imageClient = &http.Client{
+	Timeout: imageFetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: imageFetchTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return fmt.Errorf("%s is not a public address", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// privateNets are the address ranges set aside for private networks.
+var privateNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, s := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, n, _ := net.ParseCIDR(s)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// publicIP reports whether ip is an address on the public internet.
+func publicIP(ip net.IP) bool {
+	if !ip.IsGlobalUnicast() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// PictureOptions is how a picture is turned into cells.
+type PictureOptions struct {
+	// Threshold is the brightness, from 0 to 1, below which a cell is dark.
+	Threshold float64
+	// Light makes the light cells alive instead of the dark ones.
+	Light bool
+	// Dither diffuses each cell's error onto its neighbours, Floyd-Steinberg
+	// style, so shades come out as a density of live cells.
+	Dither bool
+}
+
+// PicturePattern scales img to fit a w by h board, keeping its proportions,
+// and thresholds it into live cells. Transparent pixels count as white.
+func PicturePattern(img image.Image, w, h int, o PictureOptions) Pattern {
+	src := img.Bounds()
+	pw, ph := w, src.Dy()*w/src.Dx()
+	if ph > h {
+		pw, ph = src.Dx()*h/src.Dy(), h
+	}
+	if pw < 1 {
+		pw = 1
+	}
+	if ph < 1 {
+		ph = 1
+	}
+
+	// Each cell is the average brightness of the pixels it covers.
+	lum := make([]float64, pw*ph)
+	for i := 0; i < pw; i++ {
+		x0, x1 := src.Min.X+i*src.Dx()/pw, src.Min.X+(i+1)*src.Dx()/pw
+		if x1 <= x0 {
+			x1 = x0 + 1
+		}
+		for j := 0; j < ph; j++ {
+			y0, y1 := src.Min.Y+j*src.Dy()/ph, src.Min.Y+(j+1)*src.Dy()/ph
+			if y1 <= y0 {
+				y1 = y0 + 1
+			}
+			var sum float64
+			for x := x0; x < x1; x++ {
+				for y := y0; y < y1; y++ {
+					r, g, b, a := img.At(x, y).RGBA()
+					// Over white: what is not covered shows through.
+					l := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b) + float64(0xffff-a)) / 0xffff
+					sum += l
+				}
+			}
+			lum[j*pw+i] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+
+	p := Pattern{W: pw, H: ph}
+	for j := 0; j < ph; j++ {
+		for i := 0; i < pw; i++ {
+			l := lum[j*pw+i]
+			dark := l < o.Threshold
+			if o.Dither {
+				out := 1.0
+				if dark {
+					out = 0
+				}
+				diffuse := func(di, dj int, k float64) {
+					if x, y := i+di, j+dj; x >= 0 && x < pw && y < ph {
+						lum[y*pw+x] += (l - out) * k
+					}
+				}
+				diffuse(1, 0, 7.0/16)
+				diffuse(-1, 1, 3.0/16)
+				diffuse(0, 1, 5.0/16)
+				diffuse(1, 1, 1.0/16)
+			}
+			if dark != o.Light {
+				p.Cells = append(p.Cells, [2]int{i, j})
+			}
+		}
+	}
+	return p
+}
+
+// pictureParams reads how a picture becomes cells: ?threshold=, from 0 to 1
+// (0.5 by default), ?alive=dark or light, and ?dither=.
+func pictureParams(r *http.Request) (PictureOptions, error) {
+	q := r.URL.Query()
+	o := PictureOptions{Threshold: 0.5}
+	if s := q.Get("threshold"); s != "" {
+		t, err := strconv.ParseFloat(s, 64)
+		if err != nil || t < 0 || t > 1 {
+			return o, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid threshold %q, want 0 to 1", s)}
+		}
+		o.Threshold = t
+	}
+	switch s := q.Get("alive"); s {
+	case "", "dark":
+	case "light":
+		o.Light = true
+	default:
+		return o, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown alive %q, want dark or light", s)}
+	}
+	if s := q.Get("dither"); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return o, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("dither must be true or false, not %q", s)}
+		}
+		o.Dither = v
+	}
+	return o, nil
+}
+
+// readPicture decodes a PNG, JPEG or GIF picture from body and turns it into
+// a pattern fitting a w by h board.
+func readPicture(r *http.Request, body io.Reader, w, h int) (Pattern, error) {
+	o, err := pictureParams(r)
+	if err != nil {
+		return Pattern{}, err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxImageBytes+1))
+	if err != nil {
+		return Pattern{}, err
+	}
+	if len(data) > maxImageBytes {
+		return Pattern{}, &requestError{status: http.StatusRequestEntityTooLarge, msg: "picture too large"}
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Pattern{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("picture: %v", err)}
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return Pattern{}, &requestError{status: http.StatusRequestEntityTooLarge, msg: fmt.Sprintf("picture is %dx%d, too many pixels", cfg.Width, cfg.Height)}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Pattern{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("picture: %v", err)}
+	}
+	if img.Bounds().Empty() {
+		return Pattern{}, &requestError{status: http.StatusBadRequest, msg: "picture is empty"}
+	}
+	return PicturePattern(img, w, h, o), nil
+}
+
+// fetchPicture fetches the picture at rawURL, over http or https, and turns it
+// into a pattern fitting a w by h board.
+func fetchPicture(r *http.Request, rawURL string, w, h int) (Pattern, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Pattern{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid url %q, want http or https", rawURL)}
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Pattern{}, err
+	}
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return Pattern{}, &requestError{status: http.StatusBadGateway, msg: fmt.Sprintf("fetching picture: %v", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Pattern{}, &requestError{status: http.StatusBadGateway, msg: fmt.Sprintf("fetching picture: %s", resp.Status)}
+	}
+	return readPicture(r, resp.Body, w, h)
+}
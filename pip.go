@@ -0,0 +1,102 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+// insetSpeed is how many times faster than the room the inset of a
+// picture-in-picture stream runs.
+const insetSpeed = 10
+
+// speculation runs a room ahead of itself for picture-in-picture streams,
+// from the generation it was last anchored at. The future it shows assumes
+// nothing happens to the board, so any event rolls it back.
+type speculation struct {
+	board Board
+	plane *Viewport
+	gen   uint64
+	base  uint64
+	rule  Rule
+}
+
+// speculate returns the board insetSpeed times as many generations past the
+// anchor as gen is, starting over from b when the rule changed or the room
+// rolled the speculation back.
+func (r *GameRender) speculate(gen uint64, b Board, rule Rule) Board {
+	s := r.ahead
+	if s == nil || s.rule != rule || gen < s.base {
+		s = &speculation{board: b, gen: gen, base: gen, rule: rule}
+		if r.plane != nil {
+			s.plane = r.plane.Clone()
+		}
+		r.ahead = s
+	}
+	for target := s.base + insetSpeed*(gen-s.base); s.gen < target; s.gen++ {
+		s.board = advance(r.opts, s.plane, rule, s.board)
+	}
+	return s.board
+}
+
+func (r *GameRender) wantsInset() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, q := range r.queues {
+		if key.Style.Inset && q.Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// insetLayout places the inset in the bottom-right corner of a frame drawn k
+// pixels per cell, at a quarter of the scale: its top-left corner and pixels
+// per cell.
+func (f Frame) insetLayout(k int) (x, y, cell int) {
+	cell = k / 4
+	if cell < 1 {
+		cell = 1
+	}
+	x = k*len(f.Board) - cell*len(f.Inset) - k
+	y = k*len(f.Board[0]) - cell*len(f.Inset[0]) - k
+	return x, y, cell
+}
+
+func insetBackground(pal *Palette) color.RGBA {
+	if pal.Background.A > 0 {
+		return pal.Background
+	}
+	return color.RGBA{R: 255, G: 255, B: 255, A: 255}
+}
+
+func (f Frame) drawInset(img draw.Image, st Style, pal *Palette) {
+	x, y, cell := f.insetLayout(st.Scale)
+	w, h := cell*len(f.Inset), cell*len(f.Inset[0])
+	r := image.Rect(x, y, x+w, y+h)
+	draw.Draw(img, r.Inset(-1), &image.Uniform{C: pal.Alt}, image.Point{}, draw.Src)
+	draw.Draw(img, r, &image.Uniform{C: insetBackground(pal)}, image.Point{}, draw.Src)
+	alive := &image.Uniform{C: pal.Alive}
+	for i, col := range f.Inset {
+		for j, a := range col {
+			if a {
+				draw.Draw(img, image.Rect(x+i*cell, y+j*cell, x+(i+1)*cell, y+(j+1)*cell), alive, image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+func (f Frame) svgInset(canvas *svg.SVG, st Style, pal *Palette) {
+	x, y, cell := f.insetLayout(st.Scale)
+	canvas.Rect(x, y, cell*len(f.Inset), cell*len(f.Inset[0]),
+		`fill="`+svgColor(insetBackground(pal))+`"`, `stroke="`+svgColor(pal.Alt)+`"`)
+	for i, col := range f.Inset {
+		for j, a := range col {
+			if a {
+				canvas.Rect(x+i*cell, y+j*cell, cell, cell, `fill="`+svgColor(pal.Alive)+`"`)
+			}
+		}
+	}
+}
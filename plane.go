@@ -0,0 +1,290 @@
+package main
+
+import (
+	"image"
+)
+
+// maxPlaneDistance is how far past the edge of its view a Plane keeps live
+// cells. Debris that far out rarely comes back, and forgetting it keeps an
+// ever-growing pattern from taking ever more memory and time to step.
+const maxPlaneDistance = 4096
+
+// Plane is a board with no bounds: the set of its live cells.
+type Plane map[image.Point]bool
+
+// neighbourhood returns the offsets of the cells r counts around a cell on a
+// square grid.
+func (r Rule) neighbourhood() []image.Point {
+	if n := int(r.LtL.Radius); n > 0 {
+		offsets := make([]image.Point, 0, (2*n+1)*(2*n+1)-1)
+		for dx := -n; dx <= n; dx++ {
+			for dy := -n; dy <= n; dy++ {
+				if dx != 0 || dy != 0 {
+					offsets = append(offsets, image.Pt(dx, dy))
+				}
+			}
+		}
+		return offsets
+	}
+	if r.Neighbourhood == VonNeumann {
+		return []image.Point{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	}
+	return []image.Point{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+}
+
+// Evolute advances p one generation under r, the way Rule.Evolute advances a
+// board, counting only the cells around live ones. Rules with birth on no
+// neighbours only light up cells next to live ones.
+func (p Plane) Evolute(r Rule) Plane {
+	offsets := r.neighbourhood()
+	counts := make(map[image.Point]int, len(p)*len(offsets)/2)
+	for c := range p {
+		for _, o := range offsets {
+			counts[c.Add(o)]++
+		}
+	}
+	for c := range p {
+		if _, ok := counts[c]; !ok {
+			counts[c] = 0
+		}
+	}
+	next := make(Plane, len(p))
+	for c, n := range counts {
+		alive := p[c]
+		var lives bool
+		if r.LtL.Radius > 0 {
+			if alive && r.LtL.Middle {
+				n++
+			}
+			lives = r.LtL.next(alive, n)
+		} else {
+			lives = r.Next(alive, n)
+		}
+		if lives {
+			next[c] = true
+		}
+	}
+	return next
+}
+
+// Window returns the part of p inside view as a board.
+func (p Plane) Window(view image.Rectangle) Board {
+	b := make(Board, view.Dx())
+	for x := range b {
+		b[x] = make([]bool, view.Dy())
+	}
+	for c := range p {
+		if c.In(view) {
+			b[c.X-view.Min.X][c.Y-view.Min.Y] = true
+		}
+	}
+	return b
+}
+
+// Paste replaces the part of p inside view with b, which is its size.
+func (p Plane) Paste(view image.Rectangle, b Board) {
+	for c := range p {
+		if c.In(view) {
+			delete(p, c)
+		}
+	}
+	for x, col := range b {
+		for y, alive := range col {
+			if alive {
+				p[image.Pt(view.Min.X+x, view.Min.Y+y)] = true
+			}
+		}
+	}
+}
+
+// Viewport is the board of an unbounded room: the window View onto a plane
+// that the room draws, edits and watches, while the plane goes on around it.
+type Viewport struct {
+	Plane Plane
+	View  image.Rectangle
+	// Life, if set, holds the plane in place of Plane and steps it with
+	// HashLife, 2^step generations at a time.
+	Life *HashLife
+	// Cells, if set, hold a bounded board of a multi-state room in place of
+	// Plane, stepped as a Generations rule of States states on Topology.
+	Cells    StateBoard
+	States   uint8
+	Topology Topology
+}
+
+// NewViewport returns a viewport onto a plane holding only b, which it shows.
+func NewViewport(b Board) *Viewport {
+	v := &Viewport{Plane: make(Plane), View: image.Rect(0, 0, len(b), len(b[0]))}
+	v.Plane.Paste(v.View, b)
+	return v
+}
+
+// NewHashLifeViewport is NewViewport for a plane HashLife steps 2^step
+// generations at a time under rule.
+func NewHashLifeViewport(b Board, rule Rule, step uint) *Viewport {
+	life := NewHashLife(rule, step)
+	life.maxNodes = roomHashLifeNodes
+	life.StampBoard(b, 0, 0)
+	return &Viewport{Life: life, View: image.Rect(0, 0, len(b), len(b[0]))}
+}
+
+// NewStatesViewport returns a viewport onto b as the cells of a room with a
+// Generations rule of states states on topology t.
+func NewStatesViewport(b Board, states uint8, t Topology) *Viewport {
+	return &Viewport{Cells: NewStateBoard(b), States: states, Topology: t, View: image.Rect(0, 0, len(b), len(b[0]))}
+}
+
+// Board returns the cells in view.
+func (v *Viewport) Board() Board {
+	if v.Cells != nil {
+		return v.Cells.Alive()
+	}
+	if v.Life != nil {
+		return v.Life.Board(int64(v.View.Min.X), int64(v.View.Min.Y), v.View.Dx(), v.View.Dy(), 0)
+	}
+	return v.Plane.Window(v.View)
+}
+
+// Evolute advances the plane one generation under r, forgetting cells more
+// than maxPlaneDistance from the view, and returns the cells then in view. A
+// HashLife plane instead advances its step and forgets nothing, and
+// multi-state cells step under r with v.States states.
+func (v *Viewport) Evolute(r Rule) Board {
+	if v.Cells != nil {
+		v.Cells = Generations{Rule: r, States: v.States}.step(v.Cells, v.Topology.Evolute(r, v.Cells.Alive()))
+		return v.Board()
+	}
+	if v.Life != nil {
+		v.Life.SetRule(r)
+		v.Life.Step()
+		return v.Board()
+	}
+	v.Plane = v.Plane.Evolute(r)
+	keep := v.View.Inset(-maxPlaneDistance)
+	for c := range v.Plane {
+		if !c.In(keep) {
+			delete(v.Plane, c)
+		}
+	}
+	return v.Board()
+}
+
+// Apply applies e to the cells in view, as Event.Apply does to a board, and
+// returns them. Replacing the board clears the whole plane, and resizing it
+// grows or crops the view around its centre, bringing cells that were out of
+// sight into it. Multi-state cells keep dying unless the board is replaced or
+// resized, and cells the event brings to life are alive.
+func (v *Viewport) Apply(e Event, rule Rule) (Board, Rule) {
+	if v.Cells != nil {
+		b, rule := e.Apply(v.Board(), rule)
+		v.pasteCells(b, e.Kind == EventBoard || e.Kind == EventResize)
+		return b, rule
+	}
+	if e.Kind == EventResize {
+		min := v.View.Min.Sub(image.Pt((e.Width-v.View.Dx())/2, (e.Height-v.View.Dy())/2))
+		v.View = image.Rectangle{Min: min, Max: min.Add(image.Pt(e.Width, e.Height))}
+		return v.Board(), rule
+	}
+	old := v.Board()
+	b, rule := e.Apply(old, rule)
+	if v.Life != nil {
+		v.pasteLife(old, b, e.Kind == EventBoard)
+		return b, rule
+	}
+	if e.Kind == EventBoard {
+		v.Plane = make(Plane)
+	}
+	v.Plane.Paste(v.View, b)
+	return b, rule
+}
+
+// pasteLife writes b over the cells in view of a HashLife plane, setting
+// only those that differ from old, or over an empty plane if clear.
+func (v *Viewport) pasteLife(old, b Board, clear bool) {
+	if clear {
+		life := NewHashLife(v.Life.rule, v.Life.j)
+		life.maxNodes, life.generation = v.Life.maxNodes, v.Life.generation
+		v.Life = life
+		v.Life.StampBoard(b, int64(v.View.Min.X), int64(v.View.Min.Y))
+		return
+	}
+	for i, col := range b {
+		for j, alive := range col {
+			if alive != old[i][j] {
+				v.Life.Set(int64(v.View.Min.X+i), int64(v.View.Min.Y+j), alive)
+			}
+		}
+	}
+}
+
+// pasteCells replaces multi-state cells with b, keeping the dying ones where
+// b is dead unless clear. Frames may still be drawing the old cells, so they
+// are left as they were.
+func (v *Viewport) pasteCells(b Board, clear bool) {
+	cells := NewStateBoard(b)
+	if !clear {
+		for i, col := range cells {
+			for j, state := range col {
+				if state == 0 && v.Cells[i][j] > 1 {
+					col[j] = v.Cells[i][j]
+				}
+			}
+		}
+	}
+	v.Cells = cells
+	v.View = image.Rect(0, 0, len(b), len(b[0]))
+}
+
+// Clone returns a copy of v to step without changing v.
+func (v *Viewport) Clone() *Viewport {
+	if v.Cells != nil {
+		c := *v
+		c.Cells = make(StateBoard, len(v.Cells))
+		for i, col := range v.Cells {
+			c.Cells[i] = append([]uint8(nil), col...)
+		}
+		return &c
+	}
+	if v.Life != nil {
+		return &Viewport{Life: v.Life.Clone(), View: v.View}
+	}
+	c := &Viewport{Plane: make(Plane, len(v.Plane)), View: v.View}
+	for p := range v.Plane {
+		c.Plane[p] = true
+	}
+	return c
+}
+
+// viewport returns a viewport onto a plane holding b, the room's first board,
+// for an unbounded room, stepped by HashLife if the room runs on it, onto
+// multi-state cells for a room with more than two states, and nil for any
+// other.
+func (o RoomOptions) viewport(b Board) *Viewport {
+	if o.States > 2 {
+		return NewStatesViewport(b, o.States, o.Topology)
+	}
+	if o.HashLife {
+		return NewHashLifeViewport(b, o.rule(), o.Step)
+	}
+	if o.topology() != Unbounded {
+		return nil
+	}
+	return NewViewport(b)
+}
+
+// advance steps b, a room's board, one generation under r: through v for a
+// room that has one, and on its own for any other.
+func advance(o RoomOptions, v *Viewport, r Rule, b Board) Board {
+	if v != nil {
+		return v.Evolute(r)
+	}
+	return o.Evolute(r, b)
+}
+
+// apply applies e to b, a room's board, through v's plane if it has one.
+func apply(v *Viewport, e Event, b Board, rule Rule) (Board, Rule) {
+	if v != nil {
+		return v.Apply(e, rule)
+	}
+	return e.Apply(b, rule)
+}
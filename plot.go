@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+	"strconv"
+)
+
+// contours traces the outlines of b's live regions along cell edges. Each
+// contour is a closed loop of corner points, clockwise around live cells and
+// anticlockwise around holes.
+func contours(b Board) [][]image.Point {
+	type edge struct{ from, to image.Point }
+	var edges []edge
+	out := make(map[image.Point][]int)
+	add := func(x0, y0, x1, y1 int) {
+		e := edge{image.Pt(x0, y0), image.Pt(x1, y1)}
+		out[e.from] = append(out[e.from], len(edges))
+		edges = append(edges, e)
+	}
+	for x, col := range b {
+		for y, alive := range col {
+			if !alive {
+				continue
+			}
+			if !b.Get(x, y-1) {
+				add(x, y, x+1, y)
+			}
+			if !b.Get(x+1, y) {
+				add(x+1, y, x+1, y+1)
+			}
+			if !b.Get(x, y+1) {
+				add(x+1, y+1, x, y+1)
+			}
+			if !b.Get(x-1, y) {
+				add(x, y+1, x, y)
+			}
+		}
+	}
+
+	// Every corner has as many edges in as out, so following unused edges
+	// from any start always leads back to it.
+	used := make([]bool, len(edges))
+	var loops [][]image.Point
+	for i := range edges {
+		if used[i] {
+			continue
+		}
+		var loop []image.Point
+		for e := i; e >= 0; {
+			used[e] = true
+			loop = append(loop, edges[e].from)
+			next := -1
+			for _, j := range out[edges[e].to] {
+				if !used[j] {
+					next = j
+					break
+				}
+			}
+			e = next
+		}
+		loops = append(loops, corners(loop))
+	}
+	return loops
+}
+
+// corners drops the points of a closed loop that lie on a straight run.
+func corners(loop []image.Point) []image.Point {
+	var kept []image.Point
+	n := len(loop)
+	for i, p := range loop {
+		prev, next := loop[(i+n-1)%n], loop[(i+1)%n]
+		if (prev.X == p.X && p.X == next.X) || (prev.Y == p.Y && p.Y == next.Y) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// travelOrder orders loops so the pen moves to the nearest unvisited loop
+// each time, starting from the origin.
+func travelOrder(loops [][]image.Point) [][]image.Point {
+	ordered := make([][]image.Point, 0, len(loops))
+	done := make([]bool, len(loops))
+	at := image.Point{}
+	for range loops {
+		best, bestDist := -1, 0
+		for i, l := range loops {
+			if done[i] {
+				continue
+			}
+			d := l[0].Sub(at)
+			if dist := d.X*d.X + d.Y*d.Y; best < 0 || dist < bestDist {
+				best, bestDist = i, dist
+			}
+		}
+		done[best] = true
+		ordered = append(ordered, loops[best])
+		at = loops[best][0]
+	}
+	return ordered
+}
+
+// PlotSvg draws the outlines of the live regions as a single stroked path in
+// millimetres, cell mm per cell and pen mm wide, for pen plotters and laser
+// cutters.
+func (f Frame) PlotSvg(cell, pen float64) []byte {
+	w, h := len(f.Board), len(f.Board[0])
+	var d bytes.Buffer
+	for _, loop := range travelOrder(contours(f.Board)) {
+		fmt.Fprintf(&d, "M%d %d", loop[0].X, loop[0].Y)
+		for i, p := range loop[1:] {
+			if p.X == loop[i].X {
+				fmt.Fprintf(&d, "V%d", p.Y)
+			} else {
+				fmt.Fprintf(&d, "H%d", p.X)
+			}
+		}
+		d.WriteString("Z")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0"?>` + "\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%smm" height="%smm" viewBox="0 0 %d %d">`+"\n",
+		formatFloat(cell*float64(w)), formatFloat(cell*float64(h)), w, h)
+	fmt.Fprintf(&buf, `<path d="%s" fill="none" stroke="black" stroke-width="%s" stroke-linejoin="miter"/>`+"\n",
+		d.String(), formatFloat(pen/cell))
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func floatParam(r *http.Request, name string, def float64) (float64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 || f > 100 {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("%s must be a number of millimetres up to 100", name)}
+	}
+	return f, nil
+}
+
+// plotHandle serves the room's latest generation as a stroke-only SVG, sized
+// by ?cell= millimetres per cell and drawn with a ?pen= millimetre pen.
+func plotHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	cell, err := floatParam(r, "cell", 2)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	pen, err := floatParam(r, "pen", 0.3)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	latest := room.history.Latest()
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="board-%d.svg"`, latest.Number))
+	if _, err := w.Write(Frame{Board: latest.Board}.PlotSvg(cell, pen)); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const (
+	// populationWindow is how many generations of population statistics a
+	// room keeps.
+	populationWindow = 1000
+	// defaultStatsWindow is how many of them /stats.json returns by default.
+	defaultStatsWindow = 100
+)
+
+// GenerationStats counts a generation's live cells, and the cells born and
+// died on the way to it.
+type GenerationStats struct {
+	Generation uint64 `json:"generation"`
+	Population int    `json:"population"`
+	Births     int    `json:"births"`
+	Deaths     int    `json:"deaths"`
+}
+
+// PopulationStats keeps the statistics of a room's last populationWindow
+// generations.
+type PopulationStats struct {
+	mu    sync.Mutex
+	prev  Board
+	ring  [populationWindow]GenerationStats
+	count int
+}
+
+// Observe records generation gen, board b, against the board observed before
+// it. The first board, and one of another size, counts its cells as births.
+func (p *PopulationStats) Observe(gen uint64, b Board) {
+	s := GenerationStats{Generation: gen}
+	p.mu.Lock()
+	prev := p.prev
+	p.mu.Unlock()
+	same := len(prev) == len(b) && (len(b) == 0 || len(prev[0]) == len(b[0]))
+	for i, col := range b {
+		for j, alive := range col {
+			was := same && prev[i][j]
+			switch {
+			case alive && was:
+				s.Population++
+			case alive:
+				s.Population++
+				s.Births++
+			case was:
+				s.Deaths++
+			}
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prev = b
+	p.ring[p.count%populationWindow] = s
+	p.count++
+}
+
+// Window returns the statistics of up to the last n generations observed,
+// oldest first.
+func (p *PopulationStats) Window(n int) []GenerationStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n > p.count {
+		n = p.count
+	}
+	window := make([]GenerationStats, n)
+	for i := range window {
+		window[i] = p.ring[(p.count-n+i)%populationWindow]
+	}
+	return window
+}
+
+// statsWindowParam reads ?window=, how many generations of statistics to
+// return.
+func statsWindowParam(r *http.Request) (int, error) {
+	n, err := intParam(r, "window", defaultStatsWindow)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > populationWindow {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("window must be between 0 and %d", populationWindow)}
+	}
+	return n, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// predecessorMaxSize bounds each side of a pattern /predecessor searches
+	// for, since the search is exponential in its area.
+	predecessorMaxSize = 10
+	// predecessorMaxNodes bounds how many partial predecessors one search
+	// tries before giving up.
+	predecessorMaxNodes = 20000000
+)
+
+// PredecessorResult reports how a predecessor search ended. A search that
+// exhausted its bounds without finding one proves the pattern has no
+// predecessor that fits them; one that hit the node limit proves nothing.
+type PredecessorResult struct {
+	Found       bool     `json:"found"`
+	Exhausted   bool     `json:"exhausted"`
+	Predecessor *Pattern `json:"predecessor,omitempty"`
+	Margin      int      `json:"margin"`
+	Nodes       int      `json:"nodes"`
+}
+
+// FindPredecessor searches for a board whose successor under rule is exactly
+// target on an otherwise empty plane, with every live cell within margin cells
+// of target's bounding box. It assigns cells column by column, checking each
+// cell of the successor as soon as its neighbourhood is known.
+func FindPredecessor(ctx context.Context, target Pattern, rule Rule, margin int) PredecessorResult {
+	res := PredecessorResult{Margin: margin}
+	w, h := target.W+2*margin, target.H+2*margin
+	want := make(Board, w+2)
+	for i := range want {
+		want[i] = make([]bool, h+2)
+	}
+	for _, c := range target.Cells {
+		want[c[0]+margin+1][c[1]+margin+1] = true
+	}
+	pred := make(Board, w)
+	for i := range pred {
+		pred[i] = make([]bool, h)
+	}
+
+	// ok checks the successor cell (a, b), in predecessor coordinates.
+	ok := func(a, b int) bool {
+		n := 0
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				if (dx != 0 || dy != 0) && pred.Get(a+dx, b+dy) {
+					n++
+				}
+			}
+		}
+		return rule.Next(pred.Get(a, b), n) == want[a+1][b+1]
+	}
+	// settled checks the successor cells whose neighbourhoods (x, y) was the
+	// last cell of.
+	settled := func(x, y int) bool {
+		as, bs := []int{x - 1}, []int{y - 1}
+		if x == w-1 {
+			as = append(as, x, x+1)
+		}
+		if y == h-1 {
+			bs = append(bs, y, y+1)
+		}
+		for _, a := range as {
+			for _, b := range bs {
+				if !ok(a, b) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	stopped := false
+	var search func(k int) bool
+	search = func(k int) bool {
+		if k == w*h {
+			return true
+		}
+		res.Nodes++
+		if res.Nodes > predecessorMaxNodes || (res.Nodes%65536 == 0 && ctx.Err() != nil) {
+			stopped = true
+		}
+		if stopped {
+			return false
+		}
+		x, y := k/h, k%h
+		for _, alive := range []bool{false, true} {
+			pred[x][y] = alive
+			if settled(x, y) && search(k+1) {
+				return true
+			}
+		}
+		pred[x][y] = false
+		return false
+	}
+
+	if w == 0 || h == 0 {
+		res.Found, res.Exhausted = true, true
+		res.Predecessor = &Pattern{}
+		return res
+	}
+	if search(0) {
+		res.Found = true
+		p := Pattern{W: w, H: h}
+		for i, col := range pred {
+			for j, alive := range col {
+				if alive {
+					p.Cells = append(p.Cells, [2]int{i - margin, j - margin})
+				}
+			}
+		}
+		res.Predecessor = &p
+	}
+	res.Exhausted = res.Found || !stopped
+	return res
+}
+
+// predecessorHandle searches for a predecessor of the request's pattern under
+// ?rule=, by default the one its RLE header names or else Conway's, within
+// ?margin= cells of it.
+func predecessorHandle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, named, err := readPattern(r, predecessorMaxSize, predecessorMaxSize)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if p.W > predecessorMaxSize || p.H > predecessorMaxSize {
+		writeError(w, r, &requestError{
+			status: http.StatusRequestEntityTooLarge,
+			msg:    fmt.Sprintf("pattern %dx%d exceeds the %dx%d predecessor search limit", p.W, p.H, predecessorMaxSize, predecessorMaxSize),
+		})
+		return
+	}
+	rule := Conway
+	if named != nil {
+		rule = *named
+	}
+	if s := r.URL.Query().Get("rule"); s != "" {
+		if rule, err = ParseRule(s); err != nil {
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: err.Error()})
+			return
+		}
+	}
+	if rule.Birth&1 != 0 {
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: "rules with B0 are not supported"})
+		return
+	}
+	if !rule.moore() {
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: "von Neumann and Larger than Life rules are not supported"})
+		return
+	}
+	margin, err := intParam(r, "margin", 1)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if margin < 0 || margin > 2 {
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: "margin must be between 0 and 2"})
+		return
+	}
+
+	res := FindPredecessor(r.Context(), p, rule, margin)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		fmt.Println(err)
+	}
+}
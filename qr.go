@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// qrStart prefixes the Start of a room that starts as a QR code.
+const qrStart = "qr:"
+
+// qrQuietZone is how many modules of empty board a QR code needs around it
+// for a scanner to find it.
+const qrQuietZone = 4
+
+// qrVersion is the layout of a QR code version at error correction level M:
+// how many error correction bytes each block gets, how many blocks of how
+// many data bytes there are (the second group's blocks hold one more), and
+// where the alignment patterns are centred.
+type qrVersion struct {
+	ec        int
+	blocks    [2]int
+	data      int
+	alignment []int
+}
+
+// qrVersions are versions 1 to 10, which hold up to 213 bytes: more than
+// fits any board a QR code could be scanned from.
+var qrVersions = []qrVersion{
+	{ec: 10, blocks: [2]int{1, 0}, data: 16},
+	{ec: 16, blocks: [2]int{1, 0}, data: 28, alignment: []int{6, 18}},
+	{ec: 26, blocks: [2]int{1, 0}, data: 44, alignment: []int{6, 22}},
+	{ec: 18, blocks: [2]int{2, 0}, data: 32, alignment: []int{6, 26}},
+	{ec: 24, blocks: [2]int{2, 0}, data: 43, alignment: []int{6, 30}},
+	{ec: 16, blocks: [2]int{4, 0}, data: 27, alignment: []int{6, 34}},
+	{ec: 18, blocks: [2]int{4, 0}, data: 31, alignment: []int{6, 22, 38}},
+	{ec: 22, blocks: [2]int{2, 2}, data: 38, alignment: []int{6, 24, 42}},
+	{ec: 22, blocks: [2]int{3, 2}, data: 36, alignment: []int{6, 26, 46}},
+	{ec: 26, blocks: [2]int{4, 1}, data: 43, alignment: []int{6, 28, 50}},
+}
+
+// capacity is how many data bytes the version holds.
+func (v qrVersion) capacity() int {
+	return v.blocks[0]*v.data + v.blocks[1]*(v.data+1)
+}
+
+// qrBits accumulates a QR code's data bit by bit.
+type qrBits []byte
+
+func (b *qrBits) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, byte(v>>i&1))
+	}
+}
+
+// QRCode encodes data in byte mode at error correction level M, in the
+// smallest version that holds it, and returns its modules, dark where true,
+// indexed like a Board. It fails if data is too long for version 10.
+func QRCode(data []byte) (Board, error) {
+	for i, v := range qrVersions {
+		countBits := 8
+		if i+1 >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) > 8*v.capacity() {
+			continue
+		}
+		var bits qrBits
+		bits.append(0x4, 4)
+		bits.append(len(data), countBits)
+		for _, c := range data {
+			bits.append(int(c), 8)
+		}
+		return qrSymbol(i+1, v, qrCodewords(v, bits)), nil
+	}
+	return nil, fmt.Errorf("%d bytes is too long for a QR code, want at most %d", len(data), qrVersions[len(qrVersions)-1].capacity()-3)
+}
+
+// qrCodewords pads bits to the version's capacity, splits it into blocks,
+// adds each block's error correction and interleaves them.
+func qrCodewords(v qrVersion, bits qrBits) []byte {
+	capBits := 8 * v.capacity()
+	for i := 0; i < 4 && len(bits) < capBits; i++ {
+		bits = append(bits, 0)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, 0)
+	}
+	for pad := 0xec; len(bits) < capBits; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	data := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		data[i/8] |= bit << (7 - i%8)
+	}
+
+	var blocks, ecs [][]byte
+	divisor := rsDivisor(v.ec)
+	for g, n := range v.blocks {
+		for ; n > 0; n-- {
+			size := v.data + g
+			blocks = append(blocks, data[:size])
+			ecs = append(ecs, rsRemainder(data[:size], divisor))
+			data = data[size:]
+		}
+	}
+	var out []byte
+	for i := 0; i <= v.data; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := 0; i < v.ec; i++ {
+		for _, e := range ecs {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// gfMul multiplies in GF(2^8) modulo the QR polynomial x^8+x^4+x^3+x^2+1.
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given
+// degree, highest coefficient first and the leading 1 left out.
+func rsDivisor(degree int) []byte {
+	d := make([]byte, degree)
+	d[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range d {
+			d[j] = gfMul(d[j], root)
+			if j+1 < degree {
+				d[j] ^= d[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return d
+}
+
+// rsRemainder returns the error correction bytes of data.
+func rsRemainder(data, divisor []byte) []byte {
+	r := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ r[0]
+		copy(r, r[1:])
+		r[len(r)-1] = 0
+		for i, d := range divisor {
+			r[i] ^= gfMul(d, factor)
+		}
+	}
+	return r
+}
+
+// qrGrid is a QR code being laid out, indexed like a Board. Function
+// modules, the finders, timing, alignment and format, are never masked.
+type qrGrid struct {
+	dark, fn Board
+}
+
+func (g qrGrid) set(x, y int, dark bool) {
+	g.dark[x][y] = dark
+	g.fn[x][y] = true
+}
+
+// qrSymbol lays out the codewords of the given version, picking the mask
+// that scores lowest under the standard's penalty rules.
+func qrSymbol(version int, v qrVersion, codewords []byte) Board {
+	n := 17 + 4*version
+	g := qrGrid{dark: make(Board, n), fn: make(Board, n)}
+	for x := 0; x < n; x++ {
+		g.dark[x], g.fn[x] = make([]bool, n), make([]bool, n)
+	}
+
+	for i := 0; i < n; i++ {
+		g.set(6, i, i%2 == 0)
+		g.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {n - 4, 3}, {3, n - 4}} {
+		for dx := -4; dx <= 4; dx++ {
+			for dy := -4; dy <= 4; dy++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || y < 0 || x >= n || y >= n {
+					continue
+				}
+				d := abs(dx)
+				if abs(dy) > d {
+					d = abs(dy)
+				}
+				g.set(x, y, d != 2 && d != 4)
+			}
+		}
+	}
+	last := len(v.alignment) - 1
+	for i, cx := range v.alignment {
+		for j, cy := range v.alignment {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dx := -2; dx <= 2; dx++ {
+				for dy := -2; dy <= 2; dy++ {
+					g.set(cx+dx, cy+dy, abs(dx) != 1 && abs(dy) != 1 || abs(dx) == 2 || abs(dy) == 2)
+				}
+			}
+		}
+	}
+	g.format(0)
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1f25
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			a, b := n-11+i%3, i/3
+			g.set(a, b, bits>>i&1 == 1)
+			g.set(b, a, bits>>i&1 == 1)
+		}
+	}
+
+	i := 0
+	for right := n - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < n; vert++ {
+			y := vert
+			if upward {
+				y = n - 1 - vert
+			}
+			for x := right; x >= right-1; x-- {
+				if !g.fn[x][y] && i < 8*len(codewords) {
+					g.dark[x][y] = codewords[i/8]>>(7-i%8)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+
+	best, bestScore := -1, 0
+	for mask := 0; mask < 8; mask++ {
+		g.mask(mask)
+		g.format(mask)
+		if score := qrPenalty(g.dark); best < 0 || score < bestScore {
+			best, bestScore = mask, score
+		}
+		g.mask(mask)
+	}
+	g.mask(best)
+	g.format(best)
+	return g.dark
+}
+
+// mask toggles the data modules the mask selects; masking twice undoes it.
+func (g qrGrid) mask(mask int) {
+	for x := range g.dark {
+		for y := range g.dark[x] {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !g.fn[x][y] {
+				g.dark[x][y] = !g.dark[x][y]
+			}
+		}
+	}
+}
+
+// format writes both copies of the format information for level M and mask,
+// along with the dark module beside them.
+func (g qrGrid) format(mask int) {
+	n := len(g.dark)
+	rem := mask
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (mask<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		g.set(8, i, bit(i))
+	}
+	g.set(8, 7, bit(6))
+	g.set(8, 8, bit(7))
+	g.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		g.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		g.set(n-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		g.set(8, n-15+i, bit(i))
+	}
+	g.set(8, n-8, true)
+}
+
+// qrPenalty scores how hard b is to scan: long runs, 2x2 blocks and
+// finder-like stretches of one colour, and an imbalance of dark and light.
+func qrPenalty(b Board) int {
+	n := len(b)
+	score, dark := 0, 0
+	finder := []bool{true, false, true, true, true, false, true}
+	at := func(x, y int, col bool) bool {
+		if col {
+			return b[y][x]
+		}
+		return b[x][y]
+	}
+	for _, col := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			run := 0
+			for x := 0; x < n; x++ {
+				if x > 0 && at(x, y, col) == at(x-1, y, col) {
+					run++
+				} else {
+					run = 1
+				}
+				if run == 5 {
+					score += 3
+				} else if run > 5 {
+					score++
+				}
+			}
+			for x := 0; x+7 <= n; x++ {
+				match := true
+				for i, f := range finder {
+					if at(x+i, y, col) != f {
+						match = false
+						break
+					}
+				}
+				if !match {
+					continue
+				}
+				light := func(from, to int) bool {
+					for i := from; i < to; i++ {
+						if i >= 0 && i < n && at(i, y, col) {
+							return false
+						}
+					}
+					return true
+				}
+				if light(x-4, x) || light(x+7, x+11) {
+					score += 40
+				}
+			}
+		}
+	}
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			if b[x][y] {
+				dark++
+			}
+			if x+1 < n && y+1 < n && b[x][y] == b[x+1][y] && b[x][y] == b[x][y+1] && b[x][y] == b[x+1][y+1] {
+				score += 3
+			}
+		}
+	}
+	total := n * n
+	return score + 10*((abs(dark*20-total*10)+total-1)/total-1)
+}
+
+// QRPattern draws the QR code of s as live cells, each module a square of
+// cells as large as lets the code and its quiet zone fit a w by h board. It
+// fails if s is too long or the code doesn't fit even at one cell a module.
+func QRPattern(s string, w, h int) (Pattern, error) {
+	code, err := QRCode([]byte(s))
+	if err != nil {
+		return Pattern{}, err
+	}
+	n := len(code)
+	k := w / (n + 2*qrQuietZone)
+	if hk := h / (n + 2*qrQuietZone); hk < k {
+		k = hk
+	}
+	if k < 1 {
+		return Pattern{}, fmt.Errorf("a QR code of %d bytes needs a board of at least %dx%d", len(s), n+2*qrQuietZone, n+2*qrQuietZone)
+	}
+	p := Pattern{W: n * k, H: n * k}
+	for x := range code {
+		for y, dark := range code[x] {
+			if !dark {
+				continue
+			}
+			for i := 0; i < k; i++ {
+				for j := 0; j < k; j++ {
+					p.Cells = append(p.Cells, [2]int{x*k + i, y*k + j})
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// qrParam checks s, the text of ?qr=, and returns the pattern its QR code
+// makes on a w by h board.
+func qrParam(s string, w, h int) (Pattern, error) {
+	p, err := QRPattern(s, w, h)
+	if err != nil {
+		return Pattern{}, &requestError{status: http.StatusBadRequest, msg: err.Error()}
+	}
+	return p, nil
+}
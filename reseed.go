@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// maxReseedLog is how many reseeds a room remembers.
+const maxReseedLog = 100
+
+// Reseed is a room's board replaced with a new soup, and why: "frozen",
+// "cycle", "extinct" or "flat".
+type Reseed struct {
+	Generation uint64    `json:"generation"`
+	Time       time.Time `json:"time"`
+	Reason     string    `json:"reason"`
+}
+
+// ReseedLog remembers a room's last maxReseedLog reseeds.
+type ReseedLog struct {
+	mu      sync.Mutex
+	reseeds []Reseed
+}
+
+func (l *ReseedLog) Append(r Reseed) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reseeds = append(l.reseeds, r)
+	if len(l.reseeds) > maxReseedLog {
+		l.reseeds = l.reseeds[1:]
+	}
+}
+
+// List returns the reseeds, oldest first.
+func (l *ReseedLog) List() []Reseed {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Reseed{}, l.reseeds...)
+}
+
+// reseed replaces the room's board b, generation gen, with a new soup as
+// generation gen+1, logging it with reason. The soup comes from the soup
+// search's pool when there is one and the room was not given a seed.
+func (r *GameRender) reseed(gen uint64, b Board, reason string) {
+	seed := r.rng.Int63()
+	if r.cfg.Soups != nil && !r.opts.Seeded {
+		if s, ok := r.cfg.Soups.Take(r.opts.soupKind()); ok {
+			seed = s
+		}
+	}
+	soup := r.opts.soup(len(b), len(b[0]), seed).Pattern()
+	now := time.Now()
+	e := Event{Generation: gen + 1, Time: now, Kind: EventBoard, Pattern: &soup}
+	next, rule := r.record(e, advance(r.opts, r.plane, r.Rule(), b))
+	r.caption = ""
+	r.publish(gen+1, b, next, rule)
+	r.seeded = gen + 1
+	r.reseeds.Append(Reseed{Generation: gen + 1, Time: now, Reason: reason})
+}
+
+// restart reseeds the room once its board, generation gen, has stopped being
+// interesting for one of the reasons restartReason checks. The generation
+// before the reseed is drawn with a "restarting" caption. It reports whether
+// the tick was spent reseeding, instead of evolving.
+func (r *GameRender) restart(gen uint64, b Board) bool {
+	reason := r.restartReason(gen)
+	if reason == "" {
+		r.caption = ""
+		return false
+	}
+	if r.caption == "" {
+		r.caption = "restarting"
+		return false
+	}
+	log.Printf("room %s: reseeded at gen %d, %s", r.name, gen, reason)
+	r.reseed(gen, b, reason)
+	return true
+}
+
+// restartReason says why the room should be reseeded at generation gen, if
+// it should: "extinct" once the board has been empty for cfg.ReseedExtinct
+// generations, "cycle" once it has repeated a cycle, still, oscillating or
+// travelling, for cfg.ReseedAfterCycle, or "flat" once its population has
+// stayed within cfg.ReseedFlatBand of itself for cfg.ReseedFlat. Each check
+// only counts generations since the room was last seeded.
+func (r *GameRender) restartReason(gen uint64) string {
+	phase := r.cycles.Phase()
+	since := gen - phase.Since
+	if phase.Since < r.seeded {
+		since = gen - r.seeded
+	}
+	switch phase.Kind {
+	case PhaseExtinct:
+		if r.cfg.ReseedExtinct > 0 && since >= r.cfg.ReseedExtinct {
+			return "extinct"
+		}
+	case PhaseStable, PhaseOscillator, PhaseSpaceship:
+		if r.cfg.ReseedAfterCycle > 0 && since >= r.cfg.ReseedAfterCycle {
+			return "cycle"
+		}
+	}
+	if n := r.cfg.ReseedFlat; n > 0 && gen-r.seeded >= n {
+		window := r.stats.Window(int(n))
+		min, max := window[0].Population, window[0].Population
+		for _, s := range window {
+			if s.Population < min {
+				min = s.Population
+			}
+			if s.Population > max {
+				max = s.Population
+			}
+		}
+		if float64(max-min) <= r.cfg.ReseedFlatBand*float64(max) {
+			return "flat"
+		}
+	}
+	return ""
+}
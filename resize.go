@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Resize returns a copy of the board grown or cropped to w by h, its cells
+// kept centred.
+func (b Board) Resize(w, h int) Board {
+	dx, dy := (w-len(b))/2, (h-len(b[0]))/2
+	c := make(Board, w)
+	for x := range c {
+		c[x] = make([]bool, h)
+		if x-dx < 0 || x-dx >= len(b) {
+			continue
+		}
+		for y := range c[x] {
+			if y-dy >= 0 && y-dy < len(b[0]) {
+				c[x][y] = b[x-dx][y-dy]
+			}
+		}
+	}
+	return c
+}
+
+// Size returns the width and height of the room's latest board, which starts
+// at the room's options and changes as it is resized.
+func (r *GameRender) Size() (int, int) {
+	b := r.history.Latest().Board
+	return len(b), len(b[0])
+}
+
+// Resize grows or crops the board to w by h as the next generation, which it
+// returns, keeping the cells centred. Streams carry on at the new size.
+func (r *GameRender) Resize(w, h int) (uint64, error) {
+	return r.change(Event{Kind: EventResize, Width: w, Height: h})
+}
+
+// resizeHandleFunc resizes a room's board to ?width= by ?height=, each
+// defaulting to the current size and bounded like a new room's.
+func resizeHandleFunc(limits Limits) func(*GameRender, http.ResponseWriter, *http.Request) {
+	return func(room *GameRender, w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		width, height := room.Size()
+		var err error
+		if width, err = intParam(r, "width", width); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if height, err = intParam(r, "height", height); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if width < 1 || height < 1 {
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: "board dimensions must be positive"})
+			return
+		}
+		if width > limits.MaxWidth || height > limits.MaxHeight {
+			writeError(w, r, &requestError{
+				status: http.StatusRequestEntityTooLarge,
+				msg:    fmt.Sprintf("board %dx%d exceeds maximum %dx%d", width, height, limits.MaxWidth, limits.MaxHeight),
+			})
+			return
+		}
+		gen, err := room.Resize(width, height)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeBoardJSON(w, room, gen)
+	}
+}
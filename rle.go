@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseRLE parses a pattern in run length encoded format. The bounding box is
+// taken from the x and y header, grown to fit the cells if needed.
+func ParseRLE(s string) (Pattern, error) {
+	p, _, err := ParseRLEWithRule(s)
+	return p, err
+}
+
+// ParseRLEWithRule is ParseRLE that also returns the rule the header names,
+// or nil if it names none. Rules are read like ParseRule reads them, after
+// dropping any of Golly's bounded grid suffix such as :T64,64.
+func ParseRLEWithRule(s string) (Pattern, *Rule, error) {
+	var p Pattern
+	var rule *Rule
+	x, y, run := 0, 0, 0
+	header := false
+
+parse:
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !header && strings.HasPrefix(line, "x") {
+			header = true
+			// The rule comes last and may hold commas of its own.
+			if i := strings.Index(line, "rule"); i >= 0 {
+				value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[i+len("rule"):]), "="))
+				if i := strings.IndexByte(value, ':'); i >= 0 {
+					value = value[:i]
+				}
+				r, err := ParseRule(value)
+				if err != nil {
+					return Pattern{}, nil, fmt.Errorf("rle: %v", err)
+				}
+				rule = &r
+				line = strings.TrimSuffix(strings.TrimSpace(line[:i]), ",")
+			}
+			for _, field := range strings.Split(line, ",") {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					return Pattern{}, nil, fmt.Errorf("rle: bad header field %q", field)
+				}
+				key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+				switch key {
+				case "x", "y":
+					n, err := strconv.Atoi(value)
+					if err != nil || n < 0 {
+						return Pattern{}, nil, fmt.Errorf("rle: bad %s %q", key, value)
+					}
+					if key == "x" {
+						p.W = n
+					} else {
+						p.H = n
+					}
+				}
+			}
+			continue
+		}
+
+		for _, c := range line {
+			switch {
+			case c >= '0' && c <= '9':
+				run = run*10 + int(c-'0')
+				continue
+			case c == ' ' || c == '\t':
+				continue
+			}
+			n := run
+			if n == 0 {
+				n = 1
+			}
+			run = 0
+			switch c {
+			case '!':
+				break parse
+			case '$':
+				x, y = 0, y+n
+			case 'b', '.':
+				x += n
+			default:
+				if c != 'o' && (c < 'A' || c > 'Z') {
+					return Pattern{}, nil, fmt.Errorf("rle: unexpected %q", c)
+				}
+				for i := 0; i < n; i++ {
+					p.Cells = append(p.Cells, [2]int{x, y})
+					x++
+				}
+			}
+		}
+	}
+
+	for _, c := range p.Cells {
+		if c[0] >= p.W {
+			p.W = c[0] + 1
+		}
+		if c[1] >= p.H {
+			p.H = c[1] + 1
+		}
+	}
+	return p, rule, nil
+}
+
+func mustParseRLE(s string) Pattern {
+	p, err := ParseRLE(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// rleLineLength is how long a line of encoded cells may get, as Golly keeps
+// them.
+const rleLineLength = 70
+
+// EncodeRLE writes p in run length encoded format, with the rule in the
+// header when it is not empty and a #C line for each comment.
+func EncodeRLE(p Pattern, rule string, comments ...string) string {
+	var sb strings.Builder
+	for _, c := range comments {
+		fmt.Fprintf(&sb, "#C %s\n", c)
+	}
+	fmt.Fprintf(&sb, "x = %d, y = %d", p.W, p.H)
+	if rule != "" {
+		fmt.Fprintf(&sb, ", rule = %s", rule)
+	}
+	sb.WriteByte('\n')
+
+	rows := make([][]bool, p.H)
+	for _, c := range p.Cells {
+		if rows[c[1]] == nil {
+			rows[c[1]] = make([]bool, p.W)
+		}
+		rows[c[1]][c[0]] = true
+	}
+	line := 0
+	write := func(n int, tag byte) {
+		run := string(tag)
+		if n > 1 {
+			run = strconv.Itoa(n) + run
+		}
+		if line+len(run) > rleLineLength {
+			sb.WriteByte('\n')
+			line = 0
+		}
+		sb.WriteString(run)
+		line += len(run)
+	}
+	// Empty rows, and dead cells at the end of a row, are left to the next $.
+	ends := 0
+	for y, row := range rows {
+		if row == nil {
+			continue
+		}
+		if y > 0 {
+			write(y-ends, '$')
+		}
+		ends = y
+		for x := 0; x < len(row); {
+			n := 1
+			for x+n < len(row) && row[x+n] == row[x] {
+				n++
+			}
+			if row[x] {
+				write(n, 'o')
+			} else if x+n < len(row) {
+				write(n, 'b')
+			}
+			x += n
+		}
+	}
+	write(1, '!')
+	sb.WriteByte('\n')
+	return sb.String()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// sortedCells returns p's cells in a fixed order, so patterns can be compared
+// whatever order they were read in.
+func sortedCells(p Pattern) [][2]int {
+	cells := append([][2]int(nil), p.Cells...)
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i][1] != cells[j][1] {
+			return cells[i][1] < cells[j][1]
+		}
+		return cells[i][0] < cells[j][0]
+	})
+	return cells
+}
+
+func TestParseRLEWithRule(t *testing.T) {
+	glider := [][2]int{{1, 0}, {2, 1}, {0, 2}, {1, 2}, {2, 2}}
+	tests := []struct {
+		name  string
+		in    string
+		w, h  int
+		cells [][2]int
+		rule  string // empty for none
+	}{
+		{"glider", "#N Glider\nx = 3, y = 3, rule = B3/S23\nbo$2bo$3o!", 3, 3, glider, "B3/S23"},
+		{"no rule", "x = 3, y = 3\nbo$2bo$3o!", 3, 3, glider, ""},
+		{"no spaces", "x=3,y=3,rule=B36/S23\nbo$2bo$3o!", 3, 3, glider, "B36/S23"},
+		{"S/B rule", "x = 3, y = 3, rule = 23/36\nbo$2bo$3o!", 3, 3, glider, "B36/S23"},
+		{"named rule", "x = 3, y = 3, rule = HighLife\nbo$2bo$3o!", 3, 3, glider, "B36/S23"},
+		{"von Neumann", "x = 3, y = 3, rule = B2/S013V\nbo$2bo$3o!", 3, 3, glider, "B2/S013V"},
+		{"torus", "x = 3, y = 3, rule = B3/S23:T64,64\nbo$2bo$3o!", 3, 3, glider, "B3/S23"},
+		{"plane", "x = 3, y = 3, rule = B3/S23:P20,30\nbo$2bo$3o!", 3, 3, glider, "B3/S23"},
+		{"Larger than Life", "x = 3, y = 3, rule = R5,C0,M1,S34..58,B34..45,NM\nbo$2bo$3o!", 3, 3, glider, "R5,C0,M1,S34..58,B34..45,NM"},
+		{"Larger than Life torus", "x = 3, y = 3, rule = R5,C0,M1,S34..58,B34..45,NM:T100,100\nbo$2bo$3o!", 3, 3, glider, "R5,C0,M1,S34..58,B34..45,NM"},
+		{"grown to fit", "x = 1, y = 1\nbo$2bo$3o!", 3, 3, glider, ""},
+		{"larger box", "x = 5, y = 4\nbo$2bo$3o!", 5, 4, glider, ""},
+		{"split lines", "x = 3, y = 3\nb\no$2b\no$3\no!", 3, 3, glider, ""},
+		{"blank rows", "x = 2, y = 4\no3$bo!", 2, 4, [][2]int{{0, 0}, {1, 3}}, ""},
+		{"long runs", "x = 12, y = 1\n12o!", 12, 1, [][2]int{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}, {6, 0}, {7, 0}, {8, 0}, {9, 0}, {10, 0}, {11, 0}}, ""},
+		{"multi-state letters", "x = 3, y = 1\nAbB!", 3, 1, [][2]int{{0, 0}, {2, 0}}, ""},
+		{"dots", "x = 3, y = 1\n.o.!", 3, 1, [][2]int{{1, 0}}, ""},
+		{"ignored after bang", "x = 1, y = 1\no!\n3o!", 1, 1, [][2]int{{0, 0}}, ""},
+		{"empty", "x = 0, y = 0\n!", 0, 0, nil, ""},
+	}
+	for _, tt := range tests {
+		p, rule, err := ParseRLEWithRule(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if p.W != tt.w || p.H != tt.h {
+			t.Errorf("%s: size %dx%d, want %dx%d", tt.name, p.W, p.H, tt.w, tt.h)
+		}
+		if got, want := sortedCells(p), sortedCells(Pattern{Cells: tt.cells}); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: cells %v, want %v", tt.name, got, want)
+		}
+		switch {
+		case tt.rule == "" && rule != nil:
+			t.Errorf("%s: rule %s, want none", tt.name, rule)
+		case tt.rule != "" && rule == nil:
+			t.Errorf("%s: no rule, want %s", tt.name, tt.rule)
+		case tt.rule != "" && rule.String() != tt.rule:
+			t.Errorf("%s: rule %s, want %s", tt.name, rule, tt.rule)
+		}
+	}
+}
+
+func TestParseRLEWithRuleMalformed(t *testing.T) {
+	for _, in := range []string{
+		"x = 3, y = 3\nbo$2bz$3o!",
+		"x = 3, y\nbo$2bo$3o!",
+		"x = three, y = 3\nbo$2bo$3o!",
+		"x = -3, y = 3\nbo$2bo$3o!",
+		"x = 3, y = 3, rule = B9/S23\nbo$2bo$3o!",
+		"x = 3, y = 3, rule = B2/S345/C4\nbo$2bo$3o!",
+		"x = 3, y = 3, rule = R1,C0,M1,S34..58,B34..45,NM\nbo$2bo$3o!",
+		"x = 3, y = 3, rule =\nbo$2bo$3o!",
+	} {
+		if p, rule, err := ParseRLEWithRule(in); err == nil {
+			t.Errorf("ParseRLEWithRule(%q) = %v, %v, want an error", in, p, rule)
+		}
+	}
+}
+
+func TestRLERoundTrip(t *testing.T) {
+	for name, lp := range library {
+		in := lp.Pattern
+		out, rule, err := ParseRLEWithRule(EncodeRLE(in, lp.Rule, "round trip"))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out.W != in.W || out.H != in.H || !reflect.DeepEqual(sortedCells(out), sortedCells(in)) {
+			t.Errorf("%s: %v came back as %v", name, in, out)
+		}
+		if lp.Rule != "" && (rule == nil || rule.String() != lp.Rule) {
+			t.Errorf("%s: rule %s came back as %v", name, lp.Rule, rule)
+		}
+	}
+
+	// Rows long enough to wrap, and a run of blank rows.
+	b := NewBoard(150, 20)
+	for y := 5; y < 12; y++ {
+		for x := range b {
+			b[x][y] = false
+		}
+	}
+	in := b.Pattern()
+	out, err := ParseRLE(EncodeRLE(in, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.W != in.W || out.H != in.H || !reflect.DeepEqual(sortedCells(out), sortedCells(in)) {
+		t.Errorf("a %dx%d soup did not come back the same", in.W, in.H)
+	}
+}
@@ -0,0 +1,677 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRoom   = "default"
+	defaultWidth  = 80
+	defaultHeight = 60
+	defaultScale  = 10
+)
+
+type RoomOptions struct {
+	Width  int
+	Height int
+	Scale  int
+	// Rule is the rule the room starts with, Conway's if zero.
+	Rule Rule
+	// States, if more than 2, makes Rule a Generations rule of that many
+	// states, whose dying cells are drawn too.
+	States uint8
+	// Topology is what lies past the board's edges, Bounded if zero.
+	Topology Topology
+	// Grid is the shape of the cells, Square if zero.
+	Grid Grid
+	// Start is how the first generation is laid out, the rule's default if
+	// empty.
+	Start Start
+	// Seed, if Seeded, seeds the room's first generation and every random
+	// choice it makes after, like the spaceships it injects and the soups it
+	// reseeds with.
+	Seed   int64
+	Seeded bool
+	// Density is the share of a soup's cells that start alive,
+	// defaultDensity if zero.
+	Density float64
+	// Symmetry is how soups mirror themselves, NoSymmetry if empty.
+	Symmetry Symmetry
+	// Noise, if not zero, is the size in cells of the clusters soups are
+	// laid down in, where coherent noise rises above Level,
+	// defaultNoiseLevel if zero.
+	Noise float64
+	Level float64
+	// Resume, if set, is the board the room carries on from at generation
+	// ResumeAt, in place of laying out a first generation.
+	Resume   Board
+	ResumeAt uint64
+	// HashLife runs the room on an unbounded plane stepped by HashLife,
+	// each generation of the room being 2^Step generations of the rule.
+	HashLife bool
+	Step     uint
+}
+
+// engine names what steps the room: cells or hashlife.
+func (o RoomOptions) engine() string {
+	if o.HashLife {
+		return "hashlife"
+	}
+	return "cells"
+}
+
+// states is how many states the room's cells have, 2 unless it runs a
+// Generations rule.
+func (o RoomOptions) states() uint8 {
+	if o.States < 2 {
+		return 2
+	}
+	return o.States
+}
+
+func (o RoomOptions) rule() Rule {
+	if o.Rule == (Rule{}) {
+		return Conway
+	}
+	return o.Rule
+}
+
+// MemoryCost estimates how many bytes a room with these options holds: two
+// generations of cells, its replay checkpoints and cached replays, plus an
+// RGBA canvas when a raster format is encoded, and the states of its cells
+// and checkpoints under a Generations rule.
+func (o RoomOptions) MemoryCost() int64 {
+	cells := int64(o.Width) * int64(o.Height)
+	cost := cells*(2+maxCheckpoints+replayCacheSize) + cells*int64(o.Scale)*int64(o.Scale)*4
+	if o.States > 2 {
+		cost += cells * (1 + maxCheckpoints)
+	}
+	if o.HashLife {
+		cost += roomHashLifeNodes * hashLifeNodeBytes
+	}
+	return cost
+}
+
+type Limits struct {
+	MaxWidth     int
+	MaxHeight    int
+	MaxScale     int
+	MemoryBudget int64
+	// MaxHashLifeSize caps the width and height of HashLife rooms in place
+	// of MaxWidth and MaxHeight.
+	MaxHashLifeSize int
+	// IdleTTL is how long a room nobody watches, polls or changes is kept
+	// before it is closed and its memory given back, forever if zero.
+	IdleTTL time.Duration
+}
+
+func (l Limits) Validate(o RoomOptions) error {
+	if o.Width < 1 || o.Height < 1 || o.Scale < 1 {
+		return &requestError{status: http.StatusBadRequest, msg: "board dimensions and scale must be positive"}
+	}
+	maxWidth, maxHeight := l.MaxWidth, l.MaxHeight
+	if o.HashLife {
+		maxWidth, maxHeight = l.MaxHashLifeSize, l.MaxHashLifeSize
+	}
+	if o.Width > maxWidth || o.Height > maxHeight {
+		return &requestError{
+			status: http.StatusRequestEntityTooLarge,
+			msg:    fmt.Sprintf("board %dx%d exceeds maximum %dx%d", o.Width, o.Height, maxWidth, maxHeight),
+		}
+	}
+	if o.topology() == Torus {
+		if err := o.grid().fitsTorus(o.Width, o.Height); err != nil {
+			return &requestError{status: http.StatusBadRequest, msg: err.Error()}
+		}
+	}
+	if o.Scale > l.MaxScale {
+		return &requestError{
+			status: http.StatusRequestEntityTooLarge,
+			msg:    fmt.Sprintf("scale %d exceeds maximum %d", o.Scale, l.MaxScale),
+		}
+	}
+	return nil
+}
+
+type requestError struct {
+	status int
+	msg    string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+// writeError reports err as JSON to clients asking for it and as an SVG image
+// otherwise, since most requests come from <img> tags.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	if re, ok := err.(*requestError); ok {
+		status = re.status
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(errorSvg(err.Error()))
+}
+
+// Rooms holds the running simulations, keyed by name. Rooms are created on
+// first request and count against the memory budget for as long as they live,
+// which ends once they have sat idle for the limits' IdleTTL, unless they are
+// the default room.
+type Rooms struct {
+	mu      sync.Mutex
+	limits  Limits
+	cfg     GameConfig
+	used    int64
+	rooms   map[string]*GameRender
+	charges map[string]roomCharge
+	task    *Task
+}
+
+// roomCharge is what a room was charged when it was created, given back when
+// it is reaped.
+type roomCharge struct {
+	cost   int64
+	tenant *Tenant
+}
+
+func NewRooms(limits Limits, cfg GameConfig) *Rooms {
+	rs := &Rooms{
+		limits:  limits,
+		cfg:     cfg,
+		rooms:   make(map[string]*GameRender),
+		charges: make(map[string]roomCharge),
+	}
+	if _, err := rs.Get(defaultRoom, RoomOptions{Width: defaultWidth, Height: defaultHeight, Scale: defaultScale}); err != nil {
+		panic(err)
+	}
+	if limits.IdleTTL > 0 {
+		rs.task = scheduler.Every(time.Minute, rs.reap)
+	}
+	return rs
+}
+
+// reap closes the rooms that have been idle for longer than the limits'
+// IdleTTL, other than the default room, and gives back what they were
+// charged.
+func (rs *Rooms) reap() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for name, room := range rs.rooms {
+		if name == defaultRoom || !room.Idle(rs.limits.IdleTTL) {
+			continue
+		}
+		room.Close()
+		delete(rs.rooms, name)
+		c := rs.charges[name]
+		delete(rs.charges, name)
+		rs.used -= c.cost
+		if c.tenant != nil {
+			c.tenant.dropRoom()
+		}
+	}
+}
+
+// Get returns the named room, creating it with opts if it does not exist.
+func (rs *Rooms) Get(name string, opts RoomOptions) (*GameRender, error) {
+	return rs.get(name, opts, nil)
+}
+
+// get is Get, charging a room it creates to tenant's quota if there is one.
+func (rs *Rooms) get(name string, opts RoomOptions, tenant *Tenant) (*GameRender, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if room, ok := rs.rooms[name]; ok {
+		return room, nil
+	}
+	if err := rs.limits.Validate(opts); err != nil {
+		return nil, err
+	}
+	cost := opts.MemoryCost()
+	if rs.used+cost > rs.limits.MemoryBudget {
+		return nil, &requestError{
+			status: http.StatusServiceUnavailable,
+			msg:    fmt.Sprintf("memory budget exhausted: room needs %d bytes, %d of %d in use", cost, rs.used, rs.limits.MemoryBudget),
+		}
+	}
+	if tenant != nil {
+		if err := tenant.createRoom(opts); err != nil {
+			return nil, err
+		}
+	}
+	rs.used += cost
+	rs.charges[name] = roomCharge{cost: cost, tenant: tenant}
+
+	room := NewGameRender(name, opts, rs.cfg)
+	rs.rooms[name] = room
+	return room, nil
+}
+
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid %s %q", name, v)}
+	}
+	return n, nil
+}
+
+// Close stops every room.
+func (rs *Rooms) Close() {
+	if rs.task != nil {
+		rs.task.Stop()
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for name, room := range rs.rooms {
+		room.Close()
+		delete(rs.rooms, name)
+		delete(rs.charges, name)
+	}
+	rs.used = 0
+}
+
+// Lookup resolves the room a request refers to. An explicit ?room= names it;
+// otherwise requests with custom dimensions or ?rule= share a room per
+// dimension set and rule. A tenant's rooms are kept apart from everyone
+// else's.
+func (rs *Rooms) Lookup(r *http.Request) (*GameRender, error) {
+	var opts RoomOptions
+	var err error
+	if opts.Width, err = intParam(r, "w", defaultWidth); err != nil {
+		return nil, err
+	}
+	if opts.Height, err = intParam(r, "h", defaultHeight); err != nil {
+		return nil, err
+	}
+	if opts.Scale, err = intParam(r, "scale", defaultScale); err != nil {
+		return nil, err
+	}
+
+	if s := r.URL.Query().Get("rule"); s != "" {
+		if opts.Rule, err = ParseRule(s); err != nil {
+			if g, gerr := ParseGenerations(s); gerr == nil {
+				opts.Rule, err = g.Rule, nil
+				if g.States > 2 {
+					opts.States = g.States
+				}
+			} else if c, cerr := ParseColorRule(s); cerr == nil {
+				err = fmt.Errorf("rule %s has %d colours, rooms only one: stream it from /colors.svg?rule=%s", c, c.Colors, url.QueryEscape(s))
+			}
+		}
+		if err != nil {
+			return nil, &requestError{status: http.StatusBadRequest, msg: err.Error()}
+		}
+	}
+	switch n := r.URL.Query().Get("neighborhood"); n {
+	case "", "moore":
+	case string(VonNeumann):
+		opts.Rule = opts.rule()
+		opts.Rule.Neighbourhood = VonNeumann
+	default:
+		return nil, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown neighborhood %q, want moore or vonneumann", n)}
+	}
+	if opts.Topology, err = topologyParam(r); err != nil {
+		return nil, err
+	}
+	if opts.Topology == Bounded {
+		opts.Topology = ""
+	}
+	if opts.Grid, err = gridParam(r); err != nil {
+		return nil, err
+	}
+	if opts.Grid == Square {
+		opts.Grid = ""
+	}
+	if opts.HashLife, err = engineParam(r); err != nil {
+		return nil, err
+	}
+	if opts.Step, err = stepParam(r); err != nil {
+		return nil, err
+	}
+	if opts.HashLife {
+		if opts.Topology != "" && opts.Topology != Unbounded {
+			return nil, &requestError{status: http.StatusBadRequest, msg: "HashLife boards are unbounded"}
+		}
+		if err := hashLifeRule(opts.rule()); err != nil {
+			return nil, &requestError{status: http.StatusBadRequest, msg: err.Error()}
+		}
+		opts.Topology = Unbounded
+	} else if r.URL.Query().Get("step") != "" {
+		return nil, &requestError{status: http.StatusBadRequest, msg: "step= needs engine=hashlife"}
+	}
+	if opts.Topology == Unbounded && opts.Grid != "" {
+		return nil, &requestError{status: http.StatusBadRequest, msg: "unbounded boards need the square grid"}
+	}
+	if opts.States > 2 && (opts.Topology == Unbounded || opts.Grid != "" || opts.Rule.Neighbourhood == VonNeumann) {
+		return nil, &requestError{status: http.StatusBadRequest, msg: "Generations rules need a bounded or torus board of square cells with the Moore neighbourhood"}
+	}
+	if opts.Start, err = startParam(r, opts.Width, opts.Height); err != nil {
+		return nil, err
+	}
+	start := opts.start()
+	if opts.Start == (RoomOptions{Rule: opts.Rule}).start() {
+		opts.Start = ""
+	}
+	if opts.Seed, opts.Seeded, err = seedParam(r); err != nil {
+		return nil, err
+	}
+	if opts.Density, err = densityParam(r); err != nil {
+		return nil, err
+	}
+	if opts.Density == defaultDensity {
+		opts.Density = 0
+	}
+	if opts.Symmetry, err = symmetryParam(r); err != nil {
+		return nil, err
+	}
+	if opts.Symmetry == NoSymmetry {
+		opts.Symmetry = ""
+	}
+	if opts.Noise, err = noiseParam(r); err != nil {
+		return nil, err
+	}
+	if opts.Level, err = levelParam(r); err != nil {
+		return nil, err
+	}
+	if opts.Level == defaultNoiseLevel || opts.Noise == 0 {
+		opts.Level = 0
+	}
+
+	name := r.URL.Query().Get("room")
+	if name == "" {
+		name = defaultRoom
+		if opts.Width != defaultWidth || opts.Height != defaultHeight || opts.Scale != defaultScale {
+			name = fmt.Sprintf("%dx%dx%d", opts.Width, opts.Height, opts.Scale)
+		}
+		if opts.rule() != Conway {
+			name += "-" + strings.Replace(opts.Rule.String(), "/", "", 1)
+		}
+		if opts.States > 2 {
+			name += fmt.Sprintf("C%d", opts.States)
+		}
+		if opts.Topology != "" {
+			name += "-" + string(opts.Topology)
+		}
+		if opts.Grid != "" {
+			name += "-" + string(opts.Grid)
+		}
+		if opts.HashLife {
+			name += fmt.Sprintf("-hashlife-step%d", opts.Step)
+		}
+		if opts.Start != "" {
+			name += "-" + string(opts.Start)
+		}
+		if opts.Density != 0 {
+			name += "-density" + strconv.FormatFloat(opts.Density, 'g', -1, 64)
+		}
+		if opts.Symmetry != "" {
+			name += "-" + string(opts.Symmetry)
+		}
+		if opts.Noise != 0 {
+			name += "-noise" + strconv.FormatFloat(opts.Noise, 'g', -1, 64)
+		}
+		if opts.Level != 0 {
+			name += "-level" + strconv.FormatFloat(opts.Level, 'g', -1, 64)
+		}
+		if opts.Seeded {
+			name += "-seed" + strconv.FormatInt(opts.Seed, 10)
+		}
+	}
+	tenant := tenantFrom(r)
+	if tenant != nil {
+		name = tenant.Name + "/" + name
+	}
+	room, err := rs.get(name, opts, tenant)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Rule != (Rule{}) && (room.opts.rule() != opts.Rule || room.opts.states() != opts.states()) {
+		msg := fmt.Sprintf("room %s was started with rule %s", name, room.opts.rule())
+		if room.opts.States > 2 {
+			msg = fmt.Sprintf("room %s was started with rule %s", name, Generations{Rule: room.opts.rule(), States: room.opts.States})
+		}
+		return nil, &requestError{status: http.StatusConflict, msg: msg}
+	}
+	if t := r.URL.Query().Get("topology"); t != "" && room.opts.topology() != Topology(t) {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s is %s", name, room.opts.topology()),
+		}
+	}
+	if e := r.URL.Query().Get("engine"); e != "" && room.opts.engine() != e {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s runs on %s", name, room.opts.engine()),
+		}
+	}
+	if r.URL.Query().Get("step") != "" && room.opts.Step != opts.Step {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s steps 2^%d generations at a time", name, room.opts.Step),
+		}
+	}
+	if g := r.URL.Query().Get("grid"); g != "" && room.opts.grid() != Grid(g) {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s has a %s grid", name, room.opts.grid()),
+		}
+	}
+	if (r.URL.Query().Get("start") != "" || r.URL.Query().Get("text") != "" || r.URL.Query().Get("qr") != "") && room.opts.start() != start {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s was started from %s", name, room.opts.start()),
+		}
+	}
+	if r.URL.Query().Get("density") != "" && room.opts.density() != opts.density() {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s was started with a density of %g", name, room.opts.density()),
+		}
+	}
+	if r.URL.Query().Get("symmetry") != "" && room.opts.symmetry() != opts.symmetry() {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s has %s symmetry", name, room.opts.symmetry()),
+		}
+	}
+	if r.URL.Query().Get("noise") != "" && room.opts.Noise != opts.Noise {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s was started with noise=%g", name, room.opts.Noise),
+		}
+	}
+	if r.URL.Query().Get("level") != "" && room.opts.level() != opts.level() {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s was started with a noise level of %g", name, room.opts.level()),
+		}
+	}
+	if opts.Seeded && room.seed != opts.Seed {
+		return nil, &requestError{
+			status: http.StatusConflict,
+			msg:    fmt.Sprintf("room %s was started from seed %d", name, room.seed),
+		}
+	}
+	return room, nil
+}
+
+func withRoom(rooms *Rooms, handle func(*GameRender, http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		room, err := rooms.Lookup(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		handle(room, w, r)
+	}
+}
+
+func roomHandleFunc(rooms *Rooms, format string, handler func(Render) func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return withRoom(rooms, func(room *GameRender, w http.ResponseWriter, r *http.Request) {
+		st, err := styleParam(r, room.DefaultStyle())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		every, err := keyframeParam(r, format)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if every > 0 {
+			handler(room.DeltaStream(format, st))(w, r)
+			return
+		}
+		handler(room.Stream(format, st))(w, r)
+	})
+}
+
+// List returns the public rooms, those outside any tenant's namespace, sorted
+// by name.
+func (rs *Rooms) List() []*GameRender {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	var list []*GameRender
+	for name, room := range rs.rooms {
+		if !strings.Contains(name, "/") {
+			list = append(list, room)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+type roomJSON struct {
+	Name       string   `json:"name"`
+	Rule       Rule     `json:"rule"`
+	States     uint8    `json:"states"`
+	Topology   Topology `json:"topology"`
+	Grid       Grid     `json:"grid"`
+	Engine     string   `json:"engine"`
+	Step       uint     `json:"step"`
+	Start      Start    `json:"start"`
+	Seed       int64    `json:"seed"`
+	Density    float64  `json:"density"`
+	Symmetry   Symmetry `json:"symmetry"`
+	Noise      float64  `json:"noise"`
+	Level      float64  `json:"level"`
+	Width      int      `json:"width"`
+	Height     int      `json:"height"`
+	Generation uint64   `json:"generation"`
+	Population int      `json:"population"`
+	Viewers    int      `json:"viewers"`
+	Stream     string   `json:"stream"`
+	Thumbnail  string   `json:"thumbnail"`
+}
+
+// Find returns the named room if it is running and listed.
+func (rs *Rooms) Find(name string) (*GameRender, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	room, ok := rs.rooms[name]
+	if !ok || strings.Contains(name, "/") {
+		return nil, false
+	}
+	return room, true
+}
+
+// ServeHTTP lists the rooms for /rooms, and serves a room's milestones for
+// /rooms/NAME/events.json.
+func (rs *Rooms) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path != "/rooms" {
+		name := strings.TrimPrefix(r.URL.Path, "/rooms/")
+		if !strings.HasSuffix(name, "/events.json") {
+			http.NotFound(w, r)
+			return
+		}
+		name = strings.TrimSuffix(name, "/events.json")
+		room, ok := rs.Find(name)
+		if !ok {
+			writeError(w, r, &requestError{status: http.StatusNotFound, msg: fmt.Sprintf("no room %q", name)})
+			return
+		}
+		timelineHandle(room, w, r)
+		return
+	}
+	resp := []roomJSON{}
+	for _, room := range rs.List() {
+		latest := room.history.Latest()
+		q := "?room=" + url.QueryEscape(room.name)
+		resp = append(resp, roomJSON{
+			Name:       room.name,
+			Rule:       room.Rule(),
+			States:     room.opts.states(),
+			Topology:   room.opts.topology(),
+			Grid:       room.opts.grid(),
+			Engine:     room.opts.engine(),
+			Step:       room.opts.Step,
+			Start:      room.opts.start(),
+			Seed:       room.seed,
+			Density:    room.opts.density(),
+			Symmetry:   room.opts.symmetry(),
+			Noise:      room.opts.Noise,
+			Level:      room.opts.level(),
+			Width:      room.opts.Width,
+			Height:     room.opts.Height,
+			Generation: latest.Number,
+			Population: latest.Board.Population(),
+			Viewers:    viewerCounts.Count(ViewerFilter{Room: room.name}),
+			Stream:     "/game.svg" + q,
+			Thumbnail:  "/thumbnail.png" + q,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// thumbnailWidth is about how many pixels wide /thumbnail.png is.
+const thumbnailWidth = 160
+
+// thumbnailHandle renders the latest generation of a room small enough for a
+// directory listing.
+func thumbnailHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	latest := room.history.Latest()
+	st := room.DefaultStyle()
+	width, _ := room.Size()
+	st.Scale = thumbnailWidth / width
+	if st.Scale < 1 {
+		st.Scale = 1
+	}
+	bundle, err := Encode("png", Frame{Board: latest.Board, Rule: room.Rule(), Grid: room.opts.Grid, Generation: latest.Number}, st)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", bundle.ContentType)
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	_, _ = w.Write(bundle.Data)
+}
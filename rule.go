@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rule is a Life-like rule. Bit n of Birth makes a dead cell with n live
+// neighbours come alive; bit n of Survive keeps a live cell with n live
+// neighbours alive.
+type Rule struct {
+	Birth   uint16
+	Survive uint16
+	// Neighbourhood is which cells count as neighbours on a square grid.
+	Neighbourhood Neighbourhood
+	// LtL, if its Radius is set, makes this a Larger than Life rule, which
+	// ignores Birth, Survive and Neighbourhood.
+	LtL LargerThanLife
+}
+
+// Neighbourhood is which of the cells around a cell on a square grid are its
+// neighbours.
+type Neighbourhood string
+
+const (
+	// Moore is the eight cells around a cell. It is the neighbourhood of the
+	// zero Neighbourhood.
+	Moore Neighbourhood = ""
+	// VonNeumann is the four cells sharing an edge with a cell, written with
+	// a V after the rulestring, like B1/S012345V.
+	VonNeumann Neighbourhood = "vonneumann"
+)
+
+// vonNeumannNeighbours are the offsets of a cell's von Neumann neighbours.
+var vonNeumannNeighbours = [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+
+// Conway is the classic B3/S23 Game of Life.
+var Conway = Rule{Birth: 1 << 3, Survive: 1<<2 | 1<<3}
+
+// HighLife is B36/S23, Conway's rule plus birth on six neighbours.
+var HighLife = Rule{Birth: 1<<3 | 1<<6, Survive: 1<<2 | 1<<3}
+
+// moore reports whether r counts the eight cells around a cell, as the
+// engines working on 3x3 blocks assume.
+func (r Rule) moore() bool {
+	return r.Neighbourhood == Moore && r.LtL.Radius == 0
+}
+
+func (r Rule) Next(alive bool, neighbours int) bool {
+	if alive {
+		return r.Survive&(1<<uint(neighbours)) != 0
+	}
+	return r.Birth&(1<<uint(neighbours)) != 0
+}
+
+// namedRules are well-known rules ParseRule accepts by name.
+var namedRules = map[string]string{
+	"conway":             "B3/S23",
+	"life":               "B3/S23",
+	"highlife":           "B36/S23",
+	"seeds":              "B2/S",
+	"day-and-night":      "B3678/S34678",
+	"life-without-death": "B3/S012345678",
+	"diamoeba":           "B35678/S5678",
+	"2x2":                "B36/S125",
+	"morley":             "B368/S245",
+	"replicator":         "B1357/S1357",
+	"maze":               "B3/S12345",
+	"mazectric":          "B3/S1234",
+	"vote":               "B5678/S45678",
+	"majority":           "B5678/S45678",
+	"anneal":             "B4678/S35678",
+	"bugs":               "R5,C0,M1,S34..58,B34..45,NM",
+	"waffle":             "R7,C0,M1,S100..200,B75..170,NM",
+	"globe":              "R8,C0,M0,S163..223,B74..252,NM",
+}
+
+// ParseRule parses a Life-like rule in B/S notation, like B36/S23, with the
+// parts in either order and in either case, or in the older S/B notation
+// without letters, like 23/36. A trailing V picks the von Neumann
+// neighbourhood. It also accepts Larger than Life rules, in Golly's notation,
+// and the names in namedRules.
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	if named, ok := namedRules[strings.ToLower(s)]; ok {
+		s = named
+	}
+	if ltlRule(s) {
+		return parseLtL(s)
+	}
+	var r Rule
+	spec := strings.ToUpper(s)
+	if strings.HasSuffix(spec, "V") {
+		spec = strings.TrimSuffix(spec, "V")
+		r.Neighbourhood = VonNeumann
+	}
+	parts := strings.Split(spec, "/")
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("bad rule %q: want B3/S23", s)
+	}
+	if !strings.HasPrefix(parts[0], "B") && !strings.HasPrefix(parts[0], "S") {
+		parts = []string{"S" + parts[0], "B" + parts[1]}
+	}
+	var seen [2]bool
+	for _, part := range parts {
+		mask, i := &r.Birth, 0
+		switch {
+		case strings.HasPrefix(part, "B"):
+		case strings.HasPrefix(part, "S"):
+			mask, i = &r.Survive, 1
+		default:
+			return Rule{}, fmt.Errorf("bad rule %q: want B3/S23", s)
+		}
+		if seen[i] {
+			return Rule{}, fmt.Errorf("bad rule %q: want B3/S23", s)
+		}
+		seen[i] = true
+		for _, c := range part[1:] {
+			if c < '0' || c > '8' {
+				return Rule{}, fmt.Errorf("bad rule %q: neighbour counts go from 0 to 8", s)
+			}
+			*mask |= 1 << uint(c-'0')
+		}
+	}
+	return r, nil
+}
+
+func conditions(mask uint16) string {
+	var s string
+	for n := 0; n <= 8; n++ {
+		if mask&(1<<uint(n)) != 0 {
+			s += strconv.Itoa(n)
+		}
+	}
+	return s
+}
+
+func (r Rule) String() string {
+	if r.LtL.Radius > 0 {
+		return r.LtL.String()
+	}
+	s := "B" + conditions(r.Birth) + "/S" + conditions(r.Survive)
+	if r.Neighbourhood == VonNeumann {
+		s += "V"
+	}
+	return s
+}
+
+// ruleTables are the lookup tables the evolution passes use for a rule.
+type ruleTables struct {
+	// window maps a 3x3 neighbourhood, packed row by row into 9 bits with the
+	// cell itself at bit 4, to the cell's next state.
+	window [512]bool
+	// sums maps the sum of a 3x3 block, itself included, plus 10 if the centre
+	// is alive to the centre's next state.
+	sums [20]bool
+}
+
+var ruleTableCache sync.Map
+
+func (r Rule) tables() *ruleTables {
+	if t, ok := ruleTableCache.Load(r); ok {
+		return t.(*ruleTables)
+	}
+	t := &ruleTables{}
+	for p := range t.window {
+		t.window[p] = r.Next(p&(1<<4) != 0, bits.OnesCount(uint(p&^(1<<4))))
+	}
+	for sum := 0; sum <= 9; sum++ {
+		t.sums[sum] = r.Next(false, sum)
+		if sum > 0 {
+			t.sums[sum+10] = r.Next(true, sum-1)
+		}
+	}
+	ruleTableCache.Store(r, t)
+	return t
+}
+
+// Mutate returns r with one birth or survival condition toggled at random from
+// rng, or for a Larger than Life rule one end of a range moved.
+// It never enables birth on 0 or 1 neighbours, which floods or explodes any
+// board, and never removes the last birth condition, which kills it.
+func (r Rule) Mutate(rng *rand.Rand) Rule {
+	if r.LtL.Radius > 0 {
+		r.LtL = r.LtL.mutate(rng)
+		return r
+	}
+	for {
+		m := r
+		n := uint(rng.Intn(9))
+		if rng.Intn(2) == 0 {
+			if n < 2 {
+				continue
+			}
+			m.Birth ^= 1 << n
+			if m.Birth == 0 {
+				continue
+			}
+		} else {
+			m.Survive ^= 1 << n
+		}
+		return m
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	bugs := Rule{LtL: LargerThanLife{Radius: 5, Middle: true, Birth: [2]uint16{34, 45}, Survive: [2]uint16{34, 58}}}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"B3/S23", "B3/S23"},
+		{"b36/s23", "B36/S23"},
+		{"S23/B3", "B3/S23"},
+		{" B3/S23 ", "B3/S23"},
+		{"23/3", "B3/S23"},
+		{"/2", "B2/S"},
+		{"B2/S", "B2/S"},
+		{"B/S012345678", "B/S012345678"},
+		{"B1357/S1357", "B1357/S1357"},
+		{"B3678/S34678", "B3678/S34678"},
+		{"B2/S013V", "B2/S013V"},
+		{"b2/s013v", "B2/S013V"},
+		{"HighLife", "B36/S23"},
+		{"seeds", "B2/S"},
+		{"R5,C0,M1,S34..58,B34..45,NM", bugs.String()},
+		{"r5,c0,m1,s34..58,b34..45,nm", bugs.String()},
+		{"R5,M1,S34..58,B34..45", bugs.String()},
+		{"bugs", bugs.String()},
+		{"R7,C2,M0,S100..200,B75..170,NM", "R7,C0,M0,S100..200,B75..170,NM"},
+	}
+	for _, tt := range tests {
+		r, err := ParseRule(tt.in)
+		if err != nil {
+			t.Errorf("ParseRule(%q): %v", tt.in, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("ParseRule(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRuleMalformed(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"B3",
+		"B3S23",
+		"B3/S23/",
+		"B9/S23",
+		"B3/S2a",
+		"B3/B23",
+		"S23/S3",
+		"X3/S23",
+		"B3/S23/C3",
+		"23/3/3",
+		"R1,C0,M1,S34..58,B34..45,NM",
+		"R11,C0,M1,S34..58,B34..45,NM",
+		"R5,C3,M1,S34..58,B34..45,NM",
+		"R5,C0,M2,S34..58,B34..45,NM",
+		"R5,C0,M1,S58..34,B34..45,NM",
+		"R5,C0,M1,S34,B34..45,NM",
+		"R5,C0,M1,S34..58,NM",
+		"R5,C0,M1,S34..58,B34..45,NN",
+		"R5,R5,S34..58,B34..45",
+		"R5,,S34..58,B34..45",
+	} {
+		if r, err := ParseRule(in); err == nil {
+			t.Errorf("ParseRule(%q) = %s, want an error", in, r)
+		}
+	}
+}
+
+func TestParseRuleRoundTrip(t *testing.T) {
+	for name := range namedRules {
+		r, err := ParseRule(name)
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %v", name, err)
+		}
+		again, err := ParseRule(r.String())
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %v", r, err)
+		}
+		if again != r {
+			t.Errorf("%s: %s parses back as %s", name, r, again)
+		}
+	}
+	for birth := uint16(0); birth < 1<<9; birth += 37 {
+		for _, n := range []Neighbourhood{Moore, VonNeumann} {
+			r := Rule{Birth: birth, Survive: 1<<9 - 1 - birth, Neighbourhood: n}
+			again, err := ParseRule(r.String())
+			if err != nil {
+				t.Fatalf("ParseRule(%q): %v", r, err)
+			}
+			if again != r {
+				t.Errorf("%s parses back as %s", r, again)
+			}
+		}
+	}
+}
+
+// cellsBoard reads a board drawn in the plaintext .cells format, one string
+// per row, every row as wide as the board.
+func cellsBoard(t *testing.T, rows ...string) Board {
+	t.Helper()
+	p, err := ParseCells(strings.Join(rows, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBoard(len(rows[0]), len(rows)).empty()
+	b.Stamp(p, 0, 0)
+	return b
+}
+
+func TestSeeds(t *testing.T) {
+	seeds, err := ParseRule("seeds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Under B2/S every live cell dies each generation, while the dead cells
+	// beside exactly two of them are born, so a domino spreads outwards.
+	gens := [][]string{{
+		"......",
+		"......",
+		"..OO..",
+		"......",
+		"......",
+	}, {
+		"......",
+		"..OO..",
+		"......",
+		"..OO..",
+		"......",
+	}, {
+		"..OO..",
+		"......",
+		".O..O.",
+		"......",
+		"..OO..",
+	}}
+	b := cellsBoard(t, gens[0]...)
+	for i, rows := range gens[1:] {
+		b = seeds.Evolute(b)
+		if want := cellsBoard(t, rows...); !reflect.DeepEqual(b, want) {
+			t.Errorf("generation %d:\n%s\nwant\n%s", i+1, b, want)
+		}
+	}
+}
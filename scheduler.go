@@ -0,0 +1,173 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Scheduler owns every periodic task of the server.
+type Scheduler struct {
+	mu    sync.Mutex
+	tasks map[*Task]struct{}
+}
+
+var scheduler = NewScheduler()
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{tasks: make(map[*Task]struct{})}
+}
+
+// Every runs f right away and then every interval until the task is stopped.
+// Runs never overlap; ticks missed while f is running are dropped.
+func (s *Scheduler) Every(interval time.Duration, f func()) *Task {
+	t := s.NewTask(interval, f)
+	t.Start()
+	return t
+}
+
+// NewTask is like Every but leaves starting the task to the caller.
+func (s *Scheduler) NewTask(interval time.Duration, f func()) *Task {
+	t := &Task{
+		f:        f,
+		sched:    s,
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.tasks[t] = struct{}{}
+	s.mu.Unlock()
+	return t
+}
+
+// Stop stops every task.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	tasks := make([]*Task, 0, len(s.tasks))
+	for t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+	s.mu.Unlock()
+	for _, t := range tasks {
+		t.Stop()
+	}
+}
+
+// Task is a function run periodically by a Scheduler.
+type Task struct {
+	f     func()
+	sched *Scheduler
+	wake  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	mu       sync.Mutex
+	started  bool
+	interval time.Duration
+	paused   bool
+	resumed  bool
+}
+
+func (t *Task) Start() {
+	t.mu.Lock()
+	t.started = true
+	t.mu.Unlock()
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(t.Interval())
+		defer ticker.Stop()
+
+		t.f()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				if !t.Paused() {
+					t.f()
+				}
+			case <-t.wake:
+				t.mu.Lock()
+				interval, paused, resumed := t.interval, t.paused, t.resumed
+				t.resumed = false
+				t.mu.Unlock()
+				if paused {
+					ticker.Stop()
+					continue
+				}
+				ticker.Reset(interval)
+				if resumed {
+					t.f()
+				}
+			}
+		}
+	}()
+}
+
+func (t *Task) notify() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (t *Task) Interval() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.interval
+}
+
+// SetInterval changes how often the task runs, starting from now.
+func (t *Task) SetInterval(d time.Duration) {
+	t.mu.Lock()
+	t.interval = d
+	t.mu.Unlock()
+	t.notify()
+}
+
+func (t *Task) Paused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.paused
+}
+
+// Pause stops running the task until Resume. It may be called from the task
+// itself.
+func (t *Task) Pause() {
+	t.mu.Lock()
+	t.paused = true
+	t.mu.Unlock()
+	t.notify()
+}
+
+// Resume runs a paused task right away and then every interval again.
+func (t *Task) Resume() {
+	t.mu.Lock()
+	if !t.paused {
+		t.mu.Unlock()
+		return
+	}
+	t.paused = false
+	t.resumed = true
+	t.mu.Unlock()
+	t.notify()
+}
+
+// Stop stops the task and waits for a run in progress to return, so it must
+// not be called from the task itself.
+func (t *Task) Stop() {
+	t.once.Do(func() {
+		close(t.stop)
+		t.sched.mu.Lock()
+		delete(t.sched.tasks, t)
+		t.sched.mu.Unlock()
+	})
+	t.mu.Lock()
+	started := t.started
+	t.mu.Unlock()
+	if started {
+		<-t.done
+	}
+}
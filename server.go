@@ -0,0 +1,310 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+var (
+	embedInterval    = flag.Duration("embed-interval", time.Minute, "how often /game.png advances to the next generation")
+	universeTTL      = flag.Duration("universe-ttl", 7*24*time.Hour, "how long an unvisited personal universe is kept")
+	universeCapacity = flag.Int("universe-capacity", 1000, "maximum number of personal universes kept in memory")
+	cookieSecret     = flag.String("cookie-secret", "", "key used to sign visitor cookies (random per process if empty)")
+	urlSigningKey    = flag.String("url-signing-key", "", "key for signing snapshot URLs; snapshots without a valid sig= render with no parameters (disabled if empty)")
+	maxWidth         = flag.Int("max-width", 500, "maximum board width a request may ask for")
+	maxHeight        = flag.Int("max-height", 500, "maximum board height a request may ask for")
+	maxScale         = flag.Int("max-scale", 20, "maximum pixels per cell a request may ask for")
+	maxHashLifeSize  = flag.Int("max-hashlife-size", 2000, "maximum board width and height an engine=hashlife room may ask for")
+	memoryBudget     = flag.Int64("memory-budget", 256<<20, "approximate bytes all rooms together may use")
+	roomIdleTTL      = flag.Duration("room-idle-ttl", time.Hour, "how long a room nobody watches is kept before it is closed and its memory given back (0 keeps rooms forever)")
+	encodeWorkers    = flag.Int("encode-workers", runtime.GOMAXPROCS(0), "maximum number of frames encoded concurrently")
+	encodeDrop       = flag.String("encode-drop", "oldest", "which frame to drop when an encoder falls behind: oldest or newest")
+	historySize      = flag.Int("history", 64, "number of recent generations kept per room")
+	mutateEvery      = flag.Duration("mutate-rule-every", 0, "experimental: randomly toggle one rule condition this often (0 disables)")
+	tournamentSize   = flag.Int("tournament-size", 9, "number of soups competing in /tournament.svg")
+	autoThemeZone    = flag.String("auto-theme", "", "make theme=auto the default, light by day and dark by night in this time zone (Local for the server's)")
+	showcaseDir      = flag.String("showcase-dir", "", "directory of .mc and .rle patterns to add to /showcase/")
+	apiKeys          = flag.String("api-keys", "", "JSON file of tenants with their API keys and quotas")
+	cpuBudget        = flag.Float64("cpu-budget", 0, "CPUs ticks and encoders may use before ticks slow down (0 disables)")
+	exportMaxGens    = flag.Int("export-max-generations", 1000, "most generations /export/frames.zip renders per request")
+	exportMaxPixels  = flag.Int("export-max-pixels", 4000000, "largest frame /export/frames.zip or sprite sheet /sprites.png renders, in pixels")
+	freezeAfter      = flag.Uint64("freeze-after", 0, "hold each room still once it has run this many generations since it was seeded, then reseed it (0 disables)")
+	freezeHold       = flag.Duration("freeze-hold", time.Minute, "how long -freeze-after holds a room still before reseeding it")
+	seed             = flag.Int64("seed", 0, "seed rooms not given a ?seed= from this mixed with their names, so they start over the same after a restart (0 seeds them at random)")
+	soupSearch       = flag.Int("soup-search", 0, "search for long-lived soups in the background, keeping this many of the best for each kind of room to reseed with (0 disables)")
+	reseedAfterCycle = flag.Uint64("reseed-after-cycle", 0, "reseed each room once its board has repeated a cycle of period up to 16 for this many generations (0 disables)")
+	reseedExtinct    = flag.Uint64("reseed-extinct", 0, "reseed each room once its board has been empty for this many generations (0 disables)")
+	reseedFlat       = flag.Uint64("reseed-flat", 0, "reseed each room once its population has stayed within -reseed-flat-band for this many generations, at most 1000 (0 disables)")
+	reseedFlatBand   = flag.Float64("reseed-flat-band", 0.02, "how far, as a share of the largest, populations may spread and still count as flat for -reseed-flat")
+	injectEvery      = flag.Uint64("inject-every", 0, "fire a glider or spaceship in from an edge every this many generations (0 disables)")
+	adminToken       = flag.String("admin-token", "", "bearer token for /admin endpoints (admin API disabled if empty)")
+	storageSpec      = flag.String("storage", "", "where to keep state across restarts: a directory, redis://[:password@]host[:port][/db][?prefix=], or sqlite:file (kept in memory only if empty)")
+	shareFile        = flag.String("share-file", "", "file to persist shared snapshots in, overriding -storage for them")
+	shareTTL         = flag.Duration("share-ttl", 30*24*time.Hour, "how long a snapshot shared with POST /share is kept")
+	shareCapacity    = flag.Int("share-capacity", 10000, "maximum number of shared snapshots kept")
+	viewersFile      = flag.String("viewers-file", "", "file to persist cumulative and peak viewer counts in, overriding -storage for them")
+	viewersImport    = flag.Uint64("viewers-import", 0, "seed the cumulative viewer count with at least this many")
+	geoIPDB          = flag.String("geoip-db", "", "path to a MaxMind GeoLite2/GeoIP2 Country database for viewer geography")
+	wasmDir          = flag.String("wasm-dir", "", "directory with the WebAssembly build from make wasm, served as /wasm/ so pages can run rooms themselves (disabled if empty)")
+	check            = flag.Bool("check", false, "validate the flags, render a frame in every format and open storage and data files, then exit")
+)
+
+func main() {
+	flag.Parse()
+	defer scheduler.Stop()
+	selfCheck(*check)
+	if *check {
+		fmt.Println("configuration ok")
+		return
+	}
+
+	storage, err := openStorage()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if storage != nil {
+		defer func() {
+			// Stop every task first, so none is still saving when storage
+			// closes.
+			scheduler.Stop()
+			storage.Close()
+		}()
+		if err := viewerCounts.Load(storage); err != nil {
+			log.Fatal(err)
+		}
+		viewerCounts.Persist(storage, 30*time.Second)
+	}
+	viewerCounts.Seed(*viewersImport)
+
+	budget.Start(*cpuBudget)
+
+	drop, err := ParseDropPolicy(*encodeDrop)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var theme string
+	if *autoThemeZone != "" {
+		if autoTheme.Location, err = time.LoadLocation(*autoThemeZone); err != nil {
+			log.Fatal(err)
+		}
+		theme = "auto"
+	}
+	var soups *SoupSearch
+	if *soupSearch > 0 {
+		soups = NewSoupSearch(*soupSearch)
+		defer soups.Close()
+	}
+
+	notes, err := NewAnnotationStore(storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer notes.Close()
+
+	rooms := NewRooms(Limits{
+		MaxWidth:        *maxWidth,
+		MaxHeight:       *maxHeight,
+		MaxScale:        *maxScale,
+		MemoryBudget:    *memoryBudget,
+		MaxHashLifeSize: *maxHashLifeSize,
+		IdleTTL:         *roomIdleTTL,
+	}, GameConfig{
+		Drop:        drop,
+		Pool:        NewWorkerPool(*encodeWorkers),
+		History:     *historySize,
+		InjectEvery: *injectEvery,
+		MutateEvery: *mutateEvery,
+		FreezeAfter: *freezeAfter,
+		FreezeHold:  *freezeHold,
+		Theme:       theme,
+		Seed:        *seed,
+		Soups:       soups,
+		Notes:       notes,
+
+		ReseedAfterCycle: *reseedAfterCycle,
+		ReseedExtinct:    *reseedExtinct,
+		ReseedFlat:       *reseedFlat,
+		ReseedFlatBand:   *reseedFlatBand,
+	})
+	defer rooms.Close()
+	viewerRender := NewViewerRender()
+	defer viewerRender.Close()
+	def, _ := rooms.Find(defaultRoom)
+	embedRender := NewEmbedRender(def, *embedInterval)
+	universes := NewUniverseStore(*universeTTL, *universeCapacity)
+	defer universes.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	mux.HandleFunc("/game.svg", roomHandleFunc(rooms, "svg", streamHandleFunc))
+	mux.HandleFunc("/game.mjpeg", roomHandleFunc(rooms, "jpeg", streamHandleFunc))
+	mux.HandleFunc("/diff", withRoom(rooms, diffHandle))
+	mux.HandleFunc("/next", withRoom(rooms, nextHandle))
+	mux.HandleFunc("/game.json", withRoom(rooms, jsonStreamHandle))
+	mux.HandleFunc("/status-badge.svg", withRoom(rooms, statusBadgeHandle))
+	mux.HandleFunc("/stats.json", withRoom(rooms, statsHandle))
+	mux.HandleFunc("/generation", withRoom(rooms, generationHandle))
+	mux.HandleFunc("/census.json", withRoom(rooms, censusHandle))
+	mux.HandleFunc("/replay", withRoom(rooms, replayHandle))
+	mux.HandleFunc("/replay.json", withRoom(rooms, replayJSONHandle))
+	mux.HandleFunc("/board.pdf", withRoom(rooms, vectorHandleFunc("pdf")))
+	mux.HandleFunc("/board.eps", withRoom(rooms, vectorHandleFunc("eps")))
+	mux.HandleFunc("/board.rle", withRoom(rooms, patternHandleFunc("rle")))
+	mux.HandleFunc("/board.lif", withRoom(rooms, patternHandleFunc("lif")))
+	mux.HandleFunc("/plot.svg", withRoom(rooms, plotHandle))
+	mux.HandleFunc("/board.ico", withRoom(rooms, icoHandle))
+	mux.HandleFunc("/thumbnail.png", withRoom(rooms, thumbnailHandle))
+	mux.HandleFunc("/widget.svg", withRoom(rooms, widgetHandle))
+	mux.HandleFunc("/display", displayHandleFunc(rooms))
+	snapshots, err := NewSnapshotStore(storage, *shareTTL, *shareCapacity)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer snapshots.Close()
+	share := &ShareHandler{store: snapshots, rooms: rooms}
+	mux.Handle("/share", share)
+	mux.Handle("/share/", share)
+	mux.HandleFunc("/annotations.json", withRoom(rooms, annotationsJSONHandle))
+	mux.Handle("/rooms", rooms)
+	mux.Handle("/rooms/", rooms)
+	exportLimits := ExportLimits{
+		MaxGenerations: *exportMaxGens,
+		MaxPixels:      *exportMaxPixels,
+	}
+	mux.HandleFunc("/export/frames.zip", withRoom(rooms, exportHandleFunc(exportLimits)))
+	mux.HandleFunc("/sprites.png", withRoom(rooms, spritesHandleFunc(exportLimits)))
+	mux.HandleFunc("/sprites.json", withRoom(rooms, spritesJSONHandleFunc(exportLimits)))
+	if *tournamentSize > 0 {
+		tournament := NewTournament(*tournamentSize, 40, 30, 4, Conway)
+		defer tournament.Close()
+		mux.HandleFunc("/tournament.svg", streamHandleFunc(tournament))
+		mux.Handle("/tournament.json", tournament)
+	}
+	if soups != nil {
+		mux.Handle("/soups.json", soups)
+	}
+	showcases, err := LoadShowcases(*showcaseDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer showcases.Close()
+	generations := NewGenerationsWorlds()
+	defer generations.Close()
+	mux.HandleFunc("/generations.svg", generations.Handle)
+	mux.HandleFunc("/generations.png", generations.Handle)
+	colors := NewColorWorlds()
+	defer colors.Close()
+	mux.HandleFunc("/colors.svg", colors.Handle)
+	mux.HandleFunc("/colors.png", colors.Handle)
+	mux.HandleFunc("/colors.json", colors.Handle)
+	ants := NewAntWorlds()
+	defer ants.Close()
+	mux.HandleFunc("/ant.svg", ants.Handle)
+	elementary := NewElementaryWorlds()
+	defer elementary.Close()
+	mux.HandleFunc("/elementary.svg", elementary.Handle)
+	lenia := NewLeniaWorlds()
+	defer lenia.Close()
+	mux.HandleFunc("/lenia.svg", lenia.Handle)
+	mux.HandleFunc("/lenia.png", lenia.Handle)
+	mux.HandleFunc("/showcase/", showcases.Handle)
+	mux.Handle("/showcase.json", showcases)
+	mux.Handle("/admin/sessions", adminOnly(*adminToken, sessions))
+	mux.Handle("/admin/bench", adminOnly(*adminToken, http.HandlerFunc(benchHandle)))
+	mux.Handle("/admin/board", adminOnly(*adminToken, http.HandlerFunc(withRoom(rooms, boardHandle))))
+	mux.Handle("/board", tenantOrAdmin(*adminToken, http.HandlerFunc(withRoom(rooms, boardHandle))))
+	mux.Handle("/admin/combine", adminOnly(*adminToken, http.HandlerFunc(withRoom(rooms, combineHandle))))
+	mux.Handle("/admin/resize", adminOnly(*adminToken, http.HandlerFunc(withRoom(rooms, resizeHandleFunc(rooms.limits)))))
+	mux.Handle("/admin/annotations", adminOnly(*adminToken, http.HandlerFunc(withRoom(rooms, annotationsHandle))))
+	if *geoIPDB != "" {
+		geo, err := OpenGeoStats(*geoIPDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sessions.geo = geo
+		mux.HandleFunc("/viewers/geo.json", geoJSONHandleFunc(geo))
+		mux.HandleFunc("/viewers/geo.svg", geoSvgHandleFunc(geo))
+	}
+	mux.HandleFunc("/viewers.svg", viewersHandleFunc(viewerRender))
+	mux.Handle("/viewers.json", viewerCounts)
+	mux.HandleFunc("/game.png", embedHandleFunc(embedRender))
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/themes.json", palettesHandle)
+	mux.HandleFunc("/predecessor", predecessorHandle)
+	mux.HandleFunc("/patterns.json", patternsHandle)
+	if *wasmDir != "" {
+		mux.Handle("/wasm/", http.StripPrefix("/wasm/", http.FileServer(http.Dir(*wasmDir))))
+	}
+	var handler http.Handler = mux
+	if *apiKeys != "" {
+		tenants, err := LoadTenants(*apiKeys)
+		if err != nil {
+			log.Fatal(err)
+		}
+		handler = tenants.Middleware(mux)
+		mux.Handle("/admin/quotas", adminOnly(*adminToken, tenants))
+	}
+	if *urlSigningKey != "" {
+		signer := NewURLSigner(*urlSigningKey)
+		handler = signer.Middleware(handler)
+		mux.Handle("/admin/sign", adminOnly(*adminToken, signer))
+	}
+	mux.HandleFunc("/my/game.svg", universeHandleFunc(universes, newCookieSigner(*cookieSecret)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{
+		Addr:        ":3000",
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdown); err != nil {
+			fmt.Println(err)
+		}
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-closed
+
+	if storage != nil {
+		if err := viewerCounts.Save(storage); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// openStorage opens -storage, with -viewers-file and -share-file keeping
+// their keys in files of their own.
+func openStorage() (Storage, error) {
+	files := make(map[string]string)
+	if *viewersFile != "" {
+		files[viewersKey] = *viewersFile
+	}
+	if *shareFile != "" {
+		files[snapshotsKey] = *shareFile
+	}
+	st, err := OpenStorage(*storageSpec)
+	if err != nil || len(files) == 0 {
+		return st, err
+	}
+	return &overrideStorage{Storage: st, files: &FileStorage{Files: files}}, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session describes one client subscribed to a stream.
+type Session struct {
+	ID         uint64
+	Path       string
+	Query      string
+	Format     string
+	RemoteAddr string
+	UserAgent  string
+	JoinedAt   time.Time
+
+	sent    uint64
+	dropped uint64
+	country string
+}
+
+func (s *Session) countSent() {
+	if s != nil {
+		atomic.AddUint64(&s.sent, 1)
+	}
+}
+
+func (s *Session) countDropped() {
+	if s != nil {
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+func (s *Session) setFormat(format string) {
+	if s != nil {
+		sessions.mu.Lock()
+		s.Format = format
+		sessions.mu.Unlock()
+	}
+}
+
+// offer sends b to c unless c is still busy with an earlier frame, counting
+// the outcome against the session.
+func offer(c chan<- ImageBundle, s *Session, b ImageBundle) {
+	select {
+	case c <- b:
+		s.countSent()
+	default:
+		s.countDropped()
+	}
+}
+
+var sessions = NewSessions()
+
+// Sessions tracks every open stream.
+type Sessions struct {
+	mu       sync.Mutex
+	lastID   uint64
+	sessions map[uint64]*Session
+	geo      *GeoStats
+}
+
+func NewSessions() *Sessions {
+	return &Sessions{sessions: make(map[uint64]*Session)}
+}
+
+// Open records a session for the request; call the returned func when the
+// stream ends.
+func (ss *Sessions) Open(r *http.Request) (*Session, func()) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.lastID++
+	s := &Session{
+		ID:         ss.lastID,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		JoinedAt:   time.Now(),
+	}
+	ss.sessions[s.ID] = s
+	if ss.geo != nil {
+		s.country = ss.geo.Join(r.RemoteAddr)
+	}
+	return s, func() {
+		ss.mu.Lock()
+		delete(ss.sessions, s.ID)
+		if ss.geo != nil {
+			ss.geo.Leave(s.country)
+		}
+		ss.mu.Unlock()
+	}
+}
+
+type sessionJSON struct {
+	ID         uint64    `json:"id"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Format     string    `json:"format"`
+	RemoteAddr string    `json:"remoteAddr"`
+	UserAgent  string    `json:"userAgent"`
+	JoinedAt   time.Time `json:"joinedAt"`
+	Sent       uint64    `json:"sent"`
+	Dropped    uint64    `json:"dropped"`
+}
+
+func (ss *Sessions) List() []sessionJSON {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	list := make([]sessionJSON, 0, len(ss.sessions))
+	for _, s := range ss.sessions {
+		list = append(list, sessionJSON{
+			ID:         s.ID,
+			Path:       s.Path,
+			Query:      s.Query,
+			Format:     s.Format,
+			RemoteAddr: s.RemoteAddr,
+			UserAgent:  s.UserAgent,
+			JoinedAt:   s.JoinedAt,
+			Sent:       atomic.LoadUint64(&s.sent),
+			Dropped:    atomic.LoadUint64(&s.dropped),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (ss *Sessions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ss.List()); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shareIDBytes is how many random bytes make up a snapshot ID, eight
+// characters once encoded.
+const shareIDBytes = 6
+
+// Snapshot is a room's board frozen at one generation, along with what it
+// takes to carry on from it.
+type Snapshot struct {
+	ID         string    `json:"id"`
+	Room       string    `json:"room"`
+	Generation uint64    `json:"generation"`
+	Rule       Rule      `json:"rule"`
+	States     uint8     `json:"states,omitempty"`
+	Topology   Topology  `json:"topology,omitempty"`
+	Grid       Grid      `json:"grid,omitempty"`
+	Scale      int       `json:"scale"`
+	Board      Pattern   `json:"board"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+}
+
+func (s *Snapshot) board() Board {
+	b := make(Board, s.Board.W)
+	for i := range b {
+		b[i] = make([]bool, s.Board.H)
+	}
+	b.Stamp(s.Board, 0, 0)
+	return b
+}
+
+// options are those of the live room resuming from the snapshot, which
+// carries on from its board and generation.
+func (s *Snapshot) options() RoomOptions {
+	return RoomOptions{
+		Width: s.Board.W, Height: s.Board.H, Scale: s.Scale, Rule: s.Rule, States: s.States, Topology: s.Topology, Grid: s.Grid,
+		Resume: s.board(), ResumeAt: s.Generation,
+	}
+}
+
+// room names the live room resuming from the snapshot.
+func (s *Snapshot) room() string {
+	return "share-" + s.ID
+}
+
+// snapshotsKey is the Storage key shared snapshots are kept under.
+const snapshotsKey = "snapshots"
+
+// SnapshotStore keeps shared snapshots for ttl, saving them to its Storage,
+// if it has one, after they change. Once it holds capacity snapshots, sharing
+// another drops the one closest to expiring.
+type SnapshotStore struct {
+	task *Task
+
+	mu       sync.Mutex
+	storage  Storage
+	ttl      time.Duration
+	capacity int
+	snaps    map[string]*Snapshot
+	dirty    bool
+}
+
+func NewSnapshotStore(st Storage, ttl time.Duration, capacity int) (*SnapshotStore, error) {
+	s := &SnapshotStore{storage: st, ttl: ttl, capacity: capacity, snaps: make(map[string]*Snapshot)}
+	if st != nil {
+		data, err := st.Get(snapshotsKey)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			var snaps []*Snapshot
+			if err := json.Unmarshal(data, &snaps); err != nil {
+				return nil, fmt.Errorf("%s: %w", snapshotsKey, err)
+			}
+			for _, snap := range snaps {
+				s.snaps[snap.ID] = snap
+			}
+		}
+	}
+	s.Start()
+	return s, nil
+}
+
+// Start drops expired snapshots and saves any changes every minute.
+func (s *SnapshotStore) Start() {
+	s.task = scheduler.Every(time.Minute, func() {
+		s.mu.Lock()
+		now := time.Now()
+		for id, snap := range s.snaps {
+			if now.After(snap.Expires) {
+				delete(s.snaps, id)
+				s.dirty = true
+			}
+		}
+		s.mu.Unlock()
+		if err := s.Save(); err != nil {
+			fmt.Println(err)
+		}
+	})
+}
+
+func (s *SnapshotStore) Close() {
+	s.task.Stop()
+	if err := s.Save(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// Save writes the snapshots to the store's Storage if they changed since it
+// last did.
+func (s *SnapshotStore) Save() error {
+	s.mu.Lock()
+	if s.storage == nil || !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	snaps := make([]*Snapshot, 0, len(s.snaps))
+	for _, snap := range s.snaps {
+		snaps = append(snaps, snap)
+	}
+	data, err := json.Marshal(snaps)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.storage.Put(snapshotsKey, data)
+}
+
+// Put freezes the room's latest generation under a new ID.
+func (s *SnapshotStore) Put(room *GameRender) (*Snapshot, error) {
+	id := make([]byte, shareIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	latest := room.history.Latest()
+	now := time.Now().Truncate(time.Second)
+	snap := &Snapshot{
+		ID:         base64.RawURLEncoding.EncodeToString(id),
+		Room:       room.name,
+		Generation: latest.Number,
+		Rule:       room.Rule(),
+		States:     room.opts.States,
+		Topology:   room.opts.Topology,
+		Grid:       room.opts.Grid,
+		Scale:      room.opts.Scale,
+		Board:      latest.Board.Pattern(),
+		Created:    now,
+		Expires:    now.Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.snaps) >= s.capacity {
+		var first *Snapshot
+		for _, old := range s.snaps {
+			if first == nil || old.Expires.Before(first.Expires) {
+				first = old
+			}
+		}
+		delete(s.snaps, first.ID)
+	}
+	s.snaps[snap.ID] = snap
+	s.dirty = true
+	return snap, nil
+}
+
+// Get returns the snapshot with the given ID unless it has expired.
+func (s *SnapshotStore) Get(id string) (*Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snaps[id]
+	if !ok || time.Now().After(snap.Expires) {
+		return nil, false
+	}
+	return snap, true
+}
+
+type shareJSON struct {
+	ID      string    `json:"id"`
+	URL     string    `json:"url"`
+	Image   string    `json:"image"`
+	Live    string    `json:"live"`
+	Expires time.Time `json:"expires"`
+}
+
+var sharePage = template.Must(template.New("share").Parse(`<html>
+<meta charset="utf-8">
+<title>Game of Life: {{.Room}} at generation {{.Generation}}</title>
+<meta property="og:title" content="Game of Life: {{.Room}} at generation {{.Generation}}">
+<meta property="og:image" content="{{.Image}}">
+<meta name="twitter:card" content="summary_large_image">
+
+<body>
+<h1>{{.Room}} at generation {{.Generation}}</h1>
+<img style="border:2px solid black" src="/share/{{.ID}}.png"/>
+<h2>Resume from here</h2>
+<img style="border:2px solid black" src="/share/{{.ID}}/live"/>
+</body>
+</html>
+`))
+
+// ShareHandler freezes rooms into snapshots for POST /share and serves
+// them: /share/ID is a permalink page, /share/ID.png and /share/ID.svg the
+// frozen board, and /share/ID/live a stream of a room of its own carrying on
+// from it, started on first request.
+type ShareHandler struct {
+	store *SnapshotStore
+	rooms *Rooms
+}
+
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+func (h *ShareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/share" {
+		h.share(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/share/")
+	id, format := rest, ""
+	switch {
+	case strings.HasSuffix(rest, "/live"):
+		id, format = strings.TrimSuffix(rest, "/live"), "live"
+	case strings.HasSuffix(rest, ".png"):
+		id, format = strings.TrimSuffix(rest, ".png"), "png"
+	case strings.HasSuffix(rest, ".svg"):
+		id, format = strings.TrimSuffix(rest, ".svg"), "svg"
+	}
+	snap, ok := h.store.Get(id)
+	if !ok {
+		writeError(w, r, &requestError{status: http.StatusNotFound, msg: fmt.Sprintf("no snapshot %q", id)})
+		return
+	}
+	switch format {
+	case "":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		page := struct {
+			*Snapshot
+			Image string
+		}{snap, absoluteURL(r, "/share/"+snap.ID+".png")}
+		if err := sharePage.Execute(w, page); err != nil {
+			fmt.Println(err)
+		}
+	case "live":
+		h.resume(w, r, snap)
+	default:
+		st, err := styleParam(r, Style{Scale: snap.Scale})
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		bundle, err := Encode(format, Frame{Board: snap.board(), Rule: snap.Rule, Topology: snap.Topology, Grid: snap.Grid}, st)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", bundle.ContentType)
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(time.Until(snap.Expires).Seconds())))
+		if _, err := w.Write(bundle.Data); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// share freezes the room the request refers to.
+func (h *ShareHandler) share(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	room, err := h.rooms.Lookup(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	snap, err := h.store.Put(room)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/share/"+snap.ID)
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(shareJSON{
+		ID:      snap.ID,
+		URL:     "/share/" + snap.ID,
+		Image:   "/share/" + snap.ID + ".png",
+		Live:    "/share/" + snap.ID + "/live",
+		Expires: snap.Expires.UTC(),
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// resume starts the snapshot's room, carrying on from its board and
+// generation, unless it is already running, and sends the client to its
+// stream. Like any room it is reaped once idle, and started afresh from the
+// snapshot on the next request while the snapshot lasts.
+func (h *ShareHandler) resume(w http.ResponseWriter, r *http.Request, snap *Snapshot) {
+	if _, err := h.rooms.Get(snap.room(), snap.options()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/game.svg?room="+snap.room(), http.StatusFound)
+}
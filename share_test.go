@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShareRoundTrip(t *testing.T) {
+	rs := NewRooms(Limits{MaxWidth: 100, MaxHeight: 100, MaxScale: 10, MemoryBudget: 1 << 30}, GameConfig{History: 8})
+	defer rs.Close()
+	st := &FileStorage{Dir: t.TempDir()}
+	store, err := NewSnapshotStore(st, time.Hour, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &ShareHandler{store: store, rooms: rs}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/share?w=20&h=10&scale=2&rule=brianbrain&topology=torus", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /share = %d: %s", w.Code, w.Body)
+	}
+	var resp shareJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if loc := w.Header().Get("Location"); loc != resp.URL || resp.URL != "/share/"+resp.ID {
+		t.Errorf("Location %s and url %s, want /share/%s", loc, resp.URL, resp.ID)
+	}
+	want, ok := store.Get(resp.ID)
+	if !ok {
+		t.Fatalf("snapshot %s was not kept", resp.ID)
+	}
+	store.Close()
+
+	// The snapshot survives a restart and resumes where it was taken.
+	again, err := NewSnapshotStore(st, time.Hour, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	h.store = again
+	snap, ok := again.Get(resp.ID)
+	if !ok {
+		t.Fatalf("snapshot %s was lost", resp.ID)
+	}
+	if !snap.Created.Equal(want.Created) || !snap.Expires.Equal(want.Expires) {
+		t.Errorf("snapshot times came back as %v to %v, want %v to %v", snap.Created, snap.Expires, want.Created, want.Expires)
+	}
+	snap.Created, snap.Expires = want.Created, want.Expires
+	if !reflect.DeepEqual(snap, want) {
+		t.Fatalf("snapshot came back as %+v, want %+v", snap, want)
+	}
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{resp.URL, http.StatusOK, "text/html; charset=utf-8"},
+		{resp.Image, http.StatusOK, "image/png"},
+		{resp.URL + ".svg", http.StatusOK, "image/svg+xml"},
+		{resp.Live, http.StatusFound, ""},
+		{"/share/nope.png", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status || (tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType) {
+			t.Errorf("GET %s = %d %s, want %d %s", tt.path, w.Code, w.Header().Get("Content-Type"), tt.status, tt.contentType)
+		}
+	}
+	room, ok := rs.Find(snap.room())
+	if !ok {
+		t.Fatalf("no room %s after resuming", snap.room())
+	}
+	first, ok := room.history.Find(func(g Generation) bool { return g.Number == snap.Generation })
+	if !ok || !reflect.DeepEqual(first.Board, snap.board()) {
+		t.Errorf("room did not resume at generation %d from the snapshot's board", snap.Generation)
+	}
+	if room.opts.Rule != snap.Rule || room.opts.States != 3 || room.opts.Topology != Torus || room.opts.Scale != 2 {
+		t.Errorf("room resumed with %+v", room.opts)
+	}
+}
+
+func TestSnapshotStoreLimits(t *testing.T) {
+	rs := NewRooms(Limits{MaxWidth: 100, MaxHeight: 100, MaxScale: 10, MemoryBudget: 1 << 30}, GameConfig{History: 8})
+	defer rs.Close()
+	room, _ := rs.Get(defaultRoom, RoomOptions{})
+	store, err := NewSnapshotStore(nil, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		snap, err := store.Put(room)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Each expires a little later than the one before.
+		snap.Expires = snap.Expires.Add(time.Duration(i) * time.Second)
+		ids = append(ids, snap.ID)
+	}
+	for i, want := range []bool{false, true, true} {
+		if _, ok := store.Get(ids[i]); ok != want {
+			t.Errorf("snapshot %d kept %v, want %v", i, ok, want)
+		}
+	}
+	snap, _ := store.Get(ids[1])
+	snap.Expires = time.Now().Add(-time.Second)
+	if _, ok := store.Get(ids[1]); ok {
+		t.Error("expired snapshot was served")
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A showcase view is showcaseWidth by showcaseHeight cells drawn
+// showcaseScale pixels wide. As a pattern grows, each cell stands for a larger
+// square of the plane.
+const (
+	showcaseWidth  = 160
+	showcaseHeight = 120
+	showcaseScale  = 4
+)
+
+// showcaseFileStep is how many generations, as a power of two, a pattern
+// loaded from the showcase directory advances per tick.
+const showcaseFileStep = 10
+
+type showcaseSpec struct {
+	name        string
+	description string
+	pattern     Pattern
+	step        uint
+}
+
+var showcaseSpecs = []showcaseSpec{
+	{
+		name:        "switch-engine",
+		description: "a 5x5 seed that becomes a block-laying switch engine, a puffer that grows forever",
+		pattern:     mustParseRLE("x = 5, y = 5\n3obo$o$3b2o$b2obo$obobo!"),
+		step:        6,
+	},
+	{
+		name:        "one-line-growth",
+		description: "a single row of 39 cells that turns into a pair of block-laying switch engines",
+		pattern:     mustParseRLE("x = 39, y = 1\n8ob5o3b3o6b7ob5o!"),
+		step:        6,
+	},
+	{
+		name:        "gosper-glider-gun",
+		description: "the first known gun, firing a glider every 30 generations",
+		pattern:     patterns["gosper-glider-gun"],
+		step:        4,
+	},
+	{
+		name:        "acorn",
+		description: "a 7-cell methuselah that takes 5206 generations to settle",
+		pattern:     patterns["acorn"],
+		step:        3,
+	},
+}
+
+// Showcase runs one famous construction on an unbounded plane with HashLife,
+// streaming a view that zooms out to keep the whole pattern in frame.
+type Showcase struct {
+	name        string
+	description string
+	task        *Task
+
+	mu          sync.Mutex
+	life        *HashLife
+	subscribers map[chan<- ImageBundle]*Session
+}
+
+func NewShowcase(name, description string, life *HashLife) *Showcase {
+	sc := &Showcase{
+		name:        name,
+		description: description,
+		life:        life,
+		subscribers: make(map[chan<- ImageBundle]*Session),
+	}
+	sc.task = scheduler.NewTask(time.Second, sc.tick)
+	sc.Start()
+	return sc
+}
+
+func (sc *Showcase) Start() {
+	sc.task.Start()
+}
+
+func (sc *Showcase) Close() {
+	sc.task.Stop()
+}
+
+// tick advances the pattern one HashLife step and streams it, pausing while
+// nobody watches.
+func (sc *Showcase) tick() {
+	if d := budget.Interval(time.Second); d != sc.task.Interval() {
+		sc.task.SetInterval(d)
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if len(sc.subscribers) == 0 {
+		sc.task.Pause()
+		return
+	}
+
+	defer budget.Track(time.Now())
+	sc.life.Step()
+	data, err := sc.frame().Svg(Style{Scale: showcaseScale})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	bundle := ImageBundle{
+		Data:        data,
+		ContentType: "image/svg+xml",
+		Generation:  sc.life.Generation(),
+		Population:  sc.life.Population(),
+		Time:        time.Now(),
+	}
+	for ch, s := range sc.subscribers {
+		offer(ch, s, bundle)
+	}
+}
+
+// frame renders the view that fits the whole pattern at the smallest zoom.
+func (sc *Showcase) frame() Frame {
+	h := sc.life
+	coarse := uint(0)
+	if h.root.level > 10 {
+		coarse = h.root.level - 10
+	}
+	x0, y0, x1, y1, ok := h.Bounds(coarse)
+	if !ok {
+		x0, y0, x1, y1 = 0, 0, 1, 1
+	}
+	zoom := coarse
+	for zoom > 0 && x1-x0 <= showcaseWidth<<(zoom-1) && y1-y0 <= showcaseHeight<<(zoom-1) {
+		zoom--
+	}
+	for x1-x0 > showcaseWidth<<zoom || y1-y0 > showcaseHeight<<zoom {
+		zoom++
+	}
+	x := (x0+x1)/2 - showcaseWidth<<zoom/2
+	y := (y0+y1)/2 - showcaseHeight<<zoom/2
+	return Frame{
+		Board:   h.Board(x, y, showcaseWidth, showcaseHeight, zoom),
+		Rule:    h.rule,
+		Caption: fmt.Sprintf("gen %d pop %d 1:%d", h.Generation(), h.Population(), 1<<zoom),
+	}
+}
+
+func (sc *Showcase) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat("svg")
+	leave := viewerCounts.Join(s, "showcase/"+sc.name)
+	sc.mu.Lock()
+	sc.subscribers[c] = s
+	sc.task.Resume()
+	sc.mu.Unlock()
+	return func() {
+		sc.mu.Lock()
+		delete(sc.subscribers, c)
+		sc.mu.Unlock()
+		leave()
+	}
+}
+
+// Showcases holds the curated showcase rooms by name.
+type Showcases struct {
+	byName map[string]*Showcase
+}
+
+// LoadShowcases starts the built-in showcases along with one for every .mc
+// and .rle file in dir, if given, so constructions too large to ship, like
+// breeders or the Gemini spaceship, can be added from a pattern collection.
+func LoadShowcases(dir string) (*Showcases, error) {
+	scs := &Showcases{byName: make(map[string]*Showcase)}
+	for _, spec := range showcaseSpecs {
+		life := NewHashLife(Conway, spec.step)
+		life.Stamp(spec.pattern, 0, 0)
+		scs.byName[spec.name] = NewShowcase(spec.name, spec.description, life)
+	}
+	if dir == "" {
+		return scs, nil
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		scs.Close()
+		return nil, err
+	}
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || (ext != ".mc" && ext != ".rle") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			scs.Close()
+			return nil, err
+		}
+		life, err := loadShowcaseFile(ext, string(data))
+		if err != nil {
+			scs.Close()
+			return nil, fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		name := strings.TrimSuffix(f.Name(), ext)
+		if old, ok := scs.byName[name]; ok {
+			old.Close()
+		}
+		scs.byName[name] = NewShowcase(name, "loaded from "+f.Name(), life)
+	}
+	return scs, nil
+}
+
+func loadShowcaseFile(ext, data string) (*HashLife, error) {
+	if ext == ".mc" {
+		return ParseMacrocell(data, showcaseFileStep)
+	}
+	p, err := ParseRLE(data)
+	if err != nil {
+		return nil, err
+	}
+	life := NewHashLife(Conway, showcaseFileStep)
+	life.Stamp(p, -int64(p.W/2), -int64(p.H/2))
+	return life, nil
+}
+
+func (scs *Showcases) Close() {
+	for _, sc := range scs.byName {
+		sc.Close()
+	}
+}
+
+// Handle serves /showcase/{name}.svg.
+func (scs *Showcases) Handle(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/showcase/")
+	sc, ok := scs.byName[strings.TrimSuffix(name, ".svg")]
+	if !ok || !strings.HasSuffix(name, ".svg") {
+		writeError(w, r, &requestError{status: http.StatusNotFound, msg: fmt.Sprintf("no showcase %q", name)})
+		return
+	}
+	streamHandleFunc(sc)(w, r)
+}
+
+type showcaseJSON struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Generation  uint64 `json:"generation"`
+	Population  int    `json:"population"`
+	StepSize    uint64 `json:"stepSize"`
+}
+
+// ServeHTTP lists the showcases.
+func (scs *Showcases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := []showcaseJSON{}
+	for _, sc := range scs.byName {
+		sc.mu.Lock()
+		resp = append(resp, showcaseJSON{
+			Name:        sc.name,
+			Description: sc.description,
+			Generation:  sc.life.Generation(),
+			Population:  sc.life.Population(),
+			StepSize:    sc.life.StepSize(),
+		})
+		sc.mu.Unlock()
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].Name < resp[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// signedPaths are the snapshot endpoints a URLSigner guards.
+var signedPaths = map[string]bool{
+	"/next":          true,
+	"/replay":        true,
+	"/thumbnail.png": true,
+	"/board.pdf":     true,
+	"/board.eps":     true,
+	"/board.ico":     true,
+	"/plot.svg":      true,
+	"/sprites.png":   true,
+}
+
+// maxSignedTTL bounds how long a signed URL /admin/sign hands out stays valid.
+const maxSignedTTL = 365 * 24 * time.Hour
+
+// URLSigner lets operators hand out snapshot URLs with parameters of their
+// choosing, like sizes and themes, without letting anyone render anything:
+// a snapshot request's parameters only count when its sig= is the HMAC of
+// its path and the rest of its query, which must include an expires= Unix
+// time still to come. Requests without a signature render with no
+// parameters at all.
+type URLSigner struct {
+	signer cookieSigner
+}
+
+func NewURLSigner(key string) *URLSigner {
+	return &URLSigner{signer: cookieSigner{key: []byte(key)}}
+}
+
+// message is what a URL's signature covers: its path and its query without
+// sig=, in canonical order.
+func (s *URLSigner) message(path string, q url.Values) string {
+	q = copyValues(q)
+	q.Del("sig")
+	return path + "?" + q.Encode()
+}
+
+func copyValues(q url.Values) url.Values {
+	c := make(url.Values, len(q))
+	for k, v := range q {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// Sign returns path with query, valid until expires.
+func (s *URLSigner) Sign(path string, q url.Values, expires time.Time) string {
+	q = copyValues(q)
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", s.signer.mac(s.message(path, q)))
+	return path + "?" + q.Encode()
+}
+
+func (s *URLSigner) verify(path string, q url.Values) error {
+	if !hmac.Equal([]byte(q.Get("sig")), []byte(s.signer.mac(s.message(path, q)))) {
+		return &requestError{status: http.StatusForbidden, msg: "invalid signature"}
+	}
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return &requestError{status: http.StatusForbidden, msg: "signature expired"}
+	}
+	return nil
+}
+
+// Middleware checks the signatures of snapshot requests, and drops the
+// parameters of those without one.
+func (s *URLSigner) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !signedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("sig") != "" {
+			if err := s.verify(r.URL.Path, q); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.RawQuery = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+type signJSON struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// ServeHTTP signs ?url=, a snapshot path with its query, for /admin/sign,
+// valid for ?ttl= (a day by default).
+func (s *URLSigner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := url.Parse(r.URL.Query().Get("url"))
+	if err != nil || !signedPaths[u.Path] {
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("url must be a snapshot path, not %q", r.URL.Query().Get("url"))})
+		return
+	}
+	ttl := 24 * time.Hour
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 || ttl > maxSignedTTL {
+			writeError(w, r, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid ttl %q", v)})
+			return
+		}
+	}
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(signJSON{URL: s.Sign(u.Path, u.Query(), expires), Expires: expires.UTC()}); err != nil {
+		fmt.Println(err)
+	}
+}
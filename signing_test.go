@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	s := NewURLSigner("secret")
+	q := url.Values{"w": {"40"}, "theme": {"dark"}}
+	valid := s.Sign("/thumbnail.png", q, time.Now().Add(time.Hour))
+	expired := s.Sign("/thumbnail.png", q, time.Now().Add(-time.Second))
+	tests := []struct {
+		name string
+		url  string
+		want string // the query the handler sees, or an error
+	}{
+		{"valid", valid, "40"},
+		{"unsigned", "/thumbnail.png?w=40", ""},
+		{"unguarded path", "/game.svg?w=40", "40"},
+		{"expired", expired, "signature expired"},
+		{"tampered parameter", strings.Replace(valid, "w=40", "w=4000", 1), "invalid signature"},
+		{"added parameter", valid + "&h=4000", "invalid signature"},
+		{"moved expiry", strings.Replace(expired, "expires=", "expires=9", 1), "invalid signature"},
+		{"other path", strings.Replace(valid, "/thumbnail.png", "/board.pdf", 1), "invalid signature"},
+		{"other key", NewURLSigner("guess").Sign("/thumbnail.png", q, time.Now().Add(time.Hour)), "invalid signature"},
+	}
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("w")))
+	}))
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if got := w.Body.String(); !strings.Contains(got, tt.want) || (tt.want == "" && got != "") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if strings.Contains(tt.want, "signature") && w.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestURLSignerHandler(t *testing.T) {
+	s := NewURLSigner("secret")
+	tests := []struct {
+		query  string
+		status int
+		ttl    time.Duration
+	}{
+		{"url=" + url.QueryEscape("/next?w=40"), http.StatusOK, 24 * time.Hour},
+		{"url=" + url.QueryEscape("/next?w=40") + "&ttl=1h", http.StatusOK, time.Hour},
+		{"url=" + url.QueryEscape("/game.svg?w=40"), http.StatusBadRequest, 0},
+		{"url=" + url.QueryEscape("/next") + "&ttl=-1h", http.StatusBadRequest, 0},
+		{"url=" + url.QueryEscape("/next") + "&ttl=9000h", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/sign?"+tt.query, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.query, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var resp signJSON
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Until(resp.Expires); d > tt.ttl || d < tt.ttl-time.Minute {
+			t.Errorf("%s: expires in %v, want %v", tt.query, d, tt.ttl)
+		}
+		u, err := url.Parse(resp.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.verify(u.Path, u.Query()); err != nil {
+			t.Errorf("%s: signed URL %s does not verify: %v", tt.query, resp.URL, err)
+		}
+	}
+}
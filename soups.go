@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// soupSearchGenerations is how long the searcher runs a soup waiting for
+	// it to settle; soups still chaotic by then score it as their lifespan.
+	soupSearchGenerations = 2000
+	// soupSearchInterval is how often the searcher tries another soup.
+	soupSearchInterval = 200 * time.Millisecond
+	// maxSoupKinds bounds how many kinds of room the searcher finds soups
+	// for.
+	maxSoupKinds = 8
+	// soupObjectWeight is how many generations of lifespan each kind of
+	// object left at the end is worth.
+	soupObjectWeight = 25
+)
+
+// SoupKind is what a soup is searched for: the options of the rooms it can
+// seed. It is comparable, so rooms that share it share a pool.
+type SoupKind struct {
+	Width    int      `json:"width"`
+	Height   int      `json:"height"`
+	Rule     Rule     `json:"rule"`
+	Topology Topology `json:"topology"`
+	Grid     Grid     `json:"grid"`
+	Density  float64  `json:"density"`
+	Symmetry Symmetry `json:"symmetry"`
+	Noise    float64  `json:"noise"`
+	Level    float64  `json:"level"`
+}
+
+// soupKind returns the kind of soup that reseeds the room.
+func (o RoomOptions) soupKind() SoupKind {
+	return SoupKind{Width: o.Width, Height: o.Height, Rule: o.rule(), Topology: o.topology(), Grid: o.grid(), Density: o.density(), Symmetry: o.symmetry(), Noise: o.Noise, Level: o.level()}
+}
+
+func (k SoupKind) options() RoomOptions {
+	return RoomOptions{Width: k.Width, Height: k.Height, Rule: k.Rule, Topology: k.Topology, Grid: k.Grid, Density: k.Density, Symmetry: k.Symmetry, Noise: k.Noise, Level: k.Level}
+}
+
+// SoupScore is a seed the searcher tried and how its soup turned out: how many
+// generations it stayed chaotic, its final population, and how many
+// different objects it left.
+type SoupScore struct {
+	Seed       int64   `json:"seed"`
+	Lifespan   uint64  `json:"lifespan"`
+	Population int     `json:"population"`
+	Objects    int     `json:"objects"`
+	Score      float64 `json:"score"`
+}
+
+// evaluate runs the soup seed lays out for k until it settles or
+// soupSearchGenerations pass, and scores it: its lifespan, plus
+// soupObjectWeight for each kind of object left, plus a generation for every
+// ten cells left alive.
+func (k SoupKind) evaluate(seed int64) SoupScore {
+	opts := k.options()
+	b := opts.soup(k.Width, k.Height, seed)
+	var cycles CycleDetector
+	cycles.Observe(0, b)
+	s := SoupScore{Seed: seed, Lifespan: soupSearchGenerations}
+	var spare Board
+	for gen := uint64(1); gen <= soupSearchGenerations; gen++ {
+		b, spare = opts.EvoluteInto(k.Rule, spare, b), b
+		cycles.Observe(gen, b)
+		if phase := cycles.Phase(); phase.Kind != PhaseChaotic {
+			s.Lifespan = phase.Since
+			break
+		}
+	}
+	s.Population = b.Population()
+	if s.Population > 0 {
+		shapes := make(map[objectShape]bool)
+		for _, o := range b.objects(k.Topology == Torus) {
+			shapes[o.shape] = true
+		}
+		s.Objects = len(shapes)
+	}
+	s.Score = float64(s.Lifespan) + soupObjectWeight*float64(s.Objects) + float64(s.Population)/10
+	return s
+}
+
+// soupPool is the best soups found for a kind, best first.
+type soupPool struct {
+	kind     SoupKind
+	soups    []SoupScore
+	searched int
+	taken    int
+}
+
+// SoupSearch evolves random soups in the background for every kind of room
+// that has asked for one, and keeps the best size of each kind in a ranked
+// pool for rooms to reseed from. It pauses while it has no kinds to search.
+type SoupSearch struct {
+	size int
+	task *Task
+	rng  *rand.Rand // only touched by task
+
+	mu    sync.Mutex
+	pools []*soupPool
+	next  int
+}
+
+func NewSoupSearch(size int) *SoupSearch {
+	s := &SoupSearch{size: size, rng: rand.New(rand.NewSource(rand.Int63()))}
+	s.task = scheduler.Every(soupSearchInterval, s.tick)
+	return s
+}
+
+func (s *SoupSearch) Close() {
+	s.task.Stop()
+}
+
+// Take removes the best soup found for k from its pool and returns its seed,
+// or reports false if there is none yet. Kinds are searched from the first
+// time they are asked for, up to maxSoupKinds of them.
+func (s *SoupSearch) Take(k SoupKind) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pools {
+		if p.kind != k {
+			continue
+		}
+		if len(p.soups) == 0 {
+			return 0, false
+		}
+		best := p.soups[0]
+		p.soups = p.soups[1:]
+		p.taken++
+		return best.Seed, true
+	}
+	if len(s.pools) < maxSoupKinds {
+		s.pools = append(s.pools, &soupPool{kind: k})
+		s.task.Resume()
+	}
+	return 0, false
+}
+
+// tick tries one more soup for the next kind in turn, keeping it if it ranks
+// among the best.
+func (s *SoupSearch) tick() {
+	if d := budget.Interval(soupSearchInterval); d != s.task.Interval() {
+		s.task.SetInterval(d)
+	}
+	if budget.Throttled() {
+		return
+	}
+	s.mu.Lock()
+	if len(s.pools) == 0 {
+		s.task.Pause()
+		s.mu.Unlock()
+		return
+	}
+	p := s.pools[s.next%len(s.pools)]
+	s.next++
+	s.mu.Unlock()
+
+	defer budget.Track(time.Now())
+	soup := p.kind.evaluate(s.rng.Int63())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.searched++
+	i := sort.Search(len(p.soups), func(i int) bool { return p.soups[i].Score < soup.Score })
+	if i >= s.size {
+		return
+	}
+	p.soups = append(p.soups, SoupScore{})
+	copy(p.soups[i+1:], p.soups[i:])
+	p.soups[i] = soup
+	if len(p.soups) > s.size {
+		p.soups = p.soups[:s.size]
+	}
+}
+
+type soupPoolJSON struct {
+	Kind     SoupKind    `json:"kind"`
+	Searched int         `json:"searched"`
+	Taken    int         `json:"taken"`
+	Soups    []SoupScore `json:"soups"`
+}
+
+// ServeHTTP lists each kind's pool for /soups.json.
+func (s *SoupSearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	resp := []soupPoolJSON{}
+	for _, p := range s.pools {
+		resp = append(resp, soupPoolJSON{Kind: p.kind, Searched: p.searched, Taken: p.taken, Soups: append([]SoupScore{}, p.soups...)})
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Println(err)
+	}
+}
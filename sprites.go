@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"strconv"
+)
+
+type spriteFrame struct {
+	Generation uint64 `json:"generation"`
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+}
+
+type spriteSheet struct {
+	From    uint64        `json:"from"`
+	Columns int           `json:"columns"`
+	Width   int           `json:"width"`
+	Height  int           `json:"height"`
+	Frames  []spriteFrame `json:"frames"`
+}
+
+// spriteRequest reads the sheet a request asks for: ?generations= frames
+// from ?from= (the latest generation by default), ?columns= to a row.
+func spriteRequest(room *GameRender, r *http.Request, limits ExportLimits) (spriteSheet, Style, error) {
+	st, err := styleParam(r, room.DefaultStyle())
+	if err != nil {
+		return spriteSheet{}, Style{}, err
+	}
+	n, err := intParam(r, "generations", 16)
+	if err != nil {
+		return spriteSheet{}, Style{}, err
+	}
+	if n < 1 || n > limits.MaxGenerations {
+		return spriteSheet{}, Style{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("generations must be between 1 and %d", limits.MaxGenerations)}
+	}
+	columns, err := intParam(r, "columns", 4)
+	if err != nil {
+		return spriteSheet{}, Style{}, err
+	}
+	if columns < 1 {
+		return spriteSheet{}, Style{}, &requestError{status: http.StatusBadRequest, msg: "columns must be positive"}
+	}
+	if columns > n {
+		columns = n
+	}
+	from, err := genParam(r, room, "from")
+	if err != nil {
+		return spriteSheet{}, Style{}, err
+	}
+
+	width, height := room.Size()
+	fw, fh := width*st.Scale, height*st.Scale
+	rows := (n + columns - 1) / columns
+	sheet := spriteSheet{From: from, Columns: columns, Width: fw * columns, Height: fh * rows}
+	if pixels := sheet.Width * sheet.Height; pixels > limits.MaxPixels {
+		return spriteSheet{}, Style{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("a sheet of %d pixels exceeds the export limit of %d", pixels, limits.MaxPixels)}
+	}
+	for i := 0; i < n; i++ {
+		sheet.Frames = append(sheet.Frames, spriteFrame{
+			Generation: from + uint64(i),
+			X:          fw * (i % columns),
+			Y:          fh * (i / columns),
+			Width:      fw,
+			Height:     fh,
+		})
+	}
+	return sheet, st, nil
+}
+
+// spritesHandleFunc serves consecutive generations tiled into one PNG.
+func spritesHandleFunc(limits ExportLimits) func(*GameRender, http.ResponseWriter, *http.Request) {
+	return func(room *GameRender, w http.ResponseWriter, r *http.Request) {
+		sheet, st, err := spriteRequest(room, r, limits)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		img := image.NewRGBA(image.Rect(0, 0, sheet.Width, sheet.Height))
+		i := 0
+		room.Frames(sheet.From, len(sheet.Frames), func(gen uint64, frame Frame) error {
+			sf := sheet.Frames[i]
+			draw.Draw(img, image.Rect(sf.X, sf.Y, sf.X+sf.Width, sf.Y+sf.Height), frame.image(st), image.Point{}, draw.Src)
+			i++
+			return nil
+		})
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("X-Sprite-From", strconv.FormatUint(sheet.From, 10))
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// spritesJSONHandleFunc describes where each frame of the matching sprite
+// sheet sits. Pass its from on to /sprites.png to get the same frames.
+func spritesJSONHandleFunc(limits ExportLimits) func(*GameRender, http.ResponseWriter, *http.Request) {
+	return func(room *GameRender, w http.ResponseWriter, r *http.Request) {
+		sheet, _, err := spriteRequest(room, r, limits)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(sheet); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
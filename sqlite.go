@@ -0,0 +1,8 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+// The SQLite driver behind -storage=sqlite:FILE. It needs cgo, so builds
+// without it, like the browser one, leave it out.
+import _ "github.com/mattn/go-sqlite3"
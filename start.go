@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Start is how a room lays out its first generation: Soup, or the name of a
+// built-in pattern alone on an empty board, centred or, written NAME@X,Y,
+// with its top-left corner at X, Y. A name of text:MESSAGE spells MESSAGE
+// instead of a pattern, and qr:TEXT draws the QR code of TEXT.
+type Start string
+
+const (
+	// Soup fills the board at random from the room's seed.
+	Soup Start = "soup"
+	// Replicator places HighLife's replicator in the middle of an empty
+	// board. A soup rarely contains one, but on its own it copies itself
+	// along the diagonals and fills the board with copies.
+	Replicator Start = "replicator"
+)
+
+// placement returns the pattern s places and where on a w by h board, or
+// reports false for a soup.
+func (s Start) placement(w, h int) (p Pattern, x, y int, ok bool) {
+	name, placed := string(s), false
+	if i := strings.LastIndexByte(name, '@'); i >= 0 {
+		if _, err := fmt.Sscanf(name[i+1:], "%d,%d", &x, &y); err == nil {
+			name, placed = name[:i], true
+		}
+	}
+	switch {
+	case strings.HasPrefix(name, textStart):
+		p, ok = TextPattern(name[len(textStart):], w, h)
+	case strings.HasPrefix(name, qrStart):
+		var err error
+		p, err = QRPattern(name[len(qrStart):], w, h)
+		ok = err == nil
+	default:
+		p, ok = patterns[name]
+	}
+	if !ok {
+		return Pattern{}, 0, 0, false
+	}
+	if !placed {
+		x, y = (w-p.W)/2, (h-p.H)/2
+	}
+	return p, x, y, true
+}
+
+// start is the room's Start: the one it was given, or else a replicator for
+// HighLife and a soup for any other rule.
+func (o RoomOptions) start() Start {
+	if o.Start != "" {
+		return o.Start
+	}
+	if o.rule() == HighLife {
+		return Replicator
+	}
+	return Soup
+}
+
+// seed returns the room's seed: the one it was given, else def mixed with the
+// room's name if def is not zero, else a random one.
+func (o RoomOptions) seed(name string, def int64) int64 {
+	switch {
+	case o.Seeded:
+		return o.Seed
+	case def != 0:
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		return def ^ int64(h.Sum64())
+	}
+	return rand.Int63()
+}
+
+// density is the room's Density: the one it was given, else defaultDensity.
+func (o RoomOptions) density() float64 {
+	if o.Density == 0 {
+		return defaultDensity
+	}
+	return o.Density
+}
+
+// board returns the room's first generation for seed, or the board it
+// resumes from.
+func (o RoomOptions) board(seed int64) Board {
+	if o.Resume != nil {
+		return o.Resume.Clone()
+	}
+	p, x, y, ok := o.start().placement(o.Width, o.Height)
+	if !ok {
+		return o.soup(o.Width, o.Height, seed)
+	}
+	b := make(Board, o.Width)
+	for i := range b {
+		b[i] = make([]bool, o.Height)
+	}
+	b.Stamp(p, x, y)
+	return b
+}
+
+// seedParam reads ?seed=, an integer, and reports whether there was one.
+func seedParam(r *http.Request) (int64, bool, error) {
+	s := r.URL.Query().Get("seed")
+	if s == "" {
+		return 0, false, nil
+	}
+	seed, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid seed %q, want an integer", s)}
+	}
+	return seed, true, nil
+}
+
+// densityParam reads ?density=, the share of a soup's cells that start alive.
+func densityParam(r *http.Request) (float64, error) {
+	s := r.URL.Query().Get("density")
+	if s == "" {
+		return 0, nil
+	}
+	d, err := strconv.ParseFloat(s, 64)
+	if err != nil || d <= 0 || d > 1 {
+		return 0, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid density %q, want more than 0 and at most 1", s)}
+	}
+	return d, nil
+}
+
+// startParam reads ?start=, soup or a built-in pattern, ?text=, a message to
+// spell, or ?qr=, text to draw the QR code of, which ?x= and ?y= place by its
+// top-left corner on a w by h board instead of centring it.
+func startParam(r *http.Request, w, h int) (Start, error) {
+	q := r.URL.Query()
+	s := Start(q.Get("start"))
+	var p Pattern
+	given := 0
+	for _, k := range []string{"start", "text", "qr"} {
+		if q.Get(k) != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return "", &requestError{status: http.StatusBadRequest, msg: "give one of start, text and qr"}
+	}
+	switch text, code := q.Get("text"), q.Get("qr"); {
+	case text != "":
+		text, tp, err := textParam(text, w, h)
+		if err != nil {
+			return "", err
+		}
+		s, p = Start(textStart+text), tp
+	case code != "":
+		qp, err := qrParam(code, w, h)
+		if err != nil {
+			return "", err
+		}
+		s, p = Start(qrStart+code), qp
+	case s == "" || s == Soup:
+		return s, nil
+	default:
+		var ok bool
+		if p, ok = patterns[string(s)]; !ok {
+			return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown start %q, want soup or one of %s", s, strings.Join(patternNames(), ", "))}
+		}
+	}
+	if q.Get("x") == "" && q.Get("y") == "" {
+		return s, nil
+	}
+	x, err := intParam(r, "x", (w-p.W)/2)
+	if err != nil {
+		return "", err
+	}
+	y, err := intParam(r, "y", (h-p.H)/2)
+	if err != nil {
+		return "", err
+	}
+	if x < 0 || y < 0 || x+p.W > w || y+p.H > h {
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("%s at %d,%d does not fit a %dx%d board", s, x, y, w, h)}
+	}
+	return Start(fmt.Sprintf("%s@%d,%d", s, x, y)), nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage keeps the blobs of state that outlive a restart, like viewer counts
+// and shared snapshots, each under a key of its own. Get returns an error
+// matching os.ErrNotExist for a key never stored.
+type Storage interface {
+	Get(key string) ([]byte, error)
+	Put(key string, data []byte) error
+	Close() error
+}
+
+// OpenStorage opens the storage spec names: a directory, "redis://" with an
+// optional password, database number and ?prefix= for its keys, or
+// "sqlite:" with the database's file. An empty spec is no storage at all.
+func OpenStorage(spec string) (Storage, error) {
+	switch {
+	case spec == "":
+		return nil, nil
+	case strings.HasPrefix(spec, "redis://"):
+		s, err := OpenRedisStorage(spec)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case strings.HasPrefix(spec, "sqlite:"):
+		s, err := OpenSQLStorage(sqliteDriver(), strings.TrimPrefix(spec, "sqlite:"))
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	dir := strings.TrimPrefix(spec, "file:")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStorage{Dir: dir}, nil
+}
+
+// FileStorage keeps each key in a file of its own: the path Files gives for
+// it, or key.json in Dir. Keys with neither are not kept.
+type FileStorage struct {
+	Dir   string
+	Files map[string]string
+}
+
+func (s *FileStorage) path(key string) string {
+	if p, ok := s.Files[key]; ok {
+		return p
+	}
+	if s.Dir == "" {
+		return ""
+	}
+	return filepath.Join(s.Dir, key+".json")
+}
+
+func (s *FileStorage) Get(key string) ([]byte, error) {
+	p := s.path(key)
+	if p == "" {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(p)
+}
+
+func (s *FileStorage) Put(key string, data []byte) error {
+	p := s.path(key)
+	if p == "" {
+		return nil
+	}
+	return writeFileAtomic(p, data)
+}
+
+func (s *FileStorage) Close() error {
+	return nil
+}
+
+// overrideStorage keeps the keys files has a path for in those files, and
+// the rest in Storage, or nowhere if it is nil.
+type overrideStorage struct {
+	Storage
+	files *FileStorage
+}
+
+func (s *overrideStorage) Get(key string) ([]byte, error) {
+	if _, ok := s.files.Files[key]; ok || s.Storage == nil {
+		return s.files.Get(key)
+	}
+	return s.Storage.Get(key)
+}
+
+func (s *overrideStorage) Put(key string, data []byte) error {
+	if _, ok := s.files.Files[key]; ok || s.Storage == nil {
+		return s.files.Put(key, data)
+	}
+	return s.Storage.Put(key, data)
+}
+
+func (s *overrideStorage) Close() error {
+	if s.Storage == nil {
+		return nil
+	}
+	return s.Storage.Close()
+}
+
+// writeFileAtomic replaces path with data, so readers never see it half
+// written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// redisTimeout bounds every Redis round trip.
+const redisTimeout = 5 * time.Second
+
+// RedisStorage keeps keys as Redis strings, under a prefix, over a single
+// connection it redials when it breaks.
+type RedisStorage struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func OpenRedisStorage(spec string) (*RedisStorage, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	s := &RedisStorage{addr: redisAddr(u), prefix: "gol:"}
+	if pw, ok := u.User.Password(); ok {
+		s.password = pw
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("bad redis database %q", db)
+		}
+	}
+	if p, ok := u.Query()["prefix"]; ok {
+		s.prefix = p[0]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// redisAddr is the host and port a redis:// URL names, on Redis's own port
+// if it names none.
+func redisAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "6379"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func (s *RedisStorage) dial() error {
+	conn, err := net.DialTimeout("tcp", s.addr, redisTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn, s.r = conn, bufio.NewReader(conn)
+	if s.password != "" {
+		if _, err := s.roundTrip("AUTH", []byte(s.password)); err != nil {
+			s.drop()
+			return err
+		}
+	}
+	if s.db != 0 {
+		if _, err := s.roundTrip("SELECT", []byte(strconv.Itoa(s.db))); err != nil {
+			s.drop()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RedisStorage) drop() {
+	s.conn.Close()
+	s.conn, s.r = nil, nil
+}
+
+// errRedisNil is Redis's reply for a missing key.
+var errRedisNil = fmt.Errorf("redis: %w", os.ErrNotExist)
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// roundTrip sends a command and reads its reply, a simple string or bulk
+// string; integers and arrays are not needed.
+func (s *RedisStorage) roundTrip(cmd string, args ...[]byte) ([]byte, error) {
+	var req []byte
+	req = append(req, "*"+strconv.Itoa(len(args)+1)+"\r\n$"+strconv.Itoa(len(cmd))+"\r\n"+cmd+"\r\n"...)
+	for _, a := range args {
+		req = append(req, "$"+strconv.Itoa(len(a))+"\r\n"...)
+		req = append(req, a...)
+		req = append(req, "\r\n"...)
+	}
+	if err := s.conn.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := s.conn.Write(req); err != nil {
+		return nil, err
+	}
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, redisError("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, redisError("bad reply " + line)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(s.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, redisError("unexpected reply " + line)
+}
+
+// do runs a command, redialling first if the connection broke last time.
+// Replies from Redis itself are not retried.
+func (s *RedisStorage) do(cmd string, args ...[]byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := s.roundTrip(cmd, args...)
+	var re redisError
+	if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.As(err, &re) {
+		s.drop()
+	}
+	return reply, err
+}
+
+func (s *RedisStorage) Get(key string) ([]byte, error) {
+	return s.do("GET", []byte(s.prefix+key))
+}
+
+func (s *RedisStorage) Put(key string, data []byte) error {
+	_, err := s.do("SET", []byte(s.prefix+key), data)
+	return err
+}
+
+func (s *RedisStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.drop()
+	}
+	return nil
+}
+
+// sqliteDriver is the name of the SQLite driver the binary was built with,
+// if it was built with cgo.
+func sqliteDriver() string {
+	for _, d := range sql.Drivers() {
+		if d == "sqlite3" || d == "sqlite" {
+			return d
+		}
+	}
+	return ""
+}
+
+// SQLStorage keeps keys in a table of a SQL database.
+type SQLStorage struct {
+	db *sql.DB
+}
+
+// OpenSQLStorage opens the database and creates its table if needed. The
+// SQLite driver, linked in by sqlite.go, needs cgo.
+func OpenSQLStorage(driver, dsn string) (*SQLStorage, error) {
+	if driver == "" {
+		return nil, errors.New("sqlite storage needs a SQLite driver: build with cgo enabled")
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS storage (key TEXT PRIMARY KEY, data BLOB NOT NULL)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLStorage{db: db}, nil
+}
+
+func (s *SQLStorage) Get(key string) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM storage WHERE key = ?`, key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%s: %w", key, os.ErrNotExist)
+	}
+	return data, err
+}
+
+func (s *SQLStorage) Put(key string, data []byte) error {
+	_, err := s.db.Exec(`INSERT INTO storage (key, data) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET data = excluded.data`, key, data)
+	return err
+}
+
+func (s *SQLStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRoundTrip puts two values under a key of s in turn, checking each
+// comes back, and that a key never put is missing.
+func testRoundTrip(t *testing.T, s Storage) {
+	t.Helper()
+	if _, err := s.Get("snapshots"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Get of a missing key: got %v, want os.ErrNotExist", err)
+	}
+	for _, data := range []string{`{"a":1}`, `{"a":2}`} {
+		if err := s.Put("snapshots", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Get("snapshots")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("Get after Put(%s): got %s", data, got)
+		}
+	}
+}
+
+func TestFileStorageRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	s, err := OpenStorage("file:" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRoundTrip(t, s)
+	if data, err := os.ReadFile(filepath.Join(dir, "snapshots.json")); err != nil || string(data) != `{"a":2}` {
+		t.Errorf("snapshots.json holds %s, %v", data, err)
+	}
+
+	// Files override the directory for their keys, and keys with neither
+	// are not kept.
+	viewers := filepath.Join(t.TempDir(), "viewers.json")
+	s = &FileStorage{Files: map[string]string{"viewers": viewers}}
+	if err := s.Put("viewers", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(viewers); err != nil || string(data) != "{}" {
+		t.Errorf("viewers file holds %s, %v", data, err)
+	}
+	if err := s.Put("snapshots", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("snapshots"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get of a key with no file: got %v, want os.ErrNotExist", err)
+	}
+}
+
+// fakeRedis answers the few commands RedisStorage sends, over RESP, keeping
+// each database's keys in memory.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu    sync.Mutex
+	keys  map[string]string // by database and key, as "db key"
+	conns []net.Conn
+}
+
+func newFakeRedis(t *testing.T, network, addr, password string) *fakeRedis {
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	f := &fakeRedis{ln: ln, password: password, keys: make(map[string]string)}
+	t.Cleanup(func() {
+		ln.Close()
+		f.hangUp()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// hangUp closes every connection, as a restarting server would.
+func (f *fakeRedis) hangUp() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	authed, db := f.password == "", "0"
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH" && len(args) == 2:
+			authed = args[1] == f.password
+			reply = "+OK"
+			if !authed {
+				reply = "-WRONGPASS invalid password"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required."
+		case cmd == "SELECT" && len(args) == 2:
+			db, reply = args[1], "+OK"
+		case cmd == "SET" && len(args) == 3:
+			f.mu.Lock()
+			f.keys[db+" "+args[1]] = args[2]
+			f.mu.Unlock()
+			reply = "+OK"
+		case cmd == "GET" && len(args) == 2:
+			f.mu.Lock()
+			v, ok := f.keys[db+" "+args[1]]
+			f.mu.Unlock()
+			reply = "$-1"
+			if ok {
+				reply = "$" + strconv.Itoa(len(v)) + "\r\n" + v
+			}
+		default:
+			reply = "-ERR unknown command"
+		}
+		if _, err := io.WriteString(conn, reply+"\r\n"); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, errors.New("bad command")
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func TestRedisStorageRoundTrip(t *testing.T) {
+	f := newFakeRedis(t, "tcp", "127.0.0.1:0", "secret")
+	s, err := OpenStorage("redis://:secret@" + f.ln.Addr().String() + "/2?prefix=test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testRoundTrip(t, s)
+	f.mu.Lock()
+	got := f.keys["2 test:snapshots"]
+	f.mu.Unlock()
+	if got != `{"a":2}` {
+		t.Errorf("server holds %q under test:snapshots in database 2", got)
+	}
+
+	// A dropped connection fails the command under way, and the next one
+	// redials.
+	f.hangUp()
+	s.Get("snapshots")
+	if data, err := s.Get("snapshots"); err != nil || string(data) != `{"a":2}` {
+		t.Errorf("Get after the server hung up: got %s, %v", data, err)
+	}
+
+	if _, err := OpenStorage("redis://:wrong@" + f.ln.Addr().String()); err == nil {
+		t.Error("opened with the wrong password")
+	}
+}
+
+func TestRedisStorageIPv6(t *testing.T) {
+	f := newFakeRedis(t, "tcp6", "[::1]:0", "")
+	s, err := OpenStorage("redis://" + f.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testRoundTrip(t, s)
+
+	for spec, want := range map[string]string{
+		"redis://[::1]":            "[::1]:6379",
+		"redis://[::1]:6380":       "[::1]:6380",
+		"redis://localhost":        "localhost:6379",
+		"redis://:pw@10.0.0.1:7/1": "10.0.0.1:7",
+	} {
+		u, err := url.Parse(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := redisAddr(u); got != want {
+			t.Errorf("%s dials %s, want %s", spec, got, want)
+		}
+	}
+}
+
+func TestSQLStorageRoundTrip(t *testing.T) {
+	if sqliteDriver() == "" {
+		t.Skip("built without cgo, so without the SQLite driver")
+	}
+	path := filepath.Join(t.TempDir(), "gol.db")
+	s, err := OpenStorage("sqlite:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRoundTrip(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The data outlives the connection.
+	s, err = OpenStorage("sqlite:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got, err := s.Get("snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"a":2}` {
+		t.Errorf("Get after reopening: got %s, want {\"a\":2}", got)
+	}
+}
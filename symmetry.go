@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Symmetry is how a room's soups mirror a random part of themselves. Ash from
+// symmetric soups keeps the symmetry, so they settle into tidier, more
+// striking shapes than plain ones.
+type Symmetry string
+
+const (
+	// NoSymmetry soups are random all over. It is the symmetry of the zero
+	// Symmetry.
+	NoSymmetry Symmetry = "none"
+	// TwoFold soups mirror their left half into their right.
+	TwoFold Symmetry = "2-fold"
+	// FourFold soups mirror their top-left quadrant into the other three.
+	FourFold Symmetry = "4-fold"
+	// Diagonal soups fill the largest square centred on the board, mirroring
+	// the half below its diagonal into the half above.
+	Diagonal Symmetry = "diagonal"
+)
+
+// apply makes the soup b symmetric in place and returns it.
+func (s Symmetry) apply(b Board) Board {
+	w, h := len(b), len(b[0])
+	switch s {
+	case TwoFold, FourFold:
+		for x := w - w/2; x < w; x++ {
+			copy(b[x], b[w-1-x])
+		}
+		if s == FourFold {
+			for x := range b {
+				for y := h - h/2; y < h; y++ {
+					b[x][y] = b[x][h-1-y]
+				}
+			}
+		}
+	case Diagonal:
+		n := w
+		if h < n {
+			n = h
+		}
+		x0, y0 := (w-n)/2, (h-n)/2
+		for x := range b {
+			for y := range b[x] {
+				i, j := x-x0, y-y0
+				switch {
+				case i < 0 || j < 0 || i >= n || j >= n:
+					b[x][y] = false
+				case j < i:
+					b[x][y] = b[x0+j][y0+i]
+				}
+			}
+		}
+	}
+	return b
+}
+
+// symmetry is the room's Symmetry, NoSymmetry if it was given none.
+func (o RoomOptions) symmetry() Symmetry {
+	if o.Symmetry == "" {
+		return NoSymmetry
+	}
+	return o.Symmetry
+}
+
+// soup returns a w by h soup of the room's density, noise and symmetry for
+// seed.
+func (o RoomOptions) soup(w, h int, seed int64) Board {
+	b := NewSoup(w, h, seed, o.density())
+	if o.Noise != 0 {
+		b = NoiseMask(b, seed, o.Noise, o.level())
+	}
+	return o.symmetry().apply(b)
+}
+
+func symmetryParam(r *http.Request) (Symmetry, error) {
+	switch s := Symmetry(r.URL.Query().Get("symmetry")); s {
+	case "", NoSymmetry, TwoFold, FourFold, Diagonal:
+		return s, nil
+	default:
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown symmetry %q, want none, 2-fold, 4-fold or diagonal", s)}
+	}
+}
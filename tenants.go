@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Quota limits what one API key may use. Zero means no limit.
+type Quota struct {
+	MaxRooms              int `json:"maxRooms"`
+	MaxArea               int `json:"maxArea"`
+	MaxViewers            int `json:"maxViewers"`
+	MaxMutationsPerMinute int `json:"maxMutationsPerMinute"`
+}
+
+// Tenant is the holder of an API key. Its rooms live in their own namespace.
+type Tenant struct {
+	Name  string `json:"name"`
+	Key   string `json:"key"`
+	Quota Quota  `json:"quota"`
+
+	mu        sync.Mutex
+	rooms     int
+	viewers   int
+	mutations float64 // tokens left in the mutation bucket
+	refilled  time.Time
+}
+
+// Tenants maps API keys to tenants, loaded from a JSON list.
+type Tenants struct {
+	byKey map[string]*Tenant
+}
+
+func LoadTenants(path string) (*Tenants, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Tenant
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	ts := &Tenants{byKey: make(map[string]*Tenant)}
+	names := make(map[string]bool)
+	for _, t := range list {
+		if t.Key == "" || t.Name == "" {
+			return nil, fmt.Errorf("%s: every tenant needs a name and a key", path)
+		}
+		if names[t.Name] || ts.byKey[t.Key] != nil {
+			return nil, fmt.Errorf("%s: duplicate tenant %q", path, t.Name)
+		}
+		names[t.Name] = true
+		t.mutations = float64(t.Quota.MaxMutationsPerMinute)
+		t.refilled = time.Now()
+		ts.byKey[t.Key] = t
+	}
+	return ts, nil
+}
+
+type tenantKey struct{}
+
+// tenantFrom returns the tenant a request was made by, or nil for anonymous
+// requests.
+func tenantFrom(r *http.Request) *Tenant {
+	t, _ := r.Context().Value(tenantKey{}).(*Tenant)
+	return t
+}
+
+// Middleware identifies the tenant from the X-API-Key header or ?key=, and
+// holds one of its viewer slots for the length of the request.
+func (ts *Tenants) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			key = r.URL.Query().Get("key")
+		}
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		t, ok := ts.byKey[key]
+		if !ok {
+			writeError(w, r, &requestError{status: http.StatusForbidden, msg: "unknown API key"})
+			return
+		}
+		if !t.join() {
+			writeError(w, r, &requestError{status: http.StatusTooManyRequests, msg: fmt.Sprintf("viewer quota of %d reached", t.Quota.MaxViewers)})
+			return
+		}
+		defer t.leave()
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, t)))
+	})
+}
+
+func (t *Tenant) join() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Quota.MaxViewers > 0 && t.viewers >= t.Quota.MaxViewers {
+		return false
+	}
+	t.viewers++
+	return true
+}
+
+func (t *Tenant) leave() {
+	t.mu.Lock()
+	t.viewers--
+	t.mu.Unlock()
+}
+
+// createRoom checks a new room against the quota and counts it.
+func (t *Tenant) createRoom(opts RoomOptions) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if area := opts.Width * opts.Height; t.Quota.MaxArea > 0 && area > t.Quota.MaxArea {
+		return &requestError{status: http.StatusForbidden, msg: fmt.Sprintf("board area %d exceeds the quota of %d", area, t.Quota.MaxArea)}
+	}
+	if t.Quota.MaxRooms > 0 && t.rooms >= t.Quota.MaxRooms {
+		return &requestError{status: http.StatusForbidden, msg: fmt.Sprintf("room quota of %d reached", t.Quota.MaxRooms)}
+	}
+	t.rooms++
+	return nil
+}
+
+// dropRoom gives back a room reaped for sitting idle.
+func (t *Tenant) dropRoom() {
+	t.mu.Lock()
+	t.rooms--
+	t.mu.Unlock()
+}
+
+// allowMutation takes a token from the tenant's mutation bucket, which
+// refills at MaxMutationsPerMinute. It returns how long to wait otherwise.
+func (t *Tenant) allowMutation() (bool, time.Duration) {
+	rate := float64(t.Quota.MaxMutationsPerMinute)
+	if rate <= 0 {
+		return true, 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.mutations = math.Min(rate, t.mutations+now.Sub(t.refilled).Minutes()*rate)
+	t.refilled = now
+	if t.mutations < 1 {
+		return false, time.Duration((1 - t.mutations) / rate * float64(time.Minute))
+	}
+	t.mutations--
+	return true, 0
+}
+
+// limitMutations rejects a tenant's mutating request once it goes over its
+// mutation rate. Anonymous requests may not mutate at all.
+func limitMutations(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := tenantFrom(r)
+		if t == nil {
+			writeError(w, r, &requestError{status: http.StatusForbidden, msg: "an API key is required"})
+			return
+		}
+		if ok, wait := t.allowMutation(); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, r, &requestError{status: http.StatusTooManyRequests, msg: fmt.Sprintf("mutation quota of %d per minute reached", t.Quota.MaxMutationsPerMinute)})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// tenantOrAdmin lets tenants call h within their mutation quota, and anyone
+// else only with the admin token.
+func tenantOrAdmin(token string, h http.Handler) http.Handler {
+	limited, admin := limitMutations(h), adminOnly(token, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenantFrom(r) != nil {
+			limited.ServeHTTP(w, r)
+			return
+		}
+		admin.ServeHTTP(w, r)
+	})
+}
+
+type tenantUsage struct {
+	Name      string `json:"name"`
+	Quota     Quota  `json:"quota"`
+	Rooms     int    `json:"rooms"`
+	Viewers   int    `json:"viewers"`
+	Mutations int    `json:"mutationsAvailable"`
+}
+
+// ServeHTTP lists every tenant's quota and current usage.
+func (ts *Tenants) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	usage := make([]tenantUsage, 0, len(ts.byKey))
+	for _, t := range ts.byKey {
+		t.mu.Lock()
+		usage = append(usage, tenantUsage{Name: t.Name, Quota: t.Quota, Rooms: t.rooms, Viewers: t.viewers, Mutations: int(t.mutations)})
+		t.mu.Unlock()
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Name < usage[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(usage); err != nil {
+		fmt.Println(err)
+	}
+}
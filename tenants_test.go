@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTenantRoomQuota(t *testing.T) {
+	tenant := &Tenant{Name: "acme", Quota: Quota{MaxRooms: 2, MaxArea: 400}}
+	steps := []struct {
+		op     string // create or drop
+		w, h   int
+		status int
+	}{
+		{"create", 20, 20, 0},
+		{"create", 21, 20, http.StatusForbidden},
+		{"create", 10, 10, 0},
+		{"create", 10, 10, http.StatusForbidden},
+		{"drop", 0, 0, 0},
+		{"create", 10, 10, 0},
+		{"create", 1, 1, http.StatusForbidden},
+	}
+	for i, s := range steps {
+		if s.op == "drop" {
+			tenant.dropRoom()
+			continue
+		}
+		err := tenant.createRoom(RoomOptions{Width: s.w, Height: s.h})
+		if s.status == 0 && err != nil {
+			t.Errorf("step %d: creating %dx%d: %v", i, s.w, s.h, err)
+		}
+		if re, ok := err.(*requestError); s.status != 0 && (!ok || re.status != s.status) {
+			t.Errorf("step %d: creating %dx%d: error %v, want status %d", i, s.w, s.h, err, s.status)
+		}
+	}
+	if tenant.rooms != 2 {
+		t.Errorf("tenant holds %d rooms, want 2", tenant.rooms)
+	}
+}
+
+func TestTenantRoomsReaped(t *testing.T) {
+	tenant := &Tenant{Name: "acme", Quota: Quota{MaxRooms: 1}}
+	rs := NewRooms(Limits{MaxWidth: 100, MaxHeight: 100, MaxScale: 10, MemoryBudget: 1 << 30, IdleTTL: time.Millisecond}, GameConfig{History: 8})
+	defer rs.Close()
+	lookup := func(query string) error {
+		r := httptest.NewRequest(http.MethodGet, "/game.svg?"+query, nil)
+		_, err := rs.Lookup(r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)))
+		return err
+	}
+
+	if err := lookup("room=a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lookup("room=a"); err != nil {
+		t.Errorf("looking up an existing room: %v", err)
+	}
+	if err := lookup("room=b"); err == nil {
+		t.Error("a second room went over the quota")
+	}
+	time.Sleep(5 * time.Millisecond)
+	rs.reap()
+	if tenant.rooms != 0 {
+		t.Errorf("tenant holds %d rooms after reaping, want 0", tenant.rooms)
+	}
+	if err := lookup("room=b"); err != nil {
+		t.Errorf("reaping did not give the room back: %v", err)
+	}
+}
+
+func TestTenantViewerQuota(t *testing.T) {
+	tenant := &Tenant{Name: "acme", Key: "k", Quota: Quota{MaxViewers: 1}}
+	ts := &Tenants{byKey: map[string]*Tenant{"k": tenant}}
+	h := ts.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("X-API-Key"); key != "" && tenantFrom(r) != tenant {
+			t.Errorf("request with key %q has no tenant", key)
+		}
+	}))
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"k", http.StatusOK},
+		{"nope", http.StatusForbidden},
+		{"", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := serve(h, tt.key); got != tt.want {
+			t.Errorf("key %q: status %d, want %d", tt.key, got, tt.want)
+		}
+	}
+
+	// A request in flight holds the only slot until it is done.
+	var inner int
+	held := ts.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = serve(h, "k")
+	}))
+	serve(held, "k")
+	if inner != http.StatusTooManyRequests {
+		t.Errorf("second viewer: status %d, want %d", inner, http.StatusTooManyRequests)
+	}
+	if got := serve(h, "k"); got != http.StatusOK {
+		t.Errorf("viewer after the first left: status %d", got)
+	}
+}
+
+// serve makes a GET request to h with key as the API key and returns the
+// status.
+func serve(h http.Handler, key string) int {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if key != "" {
+		r.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestTenantMutationQuota(t *testing.T) {
+	tenant := &Tenant{Quota: Quota{MaxMutationsPerMinute: 2}, mutations: 2, refilled: time.Now()}
+	for i, want := range []bool{true, true, false} {
+		if ok, wait := tenant.allowMutation(); ok != want || (!ok && wait <= 0) {
+			t.Errorf("mutation %d: allowed %v after %v, want %v", i, ok, wait, want)
+		}
+	}
+	// Half a minute refills one of the two tokens.
+	tenant.refilled = tenant.refilled.Add(-30 * time.Second)
+	for i, want := range []bool{true, false} {
+		if ok, _ := tenant.allowMutation(); ok != want {
+			t.Errorf("mutation %d after refilling: allowed %v, want %v", i, ok, want)
+		}
+	}
+
+	if ok, _ := (&Tenant{}).allowMutation(); !ok {
+		t.Error("a tenant without a mutation quota was limited")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// textStart prefixes the Start of a room that starts by spelling a message.
+const textStart = "text:"
+
+// TextPattern spells s in the 3x5 font, each font pixel a square of cells as
+// large as lets the text fit a w by h board. It reports false if the text
+// doesn't fit even at one cell a pixel.
+func TextPattern(s string, w, h int) (Pattern, bool) {
+	tw := textWidth(s)
+	if tw == 0 {
+		return Pattern{}, false
+	}
+	k := w / tw
+	if h/glyphHeight < k {
+		k = h / glyphHeight
+	}
+	if k < 1 {
+		return Pattern{}, false
+	}
+	p := Pattern{W: tw * k, H: glyphHeight * k}
+	textPixels(s, func(x, y int) {
+		for i := 0; i < k; i++ {
+			for j := 0; j < k; j++ {
+				p.Cells = append(p.Cells, [2]int{x*k + i, y*k + j})
+			}
+		}
+	})
+	return p, true
+}
+
+// textParam checks s, the message of ?text=, and returns it in capitals with
+// the pattern it spells on a w by h board.
+func textParam(s string, w, h int) (string, Pattern, error) {
+	s = strings.ToUpper(s)
+	for _, ch := range s {
+		if _, ok := fontGlyphs[ch]; !ok {
+			return "", Pattern{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("text %q has no glyph for %q, want letters, digits, spaces and /-.:!?", s, ch)}
+		}
+	}
+	p, ok := TextPattern(s, w, h)
+	if !ok {
+		return "", Pattern{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("text %q does not fit a %dx%d board", s, w, h)}
+	}
+	return s, p, nil
+}
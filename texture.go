@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"net/http"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+// textures are the dead cell textures styles can name with ?texture=.
+var textures = map[string]bool{"dots": true, "grid": true, "noise": true}
+
+// noiseTile is how many cells the noise texture repeats over, each way.
+const noiseTile = 8
+
+// textureMarks describes a texture at k pixels per cell as the marks making
+// up one square tile of it, tile pixels wide, repeated across the board.
+func textureMarks(name string, k int) (tile int, marks []image.Rectangle) {
+	switch name {
+	case "dots":
+		d := k / 5
+		if d < 1 {
+			d = 1
+		}
+		o := (k - d) / 2
+		return k, []image.Rectangle{image.Rect(o, o, o+d, o+d)}
+	case "grid":
+		return k, []image.Rectangle{image.Rect(0, 0, k, 1), image.Rect(0, 0, 1, k)}
+	case "noise":
+		d := k / 4
+		if d < 1 {
+			d = 1
+		}
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < noiseTile; i++ {
+			for j := 0; j < noiseTile; j++ {
+				if rng.Intn(3) != 0 {
+					continue
+				}
+				x, y := i*k+rng.Intn(k-d+1), j*k+rng.Intn(k-d+1)
+				marks = append(marks, image.Rect(x, y, x+d, y+d))
+			}
+		}
+		return noiseTile * k, marks
+	}
+	return 0, nil
+}
+
+// textureColor is a faint shade of the live colour over the background.
+func textureColor(pal *Palette) color.RGBA {
+	return mixColor(pal.Alive, insetBackground(pal), 0.15)
+}
+
+// drawTexture covers img with the style's texture, under the cells.
+func drawTexture(img draw.Image, st Style, pal *Palette) {
+	tile, marks := textureMarks(st.Texture, st.Scale)
+	if tile == 0 {
+		return
+	}
+	u := &image.Uniform{C: textureColor(pal)}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y += tile {
+		for x := b.Min.X; x < b.Max.X; x += tile {
+			for _, m := range marks {
+				draw.Draw(img, m.Add(image.Pt(x, y)).Intersect(b), u, image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+// svgTexture fills a w by h canvas with the style's texture as a pattern.
+func svgTexture(canvas *svg.SVG, st Style, pal *Palette, w, h int) {
+	tile, marks := textureMarks(st.Texture, st.Scale)
+	if tile == 0 {
+		return
+	}
+	canvas.Def()
+	canvas.Pattern("texture", 0, 0, tile, tile, "user")
+	fill := `fill="` + svgColor(textureColor(pal)) + `"`
+	for _, m := range marks {
+		canvas.Rect(m.Min.X, m.Min.Y, m.Dx(), m.Dy(), fill)
+	}
+	canvas.PatternEnd()
+	canvas.DefEnd()
+	canvas.Rect(0, 0, w, h, `fill="url(#texture)"`)
+}
+
+func textureParam(r *http.Request, def string) (string, error) {
+	name := r.URL.Query().Get("texture")
+	if name == "" {
+		return def, nil
+	}
+	if !textures[name] {
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown texture %q", name)}
+	}
+	return name, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"time"
+)
+
+// A ThemeProvider picks the palette for a theme that changes over time. It is
+// consulted for every frame drawn in its theme.
+type ThemeProvider interface {
+	Palette(now time.Time) *Palette
+}
+
+// themeProviders are the themes styles can name besides the fixed palettes.
+var themeProviders = map[string]ThemeProvider{
+	"auto": autoTheme,
+}
+
+// autoTheme is light by day and dark by night, in the server's time zone
+// unless -auto-theme names another.
+var autoTheme = &DaylightTheme{
+	Location: time.Local,
+	Day:      "default",
+	Night:    "dark",
+	Dawn:     7 * time.Hour,
+	Dusk:     19 * time.Hour,
+	Fade:     time.Hour,
+}
+
+// DaylightTheme switches between a day and a night palette at dawn and dusk,
+// local time, blending the two over Fade so the change is gradual.
+type DaylightTheme struct {
+	Location   *time.Location
+	Day, Night string
+	Dawn, Dusk time.Duration // since midnight
+	Fade       time.Duration
+}
+
+func (t *DaylightTheme) Palette(now time.Time) *Palette {
+	day, night := palettes[t.Day], palettes[t.Night]
+	switch k := t.daylight(now); k {
+	case 1:
+		return day
+	case 0:
+		return night
+	default:
+		return blendPalettes(day, night, k)
+	}
+}
+
+// daylight is 1 by day, 0 by night and in between while fading.
+func (t *DaylightTheme) daylight(now time.Time) float64 {
+	now = now.In(t.Location)
+	since := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+	ramp := func(d time.Duration) float64 {
+		v := float64(d)/float64(t.Fade) + 0.5
+		return math.Max(0, math.Min(1, v))
+	}
+	return math.Min(ramp(since-t.Dawn), 1-ramp(since-t.Dusk))
+}
+
+// blendPalettes mixes two palettes, keeping k of a. A transparent background
+// blends as white.
+func blendPalettes(a, b *Palette, k float64) *Palette {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	bg := func(p *Palette) color.RGBA {
+		if p.Background.A == 0 {
+			return white
+		}
+		return p.Background
+	}
+	return &Palette{
+		Name:       a.Name + "+" + b.Name,
+		Background: mixColor(bg(a), bg(b), k),
+		Alive:      mixColor(a.Alive, b.Alive, k),
+		Alt:        mixColor(a.Alt, b.Alt, k),
+		Born:       mixColor(a.Born, b.Born, k),
+		Dying:      mixColor(a.Dying, b.Dying, k),
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+type MilestoneKind string
+
+const (
+	// MilestoneReseed is the board being replaced.
+	MilestoneReseed MilestoneKind = "reseed"
+	// MilestoneRule is the rule changing.
+	MilestoneRule MilestoneKind = "rule"
+	// MilestoneCycle is the whole board settling into a still life,
+	// oscillator or spaceship.
+	MilestoneCycle MilestoneKind = "cycle"
+	// MilestoneObject is the first sighting of a kind of spaceship.
+	MilestoneObject  MilestoneKind = "object"
+	MilestoneExtinct MilestoneKind = "extinct"
+	// MilestonePeak is the highest population so far. There is only ever
+	// one, moved whenever the peak is beaten.
+	MilestonePeak MilestoneKind = "peak"
+)
+
+// maxMilestones is how many milestones a timeline keeps, dropping the oldest.
+const maxMilestones = 200
+
+// shipSightings is how many generations a kind of spaceship must be seen in
+// before the timeline believes it, since debris in a soup can pass for a
+// small one for a generation or two.
+const shipSightings = 3
+
+// timelineHeight is the height of the timeline strip drawn under a board, in
+// pixels.
+const timelineHeight = 14
+
+var milestoneColors = map[MilestoneKind]color.RGBA{
+	MilestoneReseed:  {R: 0x55, G: 0x55, B: 0x55, A: 255},
+	MilestoneRule:    {R: 0xfe, G: 0x7d, B: 0x37, A: 255},
+	MilestoneCycle:   {R: 0x00, G: 0x7e, B: 0xc6, A: 255},
+	MilestoneObject:  {R: 0x9f, G: 0x5f, B: 0xd0, A: 255},
+	MilestoneExtinct: {R: 0xe0, G: 0x5d, B: 0x44, A: 255},
+	MilestonePeak:    {R: 0x44, G: 0xcc, B: 0x11, A: 255},
+}
+
+// Milestone is something notable that happened in a room at a generation.
+type Milestone struct {
+	Generation uint64        `json:"generation"`
+	Time       time.Time     `json:"time"`
+	Kind       MilestoneKind `json:"kind"`
+	Detail     string        `json:"detail"`
+}
+
+// shipKind tells spaceships apart for the timeline whichever way they face.
+type shipKind struct {
+	population, period, dx, dy int
+}
+
+// Timeline records a room's milestones from its events and from watching its
+// generations go by.
+type Timeline struct {
+	mu         sync.Mutex
+	milestones []Milestone
+	phase      Phase
+	peak       int
+	ships      map[shipKind]int
+}
+
+func (t *Timeline) add(m Milestone) {
+	t.milestones = append(t.milestones, m)
+	if len(t.milestones) > maxMilestones {
+		t.milestones = t.milestones[1:]
+	}
+}
+
+// Record notes the events worth a milestone: reseeds and rule changes.
+func (t *Timeline) Record(e Event) {
+	m := Milestone{Generation: e.Generation, Time: e.Time}
+	switch e.Kind {
+	case EventBoard:
+		m.Kind, m.Detail = MilestoneReseed, "board replaced"
+	case EventRule:
+		m.Kind, m.Detail = MilestoneRule, "rule changed to "+e.Rule.String()
+	default:
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(m)
+}
+
+// Observe notes generation gen's milestones: a new peak population, the
+// board's phase changing to anything but chaotic, and spaceships of a kind
+// not seen before.
+func (t *Timeline) Observe(gen uint64, population int, phase Phase, ships []Ship) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if population > t.peak {
+		t.peak = population
+		for i, m := range t.milestones {
+			if m.Kind == MilestonePeak {
+				t.milestones = append(t.milestones[:i], t.milestones[i+1:]...)
+				break
+			}
+		}
+		t.add(Milestone{Generation: gen, Time: now, Kind: MilestonePeak, Detail: fmt.Sprintf("population peaked at %d", population)})
+	}
+	if phase != t.phase {
+		t.phase = phase
+		switch phase.Kind {
+		case PhaseChaotic:
+		case PhaseExtinct:
+			t.add(Milestone{Generation: gen, Time: now, Kind: MilestoneExtinct, Detail: "every cell died"})
+		default:
+			t.add(Milestone{Generation: gen, Time: now, Kind: MilestoneCycle, Detail: "board became a " + phase.String()})
+		}
+	}
+	if t.ships == nil {
+		t.ships = make(map[shipKind]int)
+	}
+	seen := make(map[shipKind]bool)
+	for _, s := range ships {
+		k := shipKind{population: s.Population, period: s.Period, dx: abs(s.DX), dy: abs(s.DY)}
+		if k.dx < k.dy {
+			k.dx, k.dy = k.dy, k.dx
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if t.ships[k]++; t.ships[k] != shipSightings {
+			continue
+		}
+		t.add(Milestone{Generation: gen, Time: now, Kind: MilestoneObject, Detail: fmt.Sprintf("first %s spaceship of %d cells", s.Speed, s.Population)})
+	}
+}
+
+// List returns the milestones kept, oldest first.
+func (t *Timeline) List() []Milestone {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Milestone(nil), t.milestones...)
+}
+
+// timelineX places generation gen on a strip w pixels wide running from
+// generation 0 to now.
+func timelineX(gen, now uint64, w int) int {
+	if now == 0 {
+		return 1
+	}
+	return 1 + int(float64(gen)/float64(now)*float64(w-3))
+}
+
+// withTimeline returns img with the frame's timeline strip added under it: a
+// tick for each milestone, coloured by kind, on an axis from generation 0 to
+// the frame's.
+func (f Frame) withTimeline(img *image.RGBA, pal *Palette) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, h+timelineHeight))
+	draw.Draw(out, img.Bounds(), img, image.Point{}, draw.Src)
+	bg := insetBackground(pal)
+	draw.Draw(out, image.Rect(0, h, w, h+timelineHeight), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+	axis := image.Rect(0, h+timelineHeight/2, w, h+timelineHeight/2+1)
+	draw.Draw(out, axis, &image.Uniform{C: mixColor(pal.Alive, bg, 0.3)}, image.Point{}, draw.Src)
+	for _, m := range f.Milestones {
+		x := timelineX(m.Generation, f.Generation, w)
+		tick := image.Rect(x-1, h+2, x+1, h+timelineHeight-2)
+		draw.Draw(out, tick, &image.Uniform{C: milestoneColors[m.Kind]}, image.Point{}, draw.Src)
+	}
+	return out
+}
+
+// svgTimeline draws the timeline strip w pixels wide at y, each tick titled
+// with its milestone.
+func (f Frame) svgTimeline(canvas *svg.SVG, pal *Palette, y, w int) {
+	bg := insetBackground(pal)
+	canvas.Rect(0, y, w, timelineHeight, `fill="`+svgColor(bg)+`"`)
+	canvas.Line(0, y+timelineHeight/2, w, y+timelineHeight/2, `stroke="`+svgColor(mixColor(pal.Alive, bg, 0.3))+`"`)
+	for _, m := range f.Milestones {
+		x := timelineX(m.Generation, f.Generation, w)
+		canvas.Group()
+		canvas.Title(fmt.Sprintf("gen %d: %s", m.Generation, m.Detail))
+		canvas.Rect(x-1, y+2, 2, timelineHeight-4, `fill="`+svgColor(milestoneColors[m.Kind])+`"`)
+		canvas.Gend()
+	}
+}
+
+func timelineParam(r *http.Request, def bool) (bool, error) {
+	s := r.URL.Query().Get("timeline")
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("timeline must be true or false, not %q", s)}
+	}
+	return v, nil
+}
+
+type timelineJSON struct {
+	Room       string      `json:"room"`
+	Generation uint64      `json:"generation"`
+	Milestones []Milestone `json:"milestones"`
+}
+
+// timelineHandle lists the room's milestones for /rooms/NAME/events.json.
+func timelineHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	milestones := room.timeline.List()
+	if milestones == nil {
+		milestones = []Milestone{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	err := json.NewEncoder(w).Encode(timelineJSON{
+		Room:       room.name,
+		Generation: room.history.Latest().Number,
+		Milestones: milestones,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Topology is what lies past a board's edges.
+type Topology string
+
+const (
+	// Bounded boards are surrounded by dead cells, so spaceships die at the
+	// edges. It is the topology of the zero Topology.
+	Bounded Topology = "bounded"
+	// Torus boards wrap around, each edge neighbouring the opposite one.
+	Torus Topology = "torus"
+	// Unbounded boards are a window onto a Plane, so patterns carry on past
+	// the edges, out of sight, and can come back. Rooms keep the plane; a
+	// board stepped on its own is treated as Bounded.
+	Unbounded Topology = "unbounded"
+)
+
+// Evolute advances b one generation under r on this topology.
+func (t Topology) Evolute(r Rule, b Board) Board {
+	if t != Torus || len(b) == 0 {
+		return r.Evolute(b)
+	}
+	n := 1
+	if r.LtL.Radius > 0 {
+		n = int(r.LtL.Radius)
+	}
+	next := r.Evolute(b.wrapped(n))
+	out := make(Board, len(b))
+	for i := range out {
+		out[i] = next[i+n][n : len(b[i])+n]
+	}
+	return out
+}
+
+// wrapped returns b framed by a border n cells deep copied from its opposite
+// edges, which a bounded step then treats as a torus's neighbours.
+func (b Board) wrapped(n int) Board {
+	w, h := len(b), len(b[0])
+	p := make(Board, w+2*n)
+	for i := range p {
+		col := b[((i-n)%w+w)%w]
+		p[i] = make([]bool, h+2*n)
+		copy(p[i][n:], col)
+		for j := 0; j < n; j++ {
+			p[i][j], p[i][n+h+j] = col[((j-n)%h+h)%h], col[j%h]
+		}
+	}
+	return p
+}
+
+func (o RoomOptions) topology() Topology {
+	if o.Topology == "" {
+		return Bounded
+	}
+	return o.Topology
+}
+
+func topologyParam(r *http.Request) (Topology, error) {
+	switch t := Topology(r.URL.Query().Get("topology")); t {
+	case "", Bounded, Torus, Unbounded:
+		return t, nil
+	default:
+		return "", &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown topology %q, want bounded, torus or unbounded", t)}
+	}
+}
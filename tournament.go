@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+type TournamentState string
+
+const (
+	TournamentRunning  TournamentState = "running"
+	TournamentFinished TournamentState = "finished"
+)
+
+// tournamentHold is how long a finished tournament shows its winner before a
+// new one starts.
+const tournamentHold = 10 * time.Second
+
+type contestant struct {
+	board        Board
+	spare        Board // the board before, written over by the next step
+	cycles       CycleDetector
+	eliminated   bool
+	eliminatedAt uint64
+	reason       string
+}
+
+// Tournament runs several soups side by side under the same rule, ticking
+// them together. Soups that die out or settle into a cycle are eliminated; the
+// last one still chaotic wins.
+type Tournament struct {
+	size          int
+	width, height int
+	scale         int
+	rule          Rule
+	task          *Task
+
+	mu          sync.Mutex
+	state       TournamentState
+	round       int
+	generation  uint64
+	contestants []*contestant
+	winner      int
+	finishedAt  time.Time
+	subscribers map[chan<- ImageBundle]*Session
+}
+
+func NewTournament(size, width, height, scale int, rule Rule) *Tournament {
+	t := &Tournament{
+		size:        size,
+		width:       width,
+		height:      height,
+		scale:       scale,
+		rule:        rule,
+		subscribers: make(map[chan<- ImageBundle]*Session),
+	}
+	t.task = scheduler.NewTask(time.Second, t.tick)
+	t.reset()
+	t.Start()
+	return t
+}
+
+func (t *Tournament) reset() {
+	t.state = TournamentRunning
+	t.round++
+	t.generation = 0
+	t.winner = -1
+	t.contestants = make([]*contestant, t.size)
+	for i := range t.contestants {
+		c := &contestant{board: NewBoard(t.width, t.height)}
+		c.cycles.Observe(0, c.board)
+		t.contestants[i] = c
+	}
+}
+
+func (t *Tournament) Start() {
+	t.task.Start()
+}
+
+func (t *Tournament) Close() {
+	t.task.Stop()
+}
+
+// tick steps the tournament and streams the mosaic, pausing while nobody
+// watches.
+func (t *Tournament) tick() {
+	if d := budget.Interval(time.Second); d != t.task.Interval() {
+		t.task.SetInterval(d)
+	}
+	t.mu.Lock()
+	idle := len(t.subscribers) == 0
+	if idle {
+		t.task.Pause()
+	}
+	t.mu.Unlock()
+	if idle {
+		return
+	}
+
+	defer budget.Track(time.Now())
+	t.step()
+	bundle := ImageBundle{ContentType: "image/svg+xml"}
+
+	t.mu.Lock()
+	bundle.Data = t.mosaicSvg()
+	bundle.Generation = t.generation
+	for ch, s := range t.subscribers {
+		offer(ch, s, bundle)
+	}
+	t.mu.Unlock()
+}
+
+// step advances every remaining soup one generation and eliminates the ones
+// that stopped being chaotic.
+func (t *Tournament) step() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == TournamentFinished {
+		if time.Since(t.finishedAt) >= tournamentHold {
+			t.reset()
+		}
+		return
+	}
+
+	t.generation++
+	var remaining, lastOut []int
+	for i, c := range t.contestants {
+		if c.eliminated {
+			continue
+		}
+		c.board, c.spare = t.rule.EvoluteInto(c.spare, c.board), c.board
+		c.cycles.Observe(t.generation, c.board)
+		if phase := c.cycles.Phase(); phase.Kind != PhaseChaotic {
+			c.eliminated = true
+			c.eliminatedAt = t.generation
+			c.reason = phase.String()
+			lastOut = append(lastOut, i)
+			continue
+		}
+		remaining = append(remaining, i)
+	}
+
+	switch {
+	case len(remaining) == 1:
+		t.finish(remaining[0])
+	case len(remaining) == 0 && len(lastOut) > 0:
+		// Everyone left went out together; the largest population wins.
+		best := lastOut[0]
+		for _, i := range lastOut[1:] {
+			if t.contestants[i].board.Population() > t.contestants[best].board.Population() {
+				best = i
+			}
+		}
+		t.finish(best)
+	}
+}
+
+func (t *Tournament) finish(winner int) {
+	t.state = TournamentFinished
+	t.winner = winner
+	t.finishedAt = time.Now()
+}
+
+func (t *Tournament) columns() int {
+	return int(math.Ceil(math.Sqrt(float64(t.size))))
+}
+
+// mosaicSvg draws every soup as a tile, greying out eliminated soups and
+// framing the winner.
+func (t *Tournament) mosaicSvg() []byte {
+	const gap, label = 4, 16
+	k := t.scale
+	tileW, tileH := t.width*k, t.height*k+label
+	cols := t.columns()
+	rows := (t.size + cols - 1) / cols
+
+	var buf bytes.Buffer
+	canvas := svg.New(&buf)
+	canvas.Start(cols*(tileW+gap)+gap, rows*(tileH+gap)+gap)
+	for n, c := range t.contestants {
+		x := gap + (n%cols)*(tileW+gap)
+		y := gap + (n/cols)*(tileH+gap)
+
+		fill, caption := "black", fmt.Sprintf("#%d", n+1)
+		switch {
+		case n == t.winner:
+			caption += " winner"
+			canvas.Rect(x-2, y-2, tileW+4, tileH+4, `fill="none"`, `stroke="#2e7d32"`, `stroke-width="3"`)
+		case c.eliminated:
+			fill = "#bbb"
+			caption += fmt.Sprintf(" out at gen %d: %s", c.eliminatedAt, c.reason)
+		}
+		canvas.Rect(x, y+label, t.width*k, t.height*k, `fill="white"`, `stroke="#ddd"`)
+		for i, col := range c.board {
+			for j, alive := range col {
+				if alive {
+					canvas.Rect(x+i*k, y+label+j*k, k, k, `fill="`+fill+`"`)
+				}
+			}
+		}
+		canvas.Text(x, y+label/2, caption, `font-size="11"`, `font-family="monospace"`, `dominant-baseline="middle"`)
+	}
+	canvas.End()
+	return buf.Bytes()
+}
+
+func (t *Tournament) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat("svg")
+	leave := viewerCounts.Join(s, "tournament")
+	t.mu.Lock()
+	t.subscribers[c] = s
+	t.task.Resume()
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		delete(t.subscribers, c)
+		t.mu.Unlock()
+		leave()
+	}
+}
+
+type contestantJSON struct {
+	Index        int    `json:"index"`
+	Population   int    `json:"population"`
+	Eliminated   bool   `json:"eliminated"`
+	EliminatedAt uint64 `json:"eliminatedAt,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+type tournamentJSON struct {
+	State       TournamentState  `json:"state"`
+	Round       int              `json:"round"`
+	Rule        string           `json:"rule"`
+	Generation  uint64           `json:"generation"`
+	Winner      *int             `json:"winner,omitempty"`
+	Contestants []contestantJSON `json:"contestants"`
+}
+
+func (t *Tournament) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	resp := tournamentJSON{
+		State:      t.state,
+		Round:      t.round,
+		Rule:       t.rule.String(),
+		Generation: t.generation,
+	}
+	if t.winner >= 0 {
+		winner := t.winner
+		resp.Winner = &winner
+	}
+	for i, c := range t.contestants {
+		resp.Contestants = append(resp.Contestants, contestantJSON{
+			Index:        i,
+			Population:   c.board.Population(),
+			Eliminated:   c.eliminated,
+			EliminatedAt: c.eliminatedAt,
+			Reason:       c.reason,
+		})
+	}
+	t.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Println(err)
+	}
+}
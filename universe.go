@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const universeCookie = "universe"
+
+type universe struct {
+	board    Board
+	rule     Rule
+	lastSeen time.Time
+
+	// watchers are the visitor's open streams, which task sends each
+	// generation to while there are any.
+	watchers map[chan<- ImageBundle]*Session
+	task     *Task
+	started  bool // whether task has sent the board it started from
+}
+
+// UniverseStore keeps one board per visitor. Boards untouched for longer than
+// ttl are dropped, and the least recently seen board nobody watches is evicted
+// once the store holds capacity boards; if everyone is watching, new visitors
+// are turned away.
+type UniverseStore struct {
+	task *Task
+
+	mu        sync.Mutex
+	ttl       time.Duration
+	capacity  int
+	universes map[string]*universe
+}
+
+func NewUniverseStore(ttl time.Duration, capacity int) *UniverseStore {
+	s := &UniverseStore{
+		ttl:       ttl,
+		capacity:  capacity,
+		universes: make(map[string]*universe),
+	}
+	s.Start()
+	return s
+}
+
+func (s *UniverseStore) Start() {
+	s.task = scheduler.Every(time.Minute, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now()
+		for id, u := range s.universes {
+			if now.Sub(u.lastSeen) > s.ttl && len(u.watchers) == 0 {
+				delete(s.universes, id)
+			}
+		}
+	})
+}
+
+func (s *UniverseStore) Close() {
+	s.task.Stop()
+}
+
+// Open returns the visitor's board, creating a fresh one under Conway's rule
+// if needed. It fails if the store is full and every board in it is being
+// watched, leaving none to evict.
+func (s *UniverseStore) Open(id string) (*universe, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.universes[id]
+	if !ok {
+		if len(s.universes) >= s.capacity && !s.evictOldest() {
+			return nil, &requestError{
+				status: http.StatusServiceUnavailable,
+				msg:    fmt.Sprintf("all %d universes are being watched", s.capacity),
+			}
+		}
+		u = &universe{board: NewBoard(80, 60), rule: Conway, watchers: make(map[chan<- ImageBundle]*Session)}
+		s.universes[id] = u
+	}
+	u.lastSeen = time.Now()
+	return u, nil
+}
+
+// evictOldest drops the least recently seen board nobody is watching,
+// reporting whether there was one.
+func (s *UniverseStore) evictOldest() bool {
+	var oldest string
+	var oldestSeen time.Time
+	for id, u := range s.universes {
+		if len(u.watchers) > 0 {
+			continue
+		}
+		if oldest == "" || u.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = id, u.lastSeen
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	delete(s.universes, oldest)
+	return true
+}
+
+// SetRule switches u to rule from its next generation.
+func (s *UniverseStore) SetRule(u *universe, rule Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.rule = rule
+}
+
+// Watch subscribes c to u and returns the function that unsubscribes it.
+// The board evolves a generation a second while anyone watches it, however
+// many of the visitor's tabs do, and every tab gets each generation.
+func (s *UniverseStore) Watch(u *universe, c chan<- ImageBundle, sess *Session) func() {
+	s.mu.Lock()
+	u.lastSeen = time.Now()
+	u.watchers[c] = sess
+	if u.task == nil {
+		u.started = false
+		u.task = scheduler.Every(time.Second, func() { s.tick(u) })
+	}
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		delete(u.watchers, c)
+		task := u.task
+		if len(u.watchers) > 0 {
+			task = nil
+		} else {
+			u.task = nil
+		}
+		s.mu.Unlock()
+		if task != nil {
+			task.Stop()
+		}
+	}
+}
+
+// tick advances u a generation, or sends it as it is the first time, and
+// offers the frame to everyone watching.
+func (s *UniverseStore) tick(u *universe) {
+	s.mu.Lock()
+	if len(u.watchers) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	var prev Board
+	if u.started {
+		prev = u.board
+		u.board = u.rule.Evolute(u.board)
+	}
+	u.started = true
+	u.lastSeen = time.Now()
+	b, rule := u.board, u.rule
+	watchers := make(map[chan<- ImageBundle]*Session, len(u.watchers))
+	for c, sess := range u.watchers {
+		watchers[c] = sess
+	}
+	s.mu.Unlock()
+
+	bundle, err := Encode("svg", Frame{Board: b, Prev: prev, Rule: rule}, Style{Scale: defaultScale})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	bundle.Population, bundle.Time = b.Population(), time.Now()
+	for c, sess := range watchers {
+		offer(c, sess, bundle)
+	}
+}
+
+// UniverseRender streams a single visitor's board. It only evolves while the
+// visitor is watching, so a returning visitor resumes where they left off.
+type UniverseRender struct {
+	store *UniverseStore
+	u     *universe
+}
+
+func (r *UniverseRender) Register(c chan<- ImageBundle, s *Session) func() {
+	s.setFormat("svg")
+	leave := viewerCounts.Join(s, "")
+	unwatch := r.store.Watch(r.u, c, s)
+	return func() {
+		unwatch()
+		leave()
+	}
+}
+
+type cookieSigner struct {
+	key []byte
+}
+
+func newCookieSigner(secret string) cookieSigner {
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		return cookieSigner{key: key}
+	}
+	return cookieSigner{key: []byte(secret)}
+}
+
+func (s cookieSigner) mac(v string) string {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(v))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func (s cookieSigner) Sign(v string) string {
+	return v + "." + s.mac(v)
+}
+
+func (s cookieSigner) Verify(signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+	v := signed[:i]
+	if !hmac.Equal([]byte(signed[i+1:]), []byte(s.mac(v))) {
+		return "", false
+	}
+	return v, true
+}
+
+func newVisitorID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+func universeHandleFunc(store *UniverseStore, signer cookieSigner) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var id string
+		if c, err := r.Cookie(universeCookie); err == nil {
+			id, _ = signer.Verify(c.Value)
+		}
+		if id == "" {
+			id = newVisitorID()
+		}
+		var rule *Rule
+		if v := r.URL.Query().Get("rule"); v != "" {
+			parsed, err := ParseRule(v)
+			if err != nil {
+				writeError(w, r, &requestError{status: http.StatusBadRequest, msg: err.Error()})
+				return
+			}
+			rule = &parsed
+		}
+		u, err := store.Open(id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if rule != nil {
+			store.SetRule(u, *rule)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     universeCookie,
+			Value:    signer.Sign(id),
+			Path:     "/",
+			MaxAge:   int(store.ttl / time.Second),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		streamHandleFunc(&UniverseRender{store: store, u: u})(w, r)
+	}
+}
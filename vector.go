@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"net/http"
+)
+
+// mergeRects covers the live cells of b with few rectangles, in cell units:
+// runs of cells down each column, joined with identical runs in the columns
+// next to them.
+func mergeRects(b Board) []image.Rectangle {
+	var rects []image.Rectangle
+	open := make(map[[2]int]int)
+	for x, col := range b {
+		next := make(map[[2]int]int)
+		for y := 0; y < len(col); y++ {
+			if !col[y] {
+				continue
+			}
+			y0 := y
+			for y < len(col) && col[y] {
+				y++
+			}
+			span := [2]int{y0, y}
+			if i, ok := open[span]; ok {
+				rects[i].Max.X = x + 1
+				next[span] = i
+			} else {
+				next[span] = len(rects)
+				rects = append(rects, image.Rect(x, y0, x+1, y))
+			}
+		}
+		open = next
+	}
+	return rects
+}
+
+// vectorLayer is a set of rectangles drawn in one colour, filled or outlined.
+type vectorLayer struct {
+	Color  color.RGBA
+	Rects  []image.Rectangle
+	Stroke bool
+}
+
+// layers groups the frame's cells by colour, merging each fill colour's cells
+// into rectangles.
+func (f Frame) layers(st Style) []vectorLayer {
+	w, h := len(f.Board), len(f.Board[0])
+	fills := make(map[color.RGBA]Board)
+	var order []color.RGBA
+	var dying []image.Rectangle
+	f.paint(st, func(i, j int, fill color.RGBA, d bool) {
+		b, ok := fills[fill]
+		if !ok {
+			b = make(Board, w)
+			for x := range b {
+				b[x] = make([]bool, h)
+			}
+			fills[fill] = b
+			order = append(order, fill)
+		}
+		b[i][j] = true
+		if d {
+			dying = append(dying, image.Rect(i, j, i+1, j+1))
+		}
+	})
+
+	var layers []vectorLayer
+	if bg := f.palette(st).Background; bg.A > 0 {
+		layers = append(layers, vectorLayer{Color: bg, Rects: []image.Rectangle{image.Rect(0, 0, w, h)}})
+	}
+	for _, c := range order {
+		layers = append(layers, vectorLayer{Color: c, Rects: mergeRects(fills[c])})
+	}
+	if len(dying) > 0 {
+		layers = append(layers, vectorLayer{Color: f.palette(st).Dying, Rects: dying, Stroke: true})
+	}
+	return layers
+}
+
+// pageSizes are paper sizes in points, portrait.
+var pageSizes = map[string][2]float64{
+	"a4":      {595, 842},
+	"a3":      {842, 1191},
+	"a2":      {1191, 1684},
+	"letter":  {612, 792},
+	"tabloid": {792, 1224},
+}
+
+// pageMargin is the blank border kept around the board on paper sizes.
+const pageMargin = 36
+
+// pageLayout places a w by h cell board on a page: the page size in points,
+// the size of a cell, and where the board's top-left corner goes, measured
+// from the bottom-left of the page.
+type pageLayout struct {
+	Width, Height float64
+	Cell          float64
+	X, Y          float64
+}
+
+// layoutPage fits the board onto the named paper size, turned to match the
+// board's orientation, or with "fit" makes the page exactly the board at
+// scale points per cell.
+func layoutPage(page string, w, h, scale int) (pageLayout, error) {
+	if page == "" || page == "fit" {
+		k := float64(scale)
+		return pageLayout{Width: k * float64(w), Height: k * float64(h), Cell: k, Y: k * float64(h)}, nil
+	}
+	size, ok := pageSizes[page]
+	if !ok {
+		return pageLayout{}, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown page %q", page)}
+	}
+	pw, ph := size[0], size[1]
+	if w > h {
+		pw, ph = ph, pw
+	}
+	cell := math.Min((pw-2*pageMargin)/float64(w), (ph-2*pageMargin)/float64(h))
+	bw, bh := cell*float64(w), cell*float64(h)
+	return pageLayout{
+		Width:  pw,
+		Height: ph,
+		Cell:   cell,
+		X:      (pw - bw) / 2,
+		Y:      (ph + bh) / 2,
+	}, nil
+}
+
+// Eps writes the frame as Encapsulated PostScript laid out by l.
+func (f Frame) Eps(st Style, l pageLayout) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%!PS-Adobe-3.0 EPSF-3.0\n")
+	fmt.Fprintf(&buf, "%%%%BoundingBox: 0 0 %d %d\n", int(math.Ceil(l.Width)), int(math.Ceil(l.Height)))
+	fmt.Fprintf(&buf, "%%%%HiResBoundingBox: 0 0 %.4f %.4f\n", l.Width, l.Height)
+	buf.WriteString("%%Title: Game of Life\n%%EndComments\n")
+	buf.WriteString("/F { rectfill } bind def\n/S { rectstroke } bind def\n")
+	fmt.Fprintf(&buf, "gsave\n%.4f %.4f translate %.4f %.4f scale\n", l.X, l.Y, l.Cell, -l.Cell)
+	for _, layer := range f.layers(st) {
+		fmt.Fprintf(&buf, "%.3f %.3f %.3f setrgbcolor\n", float64(layer.Color.R)/255, float64(layer.Color.G)/255, float64(layer.Color.B)/255)
+		op := "F"
+		if layer.Stroke {
+			buf.WriteString("0.1 setlinewidth\n")
+			op = "S"
+		}
+		for _, r := range layer.Rects {
+			fmt.Fprintf(&buf, "%d %d %d %d %s\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), op)
+		}
+	}
+	buf.WriteString("grestore\nshowpage\n%%EOF\n")
+	return buf.Bytes()
+}
+
+// Pdf writes the frame as a single page PDF laid out by l.
+func (f Frame) Pdf(st Style, l pageLayout) ([]byte, error) {
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "%.4f 0 0 %.4f %.4f %.4f cm\n", l.Cell, -l.Cell, l.X, l.Y)
+	for _, layer := range f.layers(st) {
+		r, g, b := float64(layer.Color.R)/255, float64(layer.Color.G)/255, float64(layer.Color.B)/255
+		if layer.Stroke {
+			fmt.Fprintf(&content, "%.3f %.3f %.3f RG 0.1 w\n", r, g, b)
+		} else {
+			fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", r, g, b)
+		}
+		for _, rc := range layer.Rects {
+			fmt.Fprintf(&content, "%d %d %d %d re\n", rc.Min.X, rc.Min.Y, rc.Dx(), rc.Dy())
+		}
+		if layer.Stroke {
+			content.WriteString("S\n")
+		} else {
+			content.WriteString("f\n")
+		}
+	}
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	if _, err := zw.Write(content.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.4f %.4f] /Contents 4 0 R /Resources << >> >>", l.Width, l.Height))
+	object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.Bytes()))
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes(), nil
+}
+
+// vectorHandleFunc serves the room's latest generation as a PDF or EPS page,
+// sized by ?page= (fit, a4, a3, a2, letter or tabloid).
+func vectorHandleFunc(kind string) func(*GameRender, http.ResponseWriter, *http.Request) {
+	return func(room *GameRender, w http.ResponseWriter, r *http.Request) {
+		st, err := styleParam(r, room.DefaultStyle())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		latest := room.history.Latest()
+		l, err := layoutPage(r.URL.Query().Get("page"), len(latest.Board), len(latest.Board[0]), st.Scale)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		frame := Frame{Board: latest.Board, Rule: room.Rule()}
+		if prev, ok := room.history.Find(func(g Generation) bool { return g.Number+1 == latest.Number }); ok {
+			frame.Prev = prev.Board
+		}
+
+		var data []byte
+		switch kind {
+		case "pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			data, err = frame.Pdf(st, l)
+		case "eps":
+			w.Header().Set("Content-Type", "application/postscript")
+			data = frame.Eps(st, l)
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="board-%d.%s"`, latest.Number, kind))
+		if _, err := w.Write(data); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var viewerCounts = NewViewerCounts()
+
+// viewerHistoryBuckets is how many hourly buckets of viewer history are kept.
+const viewerHistoryBuckets = 24 * 7
+
+type viewerKey struct {
+	path string
+	room string
+}
+
+// ViewerFilter selects viewers by stream endpoint and room. Empty fields match
+// everything, so the zero filter counts all viewers. Stat picks what is
+// counted: current viewers by default, or the all-time "cumulative" joins or
+// "peak" concurrent viewers, which ignore the endpoint and room.
+type ViewerFilter struct {
+	Path string
+	Room string
+	Stat string
+}
+
+func (f ViewerFilter) match(k viewerKey) bool {
+	return (f.Path == "" || f.Path == k.path) && (f.Room == "" || f.Room == k.room)
+}
+
+type viewerBucket struct {
+	Start time.Time `json:"start"`
+	Joins uint64    `json:"joins"`
+	Peak  int       `json:"peak"`
+}
+
+// viewerState is the part of the counters that survives restarts.
+type viewerState struct {
+	Cumulative uint64         `json:"cumulative"`
+	Peak       int            `json:"peak"`
+	History    []viewerBucket `json:"history"`
+}
+
+// ViewerCounts counts the clients watching each endpoint and room, along with
+// all-time totals and an hourly history.
+type ViewerCounts struct {
+	mu     sync.Mutex
+	counts map[viewerKey]int
+	total  int
+	state  viewerState
+}
+
+func NewViewerCounts() *ViewerCounts {
+	return &ViewerCounts{counts: make(map[viewerKey]int)}
+}
+
+func (vc *ViewerCounts) bucket(now time.Time) *viewerBucket {
+	start := now.Truncate(time.Hour)
+	h := vc.state.History
+	if len(h) == 0 || !h[len(h)-1].Start.Equal(start) {
+		h = append(h, viewerBucket{Start: start, Peak: vc.total})
+		if len(h) > viewerHistoryBuckets {
+			h = h[len(h)-viewerHistoryBuckets:]
+		}
+		vc.state.History = h
+	}
+	return &h[len(h)-1]
+}
+
+// Join counts the session as watching room until the returned func is called.
+// Sessionless clients, such as long polls, are not counted.
+func (vc *ViewerCounts) Join(s *Session, room string) func() {
+	if s == nil {
+		return func() {}
+	}
+	k := viewerKey{path: s.Path, room: room}
+
+	vc.mu.Lock()
+	vc.counts[k]++
+	vc.total++
+	vc.state.Cumulative++
+	if vc.total > vc.state.Peak {
+		vc.state.Peak = vc.total
+	}
+	b := vc.bucket(time.Now())
+	b.Joins++
+	if vc.total > b.Peak {
+		b.Peak = vc.total
+	}
+	vc.mu.Unlock()
+	return func() {
+		vc.mu.Lock()
+		vc.counts[k]--
+		if vc.counts[k] == 0 {
+			delete(vc.counts, k)
+		}
+		vc.total--
+		vc.mu.Unlock()
+	}
+}
+
+func (vc *ViewerCounts) Count(f ViewerFilter) int {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	switch f.Stat {
+	case "cumulative":
+		return int(vc.state.Cumulative)
+	case "peak":
+		return vc.state.Peak
+	}
+	var n int
+	for k, c := range vc.counts {
+		if f.match(k) {
+			n += c
+		}
+	}
+	return n
+}
+
+// Seed raises the cumulative count to at least n, for carrying a count over
+// from an earlier deployment.
+func (vc *ViewerCounts) Seed(n uint64) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if vc.state.Cumulative < n {
+		vc.state.Cumulative = n
+	}
+}
+
+// viewersKey is the Storage key viewer counts are kept under.
+const viewersKey = "viewers"
+
+func (vc *ViewerCounts) Load(st Storage) error {
+	data, err := st.Get(viewersKey)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state viewerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%s: %w", viewersKey, err)
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.state = state
+	return nil
+}
+
+// Save writes the counters to st.
+func (vc *ViewerCounts) Save(st Storage) error {
+	vc.mu.Lock()
+	data, err := json.Marshal(vc.state)
+	vc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return st.Put(viewersKey, data)
+}
+
+// Persist saves the counters to st every interval.
+func (vc *ViewerCounts) Persist(st Storage, interval time.Duration) {
+	scheduler.Every(interval, func() {
+		if err := vc.Save(st); err != nil {
+			fmt.Println(err)
+		}
+	})
+}
+
+type viewerStats struct {
+	Current int `json:"current"`
+	viewerState
+}
+
+func (vc *ViewerCounts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vc.mu.Lock()
+	stats := viewerStats{Current: vc.total, viewerState: vc.state}
+	stats.History = append([]viewerBucket(nil), vc.state.History...)
+	vc.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		fmt.Println(err)
+	}
+}
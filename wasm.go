@@ -0,0 +1,86 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+)
+
+// The browser build runs rooms client-side. The server only hands out what
+// a room started from, its seed and events as /replay.json; the page catches
+// up to the room's generation and evolves it from there, so interactive
+// viewers cost the server one request instead of a stream.
+func main() {
+	js.Global().Set("golReplay", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var rj replayJSON
+		if err := json.Unmarshal([]byte(args[0].String()), &rj); err != nil {
+			return js.Global().Get("Error").New(err.Error())
+		}
+		return newBrowserWorld(rj).value()
+	}))
+	select {}
+}
+
+// browserWorld is a room evolving in the browser.
+type browserWorld struct {
+	opts  RoomOptions
+	board Board
+	prev  Board
+	rule  Rule
+	gen   uint64
+	plane *Viewport // nil unless the room is unbounded or multi-state
+}
+
+func newBrowserWorld(rj replayJSON) *browserWorld {
+	w := &browserWorld{opts: rj.options(), gen: rj.Generation}
+	w.board, w.rule, w.plane = replay(w.opts, rj.Seed, rj.Events, rj.Generation)
+	return w
+}
+
+// step advances the world one generation.
+func (w *browserWorld) step() {
+	if w.plane != nil {
+		w.prev, w.board = w.board, w.plane.Evolute(w.rule)
+	} else {
+		// The frame before last has been drawn already, so its board can
+		// take the next step.
+		w.prev, w.board = w.board, w.opts.EvoluteInto(w.rule, w.prev, w.board)
+	}
+	w.gen++
+}
+
+// frame renders the current generation as SVG.
+func (w *browserWorld) frame() string {
+	f := Frame{Board: w.board, Prev: w.prev, Rule: w.rule, Topology: w.opts.Topology, Grid: w.opts.Grid, Generation: w.gen}
+	if w.plane != nil && w.plane.Cells != nil {
+		f.Cells, f.States = w.plane.Cells, w.plane.States
+	}
+	data, err := f.Svg(Style{Scale: w.opts.Scale})
+	if err != nil {
+		return string(errorSvg(err.Error()))
+	}
+	return string(data)
+}
+
+// value exposes the world to JavaScript as an object with step(), which
+// advances it, frame(), which returns its SVG, and generation() and
+// population().
+func (w *browserWorld) value() js.Value {
+	return js.ValueOf(map[string]interface{}{
+		"step": js.FuncOf(func(js.Value, []js.Value) interface{} {
+			w.step()
+			return nil
+		}),
+		"frame": js.FuncOf(func(js.Value, []js.Value) interface{} {
+			return w.frame()
+		}),
+		"generation": js.FuncOf(func(js.Value, []js.Value) interface{} {
+			return float64(w.gen)
+		}),
+		"population": js.FuncOf(func(js.Value, []js.Value) interface{} {
+			return w.board.Population()
+		}),
+	})
+}
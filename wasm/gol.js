@@ -0,0 +1,46 @@
+// gol.js runs a room in the browser with the WebAssembly build of the
+// simulation, fetching only the room's seed and events from the server.
+// Build gol.wasm and copy wasm_exec.js next to this file with `make wasm`,
+// then serve the directory with -wasm-dir.
+//
+//   <script src="/wasm/wasm_exec.js"></script>
+//   <script src="/wasm/gol.js"></script>
+//   <img id="board">
+//   <script>golRun("default", document.getElementById("board"))</script>
+
+let golReady;
+
+// golLoad starts the Go program once, which defines golReplay.
+function golLoad() {
+    if (!golReady) {
+        const go = new Go();
+        golReady = WebAssembly.instantiateStreaming(fetch("/wasm/gol.wasm"), go.importObject)
+            .then(({instance}) => { go.run(instance); });
+    }
+    return golReady;
+}
+
+// golRun catches up with a room and shows it in img, one generation a second,
+// until the returned function is called.
+async function golRun(room, img) {
+    await golLoad();
+    const replay = await fetch("/replay.json?room=" + encodeURIComponent(room)).then(r => r.text());
+    const world = golReplay(replay);
+    if (world instanceof Error) {
+        throw world;
+    }
+    let url;
+    const show = () => {
+        if (url) {
+            URL.revokeObjectURL(url);
+        }
+        url = URL.createObjectURL(new Blob([world.frame()], {type: "image/svg+xml"}));
+        img.src = url;
+    };
+    show();
+    const timer = setInterval(() => {
+        world.step();
+        show();
+    }, 1000);
+    return () => clearInterval(timer);
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+// widgetComponents are the parts /widget.svg can show, in the order it
+// stacks them.
+var widgetComponents = []string{"board", "viewers", "generation", "population"}
+
+const (
+	defaultWidgetWidth = 320
+	minWidgetWidth     = 160
+	maxWidgetWidth     = 1200
+	widgetPadding      = 12
+	widgetStatsHeight  = 20
+	widgetSparkHeight  = 28
+)
+
+// Populations returns the population of each generation kept, oldest first.
+func (h *History) Populations() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	pops := make([]int, len(h.entries))
+	for i, g := range h.entries {
+		pops[i] = g.Board.Population()
+	}
+	return pops
+}
+
+// widgetShowParam reads ?show=, a comma separated list of widgetComponents,
+// all of them by default.
+func widgetShowParam(r *http.Request) (map[string]bool, error) {
+	show := make(map[string]bool)
+	v := r.URL.Query().Get("show")
+	if v == "" {
+		for _, c := range widgetComponents {
+			show[c] = true
+		}
+		return show, nil
+	}
+	for _, c := range strings.Split(v, ",") {
+		c = strings.TrimSpace(c)
+		known := false
+		for _, k := range widgetComponents {
+			known = known || k == c
+		}
+		if !known {
+			return nil, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("unknown component %q, want %s", c, strings.Join(widgetComponents, ", "))}
+		}
+		show[c] = true
+	}
+	return show, nil
+}
+
+// embedSvg returns a standalone SVG document as an element to nest in
+// another.
+func embedSvg(doc []byte) []byte {
+	if i := bytes.Index(doc, []byte("<svg")); i > 0 {
+		return doc[i:]
+	}
+	return doc
+}
+
+// sparkline draws pops as a line w by h pixels at x, y, scaled from their
+// lowest to their highest.
+func sparkline(canvas *svg.SVG, x, y, w, h int, pops []int, stroke string) {
+	if len(pops) < 2 {
+		return
+	}
+	lo, hi := pops[0], pops[0]
+	for _, p := range pops {
+		if p < lo {
+			lo = p
+		}
+		if p > hi {
+			hi = p
+		}
+	}
+	xs, ys := make([]int, len(pops)), make([]int, len(pops))
+	for i, p := range pops {
+		xs[i] = x + i*(w-1)/(len(pops)-1)
+		ys[i] = y + h/2
+		if hi > lo {
+			ys[i] = y + h - 1 - (p-lo)*(h-1)/(hi-lo)
+		}
+	}
+	canvas.Polyline(xs, ys, `fill="none"`, `stroke="`+stroke+`"`, `stroke-width="1.5"`, `stroke-linejoin="round"`)
+	canvas.Circle(xs[len(xs)-1], ys[len(ys)-1], 2, `fill="`+stroke+`"`)
+}
+
+// Widget draws a w pixel wide card of the room for st, stacking the board,
+// a row of viewer, generation and population counts, and a population
+// sparkline, keeping those in show.
+func (r *GameRender) Widget(st Style, w int, show map[string]bool) ([]byte, error) {
+	latest := r.history.Latest()
+	pal := st.palette()
+	bg := svgColor(insetBackground(pal))
+	ink := svgColor(pal.Alive)
+	inner := w - 2*widgetPadding
+
+	var board []byte
+	boardH := 0
+	if show["board"] {
+		data, err := Frame{Board: latest.Board, Rule: r.Rule(), Topology: r.opts.Topology, Grid: r.opts.Grid, Notes: r.notes.List()}.Svg(st)
+		if err != nil {
+			return nil, err
+		}
+		board = embedSvg(data)
+		boardH = inner * len(latest.Board[0]) / len(latest.Board)
+	}
+	var stats []string
+	if show["viewers"] {
+		stats = append(stats, fmt.Sprintf("%d watching", viewerCounts.Count(ViewerFilter{Room: r.name})))
+	}
+	if show["generation"] {
+		stats = append(stats, "gen "+strconv.FormatUint(latest.Number, 10))
+	}
+	if show["population"] {
+		stats = append(stats, "pop "+strconv.Itoa(latest.Board.Population()))
+	}
+
+	h := widgetPadding
+	if board != nil {
+		h += boardH + widgetPadding
+	}
+	if len(stats) > 0 {
+		h += widgetStatsHeight
+	}
+	if show["population"] {
+		h += widgetSparkHeight + widgetPadding/2
+	}
+	if len(stats) > 0 {
+		h += widgetPadding / 2
+	}
+
+	var buf bytes.Buffer
+	canvas := svg.New(&buf)
+	canvas.Start(w, h)
+	canvas.Roundrect(0, 0, w, h, 6, 6, `fill="`+bg+`"`, `stroke="#d0d7de"`)
+	y := widgetPadding
+	if board != nil {
+		canvas.Gtransform(fmt.Sprintf("translate(%d %d) scale(%g)", widgetPadding, y, float64(inner)/float64(st.Scale*len(latest.Board))))
+		buf.Write(board)
+		canvas.Gend()
+		y += boardH + widgetPadding
+	}
+	for i, s := range stats {
+		canvas.Text(widgetPadding+i*inner/len(stats), y+widgetStatsHeight/2, s,
+			`font-size="13"`, `font-family="Verdana,DejaVu Sans,sans-serif"`, `fill="`+ink+`"`,
+			`dominant-baseline="middle"`,
+		)
+	}
+	if len(stats) > 0 {
+		y += widgetStatsHeight
+	}
+	if show["population"] {
+		sparkline(canvas, widgetPadding, y+widgetPadding/2, inner, widgetSparkHeight, r.history.Populations(), ink)
+	}
+	canvas.End()
+	return buf.Bytes(), nil
+}
+
+// widgetHandle serves /widget.svg, a single card for READMEs with the
+// components in ?show= on a card ?width= pixels wide, keeping the room
+// evolving for a while like a poll.
+func widgetHandle(room *GameRender, w http.ResponseWriter, r *http.Request) {
+	st, err := styleParam(r, room.DefaultStyle())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	width, err := intParam(r, "width", defaultWidgetWidth)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if width < minWidgetWidth || width > maxWidgetWidth {
+		writeError(w, r, &requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("width must be between %d and %d", minWidgetWidth, maxWidgetWidth)})
+		return
+	}
+	show, err := widgetShowParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	room.Touch()
+	data, err := room.Widget(st, width, show)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if _, err := w.Write(data); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+// Xbm writes the board as an X bitmap, a C source snippet with live cells as
+// set bits. Colours and captions are left out.
+func (f Frame) Xbm(st Style) ([]byte, error) {
+	k := st.Scale
+	w, h := k*len(f.Board), k*len(f.Board[0])
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "#define gol_width %d\n#define gol_height %d\n", w, h)
+	buf.WriteString("static unsigned char gol_bits[] = {")
+	n := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x += 8 {
+			var bits byte
+			for i := 0; i < 8 && x+i < w; i++ {
+				if f.Board[(x+i)/k][y/k] {
+					bits |= 1 << uint(i)
+				}
+			}
+			if n > 0 {
+				buf.WriteByte(',')
+			}
+			if n%12 == 0 {
+				buf.WriteString("\n  ")
+			} else {
+				buf.WriteByte(' ')
+			}
+			fmt.Fprintf(&buf, "0x%02x", bits)
+			n++
+		}
+	}
+	buf.WriteString("};\n")
+	return buf.Bytes(), nil
+}
+
+// xpmChars are the characters XPM pixels are written with; quotes and
+// backslashes would need escaping in the C string.
+const xpmChars = " .+@#$%&*=-;:>,<1234567890abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Xpm writes the rendered frame as an X pixmap, with transparent pixels as
+// the None colour.
+func (f Frame) Xpm(st Style) ([]byte, error) {
+	img := f.image(st)
+	b := img.Bounds()
+
+	index := make(map[color.RGBA]int)
+	var colors []color.RGBA
+	pixels := make([]int, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			if c.A == 0 {
+				c = color.RGBA{}
+			}
+			i, ok := index[c]
+			if !ok {
+				i = len(colors)
+				index[c] = i
+				colors = append(colors, c)
+			}
+			pixels = append(pixels, i)
+		}
+	}
+	cpp := 1
+	for n := len(xpmChars); n < len(colors); n *= len(xpmChars) {
+		cpp++
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("/* XPM */\nstatic char *gol[] = {\n")
+	fmt.Fprintf(&buf, "\"%d %d %d %d\",\n", b.Dx(), b.Dy(), len(colors), cpp)
+	for i, c := range colors {
+		value := "None"
+		if c.A > 0 {
+			value = svgColor(c)
+		}
+		fmt.Fprintf(&buf, "\"%s c %s\",\n", xpmKey(i, cpp), value)
+	}
+	for y := 0; y < b.Dy(); y++ {
+		buf.WriteByte('"')
+		for _, i := range pixels[y*b.Dx() : (y+1)*b.Dx()] {
+			buf.WriteString(xpmKey(i, cpp))
+		}
+		if y < b.Dy()-1 {
+			buf.WriteString("\",\n")
+		} else {
+			buf.WriteString("\"\n")
+		}
+	}
+	buf.WriteString("};\n")
+	return buf.Bytes(), nil
+}
+
+func xpmKey(i, cpp int) string {
+	var sb strings.Builder
+	for j := 0; j < cpp; j++ {
+		sb.WriteByte(xpmChars[i%len(xpmChars)])
+		i /= len(xpmChars)
+	}
+	return sb.String()
+}